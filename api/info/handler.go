@@ -63,6 +63,22 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			response, err = GetPairIdRequest(r)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
+		case "get-markets": // full pair metadata from the registry
+			response, err = GetMarketsRequest(r)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-pair-risk-params":
+			response, err = GetPairRiskParamsRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-funding-rates":
+			response, err = GetFundingRatesRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-funding-history":
+			response, err = GetFundingHistoryRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
 		default:
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(utils.ErrMalformedRequest("Invalid query parameter"))
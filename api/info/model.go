@@ -1,9 +1,18 @@
 package infoHandler
 
+import (
+	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/pairs"
+)
+
 type GetPairsResponse struct {
 	Pairs []string `json:"pairs"`
 }
 
+type GetMarketsResponse struct {
+	Markets []pairs.Pair `json:"markets"`
+}
+
 type GetPairResponse struct {
 	Pair   string `json:"pair"`
 	PairId string `json:"pair-id"`
@@ -13,3 +22,21 @@ type Pair struct {
 	Pair   string `json:"pair"`
 	PairId string `json:"pair-id"`
 }
+
+// PairRiskParams are the limits the frontend renders for a pair, a zero cap is uncapped
+type PairRiskParams struct {
+	Pair string `json:"pair"`
+	db.PairRiskParamsResponse
+}
+
+// PairFunding is the current hourly funding rate of a pair, positive when longs pay shorts
+type PairFunding struct {
+	Pair string `json:"pair"`
+	db.PairFundingResponse
+}
+
+type GetFundingHistoryResponse struct {
+	Pair   string                   `json:"pair"`
+	PairId string                   `json:"pair-id"`
+	Rates  []db.FundingRateResponse `json:"rates"`
+}
@@ -3,3 +3,16 @@ package infoHandler
 type GetPairRequestParams struct {
 	Pair string `query:"pair"`
 }
+
+type GetPairRiskParamsRequestParams struct {
+	Pair string `query:"pair" optional:"true"` // all pairs when empty
+}
+
+type GetFundingRatesRequestParams struct {
+	Pair string `query:"pair" optional:"true"` // all pairs when empty
+}
+
+type GetFundingHistoryRequestParams struct {
+	Pair  string `query:"pair"`
+	Limit string `query:"limit" optional:"true"` // hourly snapshots, defaults to a week
+}
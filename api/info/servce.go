@@ -3,8 +3,13 @@ package infoHandler
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/pairs"
+	"github.com/BlueSpadeXchain/blp-api/pkg/risk"
 	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
+	"github.com/supabase-community/supabase-go"
 )
 
 func VersionRequest(r *http.Request, parameters ...interface{}) (interface{}, error) {
@@ -27,6 +32,12 @@ func GetPairIdsRequest(r *http.Request, parameters ...interface{}) (interface{},
 	return &Pairs, nil
 }
 
+func GetMarketsRequest(r *http.Request, parameters ...interface{}) (interface{}, error) {
+	return GetMarketsResponse{
+		Markets: pairs.All(),
+	}, nil
+}
+
 func GetPairIdRequest(r *http.Request, parameters ...*GetPairRequestParams) (interface{}, error) {
 	var params *GetPairRequestParams
 
@@ -57,3 +68,140 @@ func GetPairIdRequest(r *http.Request, parameters ...*GetPairRequestParams) (int
 	}, nil
 
 }
+
+// GetPairRiskParamsRequest returns the order limits of one pair, or of every listed pair
+func GetPairRiskParamsRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetPairRiskParamsRequestParams) (interface{}, error) {
+	var params *GetPairRiskParamsRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetPairRiskParamsRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	listed := PairAndIds
+	if params.Pair != "" {
+		pairId, err := getPairId(params.Pair)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		listed = []Pair{{Pair: params.Pair, PairId: pairId}}
+	}
+
+	pairIds := make([]string, 0, len(listed))
+	for _, pair := range listed {
+		pairIds = append(pairIds, pair.PairId)
+	}
+	pairsParams, err := risk.GetPairsParams(supabaseClient, pairIds)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	response := make([]PairRiskParams, 0, len(listed))
+	for i, pair := range listed {
+		response = append(response, PairRiskParams{
+			Pair:                   pair.Pair,
+			PairRiskParamsResponse: pairsParams[i],
+		})
+	}
+	return response, nil
+}
+
+func GetFundingRatesRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetFundingRatesRequestParams) (interface{}, error) {
+	var params *GetFundingRatesRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetFundingRatesRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	listed := PairAndIds
+	queryPairId := ""
+	if params.Pair != "" {
+		pairId, err := getPairId(params.Pair)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		listed = []Pair{{Pair: params.Pair, PairId: pairId}}
+		queryPairId = pairId
+	}
+
+	pairsFunding, err := db.GetPairFunding(supabaseClient, queryPairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	current := make(map[string]db.PairFundingResponse, len(*pairsFunding))
+	for _, funding := range *pairsFunding {
+		current[funding.PairId] = funding
+	}
+
+	// pairs that never accrued have no row yet and pay no funding
+	response := make([]PairFunding, 0, len(listed))
+	for _, pair := range listed {
+		funding, found := current[pair.PairId]
+		if !found {
+			funding = db.PairFundingResponse{PairId: pair.PairId}
+		}
+		response = append(response, PairFunding{
+			Pair:                pair.Pair,
+			PairFundingResponse: funding,
+		})
+	}
+	return response, nil
+}
+
+func GetFundingHistoryRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetFundingHistoryRequestParams) (interface{}, error) {
+	var params *GetFundingHistoryRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetFundingHistoryRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	pairId, err := getPairId(params.Pair)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	limit := defaultFundingHistoryLimit
+	if params.Limit != "" {
+		limit, err = strconv.Atoi(params.Limit)
+		if err != nil || limit <= 0 || limit > maxFundingHistoryLimit {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("limit must be between 1 and %v", maxFundingHistoryLimit))
+		}
+	}
+
+	rates, err := db.GetFundingRates(supabaseClient, pairId, limit)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return GetFundingHistoryResponse{
+		Pair:   params.Pair,
+		PairId: pairId,
+		Rates:  *rates,
+	}, nil
+}
@@ -1,25 +1,35 @@
 package orderHandler
 
-import (
-	"fmt"
-)
+import "github.com/BlueSpadeXchain/blp-api/pkg/pairs"
 
-var PriceFeedIds = []string{
-	"e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b43", // BTC/USD
-	"ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace", // ETH/USD
+// getPairId resolves a pair name for new orders, pairs that are not active are rejected
+func getPairId(pairString string) (string, error) {
+	return pairs.FeedId(pairString)
 }
 
-var pairIdMap = map[string]string{
-	"btcusd": "e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b43",
-	"usdbtc": "e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b43",
-	"ethusd": "ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace",
-	"usdeth": "ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace",
-}
+// take profit and stop loss kinds of exit levels and reduce-only orders, matching order_exit_levels.kind and reduce_only_orders.kind
+const (
+	takeProfitLevel = "tp"
+	stopLossLevel   = "sl"
+)
 
-func getPairId(pairString string) (string, error) {
-	if pairHex, found := pairIdMap[pairString]; found {
-		return pairHex, nil
-	}
+// maxExitLevels caps the ladder of a single order
+const maxExitLevels = 10
 
-	return "", fmt.Errorf("unsupported pair name: %s", pairString)
-}
+// margin actions, matching the signature action recorded by unsigned_margin_order
+const (
+	addMarginAction    = "add_margin"
+	removeMarginAction = "remove_margin"
+)
+
+// maxBatchOrders caps the orders of a single create or cancel batch
+const maxBatchOrders = 20
+
+// batch actions, matching order_batches.action
+const (
+	createBatchAction = "create"
+	cancelBatchAction = "cancel"
+)
+
+// maxClientOrderIdLength matches orders2.client_order_id
+const maxClientOrderIdLength = 64
@@ -8,6 +8,7 @@ import (
 
 	user "github.com/BlueSpadeXchain/blp-api/api/user"
 	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
 	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/sirupsen/logrus"
@@ -257,12 +258,11 @@ func UnsignedOrderRequest(r *http.Request, supabaseClient *supabase.Client, para
 		return nil, err
 	}
 
-	priceData, err := utils.GetCurrentPriceData(pair)
+	validatedPrice, err := utils.GetValidatedPrice(pair)
 	if err != nil {
 		return nil, err
 	}
-	markPrice, _ := strconv.ParseFloat(priceData.Price.Price, 64)
-	exponent := priceData.Price.Expo
+	markPrice := validatedPrice.Price.Float64()
 
 	var slippage float64
 	if params.Slippage != "" {
@@ -273,20 +273,8 @@ func UnsignedOrderRequest(r *http.Request, supabaseClient *supabase.Client, para
 		}
 	}
 
-	// If exponent is negative, divide by 10^abs(Expo)
-	if exponent < 0 {
-		// Convert exponent to int64 for proper comparison
-		for i := int64(0); i < -int64(exponent); i++ {
-			markPrice /= 10
-		}
-	} else { // If exponent is positive, multiply by 10^Expo
-		for i := int64(0); i < int64(exponent); i++ {
-			markPrice *= 10
-		}
-	}
-
 	balance := userData.(*db.UserResponse).Balance
-	if balance < collateral {
+	if balance.LessThan(decimal.NewFromFloat(collateral)) {
 		return nil, utils.ErrInternal(fmt.Sprintf("user %v insufficent balance: expected >=%v, found %v", params.UserId, params.Collateral, balance))
 	}
 
@@ -55,6 +55,10 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			response, err = UnsignedCreateOrderRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
+		case "quote-order": // dry run of create-order
+			response, err = QuoteOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
 		case "sign-order":
 			response, err = SignedCreateOrderRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
@@ -75,6 +79,26 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			response, err = GetOrderByIdRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
+		case "get-order-fills":
+			response, err = GetOrderFillsRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-positions":
+			response, err = GetPositionsRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-order-events":
+			response, err = GetOrderEventsRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-order-exit-levels":
+			response, err = GetOrderExitLevelsRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-reduce-only-orders":
+			response, err = GetReduceOnlyOrdersRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
 		case "close-order":
 			response, err = UnsignedCloseOrderRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
@@ -91,14 +115,84 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			response, err = SignedCancelOrderRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
-		// todo
 		case "modify-order":
-			response, err = UnsignedCancelOrderRequest(r, supabaseClient)
+			response, err = UnsignedModifyOrderRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
-		// todo
 		case "sign-modify-order":
-			response, err = SignedCancelOrderRequest(r, supabaseClient)
+			response, err = SignedModifyOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "add-margin":
+			response, err = UnsignedMarginRequest(r, supabaseClient, addMarginAction)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-add-margin":
+			response, err = SignedMarginRequest(r, supabaseClient, addMarginAction)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "remove-margin":
+			response, err = UnsignedMarginRequest(r, supabaseClient, removeMarginAction)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-remove-margin":
+			response, err = SignedMarginRequest(r, supabaseClient, removeMarginAction)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "create-reduce-only-order": // returns the reduce-only order + hash to sign
+			response, err = UnsignedReduceOnlyOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-reduce-only-order":
+			response, err = SignedReduceOnlyOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "cancel-reduce-only-order":
+			response, err = UnsignedCancelReduceOnlyOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-cancel-reduce-only-order":
+			response, err = SignedCancelReduceOnlyOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "create-orders-batch": // returns the created orders + one hash to sign for all of them
+			response, err = UnsignedCreateOrdersBatchRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-orders-batch":
+			response, err = SignedOrdersBatchRequest(r, supabaseClient, createBatchAction)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "cancel-orders-batch":
+			response, err = UnsignedCancelOrdersBatchRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-cancel-orders-batch":
+			response, err = SignedOrdersBatchRequest(r, supabaseClient, cancelBatchAction)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "create-algo-order": // returns the algo order with its slices + hash to sign
+			response, err = UnsignedAlgoOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-algo-order":
+			response, err = SignedAlgoOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "cancel-algo-order":
+			response, err = UnsignedCancelAlgoOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "sign-cancel-algo-order":
+			response, err = SignedCancelAlgoOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-algo-order":
+			response, err = GetAlgoOrderRequest(r, supabaseClient)
+			HandleResponse(w, r, supabaseClient, response, err)
+			return
+		case "get-algo-orders":
+			response, err = GetAlgoOrdersRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
 		// case "get-order-by-id-old": // deprecated
@@ -1,12 +1,32 @@
 package orderHandler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/BlueSpadeXchain/blp-api/pkg/entry"
+	"github.com/BlueSpadeXchain/blp-api/pkg/funding"
+	"github.com/BlueSpadeXchain/blp-api/pkg/orderstate"
+	"github.com/BlueSpadeXchain/blp-api/pkg/pagination"
+	"github.com/BlueSpadeXchain/blp-api/pkg/risk"
+	"github.com/BlueSpadeXchain/blp-api/pkg/trailing"
+	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
+	"github.com/supabase-community/supabase-go"
 )
 
+// leverage is stored as NUMERIC(7, 2)
+const leveragePlaces int32 = 2
+
+var hundred = decimal.NewFromInt(100)
+
 func validateOrderRequest() error {
 	// _, relayAddress, err := utils.EnvKey2Ecdsa()
 	// if err != nil {
@@ -77,17 +97,1208 @@ func getBaseFee() float64 {
 	return 0.001
 }
 
-func dynamicLeverageFee(leverage float64) float64 {
+// dynamicLeverageFee is the only rate derived from float math (the log), it is converted once and applied to exact amounts
+func dynamicLeverageFee(leverage decimal.Decimal) decimal.Decimal {
 	//fee percent = 1/ (1+ scaling factor * log(leverage)) * base fee / 100
-	return 1 / (1 + getFeeScalingFactor()*math.Log(leverage)) * getBaseFee()
+	return decimal.NewFromFloat(1 / (1 + getFeeScalingFactor()*math.Log(leverage.Float64())) * getBaseFee())
+}
+
+// borrowFee is the utilization fee rate accrued since the position opened, from the cumulative borrow index (db/global/borrow_index.sql)
+// each hour is charged base_borrow_rate * borrowed / liquidity at the utilization of that hour
+func borrowFee(entryIndex, index decimal.Decimal) decimal.Decimal {
+	if index.LessThan(entryIndex) {
+		return decimal.Zero
+	}
+	return index.Sub(entryIndex)
+}
+
+func orderTypedData(order db.OrderResponse, nonce uint64, expiry int64) utils.OrderTypedData {
+	return utils.OrderTypedData{
+		OrderId:    order.ID,
+		Pair:       order.Pair,
+		Side:       order.OrderType,
+		Leverage:   order.Leverage,
+		Collateral: order.Collateral,
+		LimitPrice: order.LimitPrice,
+		StopPrice:  order.StopLossPrice,
+		TpPrice:    order.TakeProfitPrice,
+		Nonce:      nonce,
+		Expiry:     expiry,
+	}
+}
+
+// quoteEntry returns the entry type with its limit price, and the trigger of a stop limit
+// stop and mit entries take trigger-price, stored as their limit price, and fill at the mark price that reaches it
+func quoteEntry(params *CreateOrderRequestParams, markPrice decimal.Decimal) (string, decimal.Decimal, decimal.Decimal, error) {
+	var limitPrice, triggerPrice decimal.Decimal
+	hasLimitPrice := params.LimitPrice != "" && params.LimitPrice != "0"
+	hasTriggerPrice := params.TriggerPrice != "" && params.TriggerPrice != "0"
+
+	entryType, err := entry.Parse(params.EntryType, hasLimitPrice)
+	if err != nil {
+		return "", limitPrice, triggerPrice, err
+	}
+	switch entryType {
+	case entry.Market:
+		if hasTriggerPrice {
+			return "", limitPrice, triggerPrice, fmt.Errorf("trigger-price requires entry-type stop, mit or stop-limit")
+		}
+		return entryType, limitPrice, triggerPrice, nil
+	case entry.Limit:
+		if hasTriggerPrice {
+			return "", limitPrice, triggerPrice, fmt.Errorf("limit entries take lim-price only, use stop-limit with a trigger-price")
+		}
+	case entry.Stop, entry.MarketIfTouched:
+		if hasLimitPrice || !hasTriggerPrice {
+			return "", limitPrice, triggerPrice, fmt.Errorf("%v entries take trigger-price only", entryType)
+		}
+	case entry.StopLimit:
+		if !hasLimitPrice || !hasTriggerPrice {
+			return "", limitPrice, triggerPrice, fmt.Errorf("stop-limit entries take both trigger-price and lim-price")
+		}
+	}
+
+	if hasLimitPrice {
+		limitPrice, err = decimal.NewFromString(params.LimitPrice)
+		if err != nil {
+			return "", decimal.Zero, decimal.Zero, fmt.Errorf("invalid limit price value: %w", err)
+		}
+		limitPrice = limitPrice.RoundUsd()
+	}
+	if hasTriggerPrice {
+		triggerPrice, err = decimal.NewFromString(params.TriggerPrice)
+		if err != nil {
+			return "", decimal.Zero, decimal.Zero, fmt.Errorf("invalid trigger price value: %w", err)
+		}
+		triggerPrice = triggerPrice.RoundUsd()
+	}
+	if entryType == entry.Stop || entryType == entry.MarketIfTouched {
+		limitPrice, triggerPrice = triggerPrice, decimal.Zero
+	}
+
+	if err := entry.Validate(entryType, params.PositionType, limitPrice, triggerPrice, markPrice); err != nil {
+		return "", decimal.Zero, decimal.Zero, err
+	}
+	return entryType, limitPrice, triggerPrice, nil
+}
+
+// parseExpiresAt reads the good-till-time of a limit order, zero when it is good-till-canceled
+func parseExpiresAt(value string, limitPrice decimal.Decimal) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if limitPrice.IsZero() {
+		return 0, fmt.Errorf("expires-at can only be set on limit orders")
+	}
+	expiresAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expires-at value: %w", err)
+	}
+	if expiresAt <= time.Now().Unix() {
+		return 0, fmt.Errorf("expires-at %v is in the past", value)
+	}
+	return expiresAt, nil
+}
+
+// parseNonce reads the nonce echoed back from the signed typed data message
+// the expiry is not echoed, it is read from the stored signature request
+func parseNonce(nonceString string) (uint64, error) {
+	nonce, err := strconv.ParseUint(nonceString, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid nonce value: %w", err)
+	}
+	return nonce, nil
+}
+
+// orderPrices are derived from the entry (or limit) price, shared by create and modify
+type orderPrices struct {
+	OpenFee             decimal.Decimal
+	EffectiveCollateral decimal.Decimal
+	EffectiveLeverage   decimal.Decimal
+	LiquidationPrice    decimal.Decimal
+	MaxProfitPrice      decimal.Decimal
+}
+
+// calculateOrderPrices expects the collateral before the open fee is deducted
+func calculateOrderPrices(positionType string, markPrice, leverage, collateral decimal.Decimal, riskParams *db.PairRiskParamsResponse) (*orderPrices, error) {
+	var liqPrice, maxProfitPrice decimal.Decimal
+
+	if !collateral.IsPositive() {
+		return nil, fmt.Errorf("invalid collateral value: %v", collateral)
+	}
+	if !leverage.IsPositive() {
+		return nil, fmt.Errorf("invalid leverage value: %v", leverage)
+	}
+
+	openFee := collateral.Mul(leverage).Mul(dynamicLeverageFee(leverage)).Mul(riskParams.LeverageFeeMultiplier).RoundUsd()
+	effectiveCollateral := collateral.Sub(openFee)
+	if !effectiveCollateral.IsPositive() {
+		return nil, fmt.Errorf("open fee %v exceeds collateral %v", openFee, collateral)
+	}
+	effectiveLeverage := leverage.Mul(collateral).Div(effectiveCollateral)
+
+	// Calculate liquidation price
+	liqDistance := decimal.One.Div(effectiveLeverage)
+	maxProfitDistance := riskParams.MaxProfitMultiple.Div(leverage)
+	switch positionType {
+	case "long":
+		liqPrice = markPrice.Mul(decimal.One.Sub(liqDistance)).RoundUsd()
+		maxProfitPrice = markPrice.Mul(decimal.One.Add(maxProfitDistance)).RoundUsd()
+	case "short":
+		liqPrice = markPrice.Mul(decimal.One.Add(liqDistance)).RoundUsd()
+		maxProfitPrice = markPrice.Mul(decimal.One.Sub(maxProfitDistance)).RoundUsd()
+	default:
+		return nil, fmt.Errorf("invalid position type: %v", positionType)
+	}
+
+	if !liqPrice.IsPositive() {
+		return nil, fmt.Errorf("invalid liquidation price calculated %v", liqPrice)
+	}
+
+	if positionType == "long" && markPrice.LessThanOrEqual(liqPrice) {
+		return nil, fmt.Errorf("long position: entry price in under liquidation price")
+	} else if positionType == "short" && markPrice.GreaterThanOrEqual(liqPrice) {
+		return nil, fmt.Errorf("short position: entry price in over liquidation price")
+	}
+
+	return &orderPrices{
+		OpenFee:             openFee,
+		EffectiveCollateral: effectiveCollateral,
+		EffectiveLeverage:   effectiveLeverage,
+		LiquidationPrice:    liqPrice,
+		MaxProfitPrice:      maxProfitPrice,
+	}, nil
+}
+
+// validateStopLoss requires the stop to sit between the liquidation price and the mark price
+func validateStopLoss(positionType string, stopLossPrice, markPrice decimal.Decimal, prices *orderPrices) error {
+	switch positionType {
+	case "long":
+		if prices.LiquidationPrice.GreaterThanOrEqual(stopLossPrice) {
+			return fmt.Errorf("stop loss %v price must exceed liquidation price: %v", positionType, prices.LiquidationPrice)
+		}
+		if markPrice.LessThanOrEqual(stopLossPrice) {
+			return fmt.Errorf("stop loss %v price cannot exceed entry price: %v", positionType, markPrice)
+		}
+	case "short":
+		if prices.LiquidationPrice.LessThanOrEqual(stopLossPrice) {
+			return fmt.Errorf("stop loss %v price cannot exceed liquidation price: %v", positionType, prices.LiquidationPrice)
+		}
+		if markPrice.GreaterThanOrEqual(stopLossPrice) {
+			return fmt.Errorf("stop loss %v price must exceed entry price: %v", positionType, markPrice)
+		}
+	default:
+		return fmt.Errorf("invalid position type: %s", positionType)
+	}
+	return nil
+}
+
+// calculateTakeProfit returns the tp value and the share of the effective collateral closed at tp
+func calculateTakeProfit(positionType string, tpPrice, tpPercent, markPrice, leverage decimal.Decimal, prices *orderPrices) (decimal.Decimal, decimal.Decimal, error) {
+	var tpValue decimal.Decimal
+
+	if !tpPrice.IsPositive() {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("invalid take profit price")
+	}
+	if !tpPercent.IsPositive() || tpPercent.GreaterThanOrEqual(hundred) {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("invalid take profit percent: expected 0 < value < 100, found %v", tpPercent)
+	}
+
+	tpCollateral := prices.EffectiveCollateral.Mul(tpPercent).Div(hundred).RoundUsd()
+	switch positionType {
+	case "long":
+		// For long positions: Profit when tpPrice > entryPrice
+		if tpPrice.LessThanOrEqual(markPrice) {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("take profit %v price must exceed entry price: %v", positionType, markPrice)
+		}
+		if tpPrice.GreaterThanOrEqual(prices.MaxProfitPrice) {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("take profit %v price cannot exceed max price: %v", positionType, prices.MaxProfitPrice)
+		}
+		tpValue = tpCollateral.Mul(prices.EffectiveLeverage).Mul(decimal.One.Add(tpPrice.Sub(markPrice).Div(markPrice))).RoundUsd()
+	case "short":
+		// For short positions: Profit when tpPrice < entryPrice
+		if tpPrice.GreaterThanOrEqual(markPrice) {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("take profit %v price must be under entry price: %v", positionType, markPrice)
+		}
+		if tpPrice.LessThanOrEqual(prices.MaxProfitPrice) {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("take profit %v price cannot be under max price: %v", positionType, prices.MaxProfitPrice)
+		}
+		tpValue = tpCollateral.Mul(leverage).Mul(decimal.One.Add(markPrice.Sub(tpPrice).Div(markPrice))).RoundUsd()
+	default:
+		return decimal.Zero, decimal.Zero, fmt.Errorf("invalid order type")
+	}
+
+	return tpValue, tpCollateral, nil
+}
+
+// quoteExitLevels prices the take profit and stop loss ladders of a new order
+// the levels are partial exits, together they close less than the whole position
+func quoteExitLevels(params *CreateOrderRequestParams, markPrice, leverage, stopLossPrice, tpPrice decimal.Decimal, prices *orderPrices) ([]ExitLevel, error) {
+	exitLevels := []ExitLevel{}
+	if params.TakeProfitLevels != "" {
+		if !tpPrice.IsZero() {
+			return nil, fmt.Errorf("tp-price and tp-levels cannot be combined")
+		}
+		levels, err := parseExitLevels(takeProfitLevel, params.PositionType, params.TakeProfitLevels, markPrice, leverage, stopLossPrice, prices)
+		if err != nil {
+			return nil, err
+		}
+		exitLevels = append(exitLevels, levels...)
+	}
+	if params.StopLossLevels != "" {
+		levels, err := parseExitLevels(stopLossLevel, params.PositionType, params.StopLossLevels, markPrice, leverage, stopLossPrice, prices)
+		if err != nil {
+			return nil, err
+		}
+		exitLevels = append(exitLevels, levels...)
+	}
+
+	if len(exitLevels) > maxExitLevels {
+		return nil, fmt.Errorf("at most %v exit levels, found %v", maxExitLevels, len(exitLevels))
+	}
+	total := decimal.Zero
+	for _, level := range exitLevels {
+		total = total.Add(level.Percent)
+	}
+	if total.GreaterThanOrEqual(hundred) {
+		return nil, fmt.Errorf("exit level percents must add up to less than 100, found %v", total)
+	}
+	return exitLevels, nil
+}
+
+// parseExitLevels reads a "price:percent,price:percent" ladder of one kind
+// take profit levels are checked like tp-price, stop loss levels like stop-price and they must trigger before it
+func parseExitLevels(kind, positionType, levels string, markPrice, leverage, stopLossPrice decimal.Decimal, prices *orderPrices) ([]ExitLevel, error) {
+	exitLevels := []ExitLevel{}
+	seen := make(map[string]bool)
+	for _, level := range strings.Split(levels, ",") {
+		priceString, percentString, found := strings.Cut(strings.TrimSpace(level), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid %s level %q, expected price:percent", kind, level)
+		}
+		price, err := decimal.NewFromString(priceString)
+		if err != nil || !price.IsPositive() {
+			return nil, fmt.Errorf("invalid %s level price: %v", kind, priceString)
+		}
+		price = price.RoundUsd()
+		percent, err := decimal.NewFromString(percentString)
+		if err != nil || !percent.IsPositive() || percent.GreaterThanOrEqual(hundred) {
+			return nil, fmt.Errorf("invalid %s level percent: expected 0 < value < 100, found %v", kind, percentString)
+		}
+		percent = percent.Round(4)
+		if seen[price.String()] {
+			return nil, fmt.Errorf("duplicate %s level price %v", kind, price)
+		}
+		seen[price.String()] = true
+
+		var collateral decimal.Decimal
+		switch kind {
+		case takeProfitLevel:
+			_, collateral, err = calculateTakeProfit(positionType, price, percent, markPrice, leverage, prices)
+		case stopLossLevel:
+			err = validateStopLoss(positionType, price, markPrice, prices)
+			if err == nil && !stopLossPrice.IsZero() &&
+				(positionType == "long" && price.LessThanOrEqual(stopLossPrice) || positionType == "short" && price.GreaterThanOrEqual(stopLossPrice)) {
+				err = fmt.Errorf("level must trigger before the stop price %v", stopLossPrice)
+			}
+			collateral = prices.EffectiveCollateral.Mul(percent).Div(hundred).RoundUsd()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s level %v: %w", kind, price, err)
+		}
+
+		exitLevels = append(exitLevels, ExitLevel{
+			Kind:       kind,
+			Price:      price,
+			Percent:    percent,
+			Collateral: collateral,
+		})
+	}
+	return exitLevels, nil
+}
+
+// validateTrigger checks a reduce-only trigger against the price the position is (or will be) at
+// take profits sit between it and the max price, stop losses between it and the liquidation price
+func validateTrigger(kind, positionType string, triggerPrice, markPrice decimal.Decimal, prices *orderPrices) error {
+	switch kind {
+	case takeProfitLevel:
+		switch positionType {
+		case "long":
+			if triggerPrice.LessThanOrEqual(markPrice) {
+				return fmt.Errorf("take profit %v price must exceed entry price: %v", positionType, markPrice)
+			}
+			if triggerPrice.GreaterThanOrEqual(prices.MaxProfitPrice) {
+				return fmt.Errorf("take profit %v price cannot exceed max price: %v", positionType, prices.MaxProfitPrice)
+			}
+		case "short":
+			if triggerPrice.GreaterThanOrEqual(markPrice) {
+				return fmt.Errorf("take profit %v price must be under entry price: %v", positionType, markPrice)
+			}
+			if triggerPrice.LessThanOrEqual(prices.MaxProfitPrice) {
+				return fmt.Errorf("take profit %v price cannot be under max price: %v", positionType, prices.MaxProfitPrice)
+			}
+		default:
+			return fmt.Errorf("invalid position type: %s", positionType)
+		}
+		return nil
+	case stopLossLevel:
+		return validateStopLoss(positionType, triggerPrice, markPrice, prices)
+	default:
+		return fmt.Errorf("invalid kind: expected %q or %q, found %q", takeProfitLevel, stopLossLevel, kind)
+	}
+}
+
+// parseTrigger reads a reduce-only trigger price and checks it with validateTrigger
+func parseTrigger(kind, positionType, value string, markPrice decimal.Decimal, prices *orderPrices) (decimal.Decimal, error) {
+	triggerPrice, err := decimal.NewFromString(value)
+	if err != nil || !triggerPrice.IsPositive() {
+		return decimal.Zero, fmt.Errorf("invalid trigger price: %v", value)
+	}
+	triggerPrice = triggerPrice.RoundUsd()
+	if err := validateTrigger(kind, positionType, triggerPrice, markPrice, prices); err != nil {
+		return decimal.Zero, err
+	}
+	return triggerPrice, nil
+}
+
+// quoteBracket prices the reduce-only take profit and stop loss of a limit order, checked from the limit price
+// a bracket closes the whole position, so it replaces the take profit, stop and ladders of the order
+func quoteBracket(params *CreateOrderRequestParams, limitPrice, stopLossPrice, tpPrice decimal.Decimal, exitLevels []ExitLevel, prices *orderPrices) (decimal.Decimal, decimal.Decimal, error) {
+	var bracketTp, bracketSl decimal.Decimal
+	if params.BracketTakeProfit == "" && params.BracketStopLoss == "" {
+		return bracketTp, bracketSl, nil
+	}
+	if limitPrice.IsZero() {
+		return bracketTp, bracketSl, fmt.Errorf("brackets can only be attached to limit orders")
+	}
+	if !stopLossPrice.IsZero() || !tpPrice.IsZero() || len(exitLevels) > 0 {
+		return bracketTp, bracketSl, fmt.Errorf("a bracket cannot be combined with stop-price, tp-price, a trailing stop or exit levels")
+	}
+
+	var err error
+	if params.BracketTakeProfit != "" {
+		bracketTp, err = parseTrigger(takeProfitLevel, params.PositionType, params.BracketTakeProfit, limitPrice, prices)
+		if err != nil {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("bracket-tp: %w", err)
+		}
+	}
+	if params.BracketStopLoss != "" {
+		bracketSl, err = parseTrigger(stopLossLevel, params.PositionType, params.BracketStopLoss, limitPrice, prices)
+		if err != nil {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("bracket-sl: %w", err)
+		}
+	}
+	return bracketTp, bracketSl, nil
+}
+
+func reduceOnlyOrderTypedData(order db.ReduceOnlyOrderResponse, nonce uint64, expiry int64) utils.ReduceOnlyOrderTypedData {
+	return utils.ReduceOnlyOrderTypedData{
+		ReduceOnlyOrderId: order.ID,
+		OrderId:           order.ParentID,
+		Kind:              order.Kind,
+		TriggerPrice:      order.TriggerPrice,
+		ClosePercent:      order.ClosePercent,
+		Nonce:             nonce,
+		Expiry:            expiry,
+	}
+}
+
+func modifyOrderTypedData(modification db.OrderModificationResponse, nonce uint64, expiry int64) utils.ModifyOrderTypedData {
+	return utils.ModifyOrderTypedData{
+		OrderId:        modification.OrderID,
+		ModificationId: modification.ID,
+		LimitPrice:     modification.LimitPrice,
+		StopPrice:      modification.StopLossPrice,
+		TpPrice:        modification.TakeProfitPrice,
+		TpCollateral:   modification.TakeProfitCollateral,
+		Nonce:          nonce,
+		Expiry:         expiry,
+	}
+}
+
+// getMarkPrice returns the latest validated pyth price for the pair, stale or uncertain prices are rejected
+func getMarkPrice(pairId string) (decimal.Decimal, error) {
+	price, err := utils.GetValidatedPrice(pairId)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if price.Ema {
+		utils.LogInfo("ema price fallback", fmt.Sprintf("pair %v: %v", pairId, price.Price))
+	}
+	return price.Price, nil
+}
+
+// getMinMarginRatio is the share of the position size that must remain as equity after removing margin
+func getMinMarginRatio() decimal.Decimal {
+	return decimal.RequireFromString("0.02")
+}
+
+// marginChange holds the position values after adding (delta > 0) or removing (delta < 0) margin
+type marginChange struct {
+	Collateral           decimal.Decimal // stored collateral, still includes the collateral released at take profit
+	LiveCollateral       decimal.Decimal
+	Size                 decimal.Decimal
+	Leverage             decimal.Decimal
+	LiquidationPrice     decimal.Decimal
+	MaxProfitPrice       decimal.Decimal
+	TakeProfitValue      decimal.Decimal
+	TakeProfitCollateral decimal.Decimal
+}
+
+// calculateMarginChange keeps the position size fixed and derives the new leverage and prices from the entry price
+// the leverage is rounded to the stored precision, so the size may move by that rounding
+func calculateMarginChange(order db.OrderResponse, delta decimal.Decimal, riskParams *db.PairRiskParamsResponse) (*marginChange, error) {
+	liveCollateral := openCollateral(order)
+	if !liveCollateral.IsPositive() {
+		return nil, fmt.Errorf("order %v has no open collateral", order.ID)
+	}
+
+	size := liveCollateral.Mul(order.Leverage)
+	newLiveCollateral := liveCollateral.Add(delta)
+	if !newLiveCollateral.IsPositive() {
+		return nil, fmt.Errorf("cannot remove %v margin from %v collateral", delta.Neg(), liveCollateral)
+	}
+	leverage := size.Div(newLiveCollateral).Round(leveragePlaces)
+	if leverage.LessThan(decimal.One) {
+		return nil, fmt.Errorf("collateral %v cannot exceed position size %v", newLiveCollateral, size)
+	}
+
+	// same effective leverage as create, the open fee stays charged against the collateral
+	prices := &orderPrices{
+		OpenFee:             order.OpenFee,
+		EffectiveCollateral: newLiveCollateral,
+		EffectiveLeverage:   leverage.Mul(newLiveCollateral.Add(order.OpenFee)).Div(newLiveCollateral),
+	}
+	liqDistance := decimal.One.Div(prices.EffectiveLeverage)
+	maxProfitDistance := riskParams.MaxProfitMultiple.Div(leverage)
+	switch order.OrderType {
+	case "long":
+		prices.LiquidationPrice = order.EntryPrice.Mul(decimal.One.Sub(liqDistance)).RoundUsd()
+		prices.MaxProfitPrice = order.EntryPrice.Mul(decimal.One.Add(maxProfitDistance)).RoundUsd()
+	case "short":
+		prices.LiquidationPrice = order.EntryPrice.Mul(decimal.One.Add(liqDistance)).RoundUsd()
+		prices.MaxProfitPrice = order.EntryPrice.Mul(decimal.One.Sub(maxProfitDistance)).RoundUsd()
+	default:
+		return nil, fmt.Errorf("invalid position type: %v", order.OrderType)
+	}
+
+	change := &marginChange{
+		Collateral:       order.Collateral.Add(delta),
+		LiveCollateral:   newLiveCollateral,
+		Size:             newLiveCollateral.Mul(leverage),
+		Leverage:         leverage,
+		LiquidationPrice: prices.LiquidationPrice,
+		MaxProfitPrice:   prices.MaxProfitPrice,
+	}
+
+	// an open take profit keeps closing the same share of the position
+	if order.TakeProfitAt.IsZero() && !order.TakeProfitPrice.IsZero() {
+		tpPercent := order.TakeProfitCollateral.Mul(hundred).Div(liveCollateral)
+		tpValue, tpCollateral, err := calculateTakeProfit(order.OrderType, order.TakeProfitPrice, tpPercent, order.EntryPrice, leverage, prices)
+		if err != nil {
+			return nil, err
+		}
+		change.TakeProfitValue, change.TakeProfitCollateral = tpValue, tpCollateral
+	}
+
+	if !order.StopLossPrice.IsZero() {
+		if order.OrderType == "long" && order.StopLossPrice.LessThanOrEqual(change.LiquidationPrice) {
+			return nil, fmt.Errorf("stop loss price %v must exceed new liquidation price: %v", order.StopLossPrice, change.LiquidationPrice)
+		} else if order.OrderType == "short" && order.StopLossPrice.GreaterThanOrEqual(change.LiquidationPrice) {
+			return nil, fmt.Errorf("new liquidation price %v must exceed stop loss price: %v", change.LiquidationPrice, order.StopLossPrice)
+		}
+	}
+
+	return change, nil
+}
+
+// validateMarginRemoval requires the position to stay above the minimum margin at the current mark price
+func validateMarginRemoval(order db.OrderResponse, change *marginChange, markPrice decimal.Decimal) error {
+	var unrealizedPnl decimal.Decimal
+	switch order.OrderType {
+	case "long":
+		if markPrice.LessThanOrEqual(change.LiquidationPrice) {
+			return fmt.Errorf("mark price %v is under the new liquidation price: %v", markPrice, change.LiquidationPrice)
+		}
+		unrealizedPnl = change.Size.Mul(markPrice.Sub(order.EntryPrice)).Div(order.EntryPrice)
+	case "short":
+		if markPrice.GreaterThanOrEqual(change.LiquidationPrice) {
+			return fmt.Errorf("mark price %v is over the new liquidation price: %v", markPrice, change.LiquidationPrice)
+		}
+		unrealizedPnl = change.Size.Mul(order.EntryPrice.Sub(markPrice)).Div(order.EntryPrice)
+	default:
+		return fmt.Errorf("invalid position type: %v", order.OrderType)
+	}
+
+	equity := change.LiveCollateral.Add(unrealizedPnl).RoundUsd()
+	if minMargin := change.Size.Mul(getMinMarginRatio()).RoundUsd(); equity.LessThan(minMargin) {
+		return fmt.Errorf("remaining margin %v is under the minimum margin %v", equity, minMargin)
+	}
+	return nil
+}
+
+func marginTypedData(order db.OrderResponse, modification db.OrderModificationResponse, action string, nonce uint64, expiry int64) utils.ModifyMarginTypedData {
+	return utils.ModifyMarginTypedData{
+		OrderId:        modification.OrderID,
+		ModificationId: modification.ID,
+		Action:         action,
+		Amount:         modification.Collateral.Sub(order.Collateral).Abs(),
+		Collateral:     modification.Collateral,
+		Leverage:       modification.Leverage,
+		Nonce:          nonce,
+		Expiry:         expiry,
+	}
+}
+
+// openCollateral is the collateral still in the position, a filled take profit has already released its share
+func openCollateral(order db.OrderResponse) decimal.Decimal {
+	if !order.TakeProfitAt.IsZero() {
+		return order.Collateral.Sub(order.TakeProfitCollateral)
+	}
+	return order.Collateral
+}
+
+// closeQuote is what closing part of a position pays at a mark price, Collateral is the closed collateral
+type closeQuote struct {
+	Collateral     decimal.Decimal
+	CloseValue     decimal.Decimal
+	UtilizationFee decimal.Decimal // accrued since the position opened, included in CloseFee
+	CloseFee       decimal.Decimal
+	FundingPaid    decimal.Decimal
+	Payout         decimal.Decimal
+}
+
+// quoteClose prices closing closePercent of the open collateral, the formula of sign-close-order
+// borrowIndex and fundingIndex are the current cumulative indexes, see AccrueBorrowIndex and AccruePairFunding
+func quoteClose(order db.OrderResponse, closePercent, markPrice, borrowIndex, fundingIndex decimal.Decimal, riskParams *db.PairRiskParamsResponse) (*closeQuote, error) {
+	liveCollateral := openCollateral(order)
+	quote := &closeQuote{Collateral: liveCollateral.Mul(closePercent).Div(hundred).RoundUsd()}
+
+	accruedFunding := funding.Accrued(order.OrderType, liveCollateral.Mul(order.Leverage), order.FundingIndex, fundingIndex, order.FundingOwed)
+	quote.FundingPaid = funding.Share(accruedFunding, quote.Collateral, liveCollateral)
+
+	switch order.OrderType {
+	case "long":
+		quote.CloseValue = quote.Collateral.Mul(order.Leverage).Mul(decimal.One.Add(markPrice.Sub(order.EntryPrice).Div(order.EntryPrice))).RoundUsd()
+	case "short":
+		quote.CloseValue = quote.Collateral.Mul(order.Leverage).Mul(decimal.One.Add(order.EntryPrice.Sub(markPrice).Div(order.EntryPrice))).RoundUsd()
+	default:
+		return nil, fmt.Errorf("unexpected order type: %v", order.OrderType)
+	}
+
+	leverageFee := dynamicLeverageFee(order.Leverage).Mul(riskParams.LeverageFeeMultiplier)
+	utilizationFee := borrowFee(order.BorrowIndex, borrowIndex).Mul(riskParams.UtilizationFeeMultiplier)
+	quote.UtilizationFee = quote.CloseValue.Mul(utilizationFee).RoundUsd()
+	quote.CloseFee = quote.CloseValue.Mul(leverageFee.Add(utilizationFee)).RoundUsd()
+	quote.Payout = quote.CloseValue.Sub(quote.CloseFee).Sub(quote.Collateral.Mul(order.Leverage.Sub(decimal.One))).Sub(quote.FundingPaid).RoundUsd()
+	if quote.Payout.IsNegative() {
+		quote.Payout = decimal.Zero
+	}
+	return quote, nil
+}
+
+// resolveClosePercent converts the close-percent or close-size request into a percent of the open collateral
+func resolveClosePercent(order db.OrderResponse, closePercent, closeSize string) (decimal.Decimal, error) {
+	if closePercent != "" && closeSize != "" {
+		return decimal.Zero, fmt.Errorf("only one of close-percent or close-size can be set")
+	}
+
+	switch {
+	case closePercent != "":
+		percent, err := decimal.NewFromString(closePercent)
+		if err != nil || !percent.IsPositive() || percent.GreaterThan(hundred) {
+			return decimal.Zero, fmt.Errorf("invalid close percent: expected 0 < value <= 100, found %v", closePercent)
+		}
+		return percent, nil
+	case closeSize != "":
+		size, err := decimal.NewFromString(closeSize)
+		if err != nil || !size.IsPositive() {
+			return decimal.Zero, fmt.Errorf("invalid close size value: %v", closeSize)
+		}
+		openSize := openCollateral(order).Mul(order.Leverage)
+		if size.GreaterThan(openSize) {
+			return decimal.Zero, fmt.Errorf("close size %v exceeds open position size %v", size, openSize)
+		}
+		return size.Mul(hundred).DivRound(openSize, decimal.UsdPlaces), nil
+	default:
+		return hundred, nil
+	}
+}
+
+// quoteOrder prices an order from the live mark price and checks it against the pair limits, shared by create-order and quote-order
+func quoteOrder(supabaseClient *supabase.Client, params *CreateOrderRequestParams) (*QuoteOrderResponse, *db.PairRiskParamsResponse, error) {
+	snapshot, err := getPairSnapshot(supabaseClient, params.Pair)
+	if err != nil {
+		return nil, nil, err
+	}
+	quote, err := quoteOrderAt(params, snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+	return quote, snapshot.RiskParams, nil
+}
+
+// pairSnapshot is the mark price and risk params of a pair, read once for all the orders quoted against it
+type pairSnapshot struct {
+	PairId     string
+	MarkPrice  decimal.Decimal
+	RiskParams *db.PairRiskParamsResponse
+}
+
+func getPairSnapshot(supabaseClient *supabase.Client, pair string) (*pairSnapshot, error) {
+	pairId, err := getPairId(pair)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	markPrice, err := getMarkPrice(pairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	riskParams, err := risk.GetPairParams(supabaseClient, pairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	return &pairSnapshot{PairId: pairId, MarkPrice: markPrice, RiskParams: riskParams}, nil
+}
+
+// quoteOrderAt quotes an order against a pair snapshot without any further read
+func quoteOrderAt(params *CreateOrderRequestParams, snapshot *pairSnapshot) (*QuoteOrderResponse, error) {
+	var markPrice, entryPrice, limitPrice, stopLossPrice, tpPrice, tpValue, tpCollateral decimal.Decimal // init as zero
+	var trailAmount, trailPercent decimal.Decimal
+
+	collateral, err := decimal.NewFromString(params.Collateral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collateral value: %w", err)
+	}
+	pairId := snapshot.PairId
+	markPrice = snapshot.MarkPrice
+	livePrice := markPrice
+
+	// skip mark price evaluation, if limit order
+	if params.LimitPrice == "" && params.EntryPrice != "" {
+		var err error
+		entryPrice, err = decimal.NewFromString(params.EntryPrice)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("invalid entry price: %v", err.Error()))
+		}
+
+		var slippage decimal.Decimal
+		if params.Slippage != "" {
+			slippage, err = decimal.NewFromString(params.Slippage)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slippage value: %w", err)
+			}
+		}
+
+		var maxSlippage = decimal.RequireFromString("0.05") // 5% slippage threshold
+		if !slippage.IsZero() {
+			maxSlippage = slippage
+		}
+		slippageThreshold := markPrice.Mul(maxSlippage)
+
+		// Validate that the entryPrice is within acceptable slippage from the markPrice
+		if params.PositionType == "long" && entryPrice.Sub(markPrice).GreaterThan(slippageThreshold) {
+			return nil, fmt.Errorf("long position: entry price exceeds 5%% slippage from the mark price %v", markPrice)
+		} else if params.PositionType == "short" && markPrice.Sub(entryPrice).GreaterThan(slippageThreshold) {
+			return nil, fmt.Errorf("short position: entry price exceeds 5%% slippage from the mark price")
+		}
+
+		entryPrice = markPrice
+	} else {
+		entryPrice = markPrice
+	}
+	// entry prices are stored as NUMERIC(20, 6)
+	entryPrice = entryPrice.RoundUsd()
+
+	// entry orders are quoted at their limit price, stop and mit entries at their trigger
+	// the rebalancer moves liquidation and max profit to the fill price when they trigger, see entry.Reprice
+	entryType, limitPrice, triggerPrice, err := quoteEntry(params, livePrice)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	if !limitPrice.IsZero() {
+		markPrice = limitPrice
+	}
+
+	leverage, err := decimal.NewFromString(params.Leverage)
+	if err != nil {
+		return nil, utils.ErrInternal(fmt.Sprintf("invalid leverage value: %v", err.Error()))
+	}
+	leverage = leverage.Round(leveragePlaces)
+	collateral = collateral.RoundUsd()
+
+	riskParams := snapshot.RiskParams
+	if err := risk.ValidateOrder(riskParams, params.PositionType, collateral, leverage); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	prices, err := calculateOrderPrices(params.PositionType, markPrice, leverage, collateral, riskParams)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	// stop loss price
+	if params.StopLossPrice != "" && params.StopLossPrice != "0" {
+		var err error
+		stopLossPrice, err = decimal.NewFromString(params.StopLossPrice)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Errorf("invalid stop loss price value: %w", err).Error())
+		}
+		stopLossPrice = stopLossPrice.RoundUsd()
+		if err := validateStopLoss(params.PositionType, stopLossPrice, markPrice, prices); err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	// trailing stop, the initial stop trails the price the position opens at
+	if params.TrailAmount != "" || params.TrailPercent != "" {
+		if !stopLossPrice.IsZero() {
+			return nil, utils.ErrMalformedRequest("stop-price and a trailing stop cannot be combined")
+		}
+		trailAmount, trailPercent, err = trailing.Parse(params.TrailAmount, params.TrailPercent)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		stopLossPrice = trailing.StopPrice(params.PositionType, markPrice, trailAmount, trailPercent)
+		if err := validateStopLoss(params.PositionType, stopLossPrice, markPrice, prices); err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("trailing stop: %v", err.Error()))
+		}
+	}
+
+	if params.TakeProfitPrice != "" && params.TakeProfitPrice != "0" {
+		tpPrice_, err := decimal.NewFromString(params.TakeProfitPrice)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("invalid take profit price: %v", err.Error()))
+		}
+		tpPrice = tpPrice_.RoundUsd()
+		tpPercent, err := decimal.NewFromString(params.TakeProfitPercent)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("invalid take profit price: %v", err.Error()))
+		}
+		tpValue, tpCollateral, err = calculateTakeProfit(params.PositionType, tpPrice, tpPercent, markPrice, leverage, prices)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	exitLevels, err := quoteExitLevels(params, markPrice, leverage, stopLossPrice, tpPrice, prices)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	bracketTp, bracketSl, err := quoteBracket(params, limitPrice, stopLossPrice, tpPrice, exitLevels, prices)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	expiresAt, err := parseExpiresAt(params.ExpiresAt, limitPrice)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	return &QuoteOrderResponse{
+		Pair:                 params.Pair,
+		PairId:               pairId,
+		PositionType:         params.PositionType,
+		MarkPrice:            livePrice,
+		EntryPrice:           entryPrice,
+		EntryType:            entryType,
+		LimitPrice:           limitPrice,
+		TriggerPrice:         triggerPrice,
+		Collateral:           collateral,
+		Leverage:             leverage,
+		OpenFee:              prices.OpenFee,
+		EffectiveCollateral:  prices.EffectiveCollateral,
+		EffectiveLeverage:    prices.EffectiveLeverage,
+		LiquidationPrice:     prices.LiquidationPrice,
+		MaxProfitPrice:       prices.MaxProfitPrice,
+		StopLossPrice:        stopLossPrice,
+		TakeProfitPrice:      tpPrice,
+		TakeProfitValue:      tpValue,
+		TakeProfitCollateral: tpCollateral,
+		TrailAmount:          trailAmount,
+		TrailPercent:         trailPercent,
+		ExitLevels:           exitLevels,
+		BracketTakeProfit:    bracketTp,
+		BracketStopLoss:      bracketSl,
+		ExpiresAt:            expiresAt,
+	}, nil
+}
+
+// hourlyUtilizationFee is the borrow fee of the next hour at the current utilization, applied to the position value
+// baseBorrowRate is borrow_index.base_borrow_rate, the rate the index accrues at 100% utilization
+func hourlyUtilizationFee(positionValue, globalBorrowed, globalLiquidity, baseBorrowRate decimal.Decimal, riskParams *db.PairRiskParamsResponse) decimal.Decimal {
+	if !globalLiquidity.IsPositive() {
+		return decimal.Zero
+	}
+	return positionValue.Mul(baseBorrowRate).Mul(globalBorrowed).Div(globalLiquidity).Mul(riskParams.UtilizationFeeMultiplier).RoundUsd()
+}
+
+// algo orders are split in 2 to 50 slices, see db/orders/algo_orders.sql
+const maxAlgoSlices = 50
+
+// algoQuote plans the slices of an algo order, collaterals, openFees and limitPrices match by slice index
+type algoQuote struct {
+	PairId          string
+	Leverage        decimal.Decimal
+	IntervalSeconds int64
+	PriceFrom       decimal.Decimal
+	PriceTo         decimal.Decimal
+	LiqDistance     decimal.Decimal
+	MaxDistance     decimal.Decimal
+	Collateral      decimal.Decimal // total before the open fees, what the user needs in balance
+	Collaterals     []decimal.Decimal
+	OpenFees        []decimal.Decimal
+	LimitPrices     []decimal.Decimal // empty for a twap
+}
+
+// quoteAlgoOrder splits the collateral evenly, the last slice takes the rounding remainder
+// every slice is validated like an order of its own, scale slices at their limit price
+func quoteAlgoOrder(supabaseClient *supabase.Client, params *CreateAlgoOrderRequestParams) (*algoQuote, error) {
+	slices, err := strconv.ParseInt(params.Slices, 10, 64)
+	if err != nil || slices < 2 || slices > maxAlgoSlices {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid slices: expected 2 to %v, found %v", maxAlgoSlices, params.Slices))
+	}
+	collateral, err := decimal.NewFromString(params.Collateral)
+	if err != nil || !collateral.IsPositive() {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid collateral value: %v", params.Collateral))
+	}
+	collateral = collateral.RoundUsd()
+	leverage, err := decimal.NewFromString(params.Leverage)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid leverage value: %v", params.Leverage))
+	}
+	leverage = leverage.Round(leveragePlaces)
+
+	pairId, err := getPairId(params.Pair)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	markPrice, err := getMarkPrice(pairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	riskParams, err := risk.GetPairParams(supabaseClient, pairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	quote := &algoQuote{PairId: pairId, Leverage: leverage, Collateral: collateral}
+	switch params.Kind {
+	case "twap":
+		if params.PriceFrom != "" || params.PriceTo != "" {
+			return nil, utils.ErrMalformedRequest("twap orders take a duration, not a price range")
+		}
+		duration, err := strconv.ParseInt(params.Duration, 10, 64)
+		if err != nil || duration <= 0 {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid duration: expected minutes > 0, found %v", params.Duration))
+		}
+		quote.IntervalSeconds = duration * 60 / (slices - 1)
+		if quote.IntervalSeconds == 0 {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("duration of %v minutes is too short for %v slices", duration, slices))
+		}
+	case "scale":
+		if params.Duration != "" {
+			return nil, utils.ErrMalformedRequest("scale orders take a price range, not a duration")
+		}
+		quote.PriceFrom, err = decimal.NewFromString(params.PriceFrom)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid price-from value: %v", params.PriceFrom))
+		}
+		quote.PriceTo, err = decimal.NewFromString(params.PriceTo)
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid price-to value: %v", params.PriceTo))
+		}
+		quote.PriceFrom, quote.PriceTo = quote.PriceFrom.RoundUsd(), quote.PriceTo.RoundUsd()
+		// the prices in between are on the same side of the mark price as both ends
+		for _, price := range []decimal.Decimal{quote.PriceFrom, quote.PriceTo} {
+			if err := entry.Validate(entry.Limit, params.PositionType, price, decimal.Zero, markPrice); err != nil {
+				return nil, utils.ErrMalformedRequest(err.Error())
+			}
+		}
+	default:
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid algo order kind: expected twap or scale, found %v", params.Kind))
+	}
+
+	sliceCollateral := collateral.Div(decimal.NewFromInt(slices)).RoundUsd()
+	for i := int64(0); i < slices; i++ {
+		slice := sliceCollateral
+		if i == slices-1 {
+			slice = collateral.Sub(sliceCollateral.Mul(decimal.NewFromInt(slices - 1)))
+		}
+		if err := risk.ValidateOrder(riskParams, params.PositionType, slice, leverage); err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("slice %v: %v", i, err.Error()))
+		}
+
+		price := markPrice
+		if params.Kind == "scale" {
+			price = quote.PriceFrom.Add(quote.PriceTo.Sub(quote.PriceFrom).Mul(decimal.NewFromInt(i)).Div(decimal.NewFromInt(slices - 1))).RoundUsd()
+			quote.LimitPrices = append(quote.LimitPrices, price)
+		}
+		prices, err := calculateOrderPrices(params.PositionType, price, leverage, slice, riskParams)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("slice %v: %v", i, err.Error()))
+		}
+		quote.Collaterals = append(quote.Collaterals, prices.EffectiveCollateral)
+		quote.OpenFees = append(quote.OpenFees, prices.OpenFee)
+
+		// the fee is a fraction of the collateral, so the distances only differ by the fee rounding
+		if i == 0 {
+			quote.LiqDistance = decimal.One.Div(prices.EffectiveLeverage).Round(12)
+			quote.MaxDistance = riskParams.MaxProfitMultiple.Div(leverage).Round(12)
+		}
+	}
+
+	return quote, nil
+}
+
+func algoOrderTypedData(order db.AlgoOrderResponse, nonce uint64, expiry int64) utils.AlgoOrderTypedData {
+	return utils.AlgoOrderTypedData{
+		AlgoOrderId:     order.ID,
+		Kind:            order.Kind,
+		Pair:            order.Pair,
+		Side:            order.OrderType,
+		Leverage:        order.Leverage,
+		Collateral:      order.Collateral,
+		Slices:          order.Slices,
+		IntervalSeconds: order.IntervalSeconds,
+		PriceFrom:       order.PriceFrom,
+		PriceTo:         order.PriceTo,
+		Nonce:           nonce,
+		Expiry:          expiry,
+	}
+}
+
+// parseBatchOrders reads the orders param of create-orders-batch, unknown keys are rejected so typos do not drop a param
+func parseBatchOrders(value string) ([]CreateOrderRequestParams, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+
+	var orders []CreateOrderRequestParams
+	if err := decoder.Decode(&orders); err != nil {
+		return nil, fmt.Errorf("invalid orders: expected a json array of create-order params: %v", err)
+	}
+	if len(orders) == 0 || len(orders) > maxBatchOrders {
+		return nil, fmt.Errorf("invalid orders: expected 1 to %v orders, found %v", maxBatchOrders, len(orders))
+	}
+	return orders, nil
+}
+
+// validateBatchOrder rejects the options that need more than create_order, they are signed with the order on their own
+func validateBatchOrder(params *CreateOrderRequestParams) error {
+	if params.TrailAmount != "" || params.TrailPercent != "" {
+		return fmt.Errorf("trailing stops are not available in batches")
+	}
+	if params.TakeProfitLevels != "" || params.StopLossLevels != "" {
+		return fmt.Errorf("tp-levels and sl-levels are not available in batches")
+	}
+	if params.BracketTakeProfit != "" || params.BracketStopLoss != "" {
+		return fmt.Errorf("brackets are not available in batches")
+	}
+	if params.ClientOrderId != "" {
+		return parseClientOrderId(params.ClientOrderId)
+	}
+	return nil
+}
+
+// batchOrder maps a quote to the create_order values of create_orders_batch
+func batchOrder(index int, quote *QuoteOrderResponse) db.BatchOrder {
+	order := db.BatchOrder{
+		Index:                index,
+		OrderType:            quote.PositionType,
+		Pair:                 quote.Pair,
+		PairId:               quote.PairId,
+		Leverage:             quote.Leverage,
+		Collateral:           quote.EffectiveCollateral,
+		EntryPrice:           quote.EntryPrice,
+		LiquidationPrice:     quote.LiquidationPrice,
+		MaxPrice:             quote.MaxProfitPrice,
+		OpenFee:              quote.OpenFee,
+		LimitPrice:           quote.LimitPrice,
+		StopLossPrice:        quote.StopLossPrice,
+		TakeProfitPrice:      quote.TakeProfitPrice,
+		TakeProfitValue:      quote.TakeProfitValue,
+		TakeProfitCollateral: quote.TakeProfitCollateral,
+		EntryType:            quote.EntryType,
+		TriggerPrice:         quote.TriggerPrice,
+	}
+	if quote.ExpiresAt != 0 {
+		order.ExpiresAt = time.Unix(quote.ExpiresAt, 0)
+	}
+	return order
+}
+
+// addOpenInterest counts an order of the batch in the snapshot so the next orders are checked against it
+func (snapshot *pairSnapshot) addOpenInterest(positionType string, size decimal.Decimal) {
+	if positionType == "short" {
+		snapshot.RiskParams.ShortOpenInterest = snapshot.RiskParams.ShortOpenInterest.Add(size)
+		return
+	}
+	snapshot.RiskParams.LongOpenInterest = snapshot.RiskParams.LongOpenInterest.Add(size)
 }
 
-func getPerHourFee() float64 {
-	return 0.0001
+func orderBatchTypedData(batch db.OrderBatchResponse, nonce uint64, expiry int64) utils.OrderBatchTypedData {
+	return utils.OrderBatchTypedData{
+		BatchId:  batch.ID,
+		Action:   batch.Action,
+		OrderIds: batch.OrderIds,
+		Nonce:    nonce,
+		Expiry:   expiry,
+	}
 }
 
-func dynamicUtilizationFee(startTimestamp db.CustomTime, globalBorrowed, globalLiquidity float64) float64 {
-	elapsedTime := time.Since(startTimestamp.UTC()).Seconds()
+// quoteBatchOrder quotes an order of a batch against the snapshot of its pair, read on the first order of the pair
+// balance is what is left after the previous orders of the batch
+func quoteBatchOrder(supabaseClient *supabase.Client, params *CreateOrderRequestParams, snapshots map[string]*pairSnapshot, balance decimal.Decimal) (*QuoteOrderResponse, error) {
+	if err := validateBatchOrder(params); err != nil {
+		return nil, err
+	}
+	snapshot, ok := snapshots[params.Pair]
+	if !ok {
+		var err error
+		snapshot, err = getPairSnapshot(supabaseClient, params.Pair)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[params.Pair] = snapshot
+	}
+
+	quote, err := quoteOrderAt(params, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if balance.LessThan(quote.Collateral) {
+		return nil, fmt.Errorf("insufficent balance: expected >=%v, found %v", quote.Collateral, balance)
+	}
+	snapshot.addOpenInterest(quote.PositionType, quote.Collateral.Mul(quote.Leverage))
+	return quote, nil
+}
+
+// parseClientOrderId accepts 1 to 64 letters, digits and . _ : -
+func parseClientOrderId(value string) error {
+	if len(value) == 0 || len(value) > maxClientOrderIdLength {
+		return fmt.Errorf("invalid client-order-id: expected 1 to %v characters, found %v", maxClientOrderIdLength, len(value))
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("._:-", c)) {
+			return fmt.Errorf("invalid client-order-id: unexpected character %q", c)
+		}
+	}
+	return nil
+}
+
+// clientOrderHash fingerprints the params of a create-order so a retry can be told apart from a reused client order id
+func clientOrderHash(params *CreateOrderRequestParams) (string, error) {
+	fingerprint := *params
+	fingerprint.ClientOrderId = ""
+	data, err := json.Marshal(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// resolveOrder finds an order by its id, or by the user id and client order id
+func resolveOrder(supabaseClient *supabase.Client, orderId, userId, clientOrderId string) (*db.OrderAndUserResponse, error) {
+	if orderId != "" {
+		orderAndUser, err := db.GetOrderById(supabaseClient, orderId)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+		return orderAndUser, nil
+	}
+	if userId == "" || clientOrderId == "" {
+		return nil, utils.ErrMalformedRequest("expected order-id, or user-id and client-order-id")
+	}
+
+	order, err := db.GetOrderByClientId(supabaseClient, userId, clientOrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	if order == nil {
+		return nil, utils.ErrInternal(fmt.Sprintf("no order with client order id %v for user %v", clientOrderId, userId))
+	}
+	return &order.OrderAndUserResponse, nil
+}
+
+// parseOrderHistory reads the filters and the page of get-orders-by-user-id and get-orders-by-user-address
+func parseOrderHistory(params OrderHistoryRequestParams) (db.OrderFilter, pagination.Page, error) {
+	filter := db.OrderFilter{
+		Statuses:  pagination.ParseList(params.OrderStatus),
+		OrderType: params.OrderType,
+		Pair:      params.Pair,
+	}
+	if params.OrderType != "" && params.OrderType != "long" && params.OrderType != "short" {
+		return filter, pagination.Page{}, fmt.Errorf("invalid order-type: expected long or short, found %v", params.OrderType)
+	}
+
+	ended, err := pagination.ParseTimeRange("ended", params.EndedFrom, params.EndedTo)
+	if err != nil {
+		return filter, pagination.Page{}, err
+	}
+	filter.Ended = ended
+
+	created, page, err := params.Page.Parse()
+	if err != nil {
+		return filter, pagination.Page{}, err
+	}
+	filter.Created = created
+	return filter, page, nil
+}
+
+// getPendingOrders reads every open position of a user, page by page
+func getPendingOrders(supabaseClient *supabase.Client, userId string) ([]db.OrderResponse, error) {
+	filter := db.OrderFilter{Statuses: []string{orderstate.Pending}}
+	page := pagination.Page{Limit: pagination.MaxLimit}
+
+	var orders []db.OrderResponse
+	for {
+		response, err := db.GetOrdersByUserId(supabaseClient, userId, filter, page)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, response.Orders...)
+		if response.NextCursor == "" {
+			return orders, nil
+		}
+		if page.After, err = pagination.Decode(response.NextCursor); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// quotePosition values an open position as if it closed at markPrice
+// the margin ratio is the equity (open collateral and unrealized pnl) over the size, margin removal keeps it over getMinMarginRatio
+func quotePosition(order db.OrderResponse, markPrice, borrowIndex, fundingIndex decimal.Decimal, riskParams *db.PairRiskParamsResponse) (*PositionResponse, error) {
+	quote, err := quoteClose(order, hundred, markPrice, borrowIndex, fundingIndex, riskParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var liqDistance decimal.Decimal
+	switch order.OrderType {
+	case "long":
+		liqDistance = markPrice.Sub(order.LiquidationPrice)
+	case "short":
+		liqDistance = order.LiquidationPrice.Sub(markPrice)
+	}
 
-	return getPerHourFee() * (elapsedTime / 3600) * globalBorrowed / globalLiquidity
+	size := quote.Collateral.Mul(order.Leverage).RoundUsd()
+	unrealizedPnl := quote.CloseValue.Sub(size)
+	position := &PositionResponse{
+		Order:                 order,
+		MarkPrice:             markPrice,
+		Size:                  size,
+		UnrealizedPnl:         unrealizedPnl,
+		AccruedUtilizationFee: quote.UtilizationFee,
+		AccruedFunding:        quote.FundingPaid,
+		EstimatedCloseFee:     quote.CloseFee,
+		EstimatedPayout:       quote.Payout,
+		LiquidationDistance:   liqDistance.Mul(hundred).DivRound(markPrice, 2),
+	}
+	if size.IsPositive() {
+		position.MarginRatio = quote.Collateral.Add(unrealizedPnl).DivRound(size, 4)
+	}
+	return position, nil
 }
@@ -58,19 +58,19 @@ func LogCreateOrderResponse(url string, response db.OrderResponse) {
 			"ID:                      %s\n"+
 			"UserID:                  %s\n"+
 			"Order Type:              %s\n"+
-			"Leverage:                %.2f\n"+
+			"Leverage:                %s\n"+
 			"Pair ID:                 %s\n"+
 			"Order Status:            %s\n"+
-			"Collateral:              %.2f\n"+
-			"Entry Price:             %.2f\n"+
-			"Liquidation Price:       %.2f\n"+
-			"Limit Order Price:       %.2f\n"+
-			"Max Price:               %.2f\n"+
-			"Max Value:               %.2f\n"+
-			"Stop Loss Price:         %.2f\n"+
-			"Take Profit Price:       %.2f\n"+
-			"Take Profit Value:       %.2f\n"+
-			"Take Profit Collateral:  %.2f\n"+
+			"Collateral:              %s\n"+
+			"Entry Price:             %s\n"+
+			"Liquidation Price:       %s\n"+
+			"Limit Order Price:       %s\n"+
+			"Max Price:               %s\n"+
+			"Max Value:               %s\n"+
+			"Stop Loss Price:         %s\n"+
+			"Take Profit Price:       %s\n"+
+			"Take Profit Value:       %s\n"+
+			"Take Profit Collateral:  %s\n"+
 			"Created At:              %s\n"+
 			"Signed At:               %s\n"+
 			"Started At:              %s\n"+
@@ -1,6 +1,10 @@
 package orderHandler
 
-import "github.com/BlueSpadeXchain/blp-api/pkg/db"
+import (
+	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
 
 type OrderRaw struct {
 	Signer    string    `json:"signer"`
@@ -41,6 +45,107 @@ type OrderResponse struct {
 }
 
 type UnsignedOrderRequestResponse struct {
-	Order db.OrderResponse `json:"order"` // created unsigned position, so it has no affect on balances
-	Hash  string           `json:"hash"`  // Hash in hex to be signed by the user
+	Order            db.OrderResponse             `json:"order"`                        // created unsigned position, so it has no affect on balances
+	ExitLevels       []db.OrderExitLevelResponse  `json:"exit_levels,omitempty"`        // take profit and stop loss ladder
+	ReduceOnlyOrders []db.ReduceOnlyOrderResponse `json:"reduce_only_orders,omitempty"` // bracket, signed with the order
+	Hash             string                       `json:"hash"`                         // EIP-712 digest in hex to be signed by the user
+	TypedData        apitypes.TypedData           `json:"typed_data"`                   // payload for eth_signTypedData_v4
+}
+
+type UnsignedReduceOnlyOrderRequestResponse struct {
+	db.UnsignedReduceOnlyOrderResponse
+	Hash      string             `json:"hash"`
+	TypedData apitypes.TypedData `json:"typed_data"`
+}
+
+// ExitLevel is a quoted ladder level, collateral is the share of the effective collateral it closes
+type ExitLevel struct {
+	Kind       string          `json:"kind"`
+	Price      decimal.Decimal `json:"price"`
+	Percent    decimal.Decimal `json:"percent"`
+	Collateral decimal.Decimal `json:"collateral"`
+}
+
+type UnsignedCloseOrderRequestResponse struct {
+	db.UnsignedCloseOrderResponse
+	Hash      string             `json:"hash"`
+	TypedData apitypes.TypedData `json:"typed_data"`
+}
+
+type UnsignedCancelOrderRequestResponse struct {
+	db.UnsignedCancelOrderResponse
+	Hash      string             `json:"hash"`
+	TypedData apitypes.TypedData `json:"typed_data"`
+}
+
+type UnsignedModifyOrderRequestResponse struct {
+	db.UnsignedModifyOrderResponse
+	Modification db.OrderModificationResponse `json:"order_modification"`
+	Hash         string                       `json:"hash"`
+	TypedData    apitypes.TypedData           `json:"typed_data"`
+}
+
+type UnsignedMarginRequestResponse struct {
+	db.UnsignedModifyOrderResponse
+	Modification db.OrderModificationResponse `json:"order_modification"`
+	Hash         string                       `json:"hash"`
+	TypedData    apitypes.TypedData           `json:"typed_data"`
+}
+
+// QuoteOrderResponse previews create-order values, nothing is stored
+type QuoteOrderResponse struct {
+	Pair                 string          `json:"pair"`
+	PairId               string          `json:"pair_id"`
+	PositionType         string          `json:"order_type"`
+	MarkPrice            decimal.Decimal `json:"mark_price"`
+	EntryPrice           decimal.Decimal `json:"entry_price"`
+	EntryType            string          `json:"entry_type"`
+	LimitPrice           decimal.Decimal `json:"limit_price"`
+	TriggerPrice         decimal.Decimal `json:"trigger_price"` // stop limits only, stop and mit entries fill at limit_price
+	Collateral           decimal.Decimal `json:"collateral"`
+	Leverage             decimal.Decimal `json:"leverage"`
+	OpenFee              decimal.Decimal `json:"open_fee"`
+	EffectiveCollateral  decimal.Decimal `json:"effective_collateral"`
+	EffectiveLeverage    decimal.Decimal `json:"effective_leverage"`
+	LiquidationPrice     decimal.Decimal `json:"liq_price"`
+	MaxProfitPrice       decimal.Decimal `json:"max_price"`
+	StopLossPrice        decimal.Decimal `json:"stop_price"`
+	TakeProfitPrice      decimal.Decimal `json:"tp_price"`
+	TakeProfitValue      decimal.Decimal `json:"tp_value"`
+	TakeProfitCollateral decimal.Decimal `json:"tp_collateral"`
+	TrailAmount          decimal.Decimal `json:"trail_amount"`
+	TrailPercent         decimal.Decimal `json:"trail_percent"`
+	ExitLevels           []ExitLevel     `json:"exit_levels"`
+	BracketTakeProfit    decimal.Decimal `json:"bracket_tp_price"`
+	BracketStopLoss      decimal.Decimal `json:"bracket_sl_price"`
+	ExpiresAt            int64           `json:"expires_at,omitempty"`   // unix seconds, zero for good-till-canceled
+	HourlyUtilizationFee decimal.Decimal `json:"hourly_utilization_fee"` // at the current pool utilization, including this order's borrow
+}
+
+// PositionResponse is an open position valued at the current mark price, the estimates are for closing all of it now
+type PositionResponse struct {
+	Order                 db.OrderResponse `json:"order"`
+	MarkPrice             decimal.Decimal  `json:"mark_price"`
+	Size                  decimal.Decimal  `json:"size"`                    // open collateral * leverage
+	UnrealizedPnl         decimal.Decimal  `json:"unrealized_pnl"`          // price move of the size, before fees and funding
+	AccruedUtilizationFee decimal.Decimal  `json:"accrued_utilization_fee"` // since open, charged with the close fee
+	AccruedFunding        decimal.Decimal  `json:"accrued_funding"`         // positive when owed by the position, taken from the payout
+	EstimatedCloseFee     decimal.Decimal  `json:"estimated_close_fee"`
+	EstimatedPayout       decimal.Decimal  `json:"estimated_payout"`
+	LiquidationDistance   decimal.Decimal  `json:"liq_distance_percent"` // adverse price move to the liquidation price, in percent of the mark price
+	MarginRatio           decimal.Decimal  `json:"margin_ratio"`         // (open collateral + unrealized pnl) / size
+	Error                 string           `json:"error,omitempty"`      // the pair has no valid price, only the order is set
+}
+
+type UnsignedAlgoOrderRequestResponse struct {
+	db.UnsignedAlgoOrderResponse
+	Hash      string             `json:"hash"`
+	TypedData apitypes.TypedData `json:"typed_data"`
+}
+
+// UnsignedOrderBatchRequestResponse has no hash to sign when every item of the batch failed
+type UnsignedOrderBatchRequestResponse struct {
+	db.UnsignedOrderBatchResponse
+	Hash      string              `json:"hash,omitempty"`
+	TypedData *apitypes.TypedData `json:"typed_data,omitempty"`
 }
@@ -1,5 +1,7 @@
 package orderHandler
 
+import "github.com/BlueSpadeXchain/blp-api/pkg/pagination"
+
 type UnsignedOrderRequestParams struct {
 	UserId       string `query:"user-id" optional:"true"`       // implied user has an existing account if to have collateral
 	Pair         string `query:"pair"`                          // Target perpetual, expects "BTC/USD", "ETH/USD", etc
@@ -12,69 +14,222 @@ type UnsignedOrderRequestParams struct {
 
 type SignedOrderRequestParams struct {
 	OrderId string `query:"order-id"`
+	Nonce   string `query:"nonce"` // nonce from the typed data message
 	R       string `query:"r"`
 	S       string `query:"s"`
 	V       string `query:"v"`
 }
 
-type ModifyOrderRequestParams struct {
-	OrderId   string `query:"order-id"`
-	NewStatus string `query:"new-status"`
+// empty values keep the current order value, "0" removes the stop loss or take profit
+// a trailing stop follows the price on its own, "0" removes it and its trail
+type UnsignedModifyOrderRequestParams struct {
+	OrderId           string `query:"order-id"`
+	LimitPrice        string `query:"lim-price" optional:"true"` // only before the limit triggers
+	StopLossPrice     string `query:"stop-price" optional:"true"`
+	TakeProfitPrice   string `query:"tp-price" optional:"true"`
+	TakeProfitPercent string `query:"tp-percent" optional:"true"`
+}
+
+type SignedModifyOrderRequestParams struct {
+	ModificationId string `query:"modification-id"`
+	SignatureId    string `query:"signature-id"`
+	Nonce          string `query:"nonce"`
+	R              string `query:"r"`
+	S              string `query:"s"`
+	V              string `query:"v"`
+}
+
+// amount is the collateral to add or remove, the position size is unchanged
+type UnsignedMarginRequestParams struct {
+	OrderId string `query:"order-id"`
+	Amount  string `query:"amount"`
 }
 
 type GetOrdersByUserAddressRequestParams struct {
 	WalletAddress string `query:"wallet-address"`
 	WalletType    string `query:"wallet-type"`
-	OrderType     string `query:"order-type" optional:"true"`   // 'long', 'short'
-	OrderStatus   string `query:"order-status" optional:"true"` // 'unsigned', 'pending', 'filled', 'canceled', 'closed', 'liquidated'
+	OrderHistoryRequestParams
 }
 
 type GetOrdersByUserIdRequestParams struct {
-	UserId      string `query:"user-id"`
-	OrderType   string `query:"order-type" optional:"true"` // filter results
-	OrderStatus string `query:"order-status" optional:"true"`
+	UserId string `query:"user-id"`
+	OrderHistoryRequestParams
+}
+
+// filters of the order history, every filter is optional and pages come newest first
+type OrderHistoryRequestParams struct {
+	OrderType   string                   `query:"order-type" optional:"true"`   // 'long', 'short'
+	OrderStatus string                   `query:"order-status" optional:"true"` // one status or a comma list, 'unsigned', 'limit', 'pending', 'filled', 'canceled', 'closed', 'liquidated', ...
+	Pair        string                   `query:"pair" optional:"true"`         // "BTC/USD", "ETH/USD", etc
+	EndedFrom   string                   `query:"ended-from" optional:"true"`   // unix seconds, inclusive
+	EndedTo     string                   `query:"ended-to" optional:"true"`     // unix seconds, exclusive
+	Page        pagination.RequestParams // created-from, created-to, cursor and limit
 }
 
+// an order is found by order-id, or by user-id and client-order-id
 type GetOrdersByIdRequestParams struct {
+	OrderId       string `query:"order-id" optional:"true"`
+	UserId        string `query:"user-id" optional:"true"`
+	ClientOrderId string `query:"client-order-id" optional:"true"`
+}
+
+type GetOrderFillsRequestParams struct {
 	OrderId string `query:"order-id"`
 }
 
-type UnsignedCancelOrderRequestParams struct {
+type GetPositionsRequestParams struct {
+	UserId string `query:"user-id"`
+}
+
+// an order is found by order-id, or by user-id and client-order-id
+type GetOrderEventsRequestParams struct {
+	OrderId       string `query:"order-id" optional:"true"`
+	UserId        string `query:"user-id" optional:"true"`
+	ClientOrderId string `query:"client-order-id" optional:"true"`
+}
+
+type GetOrderExitLevelsRequestParams struct {
 	OrderId string `query:"order-id"`
 }
 
+type UnsignedCancelOrderRequestParams struct {
+	OrderId       string `query:"order-id" optional:"true"`
+	UserId        string `query:"user-id" optional:"true"`
+	ClientOrderId string `query:"client-order-id" optional:"true"`
+}
+
+// close-percent or close-size closes part of the position, neither closes all of it
 type UnsignedCloseOrderRequestParams struct {
-	OrderId string `query:"order-id"`
+	OrderId      string `query:"order-id"`
+	ClosePercent string `query:"close-percent" optional:"true"` // percent of the open collateral, 0 < value <= 100
+	CloseSize    string `query:"close-size" optional:"true"`    // position size (collateral * leverage) in USD
 }
 
 // set the ended_at timestamp
 // the signature ov
 type SignedCloseOrderRequestParams struct {
-	OrderId     string `query:"order-id"`
-	SignatureId string `query:"signature-id"`
-	R           string `query:"r" optional:"true"`
-	S           string `query:"s" optional:"true"`
-	V           string `query:"v" optional:"true"`
+	OrderId      string `query:"order-id"`
+	SignatureId  string `query:"signature-id"`
+	ClosePercent string `query:"close-percent" optional:"true"` // closePercent from the typed data message, defaults to 100
+	Nonce        string `query:"nonce"`
+	R            string `query:"r"`
+	S            string `query:"s"`
+	V            string `query:"v"`
 }
 
 type SignedCancelOrderRequestParams struct {
-	OrderId     string `query:"order-id"`
-	SignatureId string `query:"signature-id"`
-	R           string `query:"r" optional:"true"`
-	S           string `query:"s" optional:"true"`
-	V           string `query:"v" optional:"true"`
+	OrderId       string `query:"order-id" optional:"true"`
+	UserId        string `query:"user-id" optional:"true"`
+	ClientOrderId string `query:"client-order-id" optional:"true"`
+	SignatureId   string `query:"signature-id"`
+	Nonce         string `query:"nonce"`
+	R             string `query:"r"`
+	S             string `query:"s"`
+	V             string `query:"v"`
 }
 
+// the json tags read the items of create-orders-batch, keyed like the query
 type CreateOrderRequestParams struct {
-	UserId            string `query:"user-id" optional:"true"`    // implied user has an existing account if to have collateral
-	Pair              string `query:"pair"`                       // Target perpetual, expects "BTC/USD", "ETH/USD", etc
-	Collateral        string `query:"value" optional:"true"`      // Collateral amount in USD
-	EntryPrice        string `query:"entry" optional:"true"`      // Entry price in USD
-	Slippage          string `query:"slip" optional:"true"`       // Max slippage (basis points, out of 10,000)
-	Leverage          string `query:"lev" optional:"true"`        // Leverage multiplier
-	PositionType      string `query:"order-type" optional:"true"` // "long" or "short"
-	LimitPrice        string `query:"lim-price" optional:"true"`
-	StopLossPrice     string `query:"stop-price" optional:"true"`
-	TakeProfitPrice   string `query:"tp-price" optional:"true"`
-	TakeProfitPercent string `query:"tp-percent" optional:"true"` // percent to close the position for take profit, when achieved the tp_price and tp_value are set to null
+	UserId            string `query:"user-id" json:"-" optional:"true"`                   // implied user has an existing account if to have collateral
+	Pair              string `query:"pair" json:"pair"`                                   // Target perpetual, expects "BTC/USD", "ETH/USD", etc
+	Collateral        string `query:"value" json:"value" optional:"true"`                 // Collateral amount in USD
+	EntryPrice        string `query:"entry" json:"entry" optional:"true"`                 // Entry price in USD
+	Slippage          string `query:"slip" json:"slip" optional:"true"`                   // Max slippage (basis points, out of 10,000)
+	Leverage          string `query:"lev" json:"lev" optional:"true"`                     // Leverage multiplier
+	PositionType      string `query:"order-type" json:"order-type" optional:"true"`       // "long" or "short"
+	EntryType         string `query:"entry-type" json:"entry-type" optional:"true"`       // "market", "limit", "stop", "mit" or "stop-limit", defaults to limit with lim-price and market otherwise
+	LimitPrice        string `query:"lim-price" json:"lim-price" optional:"true"`         // fill price of limit entries, worst acceptable price of a stop-limit
+	TriggerPrice      string `query:"trigger-price" json:"trigger-price" optional:"true"` // stop price of stop and stop-limit entries, touch price of mit entries, they fill at the mark
+	StopLossPrice     string `query:"stop-price" json:"stop-price" optional:"true"`
+	TakeProfitPrice   string `query:"tp-price" json:"tp-price" optional:"true"`
+	TakeProfitPercent string `query:"tp-percent" json:"tp-percent" optional:"true"`           // percent to close the position for take profit, when achieved the tp_price and tp_value are set to null
+	TrailAmount       string `query:"trail-amount" json:"trail-amount" optional:"true"`       // trailing stop distance in USD, instead of stop-price
+	TrailPercent      string `query:"trail-percent" json:"trail-percent" optional:"true"`     // trailing stop distance in percent of the best price, instead of stop-price
+	TakeProfitLevels  string `query:"tp-levels" json:"tp-levels" optional:"true"`             // take profit ladder "price:percent,price:percent", instead of tp-price
+	StopLossLevels    string `query:"sl-levels" json:"sl-levels" optional:"true"`             // partial stop losses "price:percent,...", on top of stop-price
+	BracketTakeProfit string `query:"bracket-tp" json:"bracket-tp" optional:"true"`           // limit orders only, reduce-only take profit active once the limit fills
+	BracketStopLoss   string `query:"bracket-sl" json:"bracket-sl" optional:"true"`           // limit orders only, reduce-only stop loss, one-cancels-other with bracket-tp
+	ExpiresAt         string `query:"expires-at" json:"expires-at" optional:"true"`           // limit orders only, unix seconds, canceled if not filled by then
+	ClientOrderId     string `query:"client-order-id" json:"client-order-id" optional:"true"` // unique per user, a retry with the same id and params returns the first order
+}
+
+// kind "tp" triggers in favour of the position and "sl" against it, oco-with links the order with another reduce-only order of the same position
+type UnsignedReduceOnlyOrderRequestParams struct {
+	OrderId      string `query:"order-id"`
+	Kind         string `query:"kind"`
+	TriggerPrice string `query:"trigger-price"`
+	ClosePercent string `query:"close-percent" optional:"true"` // percent of the open collateral when triggered, 0 < value <= 100, defaults to 100
+	OcoWith      string `query:"oco-with" optional:"true"`
+}
+
+type SignedReduceOnlyOrderRequestParams struct {
+	ReduceOnlyOrderId string `query:"reduce-only-order-id"`
+	SignatureId       string `query:"signature-id"`
+	Nonce             string `query:"nonce"`
+	R                 string `query:"r"`
+	S                 string `query:"s"`
+	V                 string `query:"v"`
+}
+
+type UnsignedCancelReduceOnlyOrderRequestParams struct {
+	ReduceOnlyOrderId string `query:"reduce-only-order-id"`
+}
+
+type GetReduceOnlyOrdersRequestParams struct {
+	OrderId string `query:"order-id"`
+}
+
+// twap orders split value in slices placed at the mark price over duration, scale orders in limit entries from price-from to price-to
+type CreateAlgoOrderRequestParams struct {
+	UserId       string `query:"user-id"`
+	Pair         string `query:"pair"`
+	Kind         string `query:"kind"`  // "twap" or "scale"
+	Collateral   string `query:"value"` // total collateral in USD, split evenly between the slices
+	Leverage     string `query:"lev"`
+	PositionType string `query:"order-type"`                 // "long" or "short"
+	Slices       string `query:"slices"`                     // 2 to 50
+	Duration     string `query:"duration" optional:"true"`   // twap only, minutes between the first and the last slice
+	PriceFrom    string `query:"price-from" optional:"true"` // scale only, price of the first slice
+	PriceTo      string `query:"price-to" optional:"true"`   // scale only, price of the last slice
+}
+
+type SignedAlgoOrderRequestParams struct {
+	AlgoOrderId string `query:"algo-order-id"`
+	SignatureId string `query:"signature-id"`
+	Nonce       string `query:"nonce"`
+	R           string `query:"r"`
+	S           string `query:"s"`
+	V           string `query:"v"`
+}
+
+type AlgoOrderRequestParams struct {
+	AlgoOrderId string `query:"algo-order-id"`
+}
+
+type GetAlgoOrdersRequestParams struct {
+	UserId string `query:"user-id"`
+}
+
+// orders is a json array of create-order params, {"pair": "BTC/USD", "value": "100", "lev": "10", "order-type": "long"}
+// trailing stops, ladders and brackets are not available in batches
+type CreateOrdersBatchRequestParams struct {
+	UserId string `query:"user-id"`
+	Orders string `query:"orders"`
+}
+
+// order-ids is a comma separated list of unsigned or limit orders of the user
+type CancelOrdersBatchRequestParams struct {
+	UserId   string `query:"user-id"`
+	OrderIds string `query:"order-ids"`
+}
+
+// sig-scheme "eip191" accepts a personal_sign of the returned hash instead of the typed data signature
+type SignedOrdersBatchRequestParams struct {
+	BatchId         string `query:"batch-id"`
+	SignatureId     string `query:"signature-id"`
+	SignatureScheme string `query:"sig-scheme" optional:"true"` // "eip712" or "eip191", defaults to eip712
+	Nonce           string `query:"nonce"`
+	R               string `query:"r"`
+	S               string `query:"s"`
+	V               string `query:"v"`
 }
@@ -4,13 +4,19 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/http"
-	"strconv"
+	"sort"
+	"strings"
+	"time"
 
 	user "github.com/BlueSpadeXchain/blp-api/api/user"
 	db "github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/BlueSpadeXchain/blp-api/pkg/entry"
+	"github.com/BlueSpadeXchain/blp-api/pkg/orderstate"
+	"github.com/BlueSpadeXchain/blp-api/pkg/risk"
 	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/BlueSpadeXchain/blp-api/pkg/verify"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/supabase-community/supabase-go"
 )
@@ -31,7 +37,20 @@ func GetOrdersByUserAddressRequest(r *http.Request, supabaseClient *supabase.Cli
 		}
 	}
 
-	orders, err := db.GetOrdersByUserAddress(supabaseClient, params.WalletAddress, params.WalletType)
+	filter, page, err := parseOrderHistory(params.OrderHistoryRequestParams)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	user_, err := db.GetUserByWallet(supabaseClient, params.WalletAddress, params.WalletType)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	// a wallet without a user has no orders, reading its history does not create one
+	if user_ == nil {
+		return &db.OrderPageResponse{Orders: []db.OrderResponse{}}, nil
+	}
+
+	orders, err := db.GetOrdersByUserId(supabaseClient, user_.UserID, filter, page)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
@@ -54,7 +73,12 @@ func GetOrdersByUserIdRequest(r *http.Request, supabaseClient *supabase.Client,
 		}
 	}
 
-	orders, err := db.GetOrdersByUserId(supabaseClient, params.UserId)
+	filter, page, err := parseOrderHistory(params.OrderHistoryRequestParams)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	orders, err := db.GetOrdersByUserId(supabaseClient, params.UserId, filter, page)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
@@ -77,438 +101,452 @@ func GetOrderByIdRequest(r *http.Request, supabaseClient *supabase.Client, param
 		}
 	}
 
-	order, err := db.GetOrderById(supabaseClient, params.OrderId)
+	return resolveOrder(supabaseClient, params.OrderId, params.UserId, params.ClientOrderId)
+}
+
+// GetOrderFillsRequest lists the exits of an order, partial and full closes and take profit fills
+func GetOrderFillsRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetOrderFillsRequestParams) (interface{}, error) {
+	var params *GetOrderFillsRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetOrderFillsRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	fills, err := db.GetOrderFillsByOrderId(supabaseClient, params.OrderId)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	return order, nil
+	return fills, nil
 }
 
-func UnsignedCreateOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*CreateOrderRequestParams) (interface{}, error) {
-	var params *CreateOrderRequestParams
-	var markPrice, entryPrice, limitPrice, stopLossPrice, tpPrice, tpValue, tpCollateral, maxProfitPrice, liqPrice float64 // init as zero
+// GetPositionsRequest values every pending order of a user at the current mark price
+// the prices of all the pairs involved are read in one hermes request, a position whose pair has no valid price
+// is returned with its error. the borrow and funding indexes are read up to now without accruing them
+func GetPositionsRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetPositionsRequestParams) (interface{}, error) {
+	var params *GetPositionsRequestParams
 
 	if len(parameters) > 0 {
 		params = parameters[0]
 	} else {
-		params = &CreateOrderRequestParams{}
+		params = &GetPositionsRequestParams{}
 	}
 
 	if r != nil {
 		if err := utils.ParseAndValidateParams(r, &params); err != nil {
-			return nil, utils.ErrInternal(fmt.Sprintf("failed to parse params: %s", err.Error()))
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
 		}
 	}
-	userData, err := user.GetUserByUserIdRequest(r, supabaseClient, &user.GetUserByUserIdRequestParams{
-		UserId: params.UserId,
-	})
+
+	orders, err := getPendingOrders(supabaseClient, params.UserId)
 	if err != nil {
-		logrus.Error("GetUserByIdRequest error:", err.Error())
-		return nil, utils.ErrInternal(fmt.Sprintf("GetUserByIdRequest error: %v", err.Error()))
+		return nil, utils.ErrInternal(err.Error())
+	}
+	positions := make([]PositionResponse, 0, len(orders))
+	if len(orders) == 0 {
+		return positions, nil
 	}
-	collateral, err := strconv.ParseFloat(params.Collateral, 64)
+
+	var pairIds []string
+	fundingIndexes := make(map[string]decimal.Decimal)
+	for _, order := range orders {
+		if _, found := fundingIndexes[order.PairId]; !found {
+			fundingIndexes[order.PairId] = decimal.Zero
+			pairIds = append(pairIds, order.PairId)
+		}
+	}
+
+	prices, priceErrors, err := utils.GetValidatedPricesByPair(pairIds)
 	if err != nil {
-		return nil, fmt.Errorf("invalid collateral value: %w", err)
+		return nil, utils.ErrInternal(err.Error())
 	}
-	pairId, err := getPairId(params.Pair)
+
+	pairsParams, err := risk.GetPairsParams(supabaseClient, pairIds)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	priceData, err := utils.GetCurrentPriceData(pairId)
+	riskParams := make(map[string]*db.PairRiskParamsResponse, len(pairsParams))
+	for i := range pairsParams {
+		riskParams[pairsParams[i].PairId] = &pairsParams[i]
+	}
+
+	borrowIndex, err := db.GetAccruedBorrowIndex(supabaseClient)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	markPrice, _ = strconv.ParseFloat(priceData.Price.Price, 64)
-	exponent := priceData.Price.Expo
-	if exponent < 0 {
-		for i := int64(0); i < -int64(exponent); i++ {
-			markPrice /= 10
+
+	for _, pairId := range pairIds {
+		if _, found := prices[pairId]; !found {
+			continue
 		}
-	} else {
-		for i := int64(0); i < int64(exponent); i++ {
-			markPrice *= 10
+		pairFunding, err := db.GetAccruedPairFunding(supabaseClient, pairId)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+		if pairFunding != nil {
+			fundingIndexes[pairId] = pairFunding.CumulativeFundingIndex
 		}
 	}
 
-	// skip mark price evaluation, if limit order
-	if params.LimitPrice == "" && params.EntryPrice != "" {
-		var err error
-		entryPrice, err = strconv.ParseFloat(params.EntryPrice, 64)
+	for _, order := range orders {
+		if err := priceErrors[order.PairId]; err != nil {
+			positions = append(positions, PositionResponse{Order: order, Error: err.Error()})
+			continue
+		}
+		position, err := quotePosition(order, prices[order.PairId].Price.RoundUsd(), borrowIndex.CumulativeBorrowIndex, fundingIndexes[order.PairId], riskParams[order.PairId])
 		if err != nil {
-			return nil, utils.ErrInternal(fmt.Sprintf("invalid entry price: %v", err.Error()))
+			return nil, utils.ErrInternal(err.Error())
 		}
+		positions = append(positions, *position)
+	}
+	return positions, nil
+}
 
-		var slippage float64
-		if params.Slippage != "" {
-			slippage, err = strconv.ParseFloat(params.Slippage, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid slippage value: %w", err)
-			}
-		}
+// GetOrderEventsRequest lists the lifecycle of an order with the price, fee and collateral change of each step
+func GetOrderEventsRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetOrderEventsRequestParams) (interface{}, error) {
+	var params *GetOrderEventsRequestParams
 
-		var maxSlippage = 0.05 // 5% slippage threshold
-		if slippage != 0 {
-			maxSlippage = slippage
-		}
-		slippageThreshold := markPrice * maxSlippage
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetOrderEventsRequestParams{}
+	}
 
-		// Validate that the entryPrice is within acceptable slippage from the markPrice
-		if params.PositionType == "long" && (entryPrice-markPrice) > slippageThreshold {
-			return nil, fmt.Errorf("long position: entry price exceeds 5%% slippage from the mark price %v", markPrice)
-		} else if params.PositionType == "short" && (markPrice-entryPrice) > slippageThreshold {
-			return nil, fmt.Errorf("short position: entry price exceeds 5%% slippage from the mark price")
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
 		}
-
-		entryPrice = markPrice
-	} else {
-		entryPrice = markPrice
 	}
 
-	// limit price
-	if params.LimitPrice != "" && params.LimitPrice != "0" {
-		var err error
-		limitPrice, err = strconv.ParseFloat(params.LimitPrice, 64)
+	orderId := params.OrderId
+	if orderId == "" {
+		orderAndUser, err := resolveOrder(supabaseClient, "", params.UserId, params.ClientOrderId)
 		if err != nil {
-			return nil, utils.ErrInternal(fmt.Errorf("invalid limit price value: %w", err).Error())
+			return nil, err
 		}
-		markPrice = limitPrice
-	}
-	/////////////////////////
-	balance := userData.(*db.UserResponse).Balance
-	if balance < collateral {
-		return nil, utils.ErrInternal(fmt.Sprintf("user %v insufficent balance: expected >=%v, found %v", params.UserId, params.Collateral, balance))
+		orderId = orderAndUser.Order.ID
 	}
 
-	leverage, err := strconv.ParseFloat(params.Leverage, 64)
+	events, err := db.GetOrderEvents(supabaseClient, orderId)
 	if err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid leverage value: %v", err.Error()))
+		return nil, utils.ErrInternal(err.Error())
 	}
+	return events, nil
+}
 
-	openFee := collateral * leverage * dynamicLeverageFee(leverage)
-	effectiveCollateral := collateral - openFee
-	effectiveLeverage := leverage * (collateral / effectiveCollateral)
+// GetReduceOnlyOrdersRequest lists the reduce-only orders of an order, brackets included
+func GetReduceOnlyOrdersRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetReduceOnlyOrdersRequestParams) (interface{}, error) {
+	var params *GetReduceOnlyOrdersRequestParams
 
-	// Calculate liquidation price
-	switch params.PositionType {
-	case "long":
-		liqPrice = markPrice * (1 - (1 / effectiveLeverage))
-		maxProfitPrice = markPrice * (1 + 10/leverage)
-	case "short":
-		liqPrice = markPrice * (1 + (1 / effectiveLeverage))
-		maxProfitPrice = markPrice * (1 - 10/leverage)
-	default:
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid position type: %v", params.PositionType))
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetReduceOnlyOrdersRequestParams{}
 	}
 
-	if liqPrice <= 0 {
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid liquidation price calculated %v", liqPrice))
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
 	}
 
-	// if maxProfitPrice <= 0 {
-	// 	return nil, utils.ErrInternal(fmt.Sprintf("invalid max profit price calculated %v", maxProfitPrice))
-	// }
-
-	if params.PositionType == "long" && (markPrice <= liqPrice) {
-		return nil, fmt.Errorf("long position: entry price in under liquidation price")
-	} else if params.PositionType == "short" && (markPrice >= liqPrice) {
-		return nil, fmt.Errorf("short position: entry price in over liquidation price")
+	orders, err := db.GetReduceOnlyOrders(supabaseClient, params.OrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
 	}
+	return orders, nil
+}
 
-	// stop loss price
-	if params.StopLossPrice != "" && params.StopLossPrice != "0" {
-		var err error
-		stopLossPrice, err = strconv.ParseFloat(params.StopLossPrice, 64)
-		if err != nil {
-			return nil, utils.ErrInternal(fmt.Errorf("invalid stop loss price value: %w", err).Error())
-		}
-		switch params.PositionType {
-		case "long":
-			if liqPrice >= stopLossPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("stop loss %v price must exceed liquidation price: %v", params.PositionType, liqPrice))
-			}
-			if markPrice <= stopLossPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("stop loss %v price cannot exceed entry price: %v", params.PositionType, entryPrice))
-			}
-		case "short":
-			if liqPrice <= stopLossPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("stop loss %v price cannot exceed liquidation price: %v", params.PositionType, liqPrice))
-			}
-			if markPrice >= stopLossPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("stop loss %v price must exceed entry price: %v", params.PositionType, entryPrice))
-			}
-		default:
-			return nil, utils.ErrInternal(fmt.Sprintf("invalid position type: %s", params.PositionType))
-		}
+// GetOrderExitLevelsRequest lists the take profit and stop loss ladder of an order
+func GetOrderExitLevelsRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetOrderExitLevelsRequestParams) (interface{}, error) {
+	var params *GetOrderExitLevelsRequestParams
 
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetOrderExitLevelsRequestParams{}
 	}
-	fmt.Print("\n got here8")
 
-	if params.TakeProfitPrice != "" && params.TakeProfitPrice != "0" {
-
-		tpPrice_, err := strconv.ParseFloat(params.TakeProfitPrice, 64)
-		if err != nil {
-			return nil, utils.ErrInternal(fmt.Sprintf("invalid take profit price: %v", err.Error()))
-		}
-		tpPrice = tpPrice_
-		if tpPrice <= 0 {
-			return nil, utils.ErrInternal(utils.ErrInternal("invalid take profit price").Error())
-		}
-		tpPercent, err := strconv.ParseFloat(params.TakeProfitPercent, 64)
-		if err != nil {
-			return nil, utils.ErrInternal(fmt.Sprintf("invalid take profit price: %v", err.Error()))
-		}
-		tpCollateral = effectiveCollateral * tpPercent / 100
-		if params.PositionType == "long" {
-			// For long positions: Profit when tpPrice > entryPrice
-			if tpPrice <= entryPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price must exceed entry price %v", params.PositionType, entryPrice))
-			}
-			if tpPrice >= maxProfitPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price cannot exceed max price: %v", params.PositionType, maxProfitPrice))
-			}
-			if tpPrice <= markPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price must exceed entry price: %v", params.PositionType, markPrice))
-			}
-			tpValue = tpCollateral * effectiveLeverage * (1 + (tpPrice-markPrice)/markPrice)
-		} else if params.PositionType == "short" {
-			// For short positions: Profit when tpPrice < entryPrice
-			if tpPrice >= markPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price must exceed entry price %v", params.PositionType, entryPrice))
-			}
-			if tpPrice >= maxProfitPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price cannot exceed max price: %v", params.PositionType, maxProfitPrice))
-			}
-			if tpPrice <= markPrice {
-				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price must exceed entry price: %v", params.PositionType, markPrice))
-			}
-			tpValue = tpCollateral * leverage * (1 + (markPrice-tpPrice)/markPrice)
-		} else {
-			return nil, utils.ErrInternal("Invalid order type")
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
 		}
-
 	}
-	fmt.Print("\n got here7")
 
-	response, err := db.CreateOrder(
-		supabaseClient,
-		params.UserId,
-		params.PositionType,
-		params.Pair,
-		pairId,
-		leverage,
-		effectiveCollateral,
-		entryPrice,
-		liqPrice,
-		maxProfitPrice,
-		limitPrice,
-		stopLossPrice,
-		tpPrice,
-		tpValue,
-		tpCollateral,
-		openFee)
+	levels, err := db.GetOrderExitLevels(supabaseClient, params.OrderId)
 	if err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("db post response: %v", err.Error()))
+		return nil, utils.ErrInternal(err.Error())
 	}
-
-	LogCreateOrderResponse("Supabase create_order response", response.Order)
-	//LogBeforeCreateOrderResponse(params.UserId, params.Pair, pair, collateral, entryPrice, entryPrice, liqPrice, leverage, params.PositionType, "unsigned")
-
-	// still need to make the hash that the user will sign
-	// thinking of just taking the keccak256 of the string order_.id
-
-	// fmt.Printf("\n order id: %v", response.ID)
-	orderIdBytes := []byte(response.Order.ID)
-	orderIdHash := crypto.Keccak256(orderIdBytes)
-
-	return UnsignedOrderRequestResponse{
-		Order: response.Order,
-		Hash:  hex.EncodeToString(orderIdHash),
-	}, nil
+	return levels, nil
 }
 
-func SignedCreateOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedOrderRequestParams) (interface{}, error) {
-	var params *SignedOrderRequestParams
+func UnsignedCreateOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*CreateOrderRequestParams) (interface{}, error) {
+	var params *CreateOrderRequestParams
 
 	if len(parameters) > 0 {
 		params = parameters[0]
 	} else {
-		params = &SignedOrderRequestParams{}
+		params = &CreateOrderRequestParams{}
 	}
 
 	if r != nil {
 		if err := utils.ParseAndValidateParams(r, &params); err != nil {
-			utils.LogError("failed to parse params", err.Error())
-			return nil, utils.ErrInternal(err.Error())
+			return nil, utils.ErrInternal(fmt.Sprintf("failed to parse params: %s", err.Error()))
 		}
 	}
-
-	// the user
-	order, err := db.GetOrderById(supabaseClient, params.OrderId)
+	userData, err := user.GetUserByUserIdRequest(r, supabaseClient, &user.GetUserByUserIdRequestParams{
+		UserId: params.UserId,
+	})
 	if err != nil {
-		return nil, utils.ErrInternal(err.Error())
+		logrus.Error("GetUserByIdRequest error:", err.Error())
+		return nil, utils.ErrInternal(fmt.Sprintf("GetUserByIdRequest error: %v", err.Error()))
 	}
 
-	// fmt.Printf("\n order id: %v", response.ID)
-	// orderIdBytes := []byte(response.ID)
-	// orderIdHash := crypto.Keccak256(orderIdBytes)
-
-	// return UnsignedOrderRequestResponse{
-	// 	Order: *response,
-	// 	Hash:  hex.EncodeToString(orderIdHash),
-	// }, nil
-
-	// orderIdBytesTest := []byte("ae96c97c-4e0d-4b13-bae6-54efffc72859")
-	// orderIdHashTest := crypto.Keccak256(orderIdBytesTest)
-	// fmt.Printf("\n generated from input: %v", hex.EncodeToString(orderIdHashTest))
-	// fmt.Printf("\n generated from api:   %v", "8cebec0419712a2ed98cb3ddd8aec8e92cc71f1677af693cfb99732e287d5902")
-	// tempr, _ := hex.DecodeString("2fbf4a2ac97a29b60e3b56bc6392805e2a398ade1d9a31e1a80961347764a49f")
-	// temps, _ := hex.DecodeString("6a9c55b2242e00d371169cb650c89130eb58a81b352bd1146735ae7557488e48")
-	// tempv, _ := hex.DecodeString("00")
-	// signatureBytesTest := append(tempr, temps...)
-	// signatureBytesTest = append(signatureBytesTest, tempv...)
-	// if ok, err := utils.ValidateEvmEcdsaSignature(orderIdHashTest, signatureBytesTest, common.HexToAddress("0xaf73d6bc4017518f45106c4eeb896204b99fd0e9")); !ok || err != nil {
-	// 	if err != nil {
-	// 		utils.LogError("error validating signature", err.Error())
-	// 		return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-	// 	} else {
-	// 		utils.LogError("signature validation failed", "invaid signature")
-	// 		return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-	// 	}
-	// }
-	// fmt.Print("\n concluded test")
-
-	orderIdBytes := []byte(params.OrderId)
-	orderIdHash := crypto.Keccak256(orderIdBytes)
-
-	signatureV, err := strconv.ParseUint(params.V, 16, 64) // the value from raw metamask is messed up
-	if err != nil {
-		err_ := utils.ErrInternal(fmt.Sprintf("invalid v value: %v", err.Error()))
-		utils.ErrInternal(err.Error())
-		utils.LogError(err_.Message, err_.Details)
-		return nil, err_
+	// a retry with the same client order id and params returns the order of the first request
+	var clientOrderHash_ string
+	if params.ClientOrderId != "" {
+		if err := parseClientOrderId(params.ClientOrderId); err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+		if clientOrderHash_, err = clientOrderHash(params); err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+		existing, err := db.GetOrderByClientId(supabaseClient, params.UserId, params.ClientOrderId)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+		if existing != nil {
+			return existingOrderRequestResponse(existing, params.ClientOrderId, clientOrderHash_)
+		}
 	}
 
-	signatureR, err := hex.DecodeString(params.R)
+	quote, _, err := quoteOrder(supabaseClient, params)
 	if err != nil {
-		utils.LogError("invalid sig-s value", err.Error())
-		err_ := utils.ErrInternal(fmt.Sprintf("invalid sig-r value: %v", err.Error()))
-		utils.ErrInternal(err.Error())
-		utils.LogError(err_.Message, err_.Details)
-		return nil, err_
+		return nil, err
+	}
+
+	balance := userData.(*db.UserResponse).Balance
+	if balance.LessThan(quote.Collateral) {
+		return nil, utils.ErrInternal(fmt.Sprintf("user %v insufficent balance: expected >=%v, found %v", params.UserId, params.Collateral, balance))
 	}
 
-	signatureS, err := hex.DecodeString(params.S)
+	var response *db.UnsignedCreateOrderResponse
+	if params.ClientOrderId != "" {
+		// labeled in the creating rpc, a concurrent retry that committed first is returned as existing
+		response, err = db.CreateOrderWithClientId(
+			supabaseClient,
+			params.UserId,
+			params.PositionType,
+			params.Pair,
+			quote.PairId,
+			params.ClientOrderId,
+			clientOrderHash_,
+			quote.Leverage,
+			quote.EffectiveCollateral,
+			quote.EntryPrice,
+			quote.LiquidationPrice,
+			quote.MaxProfitPrice,
+			quote.LimitPrice,
+			quote.StopLossPrice,
+			quote.TakeProfitPrice,
+			quote.TakeProfitValue,
+			quote.TakeProfitCollateral,
+			quote.OpenFee)
+	} else {
+		response, err = db.CreateOrder(
+			supabaseClient,
+			params.UserId,
+			params.PositionType,
+			params.Pair,
+			quote.PairId,
+			quote.Leverage,
+			quote.EffectiveCollateral,
+			quote.EntryPrice,
+			quote.LiquidationPrice,
+			quote.MaxProfitPrice,
+			quote.LimitPrice,
+			quote.StopLossPrice,
+			quote.TakeProfitPrice,
+			quote.TakeProfitValue,
+			quote.TakeProfitCollateral,
+			quote.OpenFee)
+	}
 	if err != nil {
-		utils.LogError("invalid sig-s value", err.Error())
-		err_ := utils.ErrInternal(fmt.Sprintf("invalid sig-s value: %v", err.Error()))
-		utils.ErrInternal(err.Error())
-		utils.LogError(err_.Message, err_.Details)
-		return nil, err_
+		return nil, utils.ErrInternal(fmt.Sprintf("db post response: %v", err.Error()))
+	}
+	if response.Existing != nil {
+		return existingOrderRequestResponse(response.Existing, params.ClientOrderId, clientOrderHash_)
 	}
 
-	if signatureV >= 27 {
-		signatureV -= 27
+	if quote.EntryType != entry.Market {
+		order, err := db.SetOrderEntry(supabaseClient, response.Order.ID, quote.EntryType, quote.TriggerPrice)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("db post response: %v", err.Error()))
+		}
+		response.Order = *order
 	}
 
-	signatureBytes := append(signatureR, signatureS...)
-	signatureBytes = append(signatureBytes, byte(signatureV))
+	if !quote.TrailAmount.IsZero() || !quote.TrailPercent.IsZero() {
+		// the stop trails the price the position opens at, the limit price for limit orders
+		trailExtreme := quote.EntryPrice
+		if !quote.LimitPrice.IsZero() {
+			trailExtreme = quote.LimitPrice
+		}
+		order, err := db.SetOrderTrailingStop(supabaseClient, response.Order.ID, quote.TrailAmount, quote.TrailPercent, trailExtreme)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("db post response: %v", err.Error()))
+		}
+		response.Order = *order
+	}
 
-	utils.LogInfo("Signature details", utils.FormatKeyValueLogs([][2]string{
-		{"address", order.User.WalletAddress},
-		{"hash", hex.EncodeToString(orderIdHash)},
-		{"signature", hex.EncodeToString(signatureBytes)},
-		{"module", "signature-validation"},
-	}))
+	if quote.ExpiresAt != 0 {
+		order, err := db.SetOrderExpiry(supabaseClient, response.Order.ID, time.Unix(quote.ExpiresAt, 0))
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("db post response: %v", err.Error()))
+		}
+		response.Order = *order
+	}
+
+	var exitLevels []db.OrderExitLevelResponse
+	if len(quote.ExitLevels) > 0 {
+		kinds := make([]string, 0, len(quote.ExitLevels))
+		var levelPrices, levelPercents, levelCollaterals []decimal.Decimal
+		for _, level := range quote.ExitLevels {
+			kinds = append(kinds, level.Kind)
+			levelPrices = append(levelPrices, level.Price)
+			levelPercents = append(levelPercents, level.Percent)
+			levelCollaterals = append(levelCollaterals, level.Collateral)
+		}
+		levels, err := db.CreateOrderExitLevels(supabaseClient, response.Order.ID, kinds, levelPrices, levelPercents, levelCollaterals)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("db post response: %v", err.Error()))
+		}
+		exitLevels = *levels
+	}
 
-	if ok, err := utils.ValidateEvmEcdsaSignature(orderIdHash, signatureBytes, common.HexToAddress("0x"+order.User.WalletAddress)); !ok || err != nil {
+	// the bracket is signed with the order and opens when the limit fills
+	var reduceOnlyOrders []db.ReduceOnlyOrderResponse
+	if !quote.BracketTakeProfit.IsZero() || !quote.BracketStopLoss.IsZero() {
+		bracket, err := db.CreateBracketOrders(supabaseClient, response.Order.ID, quote.BracketTakeProfit, quote.BracketStopLoss)
 		if err != nil {
-			utils.LogError("error validating signature", err.Error())
-			// return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		} else {
-			utils.LogError("signature validation failed", "invaid signature")
-			// return nil, utils.ErrInternal("Signature validation failed: invalid signature")
+			return nil, utils.ErrInternal(fmt.Sprintf("db post response: %v", err.Error()))
 		}
+		reduceOnlyOrders = *bracket
 	}
 
-	orderResponse, err := db.SignOrder(supabaseClient, params.OrderId)
+	LogCreateOrderResponse("Supabase create_order response", response.Order)
+	//LogBeforeCreateOrderResponse(params.UserId, params.Pair, pair, collateral, entryPrice, entryPrice, liqPrice, leverage, params.PositionType, "unsigned")
+
+	// the typed data is built from the stored order so the signed request can rebuild it exactly
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
 	if err != nil {
-		err_ := utils.ErrInternal(err.Error())
-		utils.LogError(err_.Message, err_.Details)
-		return nil, err_
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(orderTypedData(response.Order, userData.(*db.UserResponse).Nonce, expiry))
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
 	}
 
-	return orderResponse.Order, nil
+	return UnsignedOrderRequestResponse{
+		Order:            response.Order,
+		ExitLevels:       exitLevels,
+		ReduceOnlyOrders: reduceOnlyOrders,
+		Hash:             hex.EncodeToString(typedDataHash),
+		TypedData:        typedData,
+	}, nil
 }
 
-func canModifyOrder(status string) error {
-	invalid := []string{"filled", "canceled", "closed", "liquidated", "stopped"}
-	for _, i := range invalid {
-		if status == i {
-			return fmt.Errorf("orders of status %v cannot be mutated", status)
-		}
+// existingOrderRequestResponse answers a retried create-order, the typed data is only returned while the order can still be signed
+// the same client order id with other params is a conflict
+func existingOrderRequestResponse(existing *db.OrderByClientIdResponse, clientOrderId, hash string) (interface{}, error) {
+	if existing.ClientOrderHash != hash {
+		return nil, utils.ErrConflict(fmt.Sprintf("client order id %v is already used by order %v with other params", clientOrderId, existing.Order.ID))
 	}
-	return nil
-}
 
-func canCancelOrder(status string) error {
-	invalid := []string{"pending", "filled", "canceled", "closed", "liquidated", "stopped"}
-	for _, i := range invalid {
-		if status == i {
-			return fmt.Errorf("orders of status %v cannot be mutated", status)
-		}
+	response := UnsignedOrderRequestResponse{Order: existing.Order}
+	if existing.Order.OrderStatus != orderstate.Unsigned || existing.ExpiryTime == "" {
+		return response, nil
 	}
-	return nil
-}
 
-func canCloseOrder(status string) error {
-	invalid := []string{"unsigned", "filled", "canceled", "closed", "liquidated", "limit", "stopped"}
-	for _, i := range invalid {
-		if status == i {
-			return fmt.Errorf("orders of status %v cannot be mutated", status)
-		}
+	expiry, err := utils.ParseExpiryTime(existing.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(orderTypedData(existing.Order, existing.User.Nonce, expiry))
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
 	}
-	return nil
+	response.Hash = hex.EncodeToString(typedDataHash)
+	response.TypedData = typedData
+	return response, nil
 }
 
-func UnsignedCloseOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*UnsignedCloseOrderRequestParams) (interface{}, error) {
-	var params *UnsignedCloseOrderRequestParams
+// QuoteOrderRequest dry runs create-order, only the global utilization and the borrow rate are read and nothing is written
+func QuoteOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*CreateOrderRequestParams) (interface{}, error) {
+	var params *CreateOrderRequestParams
 
 	if len(parameters) > 0 {
 		params = parameters[0]
 	} else {
-		params = &UnsignedCloseOrderRequestParams{}
+		params = &CreateOrderRequestParams{}
 	}
 
 	if r != nil {
 		if err := utils.ParseAndValidateParams(r, &params); err != nil {
-			utils.LogError("failed to parse params", err.Error())
-			return nil, utils.ErrInternal(err.Error())
+			return nil, utils.ErrInternal(fmt.Sprintf("failed to parse params: %s", err.Error()))
 		}
 	}
 
-	if response, err := db.GetOrderById(supabaseClient, params.OrderId); err != nil {
+	quote, riskParams, err := quoteOrder(supabaseClient, params)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.GetGlobalStateMetrics(supabaseClient, []string{"current_borrowed", "current_liquidity"})
+	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
-	} else {
-		if err := canCloseOrder(response.Order.OrderStatus); err != nil {
-			return nil, utils.ErrInternal(err.Error())
-		}
 	}
 
-	response, err := db.CloseOrder(supabaseClient, params.OrderId)
+	var globalBorrowed, globalLiquidity decimal.Decimal
+	for _, metric := range *result {
+		switch metric.Key {
+		case "current_borrowed":
+			globalBorrowed = metric.Value
+		case "current_liquidity":
+			globalLiquidity = metric.Value
+		}
+	}
+	borrowIndex, err := db.GetBorrowIndex(supabaseClient)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	return response, nil
+	globalBorrowed = globalBorrowed.Add(quote.EffectiveCollateral.Mul(quote.Leverage.Sub(decimal.One)))
+	quote.HourlyUtilizationFee = hourlyUtilizationFee(quote.EffectiveCollateral.Mul(quote.Leverage), globalBorrowed, globalLiquidity, borrowIndex.BaseBorrowRate, riskParams)
+
+	return quote, nil
 }
 
-func SignedCloseOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedCloseOrderRequestParams) (interface{}, error) {
-	var params *SignedCloseOrderRequestParams
-	var markPrice, collateral, payoutValue float64
+func SignedCreateOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedOrderRequestParams) (interface{}, error) {
+	var params *SignedOrderRequestParams
 
 	if len(parameters) > 0 {
 		params = parameters[0]
 	} else {
-		params = &SignedCloseOrderRequestParams{}
+		params = &SignedOrderRequestParams{}
 	}
 
 	if r != nil {
@@ -518,94 +556,1102 @@ func SignedCloseOrderRequest(r *http.Request, supabaseClient *supabase.Client, p
 		}
 	}
 
-	// need to fetch the order
-	response, err := db.GetOrderById(supabaseClient, params.OrderId)
+	// the user
+	order, err := db.GetOrderById(supabaseClient, params.OrderId)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-
-	order_ := response.Order
-	// user_ := response.User
-
-	if err := canCloseOrder(order_.OrderStatus); err != nil {
+	if err := orderstate.Allows(order.Order.OrderStatus, orderstate.Sign, orderstate.User); err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
 
-	priceData, err := utils.GetCurrentPriceData(order_.PairId)
+	nonce, err := parseNonce(params.Nonce)
 	if err != nil {
-		return nil, utils.ErrInternal(err.Error())
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, "", params.OrderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(order.User, orderTypedData(order.Order, nonce, expiry), params.R, params.S, params.V); err != nil {
+		return nil, err
 	}
-	markPrice, _ = strconv.ParseFloat(priceData.Price.Price, 64)
-	exponent := priceData.Price.Expo
 
-	if exponent < 0 {
-		for i := int64(0); i < -int64(exponent); i++ {
-			markPrice /= 10
-		}
+	orderResponse, err := db.SignOrder(supabaseClient, params.OrderId, nonce)
+	if err != nil {
+		err_ := verify.ActionError(err)
+		utils.LogError(err_.Message, err_.Details)
+		return nil, err_
+	}
+
+	return orderResponse.Order, nil
+}
+
+func UnsignedModifyOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*UnsignedModifyOrderRequestParams) (interface{}, error) {
+	var params *UnsignedModifyOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &UnsignedModifyOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	orderAndUser, err := db.GetOrderById(supabaseClient, params.OrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	order_ := orderAndUser.Order
+	if err := orderstate.Allows(order_.OrderStatus, orderstate.Modify, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	// side, pair, leverage and collateral are immutable here
+	limitPrice, stopLossPrice := order_.LimitPrice, order_.StopLossPrice
+	tpPrice, tpValue, tpCollateral := order_.TakeProfitPrice, order_.TakeProfitValue, order_.TakeProfitCollateral
+	isTriggered := order_.OrderStatus != orderstate.Unsigned && order_.OrderStatus != orderstate.Limit
+
+	if params.LimitPrice != "" {
+		if isTriggered {
+			return nil, utils.ErrInternal(fmt.Sprintf("limit price cannot be modified for orders of status %v", order_.OrderStatus))
+		}
+		limitPrice, err = decimal.NewFromString(params.LimitPrice)
+		if err != nil || !limitPrice.IsPositive() {
+			return nil, utils.ErrInternal(fmt.Sprintf("invalid limit price value: %v", params.LimitPrice))
+		}
+		limitPrice = limitPrice.RoundUsd()
+
+		// an armed stop limit rests like a plain limit
+		entryType := order_.EntryType
+		if entryType == entry.StopLimit && !order_.TriggeredAt.IsZero() {
+			entryType = entry.Limit
+		}
+		livePrice, err := getMarkPrice(order_.PairId)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+		if err := entry.Validate(entryType, order_.OrderType, limitPrice, order_.TriggerPrice, livePrice); err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+	}
+
+	// liquidation and max profit are derived from the price the position opens (or opened) at
+	entryPrice := order_.EntryPrice
+	if !isTriggered && !limitPrice.IsZero() {
+		entryPrice = limitPrice
+	}
+	riskParams, err := risk.GetPairParams(supabaseClient, order_.PairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	prices, err := calculateOrderPrices(order_.OrderType, entryPrice, order_.Leverage, order_.Collateral.Add(order_.OpenFee), riskParams)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	// a live position is validated against the current price instead of the entry
+	markPrice := entryPrice
+	if isTriggered && (params.StopLossPrice != "" || params.TakeProfitPrice != "" || params.TakeProfitPercent != "") {
+		markPrice, err = getMarkPrice(order_.PairId)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	if params.StopLossPrice != "" {
+		stopLossPrice, err = decimal.NewFromString(params.StopLossPrice)
+		if err != nil {
+			return nil, utils.ErrInternal(fmt.Sprintf("invalid stop loss price value: %v", err.Error()))
+		}
+		stopLossPrice = stopLossPrice.RoundUsd()
+		if !stopLossPrice.IsZero() && !order_.TrailExtreme.IsZero() {
+			return nil, utils.ErrMalformedRequest("the stop of a trailing stop order can only be removed, with stop-price=0")
+		}
+		if !stopLossPrice.IsZero() {
+			if err := validateStopLoss(order_.OrderType, stopLossPrice, markPrice, prices); err != nil {
+				return nil, utils.ErrInternal(err.Error())
+			}
+		}
+	}
+
+	if params.TakeProfitPrice != "" || params.TakeProfitPercent != "" {
+		if !order_.TakeProfitAt.IsZero() {
+			return nil, utils.ErrInternal(fmt.Sprintf("take profit was already taken at %v", order_.TakeProfitAt))
+		}
+		if params.TakeProfitPrice != "" {
+			tpPrice, err = decimal.NewFromString(params.TakeProfitPrice)
+			if err != nil {
+				return nil, utils.ErrInternal(fmt.Sprintf("invalid take profit price: %v", err.Error()))
+			}
+			tpPrice = tpPrice.RoundUsd()
+		}
+
+		if tpPrice.IsZero() {
+			tpValue, tpCollateral = decimal.Zero, decimal.Zero
+		} else {
+			var tpPercent decimal.Decimal
+			if params.TakeProfitPercent != "" {
+				tpPercent, err = decimal.NewFromString(params.TakeProfitPercent)
+				if err != nil {
+					return nil, utils.ErrInternal(fmt.Sprintf("invalid take profit percent: %v", err.Error()))
+				}
+			} else if !order_.Collateral.IsZero() {
+				tpPercent = order_.TakeProfitCollateral.Mul(hundred).Div(order_.Collateral)
+			}
+
+			tpValue, tpCollateral, err = calculateTakeProfit(order_.OrderType, tpPrice, tpPercent, entryPrice, order_.Leverage, prices)
+			if err != nil {
+				return nil, utils.ErrInternal(err.Error())
+			}
+			if order_.OrderType == "long" && tpPrice.LessThanOrEqual(markPrice) {
+				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price must exceed mark price: %v", order_.OrderType, markPrice))
+			} else if order_.OrderType == "short" && tpPrice.GreaterThanOrEqual(markPrice) {
+				return nil, utils.ErrInternal(fmt.Sprintf("take profit %v price must be under mark price: %v", order_.OrderType, markPrice))
+			}
+		}
+	}
+
+	response, err := db.UnsignedModifyOrder(
+		supabaseClient,
+		order_.ID,
+		limitPrice,
+		stopLossPrice,
+		prices.LiquidationPrice,
+		prices.MaxProfitPrice,
+		tpPrice,
+		tpValue,
+		tpCollateral)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	// the typed data is built from the stored modification so the signed request can rebuild it exactly
+	modification, err := db.GetOrderModificationById(supabaseClient, response.ModificationId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(modifyOrderTypedData(*modification, orderAndUser.User.Nonce, expiry))
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedModifyOrderRequestResponse{
+		UnsignedModifyOrderResponse: *response,
+		Modification:                *modification,
+		Hash:                        hex.EncodeToString(typedDataHash),
+		TypedData:                   typedData,
+	}, nil
+}
+
+func SignedModifyOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedModifyOrderRequestParams) (interface{}, error) {
+	var params *SignedModifyOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &SignedModifyOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	modification, err := db.GetOrderModificationById(supabaseClient, params.ModificationId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	orderAndUser, err := db.GetOrderById(supabaseClient, modification.OrderID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	if err := orderstate.Allows(orderAndUser.Order.OrderStatus, orderstate.Modify, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.ModificationId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(orderAndUser.User, modifyOrderTypedData(*modification, nonce, expiry), params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	modifyResponse, err := db.SignModifyOrder(supabaseClient, params.ModificationId, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !modifyResponse.IsValid {
+		utils.LogError("sign modify order error", modifyResponse.ErrorMessage)
+		return nil, utils.ErrInternal(modifyResponse.ErrorMessage)
+	}
+	return modifyResponse, nil
+}
+
+// UnsignedMarginRequest adds or removes collateral on a pending position, the size is kept so the leverage and liquidation price move
+func UnsignedMarginRequest(r *http.Request, supabaseClient *supabase.Client, action string, parameters ...*UnsignedMarginRequestParams) (interface{}, error) {
+	var params *UnsignedMarginRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &UnsignedMarginRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	amount, err := decimal.NewFromString(params.Amount)
+	if err != nil || !amount.IsPositive() {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid amount value: %v", params.Amount))
+	}
+	amount = amount.RoundUsd()
+
+	orderAndUser, err := db.GetOrderById(supabaseClient, params.OrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	order_ := orderAndUser.Order
+	if err := orderstate.Allows(order_.OrderStatus, orderstate.Margin, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	delta := amount
+	switch action {
+	case addMarginAction:
+		if orderAndUser.User.Balance.LessThan(amount) {
+			return nil, utils.ErrInternal(fmt.Sprintf("insufficient balance to add margin: required %v, available %v", amount, orderAndUser.User.Balance))
+		}
+	case removeMarginAction:
+		delta = amount.Neg()
+	default:
+		return nil, utils.ErrInternal(fmt.Sprintf("unexpected margin action: %v", action))
+	}
+
+	riskParams, err := risk.GetPairParams(supabaseClient, order_.PairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	change, err := calculateMarginChange(order_, delta, riskParams)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	if change.Leverage.GreaterThan(riskParams.MaxLeverage) {
+		return nil, utils.ErrInternal(fmt.Sprintf("leverage %v after removing margin exceeds the pair max leverage %v", change.Leverage, riskParams.MaxLeverage))
+	}
+
+	if action == removeMarginAction {
+		markPrice, err := getMarkPrice(order_.PairId)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+		if err := validateMarginRemoval(order_, change, markPrice); err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	response, err := db.UnsignedMarginOrder(
+		supabaseClient,
+		order_.ID,
+		change.Collateral,
+		change.Leverage,
+		change.LiquidationPrice,
+		change.MaxProfitPrice,
+		change.TakeProfitValue,
+		change.TakeProfitCollateral)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	modification, err := db.GetOrderModificationById(supabaseClient, response.ModificationId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(marginTypedData(order_, *modification, action, orderAndUser.User.Nonce, expiry))
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedMarginRequestResponse{
+		UnsignedModifyOrderResponse: *response,
+		Modification:                *modification,
+		Hash:                        hex.EncodeToString(typedDataHash),
+		TypedData:                   typedData,
+	}, nil
+}
+
+func SignedMarginRequest(r *http.Request, supabaseClient *supabase.Client, action string, parameters ...*SignedModifyOrderRequestParams) (interface{}, error) {
+	var params *SignedModifyOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &SignedModifyOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	modification, err := db.GetOrderModificationById(supabaseClient, params.ModificationId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	orderAndUser, err := db.GetOrderById(supabaseClient, modification.OrderID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	order_ := orderAndUser.Order
+	if err := orderstate.Allows(order_.OrderStatus, orderstate.Margin, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	// the amount is signed as an absolute value, the direction must match the requested action
+	if (action == addMarginAction) != modification.Collateral.GreaterThan(order_.Collateral) {
+		return nil, utils.ErrInternal(fmt.Sprintf("order modification %v is not a %v request", modification.ID, action))
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.ModificationId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(orderAndUser.User, marginTypedData(order_, *modification, action, nonce, expiry), params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	marginResponse, err := db.SignMarginOrder(supabaseClient, params.ModificationId, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !marginResponse.IsValid {
+		utils.LogError("sign margin order error", marginResponse.ErrorMessage)
+		return nil, utils.ErrInternal(marginResponse.ErrorMessage)
+	}
+	return marginResponse, nil
+}
+
+func UnsignedCloseOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*UnsignedCloseOrderRequestParams) (interface{}, error) {
+	var params *UnsignedCloseOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &UnsignedCloseOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	orderAndUser, err := db.GetOrderById(supabaseClient, params.OrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	if err := orderstate.Allows(orderAndUser.Order.OrderStatus, orderstate.Close, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	closePercent, err := resolveClosePercent(orderAndUser.Order, params.ClosePercent, params.CloseSize)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	response, err := db.CloseOrder(supabaseClient, params.OrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(utils.CloseOrderTypedData{
+		OrderId:      orderAndUser.Order.ID,
+		Pair:         orderAndUser.Order.Pair,
+		Side:         orderAndUser.Order.OrderType,
+		ClosePercent: closePercent,
+		Nonce:        orderAndUser.User.Nonce,
+		Expiry:       expiry,
+	})
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedCloseOrderRequestResponse{
+		UnsignedCloseOrderResponse: *response,
+		Hash:                       hex.EncodeToString(typedDataHash),
+		TypedData:                  typedData,
+	}, nil
+}
+
+func SignedCloseOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedCloseOrderRequestParams) (interface{}, error) {
+	var params *SignedCloseOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &SignedCloseOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	// need to fetch the order
+	response, err := db.GetOrderById(supabaseClient, params.OrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	order_ := response.Order
+	user_ := response.User
+
+	if err := orderstate.Allows(order_.OrderStatus, orderstate.Close, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	closePercent := hundred
+	if params.ClosePercent != "" {
+		closePercent, err = resolveClosePercent(order_, params.ClosePercent, "")
+		if err != nil {
+			return nil, utils.ErrMalformedRequest(err.Error())
+		}
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, order_.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(user_, utils.CloseOrderTypedData{
+		OrderId:      order_.ID,
+		Pair:         order_.Pair,
+		Side:         order_.OrderType,
+		ClosePercent: closePercent,
+		Nonce:        nonce,
+		Expiry:       expiry,
+	}, params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	markPrice, err := getMarkPrice(order_.PairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	riskParams, err := risk.GetPairParams(supabaseClient, order_.PairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	borrowIndex, err := db.AccrueBorrowIndex(supabaseClient)
+	if err != nil {
+		logrus.Error(err.Error())
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	pairFunding, err := db.AccruePairFunding(supabaseClient, order_.PairId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	markPrice = markPrice.RoundUsd()
+	quote, err := quoteClose(order_, closePercent, markPrice, borrowIndex.CumulativeBorrowIndex, pairFunding.CumulativeFundingIndex, riskParams)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	if closePercent.LessThan(hundred) {
+		// an open take profit shrinks with the position
+		remaining := hundred.Sub(closePercent).Div(hundred)
+		partialResponse, err := db.SignPartialCloseOrder(
+			supabaseClient,
+			params.OrderId,
+			params.SignatureId,
+			nonce,
+			quote.Collateral,
+			quote.Payout,
+			quote.CloseFee,
+			markPrice,
+			quote.CloseValue,
+			order_.TakeProfitValue.Mul(remaining).RoundUsd(),
+			order_.TakeProfitCollateral.Mul(remaining).RoundUsd(),
+			quote.FundingPaid)
+		if err != nil {
+			return nil, verify.ActionError(err)
+		}
+		if !partialResponse.IsValid {
+			return nil, utils.ErrInternal(partialResponse.ErrorMessage)
+		}
+		return partialResponse, nil
+	}
+
+	closeResponse, err := db.SignCloseOrder(supabaseClient, params.OrderId, params.SignatureId, nonce, quote.Collateral, quote.Payout, quote.CloseFee, markPrice, quote.FundingPaid)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !closeResponse.IsValid {
+		return nil, utils.ErrInternal(closeResponse.ErrorMessage)
+	}
+	return closeResponse, nil
+}
+
+func UnsignedCancelOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*UnsignedCancelOrderRequestParams) (interface{}, error) {
+	var params *UnsignedCancelOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &UnsignedCancelOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	orderAndUser, err := resolveOrder(supabaseClient, params.OrderId, params.UserId, params.ClientOrderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := orderstate.Allows(orderAndUser.Order.OrderStatus, orderstate.Cancel, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	response, err := db.CancelOrder(supabaseClient, orderAndUser.Order.ID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(utils.CancelOrderTypedData{
+		OrderId: orderAndUser.Order.ID,
+		Pair:    orderAndUser.Order.Pair,
+		Side:    orderAndUser.Order.OrderType,
+		Nonce:   orderAndUser.User.Nonce,
+		Expiry:  expiry,
+	})
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedCancelOrderRequestResponse{
+		UnsignedCancelOrderResponse: *response,
+		Hash:                        hex.EncodeToString(typedDataHash),
+		TypedData:                   typedData,
+	}, nil
+}
+
+func SignedCancelOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedCancelOrderRequestParams) (interface{}, error) {
+	var params *SignedCancelOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &SignedCancelOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	orderAndUser, err := resolveOrder(supabaseClient, params.OrderId, params.UserId, params.ClientOrderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := orderstate.Allows(orderAndUser.Order.OrderStatus, orderstate.Cancel, orderstate.User); err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, orderAndUser.Order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(orderAndUser.User, utils.CancelOrderTypedData{
+		OrderId: orderAndUser.Order.ID,
+		Pair:    orderAndUser.Order.Pair,
+		Side:    orderAndUser.Order.OrderType,
+		Nonce:   nonce,
+		Expiry:  expiry,
+	}, params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	cancelResponse, err := db.SignCancelOrder(supabaseClient, orderAndUser.Order.ID, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !cancelResponse.IsValid {
+		utils.LogError("sign cancel order error", cancelResponse.ErrorMessage)
+		return nil, utils.ErrInternal(cancelResponse.ErrorMessage)
+	}
+	return cancelResponse, nil
+}
+
+// UnsignedReduceOnlyOrderRequest adds a reduce-only close order to a limit or pending order
+// it only closes part or all of its order, so it can never open, increase or flip a position
+func UnsignedReduceOnlyOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*UnsignedReduceOnlyOrderRequestParams) (interface{}, error) {
+	var params *UnsignedReduceOnlyOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &UnsignedReduceOnlyOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	orderAndUser, err := db.GetOrderById(supabaseClient, params.OrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	order_ := orderAndUser.Order
+	if order_.OrderStatus != orderstate.Limit && order_.OrderStatus != orderstate.Pending {
+		return nil, utils.ErrInternal(fmt.Sprintf("reduce-only orders need a limit or pending order, found %v", order_.OrderStatus))
+	}
+
+	closePercent := hundred
+	if params.ClosePercent != "" {
+		closePercent, err = decimal.NewFromString(params.ClosePercent)
+		if err != nil || !closePercent.IsPositive() || closePercent.GreaterThan(hundred) {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid close percent: expected 0 < value <= 100, found %v", params.ClosePercent))
+		}
+		closePercent = closePercent.Round(4)
+	}
+
+	// a limit order is checked from its limit price, a live position from the current price
+	markPrice := order_.LimitPrice
+	if order_.OrderStatus == orderstate.Pending {
+		markPrice, err = getMarkPrice(order_.PairId)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+	prices := &orderPrices{LiquidationPrice: order_.LiquidationPrice, MaxProfitPrice: order_.MaxPrice}
+	triggerPrice, err := parseTrigger(params.Kind, order_.OrderType, params.TriggerPrice, markPrice, prices)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	response, err := db.UnsignedReduceOnlyOrder(supabaseClient, order_.ID, params.Kind, triggerPrice, closePercent, params.OcoWith)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(reduceOnlyOrderTypedData(response.ReduceOnlyOrder, orderAndUser.User.Nonce, expiry))
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedReduceOnlyOrderRequestResponse{
+		UnsignedReduceOnlyOrderResponse: *response,
+		Hash:                            hex.EncodeToString(typedDataHash),
+		TypedData:                       typedData,
+	}, nil
+}
+
+func SignedReduceOnlyOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedReduceOnlyOrderRequestParams) (interface{}, error) {
+	var params *SignedReduceOnlyOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &SignedReduceOnlyOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	reduceOnlyOrder, err := db.GetReduceOnlyOrderById(supabaseClient, params.ReduceOnlyOrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	orderAndUser, err := db.GetOrderById(supabaseClient, reduceOnlyOrder.ParentID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.ReduceOnlyOrderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(orderAndUser.User, reduceOnlyOrderTypedData(*reduceOnlyOrder, nonce, expiry), params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	signResponse, err := db.SignReduceOnlyOrder(supabaseClient, params.ReduceOnlyOrderId, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !signResponse.IsValid {
+		utils.LogError("sign reduce-only order error", signResponse.ErrorMessage)
+		return nil, utils.ErrInternal(signResponse.ErrorMessage)
+	}
+	return signResponse, nil
+}
+
+// UnsignedCancelReduceOnlyOrderRequest follows cancel-order, the typed data is a CancelOrder of the reduce-only order id
+func UnsignedCancelReduceOnlyOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*UnsignedCancelReduceOnlyOrderRequestParams) (interface{}, error) {
+	var params *UnsignedCancelReduceOnlyOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &UnsignedCancelReduceOnlyOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	reduceOnlyOrder, err := db.GetReduceOnlyOrderById(supabaseClient, params.ReduceOnlyOrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	orderAndUser, err := db.GetOrderById(supabaseClient, reduceOnlyOrder.ParentID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	response, err := db.CancelReduceOnlyOrder(supabaseClient, params.ReduceOnlyOrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(utils.CancelOrderTypedData{
+		OrderId: reduceOnlyOrder.ID,
+		Pair:    orderAndUser.Order.Pair,
+		Side:    orderAndUser.Order.OrderType,
+		Nonce:   orderAndUser.User.Nonce,
+		Expiry:  expiry,
+	})
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedCancelOrderRequestResponse{
+		UnsignedCancelOrderResponse: *response,
+		Hash:                        hex.EncodeToString(typedDataHash),
+		TypedData:                   typedData,
+	}, nil
+}
+
+func SignedCancelReduceOnlyOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedReduceOnlyOrderRequestParams) (interface{}, error) {
+	var params *SignedReduceOnlyOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
 	} else {
-		for i := int64(0); i < int64(exponent); i++ {
-			markPrice *= 10
+		params = &SignedReduceOnlyOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
 		}
 	}
 
-	result, err := db.GetGlobalStateMetrics(supabaseClient, []string{"current_borrowed", "current_liquidity"})
+	reduceOnlyOrder, err := db.GetReduceOnlyOrderById(supabaseClient, params.ReduceOnlyOrderId)
 	if err != nil {
-		logrus.Error(err.Error())
 		return nil, utils.ErrInternal(err.Error())
 	}
-	if result == nil || len(*result) != 2 {
-		return nil, fmt.Errorf("unexpected response from GetGlobalStateMetrics: %v", err)
+	orderAndUser, err := db.GetOrderById(supabaseClient, reduceOnlyOrder.ParentID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
 	}
 
-	var globalBorrowed, globalLiquidity float64
-	for _, metric := range *result {
-		switch metric.Key {
-		case "current_borrowed":
-			globalBorrowed = metric.Value
-		case "current_liquidity":
-			globalLiquidity = metric.Value
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.ReduceOnlyOrderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(orderAndUser.User, utils.CancelOrderTypedData{
+		OrderId: reduceOnlyOrder.ID,
+		Pair:    orderAndUser.Order.Pair,
+		Side:    orderAndUser.Order.OrderType,
+		Nonce:   nonce,
+		Expiry:  expiry,
+	}, params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	cancelResponse, err := db.SignCancelReduceOnlyOrder(supabaseClient, params.ReduceOnlyOrderId, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !cancelResponse.IsValid {
+		utils.LogError("sign cancel reduce-only order error", cancelResponse.ErrorMessage)
+		return nil, utils.ErrInternal(cancelResponse.ErrorMessage)
+	}
+	return cancelResponse, nil
+}
+
+// UnsignedAlgoOrderRequest plans a twap or scale order, the user signs it once for all of its slices
+// the rebalancer places each slice once it is due, twap slices as market entries at the mark price of that cycle and
+// scale slices as limit orders at their price, see db/orders/algo_orders.sql
+func UnsignedAlgoOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*CreateAlgoOrderRequestParams) (interface{}, error) {
+	var params *CreateAlgoOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &CreateAlgoOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	user_, err := db.GetUserByUserId(supabaseClient, params.UserId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	quote, err := quoteAlgoOrder(supabaseClient, params)
+	if err != nil {
+		return nil, err
+	}
+	if user_.Balance.LessThan(quote.Collateral) {
+		return nil, utils.ErrInternal(fmt.Sprintf("user %v insufficent balance: expected >=%v, found %v", params.UserId, quote.Collateral, user_.Balance))
+	}
+
+	response, err := db.UnsignedAlgoOrder(
+		supabaseClient,
+		params.UserId,
+		params.Kind,
+		params.PositionType,
+		params.Pair,
+		quote.PairId,
+		quote.Leverage,
+		quote.IntervalSeconds,
+		quote.PriceFrom,
+		quote.PriceTo,
+		quote.LiqDistance,
+		quote.MaxDistance,
+		quote.Collaterals,
+		quote.OpenFees,
+		quote.LimitPrices)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(algoOrderTypedData(response.AlgoOrder, user_.Nonce, expiry))
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedAlgoOrderRequestResponse{
+		UnsignedAlgoOrderResponse: *response,
+		Hash:                      hex.EncodeToString(typedDataHash),
+		TypedData:                 typedData,
+	}, nil
+}
+
+func SignedAlgoOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedAlgoOrderRequestParams) (interface{}, error) {
+	var params *SignedAlgoOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &SignedAlgoOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
 		}
 	}
 
-	if order_.TakeProfitValue == 0 {
-		collateral = order_.Collateral - order_.TakeProfitCollateral
+	algoOrder, err := db.GetAlgoOrder(supabaseClient, params.AlgoOrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	user_, err := db.GetUserByUserId(supabaseClient, algoOrder.AlgoOrder.UserID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.AlgoOrderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(*user_, algoOrderTypedData(algoOrder.AlgoOrder, nonce, expiry), params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	signResponse, err := db.SignAlgoOrder(supabaseClient, params.AlgoOrderId, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !signResponse.IsValid {
+		utils.LogError("sign algo order error", signResponse.ErrorMessage)
+		return nil, utils.ErrInternal(signResponse.ErrorMessage)
+	}
+	return signResponse, nil
+}
+
+// UnsignedCancelAlgoOrderRequest follows cancel-order, the typed data is a CancelOrder of the algo order id
+// slices already filled stay open and are closed like any other order
+func UnsignedCancelAlgoOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*AlgoOrderRequestParams) (interface{}, error) {
+	var params *AlgoOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
 	} else {
-		collateral = order_.Collateral
+		params = &AlgoOrderRequestParams{}
 	}
 
-	// need to calculate the v
-	switch order_.OrderType {
-	case "long":
-		payoutValue = collateral * order_.Leverage * (1 + (markPrice-order_.EntryPrice)/order_.EntryPrice)
-	case "short":
-		payoutValue = collateral * order_.Leverage * (1 + (order_.EntryPrice-markPrice)/order_.EntryPrice)
-	default:
-		return nil, utils.ErrInternal(fmt.Sprintf("unexpected order type: %v", order_.OrderType))
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
 	}
 
-	closeFee := payoutValue * (dynamicLeverageFee(order_.Leverage) + dynamicUtilizationFee(order_.StartedAt, globalBorrowed, globalLiquidity))
-	payoutValue = payoutValue - closeFee - collateral*(order_.Leverage-1)
-	if payoutValue < 0 {
-		payoutValue = 0
+	algoOrder, err := db.GetAlgoOrder(supabaseClient, params.AlgoOrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	user_, err := db.GetUserByUserId(supabaseClient, algoOrder.AlgoOrder.UserID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
 	}
 
-	closeResponse, err := db.SignCloseOrder(supabaseClient, params.OrderId, params.SignatureId, collateral, payoutValue, closeFee, markPrice)
+	response, err := db.CancelAlgoOrder(supabaseClient, params.AlgoOrderId)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	if !closeResponse.IsValid {
-		return nil, utils.ErrInternal(closeResponse.ErrorMessage)
+
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
 	}
-	return closeResponse, nil
+	typedData := utils.NewTypedData(utils.CancelOrderTypedData{
+		OrderId: algoOrder.AlgoOrder.ID,
+		Pair:    algoOrder.AlgoOrder.Pair,
+		Side:    algoOrder.AlgoOrder.OrderType,
+		Nonce:   user_.Nonce,
+		Expiry:  expiry,
+	})
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedCancelOrderRequestResponse{
+		UnsignedCancelOrderResponse: *response,
+		Hash:                        hex.EncodeToString(typedDataHash),
+		TypedData:                   typedData,
+	}, nil
 }
 
-func UnsignedCancelOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*UnsignedCancelOrderRequestParams) (interface{}, error) {
-	var params *UnsignedCancelOrderRequestParams
+func SignedCancelAlgoOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedAlgoOrderRequestParams) (interface{}, error) {
+	var params *SignedAlgoOrderRequestParams
 
 	if len(parameters) > 0 {
 		params = parameters[0]
 	} else {
-		params = &UnsignedCancelOrderRequestParams{}
+		params = &SignedAlgoOrderRequestParams{}
 	}
 
 	if r != nil {
@@ -615,28 +1661,75 @@ func UnsignedCancelOrderRequest(r *http.Request, supabaseClient *supabase.Client
 		}
 	}
 
-	if response, err := db.GetOrderById(supabaseClient, params.OrderId); err != nil {
+	algoOrder, err := db.GetAlgoOrder(supabaseClient, params.AlgoOrderId)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	user_, err := db.GetUserByUserId(supabaseClient, algoOrder.AlgoOrder.UserID)
+	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.AlgoOrderId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserAction(*user_, utils.CancelOrderTypedData{
+		OrderId: algoOrder.AlgoOrder.ID,
+		Pair:    algoOrder.AlgoOrder.Pair,
+		Side:    algoOrder.AlgoOrder.OrderType,
+		Nonce:   nonce,
+		Expiry:  expiry,
+	}, params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	cancelResponse, err := db.SignCancelAlgoOrder(supabaseClient, params.AlgoOrderId, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !cancelResponse.IsValid {
+		utils.LogError("sign cancel algo order error", cancelResponse.ErrorMessage)
+		return nil, utils.ErrInternal(cancelResponse.ErrorMessage)
+	}
+	return cancelResponse, nil
+}
+
+// GetAlgoOrderRequest returns an algo order with its slices and how much of it filled
+func GetAlgoOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*AlgoOrderRequestParams) (interface{}, error) {
+	var params *AlgoOrderRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
 	} else {
-		if err := canCancelOrder(response.Order.OrderStatus); err != nil {
+		params = &AlgoOrderRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
 			return nil, utils.ErrInternal(err.Error())
 		}
 	}
 
-	response, err := db.CancelOrder(supabaseClient, params.OrderId)
+	algoOrder, err := db.GetAlgoOrder(supabaseClient, params.AlgoOrderId)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	return response, nil
+	return algoOrder, nil
 }
 
-func SignedCancelOrderRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedCancelOrderRequestParams) (interface{}, error) {
-	var params *SignedCancelOrderRequestParams
+func GetAlgoOrdersRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetAlgoOrdersRequestParams) (interface{}, error) {
+	var params *GetAlgoOrdersRequestParams
 
 	if len(parameters) > 0 {
 		params = parameters[0]
 	} else {
-		params = &SignedCancelOrderRequestParams{}
+		params = &GetAlgoOrdersRequestParams{}
 	}
 
 	if r != nil {
@@ -646,61 +1739,190 @@ func SignedCancelOrderRequest(r *http.Request, supabaseClient *supabase.Client,
 		}
 	}
 
-	signatureV, err := strconv.ParseUint(params.V, 16, 64) // the value from raw metamask is messed up
+	algoOrders, err := db.GetAlgoOrders(supabaseClient, params.UserId)
 	if err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid v value: %v", err.Error()))
+		return nil, utils.ErrInternal(err.Error())
+	}
+	return algoOrders, nil
+}
+
+// UnsignedCreateOrdersBatchRequest creates up to maxBatchOrders orders signed with a single signature
+// every order is quoted against one snapshot per pair, an order that fails is reported and the others are created
+func UnsignedCreateOrdersBatchRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*CreateOrdersBatchRequestParams) (interface{}, error) {
+	var params *CreateOrdersBatchRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &CreateOrdersBatchRequestParams{}
 	}
 
-	signatureR, err := hex.DecodeString(params.R)
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	orders, err := parseBatchOrders(params.Orders)
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	user_, err := db.GetUserByUserId(supabaseClient, params.UserId)
 	if err != nil {
-		utils.LogError("invalid sig-s value", err.Error())
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid sig-r value: %v", err.Error()))
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	snapshots := make(map[string]*pairSnapshot)
+	var results []db.OrderBatchItemResponse
+	var batch []db.BatchOrder
+	balance := user_.Balance
+	for index := range orders {
+		quote, err := quoteBatchOrder(supabaseClient, &orders[index], snapshots, balance)
+		if err != nil {
+			index := index
+			results = append(results, db.OrderBatchItemResponse{Index: &index, Error: err.Error()})
+			continue
+		}
+		balance = balance.Sub(quote.Collateral)
+		order := batchOrder(index, quote)
+		if orders[index].ClientOrderId != "" {
+			order.ClientOrderId = orders[index].ClientOrderId
+			if order.ClientOrderHash, err = clientOrderHash(&orders[index]); err != nil {
+				return nil, utils.ErrInternal(err.Error())
+			}
+		}
+		batch = append(batch, order)
 	}
 
-	signatureS, err := hex.DecodeString(params.S)
+	response := &db.UnsignedOrderBatchResponse{}
+	if len(batch) > 0 {
+		response, err = db.CreateOrdersBatch(supabaseClient, params.UserId, batch)
+		if err != nil {
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+	response.Results = append(response.Results, results...)
+	sort.Slice(response.Results, func(i, j int) bool { return *response.Results[i].Index < *response.Results[j].Index })
+
+	return orderBatchRequestResponse(response, user_.Nonce)
+}
+
+// UnsignedCancelOrdersBatchRequest cancels unsigned and limit orders of the user with a single signature
+func UnsignedCancelOrdersBatchRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*CancelOrdersBatchRequestParams) (interface{}, error) {
+	var params *CancelOrdersBatchRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &CancelOrdersBatchRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	orderIds := strings.Split(params.OrderIds, ",")
+	if len(orderIds) > maxBatchOrders {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid order-ids: expected 1 to %v orders, found %v", maxBatchOrders, len(orderIds)))
+	}
+	for i, orderId := range orderIds {
+		orderId = strings.TrimSpace(orderId)
+		if _, err := uuid.Parse(orderId); err != nil {
+			return nil, utils.ErrMalformedRequest(fmt.Sprintf("invalid order id %v: %v", orderId, err.Error()))
+		}
+		orderIds[i] = orderId
+	}
+
+	user_, err := db.GetUserByUserId(supabaseClient, params.UserId)
 	if err != nil {
-		utils.LogError("invalid sig-s value", err.Error())
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid sig-s value: %v", err.Error()))
+		return nil, utils.ErrInternal(err.Error())
 	}
 
-	if signatureV >= 27 {
-		signatureV -= 27
+	response, err := db.CancelOrdersBatch(supabaseClient, params.UserId, orderIds)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
 	}
 
-	signatureBytes := append(signatureR, signatureS...)
-	signatureBytes = append(signatureBytes, byte(signatureV))
+	return orderBatchRequestResponse(response, user_.Nonce)
+}
+
+// orderBatchRequestResponse adds the typed data of the batch, there is nothing to sign when every item failed
+func orderBatchRequestResponse(response *db.UnsignedOrderBatchResponse, nonce uint64) (interface{}, error) {
+	if response.Batch == nil {
+		return UnsignedOrderBatchRequestResponse{UnsignedOrderBatchResponse: *response}, nil
+	}
 
-	// given an order-id,
-	// if response, err := db.GetOrderById(supabaseClient, params.OrderId); err != nil {
-	// 	return nil, utils.ErrInternal(err.Error())
-	// } else {
-	// 	if err := canCancelOrder(response.Order.Status); err != nil {
-	// 		return nil, utils.ErrInternal(err.Error())
-	// 	}
-	// }
-	if response, err := db.GetSignatureValidationHash(supabaseClient, params.SignatureId); err != nil {
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(orderBatchTypedData(*response.Batch, nonce, expiry))
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedOrderBatchRequestResponse{
+		UnsignedOrderBatchResponse: *response,
+		Hash:                       hex.EncodeToString(typedDataHash),
+		TypedData:                  &typedData,
+	}, nil
+}
+
+// SignedOrdersBatchRequest signs every order of a create batch, or cancels every order of a cancel batch
+// the batch is signed with eip712, or with eip191 over the hash returned with it
+func SignedOrdersBatchRequest(r *http.Request, supabaseClient *supabase.Client, action string, parameters ...*SignedOrdersBatchRequestParams) (interface{}, error) {
+	var params *SignedOrdersBatchRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
 	} else {
-		hash_, _ := hex.DecodeString(response.Hash)
-		logrus.Info(fmt.Sprintf("hash to evaluate: %v", hash_))
-		// if ok, err := utils.ValidateEvmEcdsaSignature(orderIdHash, signatureBytes, common.HexToAddress("0x"+order.User.WalletAddress)); !ok || err != nil {
-		// 	if err != nil {
-		// 		utils.LogError("error validating signature", err.Error())
-		// 		return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		// 	} else {
-		// 		utils.LogError("signature validation failed", "invaid signature")
-		// 		return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-		// 	}
-		// }
+		params = &SignedOrdersBatchRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
 	}
 
-	cancelResponse, err := db.SignCancelOrder(supabaseClient, params.OrderId, params.SignatureId)
+	batch, err := db.GetOrderBatch(supabaseClient, params.BatchId)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	if !cancelResponse.IsValid {
-		utils.LogError("sign cancel order error", err.Error())
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid sig-s value: %v", cancelResponse.ErrorMessage))
+	if batch.Action != action {
+		return nil, utils.ErrMalformedRequest(fmt.Sprintf("batch %v is a %v batch, not %v", batch.ID, batch.Action, action))
 	}
-	return cancelResponse, nil
+	user_, err := db.GetUserByUserId(supabaseClient, batch.UserID)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	nonce, err := parseNonce(params.Nonce)
+	if err != nil {
+		return nil, utils.ErrSignatureMalformed(err.Error())
+	}
+	// the batch expires with its signature request, not with an expiry sent back by the client
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.BatchId)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify.UserActionWithScheme(*user_, orderBatchTypedData(*batch, nonce, expiry), params.SignatureScheme, params.R, params.S, params.V); err != nil {
+		return nil, err
+	}
+
+	signResponse, err := db.SignOrdersBatch(supabaseClient, params.BatchId, params.SignatureId, nonce)
+	if err != nil {
+		return nil, verify.ActionError(err)
+	}
+	if !signResponse.IsValid {
+		utils.LogError("sign orders batch error", signResponse.ErrorMessage)
+		return nil, utils.ErrInternal(signResponse.ErrorMessage)
+	}
+	return signResponse, nil
 }
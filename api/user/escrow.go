@@ -217,7 +217,7 @@ func updateBalance(client *supabase.Client, user map[string]interface{}, assetAd
 	}
 
 	fmt.Printf("User %s balances updated!\n", signer)
-	fmt.Println("Balances: %s\n", string(updatedBalanceData))
+	fmt.Printf("Balances: %s\n", string(updatedBalanceData))
 
 	return nil
 }
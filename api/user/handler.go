@@ -89,14 +89,12 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			response, err = GetDepositsByUserAddressRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
-		// todo
 		case "get-withdrawals-by-user-id":
-			response, err = GetDepositsByUserIdRequest(r, supabaseClient)
+			response, err = GetWithdrawalsByUserIdRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
-		// todo
 		case "get-withdrawals-by-user-address":
-			response, err = GetDepositsByUserAddressRequest(r, supabaseClient)
+			response, err = GetWithdrawalsByUserAddressRequest(r, supabaseClient)
 			HandleResponse(w, r, supabaseClient, response, err)
 			return
 		case "get-stakes-by-user-id":
@@ -0,0 +1,12 @@
+package userHandler
+
+import (
+	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+type UnsignedWithdrawalRequestResponse struct {
+	db.UnsignedWithdrawalResponse
+	Hash      string             `json:"hash"`       // EIP-712 digest in hex to be signed by the user
+	TypedData apitypes.TypedData `json:"typed_data"` // payload for eth_signTypedData_v4
+}
@@ -1,5 +1,7 @@
 package userHandler
 
+import "github.com/BlueSpadeXchain/blp-api/pkg/pagination"
+
 type SignatureRaw struct {
 	V string `query:"v"` // tvm is often a garbage value at least from ts
 	R string `query:"r"`
@@ -64,13 +66,18 @@ type GetUserByUserAddressRequestParams struct {
 	AddressType string `query:"type"` // referance to signature format (ecdsa/secp/edd/etc used by sig validation)
 }
 
+// the history lists are paged newest first, see pagination.RequestParams
 type GetDepositsByUserIdRequestParams struct {
-	UserId string `query:"user-id"`
+	UserId string                   `query:"user-id"`
+	Asset  string                   `query:"asset" optional:"true"` // token contract address
+	Page   pagination.RequestParams // created-from, created-to, cursor and limit
 }
 
 type GetDepositsByUserAddressRequestParams struct {
 	WalletAddress string `query:"wallet-address"`
 	WalletType    string `query:"wallet-type"`
+	Asset         string `query:"asset" optional:"true"`
+	Page          pagination.RequestParams
 }
 
 type UnsignedStakeRequestParams struct {
@@ -101,16 +108,29 @@ type EoaStakeRequestParams struct {
 }
 
 type GetStakesByUserIdRequestParams struct {
-	UserId    string `query:"user-id"`
-	StakeType string `query:"stake-type" optional:"true"`
-	Limit     string `query:"limit" optional:"true"`
+	UserId    string                   `query:"user-id"`
+	StakeType string                   `query:"stake-type" optional:"true"`
+	Page      pagination.RequestParams // limit is the page size
 }
 
 type GetStakesByUserAddressRequestParams struct {
 	WalletAddress string `query:"wallet-address"`
 	WalletType    string `query:"wallet-type"`
 	StakeType     string `query:"stake-type" optional:"true"`
-	Limit         string `query:"limit" optional:"true"`
+	Page          pagination.RequestParams
+}
+
+type GetWithdrawalsByUserIdRequestParams struct {
+	UserId string `query:"user-id"`
+	Status string `query:"status" optional:"true"` // one status or a comma list
+	Page   pagination.RequestParams
+}
+
+type GetWithdrawalsByUserAddressRequestParams struct {
+	WalletAddress string `query:"wallet-address"`
+	WalletType    string `query:"wallet-type"`
+	Status        string `query:"status" optional:"true"`
+	Page          pagination.RequestParams
 }
 
 type UnsignedWithdrawalRequestParams struct {
@@ -122,9 +142,10 @@ type UnsignedWithdrawalRequestParams struct {
 type SignedWithdrawalRequestParams struct {
 	WithdrawalId string `query:"withdrawal-id"`
 	SignatureId  string `query:"signature-id"`
-	R            string `query:"r" optional:"true"`
-	S            string `query:"s" optional:"true"`
-	V            string `query:"v" optional:"true"`
+	Nonce        string `query:"nonce"`
+	R            string `query:"r"`
+	S            string `query:"s"`
+	V            string `query:"v"`
 }
 
 type UnstakeRequestParams struct {
@@ -4,7 +4,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
-	"math"
 	"math/big"
 	"net/http"
 	"os"
@@ -12,9 +11,10 @@ import (
 	"strings"
 
 	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/BlueSpadeXchain/blp-api/pkg/pagination"
 	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/BlueSpadeXchain/blp-api/pkg/verify"
 	"github.com/sirupsen/logrus"
 	"github.com/supabase-community/supabase-go"
 )
@@ -36,21 +36,8 @@ func DespositRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 	}
 
 	// validate signature to verify backend query
-	txHash, _ := hex.DecodeString(utils.RemoveHex0xPrefix(params.TxHash))
-	fmt.Printf("\n txhash: %v", txHash)
-	signature, _ := hex.DecodeString(params.Signature)
-	pubkey := os.Getenv("EVM_ADDRESS")
-	if pubkey == "" {
-		logrus.Fatal("EVM_ADDRESS is not set")
-	}
-	if ok, err := utils.ValidateEvmEcdsaSignature(crypto.Keccak256(txHash), signature, common.HexToAddress(pubkey)); !ok || err != nil {
-		if err != nil {
-			utils.LogError("error validating isgnature", err.Error())
-			return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		} else {
-			utils.LogError("signature validation failed", "invaid signature")
-			return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-		}
+	if err := verify.ListenerRequest(params.TxHash, params.Signature); err != nil {
+		return nil, err
 	}
 
 	// parse value or deposit (1 eth = 3000 usd, 1 token = 1 usd)
@@ -65,20 +52,16 @@ func DespositRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 	if utils.RemoveHex0xPrefix(params.Asset) == "0000000000000000000000000000000000000000" {
 		// If address(0), assume 18 decimals
 		// 1 * 10^18 tokens = 3000 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil) // 10^18
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		usdValue.Mul(usdValue, big.NewFloat(3000)) // Multiply by 3000 USD
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 18).Mul(decimal.NewFromInt(3000)).StringFixed(9)
 	} else {
 		// For non-address(0), assume 6 decimals
 		// 1 * 10^9 tokens = 1 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(6), nil) // 10^9
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 6).StringFixed(9)
 	}
 
 	if err := db.AddUserDeposit(
 		supabaseClient,
+		"deposit",
 		utils.RemoveHex0xPrefix(params.Receiver),
 		"ecdsa",
 		params.ChainId,
@@ -90,7 +73,7 @@ func DespositRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 		utils.RemoveHex0xPrefix(params.Asset),
 		params.Amount,
 		value); err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("Failed to add deposit: %v", err.Error()))
+		return nil, verify.ListenerError(fmt.Errorf("failed to add deposit: %v", err))
 	}
 
 	return nil, nil
@@ -112,7 +95,19 @@ func GetDepositsByUserAddressRequest(r *http.Request, supabaseClient *supabase.C
 		}
 	}
 
-	deposits, err := db.GetDepositsByUserAddress(supabaseClient, params.WalletAddress, params.WalletType)
+	created, page, err := params.Page.Parse()
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	user, err := db.GetUserByWallet(supabaseClient, params.WalletAddress, params.WalletType)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	if user == nil {
+		return &db.DepositPageResponse{Deposits: []db.DepositResponse{}}, nil
+	}
+
+	deposits, err := db.GetDepositsByUserId(supabaseClient, user.UserID, params.Asset, created, page)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
@@ -135,7 +130,12 @@ func GetDepositsByUserIdRequest(r *http.Request, supabaseClient *supabase.Client
 		}
 	}
 
-	deposits, err := db.GetDepositsByUserId(supabaseClient, params.UserId)
+	created, page, err := params.Page.Parse()
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	deposits, err := db.GetDepositsByUserId(supabaseClient, params.UserId, params.Asset, created, page)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
@@ -265,21 +265,8 @@ func UnsignedStakeFromBalanceRequest(r *http.Request, supabaseClient *supabase.C
 	}
 
 	// validate signature to verify backend query
-	txHash, _ := hex.DecodeString(utils.RemoveHex0xPrefix(params.TxHash))
-	fmt.Printf("\n txhash: %v", txHash)
-	signature, _ := hex.DecodeString(params.Signature)
-	pubkey := os.Getenv("EVM_ADDRESS")
-	if pubkey == "" {
-		logrus.Fatal("EVM_ADDRESS is not set")
-	}
-	if ok, err := utils.ValidateEvmEcdsaSignature(crypto.Keccak256(txHash), signature, common.HexToAddress(pubkey)); !ok || err != nil {
-		if err != nil {
-			utils.LogError("error validating isgnature", err.Error())
-			return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		} else {
-			utils.LogError("signature validation failed", "invaid signature")
-			return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-		}
+	if err := verify.ListenerRequest(params.TxHash, params.Signature); err != nil {
+		return nil, err
 	}
 
 	// parse value or deposit (1 eth = 3000 usd, 1 token = 1 usd)
@@ -292,20 +279,16 @@ func UnsignedStakeFromBalanceRequest(r *http.Request, supabaseClient *supabase.C
 	if utils.RemoveHex0xPrefix(params.Asset) == "0000000000000000000000000000000000000000" {
 		// If address(0), assume 18 decimals
 		// 1 * 10^18 tokens = 3000 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil) // 10^18
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		usdValue.Mul(usdValue, big.NewFloat(3000)) // Multiply by 3000 USD
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 18).Mul(decimal.NewFromInt(3000)).StringFixed(9)
 	} else {
 		// For non-address(0), assume 9 decimals
 		// 1 * 10^9 tokens = 1 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(9), nil) // 10^9
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 9).StringFixed(9)
 	}
 
 	if err := db.AddUserDeposit(
 		supabaseClient,
+		"stake-from-balance-unsigned",
 		utils.RemoveHex0xPrefix(params.Receiver),
 		"ecdsa",
 		params.ChainId,
@@ -317,7 +300,7 @@ func UnsignedStakeFromBalanceRequest(r *http.Request, supabaseClient *supabase.C
 		utils.RemoveHex0xPrefix(params.Asset),
 		params.Amount,
 		value); err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("Failed to add deposit: %v", err.Error()))
+		return nil, verify.ListenerError(fmt.Errorf("failed to add deposit: %v", err))
 	}
 
 	return nil, nil
@@ -340,21 +323,8 @@ func StakeFromBalanceRequest(r *http.Request, supabaseClient *supabase.Client, p
 	}
 
 	// validate signature to verify backend query
-	txHash, _ := hex.DecodeString(utils.RemoveHex0xPrefix(params.TxHash))
-	fmt.Printf("\n txhash: %v", txHash)
-	signature, _ := hex.DecodeString(params.Signature)
-	pubkey := os.Getenv("EVM_ADDRESS")
-	if pubkey == "" {
-		logrus.Fatal("EVM_ADDRESS is not set")
-	}
-	if ok, err := utils.ValidateEvmEcdsaSignature(crypto.Keccak256(txHash), signature, common.HexToAddress(pubkey)); !ok || err != nil {
-		if err != nil {
-			// utils.LogError("error validating isgnature", err.Error())
-			// return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		} else {
-			// utils.LogError("signature validation failed", "invaid signature")
-			// return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-		}
+	if err := verify.ListenerRequest(params.TxHash, params.Signature); err != nil {
+		return nil, err
 	}
 
 	// parse value or deposit (1 eth = 3000 usd, 1 token = 1 usd)
@@ -367,20 +337,16 @@ func StakeFromBalanceRequest(r *http.Request, supabaseClient *supabase.Client, p
 	if utils.RemoveHex0xPrefix(params.Asset) == "0000000000000000000000000000000000000000" {
 		// If address(0), assume 18 decimals
 		// 1 * 10^18 tokens = 3000 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil) // 10^18
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		usdValue.Mul(usdValue, big.NewFloat(3000)) // Multiply by 3000 USD
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 18).Mul(decimal.NewFromInt(3000)).StringFixed(9)
 	} else {
 		// For non-address(0), assume 9 decimals
 		// 1 * 10^9 tokens = 1 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(9), nil) // 10^9
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 9).StringFixed(9)
 	}
 
 	if err := db.AddUserDeposit(
 		supabaseClient,
+		"stake-from-balance",
 		utils.RemoveHex0xPrefix(params.Receiver),
 		"ecdsa",
 		params.ChainId,
@@ -392,7 +358,7 @@ func StakeFromBalanceRequest(r *http.Request, supabaseClient *supabase.Client, p
 		utils.RemoveHex0xPrefix(params.Asset),
 		params.Amount,
 		value); err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("Failed to add deposit: %v", err.Error()))
+		return nil, verify.ListenerError(fmt.Errorf("failed to add deposit: %v", err))
 	}
 
 	return nil, nil
@@ -415,21 +381,8 @@ func EoaStakeRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 	}
 
 	// validate signature to verify backend query
-	txHash, _ := hex.DecodeString(utils.RemoveHex0xPrefix(params.TxHash))
-	fmt.Printf("\n txhash: %v", txHash)
-	signature, _ := hex.DecodeString(params.Signature)
-	pubkey := os.Getenv("EVM_ADDRESS")
-	if pubkey == "" {
-		logrus.Fatal("EVM_ADDRESS is not set")
-	}
-	if ok, err := utils.ValidateEvmEcdsaSignature(crypto.Keccak256(txHash), signature, common.HexToAddress(pubkey)); !ok || err != nil {
-		if err != nil {
-			// utils.LogError("error validating isgnature", err.Error())
-			// return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		} else {
-			// utils.LogError("signature validation failed", "invaid signature")
-			// return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-		}
+	if err := verify.ListenerRequest(params.TxHash, params.Signature); err != nil {
+		return nil, err
 	}
 
 	amount, ok := new(big.Int).SetString(params.Amount, 10) // Convert amount to big.Int
@@ -452,23 +405,19 @@ func EoaStakeRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 	// need to fetch the current price of eth
 	switch assetAddress {
 	case "0000000000000000000000000000000000000000": // stake blp: from eth
-		priceData, err := utils.GetCurrentPriceData("ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace")
+		ethPrice, err := utils.GetValidatedPrice("ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace")
 		if err != nil {
 			return "", utils.ErrInternal(err.Error())
 		}
 
-		markPrice, err := strconv.ParseFloat(priceData.Price.Price, 64)
-		if err != nil {
-			return "", utils.ErrInternal(fmt.Sprintf("failed to parse mark price: %v", err))
-		}
-
-		value, err := calculatePriceValue(amount, markPrice, int32(priceData.Price.Expo), 18)
+		value, err := calculatePriceValue(amount, ethPrice.Price, 18)
 		if err != nil {
 			return "", utils.ErrInternal(fmt.Sprintf("failed to calculate price value: %v", err))
 		}
 
 		if err := db.ProcessDepositAndStake(
 			supabaseClient,
+			"eoa-stake",
 			utils.RemoveHex0xPrefix(params.Receiver),
 			"ecdsa",
 			params.ChainId,
@@ -481,17 +430,18 @@ func EoaStakeRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 			params.Amount,
 			value,
 			"BLP"); err != nil {
-			return nil, utils.ErrInternal(fmt.Sprintf("Failed to add deposit: %v", err.Error()))
+			return nil, verify.ListenerError(fmt.Errorf("failed to add deposit: %v", err))
 		}
 		break
 	case bluAddress: // staked blu
-		value, err := calculatePriceValue(amount, 1, 0, 18)
+		value, err := calculatePriceValue(amount, decimal.One, 18)
 		if err != nil {
 			return "", utils.ErrInternal(fmt.Sprintf("failed to calculate price value: %v", err))
 		}
 
 		if err := db.ProcessDepositAndStake(
 			supabaseClient,
+			"eoa-stake",
 			utils.RemoveHex0xPrefix(params.Receiver),
 			"ecdsa",
 			params.ChainId,
@@ -504,17 +454,18 @@ func EoaStakeRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 			params.Amount,
 			value,
 			"BLU"); err != nil {
-			return nil, utils.ErrInternal(fmt.Sprintf("Failed to add deposit: %v", err.Error()))
+			return nil, verify.ListenerError(fmt.Errorf("failed to add deposit: %v", err))
 		}
 		break
 	case usdcAddress: // stake blp: from usdc
-		value, err := calculatePriceValue(amount, 1, 0, 6)
+		value, err := calculatePriceValue(amount, decimal.One, 6)
 		if err != nil {
 			return "", utils.ErrInternal(fmt.Sprintf("failed to calculate price value: %v", err))
 		}
 
 		if err := db.ProcessDepositAndStake(
 			supabaseClient,
+			"eoa-stake",
 			utils.RemoveHex0xPrefix(params.Receiver),
 			"ecdsa",
 			params.ChainId,
@@ -527,7 +478,7 @@ func EoaStakeRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 			params.Amount,
 			value,
 			"BLP"); err != nil {
-			return nil, utils.ErrInternal(fmt.Sprintf("Failed to add deposit: %v", err.Error()))
+			return nil, verify.ListenerError(fmt.Errorf("failed to add deposit: %v", err))
 		}
 		break
 	default:
@@ -564,26 +515,16 @@ func EoaStakeRequest(r *http.Request, supabaseClient *supabase.Client, parameter
 	return nil, nil
 }
 
-func calculatePriceValue(amount *big.Int, price float64, priceExponent int32, tokenDecimals int64) (string, error) {
+// calculatePriceValue returns the usd value at the deposit precision, NUMERIC(78, 9)
+func calculatePriceValue(amount *big.Int, price decimal.Decimal, tokenDecimals int32) (string, error) {
 	if amount == nil {
 		return "", fmt.Errorf("amount cannot be nil")
 	}
 
-	// Adjust mark price based on its exponent
-	adjustedPrice := adjustPriceByExponent(price, priceExponent)
-
-	// Convert amount from token decimals to regular value
-	tokensScale := new(big.Int).Exp(big.NewInt(10), big.NewInt(tokenDecimals), nil)
-	usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensScale))
+	// Convert amount from token decimals to regular value, then multiply by the mark price
+	usdValue := decimal.NewFromTokenAmount(amount, tokenDecimals).Mul(price)
 
-	// Multiply by adjusted mark price
-	usdValue.Mul(usdValue, big.NewFloat(adjustedPrice))
-
-	return fmt.Sprintf("%.9f", usdValue), nil
-}
-
-func adjustPriceByExponent(price float64, exponent int32) float64 {
-	return price * math.Pow10(int(exponent))
+	return usdValue.StringFixed(9), nil
 }
 
 func StakeRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*DespositRequestParams) (interface{}, error) {
@@ -603,21 +544,8 @@ func StakeRequest(r *http.Request, supabaseClient *supabase.Client, parameters .
 	}
 
 	// validate signature to verify backend query
-	txHash, _ := hex.DecodeString(utils.RemoveHex0xPrefix(params.TxHash))
-	fmt.Printf("\n txhash: %v", txHash)
-	signature, _ := hex.DecodeString(params.Signature)
-	pubkey := os.Getenv("EVM_ADDRESS")
-	if pubkey == "" {
-		logrus.Fatal("EVM_ADDRESS is not set")
-	}
-	if ok, err := utils.ValidateEvmEcdsaSignature(crypto.Keccak256(txHash), signature, common.HexToAddress(pubkey)); !ok || err != nil {
-		if err != nil {
-			// utils.LogError("error validating isgnature", err.Error())
-			// return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		} else {
-			// utils.LogError("signature validation failed", "invaid signature")
-			// return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-		}
+	if err := verify.ListenerRequest(params.TxHash, params.Signature); err != nil {
+		return nil, err
 	}
 
 	// parse value or deposit (1 eth = 3000 usd, 1 token = 1 usd)
@@ -630,20 +558,16 @@ func StakeRequest(r *http.Request, supabaseClient *supabase.Client, parameters .
 	if utils.RemoveHex0xPrefix(params.Asset) == "0000000000000000000000000000000000000000" {
 		// If address(0), assume 18 decimals
 		// 1 * 10^18 tokens = 3000 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil) // 10^18
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		usdValue.Mul(usdValue, big.NewFloat(3000)) // Multiply by 3000 USD
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 18).Mul(decimal.NewFromInt(3000)).StringFixed(9)
 	} else {
 		// For non-address(0), assume 9 decimals
 		// 1 * 10^9 tokens = 1 USD
-		tokensPerUSD := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil) // 10^9
-		usdValue := new(big.Float).Quo(new(big.Float).SetInt(amount), new(big.Float).SetInt(tokensPerUSD))
-		value = fmt.Sprintf("%.9f", usdValue)
+		value = decimal.NewFromTokenAmount(amount, 18).StringFixed(9)
 	}
 
 	if err := db.AddUserDeposit(
 		supabaseClient,
+		"stake",
 		utils.RemoveHex0xPrefix(params.Receiver),
 		"ecdsa",
 		params.ChainId,
@@ -655,7 +579,7 @@ func StakeRequest(r *http.Request, supabaseClient *supabase.Client, parameters .
 		utils.RemoveHex0xPrefix(params.Asset),
 		params.Amount,
 		value); err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("Failed to add deposit: %v", err.Error()))
+		return nil, verify.ListenerError(fmt.Errorf("failed to add deposit: %v", err))
 	}
 
 	return nil, nil
@@ -677,11 +601,16 @@ func GetStakesByUserIdRequest(r *http.Request, supabaseClient *supabase.Client,
 		}
 	}
 
-	deposits, err := db.GetStakesByUserId(supabaseClient, params.UserId, params.StakeType, 0)
+	created, page, err := params.Page.Parse()
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	stakes, err := db.GetStakesByUserId(supabaseClient, params.UserId, params.StakeType, created, page)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	return deposits, nil
+	return stakes, nil
 }
 
 func GetStakesByUserAddressRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetStakesByUserAddressRequestParams) (interface{}, error) {
@@ -700,11 +629,86 @@ func GetStakesByUserAddressRequest(r *http.Request, supabaseClient *supabase.Cli
 		}
 	}
 
-	deposits, err := db.GetStakesByUserAddress(supabaseClient, params.WalletAddress, params.WalletType, params.StakeType, 0)
+	created, page, err := params.Page.Parse()
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	user, err := db.GetUserByWallet(supabaseClient, params.WalletAddress, params.WalletType)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	return deposits, nil
+	if user == nil {
+		return &db.StakePageResponse{Stakes: []db.StakeResponse{}}, nil
+	}
+
+	stakes, err := db.GetStakesByUserId(supabaseClient, user.UserID, params.StakeType, created, page)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	return stakes, nil
+}
+
+func GetWithdrawalsByUserIdRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetWithdrawalsByUserIdRequestParams) (interface{}, error) {
+	var params *GetWithdrawalsByUserIdRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetWithdrawalsByUserIdRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	created, page, err := params.Page.Parse()
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+
+	withdrawals, err := db.GetWithdrawalsByUserId(supabaseClient, params.UserId, pagination.ParseList(params.Status), created, page)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	return withdrawals, nil
+}
+
+func GetWithdrawalsByUserAddressRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*GetWithdrawalsByUserAddressRequestParams) (interface{}, error) {
+	var params *GetWithdrawalsByUserAddressRequestParams
+
+	if len(parameters) > 0 {
+		params = parameters[0]
+	} else {
+		params = &GetWithdrawalsByUserAddressRequestParams{}
+	}
+
+	if r != nil {
+		if err := utils.ParseAndValidateParams(r, &params); err != nil {
+			utils.LogError("failed to parse params", err.Error())
+			return nil, utils.ErrInternal(err.Error())
+		}
+	}
+
+	created, page, err := params.Page.Parse()
+	if err != nil {
+		return nil, utils.ErrMalformedRequest(err.Error())
+	}
+	user, err := db.GetUserByWallet(supabaseClient, params.WalletAddress, params.WalletType)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	if user == nil {
+		return &db.WithdrawalPageResponse{Withdrawals: []db.WithdrawalResponse{}}, nil
+	}
+
+	withdrawals, err := db.GetWithdrawalsByUserId(supabaseClient, user.UserID, pagination.ParseList(params.Status), created, page)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	return withdrawals, nil
 }
 
 type WithdrawBluRequestParams struct {
@@ -737,7 +741,7 @@ func UnstakeRequest(r *http.Request, supabaseClient *supabase.Client, parameters
 		}
 	}
 
-	amount, err := strconv.ParseFloat(params.Amount, 64)
+	amount, err := decimal.NewFromString(params.Amount)
 	if err != nil {
 		return nil, utils.ErrInternal(fmt.Sprintf("invalid amount input: %v", err.Error()))
 	}
@@ -751,12 +755,12 @@ func UnstakeRequest(r *http.Request, supabaseClient *supabase.Client, parameters
 
 	switch stakeType {
 	case "BLU":
-		if (response.BluStakeBalance + response.BluStakePending) < amount {
-			return nil, utils.ErrInternal(fmt.Sprintf("insufficent BLU balance: %v", response.BluStakeBalance+response.BluStakePending))
+		if response.BluStakeBalance.Add(response.BluStakePending).LessThan(amount) {
+			return nil, utils.ErrInternal(fmt.Sprintf("insufficent BLU balance: %v", response.BluStakeBalance.Add(response.BluStakePending)))
 		}
 	case "BLP":
-		if (response.BlpStakeBalance + response.BlpStakePending) < amount {
-			return nil, utils.ErrInternal(fmt.Sprintf("insufficent BLP balance: %v", response.BlpStakeBalance+response.BlpStakePending))
+		if response.BlpStakeBalance.Add(response.BlpStakePending).LessThan(amount) {
+			return nil, utils.ErrInternal(fmt.Sprintf("insufficent BLP balance: %v", response.BlpStakeBalance.Add(response.BlpStakePending)))
 		}
 	default:
 		return nil, utils.ErrInternal(fmt.Sprintf("invalid stake-type found: %v", stakeType))
@@ -809,24 +813,45 @@ func UnsignedWithdrawRequest(r *http.Request, supabaseClient *supabase.Client, p
 		}
 	}
 
-	amount, err := strconv.ParseFloat(params.Amount, 64)
+	amount, err := decimal.NewFromString(params.Amount)
 	if err != nil {
 		return nil, utils.ErrInternal(fmt.Sprintf("invalid amount input: %v", err.Error()))
 	}
+	amount = amount.RoundUsd()
 
-	if response, err := db.GetUserByUserId(supabaseClient, params.UserId); err != nil {
+	user, err := db.GetUserByUserId(supabaseClient, params.UserId)
+	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
-	} else {
-		if response.Balance < amount {
-			return nil, utils.ErrInternal(fmt.Sprintf("insufficent balance: %v", response.Balance))
-		}
+	}
+	if user.Balance.LessThan(amount) {
+		return nil, utils.ErrInternal(fmt.Sprintf("insufficent balance: %v", user.Balance))
 	}
 
 	response, err := db.Withdraw(supabaseClient, params.UserId, amount)
 	if err != nil {
 		return nil, utils.ErrInternal(err.Error())
 	}
-	return response, nil
+
+	expiry, err := utils.ParseExpiryTime(response.ExpiryTime)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+	typedData := utils.NewTypedData(utils.WithdrawalTypedData{
+		WithdrawalId: response.WithdrawalId,
+		Amount:       amount,
+		Nonce:        user.Nonce,
+		Expiry:       expiry,
+	})
+	typedDataHash, err := utils.HashTypedData(typedData)
+	if err != nil {
+		return nil, utils.ErrInternal(err.Error())
+	}
+
+	return UnsignedWithdrawalRequestResponse{
+		UnsignedWithdrawalResponse: *response,
+		Hash:                       hex.EncodeToString(typedDataHash),
+		TypedData:                  typedData,
+	}, nil
 }
 
 func SignedWithdrawRequest(r *http.Request, supabaseClient *supabase.Client, parameters ...*SignedWithdrawalRequestParams) (interface{}, error) {
@@ -845,49 +870,26 @@ func SignedWithdrawRequest(r *http.Request, supabaseClient *supabase.Client, par
 		}
 	}
 
-	signatureV, err := strconv.ParseUint(params.V, 16, 64) // the value from raw metamask is messed up
+	withdrawalAndUser, err := db.GetPendingWithdrawalById(supabaseClient, params.WithdrawalId)
 	if err != nil {
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid v value: %v", err.Error()))
+		return nil, utils.ErrInternal(err.Error())
 	}
 
-	signatureR, err := hex.DecodeString(params.R)
+	nonce, err := strconv.ParseUint(params.Nonce, 10, 64)
 	if err != nil {
-		utils.LogError("invalid sig-s value", err.Error())
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid sig-r value: %v", err.Error()))
+		return nil, utils.ErrSignatureMalformed(fmt.Sprintf("invalid nonce value: %v", err.Error()))
 	}
-
-	signatureS, err := hex.DecodeString(params.S)
+	expiry, err := verify.SignatureExpiry(supabaseClient, params.SignatureId, params.WithdrawalId)
 	if err != nil {
-		utils.LogError("invalid sig-s value", err.Error())
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid sig-s value: %v", err.Error()))
-	}
-
-	if signatureV >= 27 {
-		signatureV -= 27
-	}
-
-	signatureBytes := append(signatureR, signatureS...)
-	signatureBytes = append(signatureBytes, byte(signatureV))
-
-	if response, err := db.GetSignatureValidationHash(supabaseClient, params.SignatureId); err != nil {
-		return nil, utils.ErrInternal(err.Error())
-	} else {
-		hash_, _ := hex.DecodeString(response.Hash)
-		logrus.Info(fmt.Sprintf("hash to evaluate: %v", hash_))
-		// if ok, err := utils.ValidateEvmEcdsaSignature(orderIdHash, signatureBytes, common.HexToAddress("0x"+order.User.WalletAddress)); !ok || err != nil {
-		// 	if err != nil {
-		// 		utils.LogError("error validating signature", err.Error())
-		// 		return nil, utils.ErrInternal(fmt.Sprintf("error validating signature: %v", err.Error()))
-		// 	} else {
-		// 		utils.LogError("signature validation failed", "invaid signature")
-		// 		return nil, utils.ErrInternal("Signature validation failed: invalid signature")
-		// 	}
-		// }
+		return nil, err
 	}
-
-	withdrawalAndUser, err := db.GetPendingWithdrawalById(supabaseClient, params.WithdrawalId)
-	if err != nil {
-		return nil, utils.ErrInternal(err.Error())
+	if err := verify.UserAction(withdrawalAndUser.User, utils.WithdrawalTypedData{
+		WithdrawalId: withdrawalAndUser.Withdrawal.ID,
+		Amount:       withdrawalAndUser.Withdrawal.Amount,
+		Nonce:        nonce,
+		Expiry:       expiry,
+	}, params.R, params.S, params.V); err != nil {
+		return nil, err
 	}
 
 	//withdrawalAndUser.User.Balance <
@@ -895,7 +897,7 @@ func SignedWithdrawRequest(r *http.Request, supabaseClient *supabase.Client, par
 
 	switch withdrawalAndUser.Withdrawal.TokenType {
 	case "BLP":
-		if withdrawalAndUser.User.Balance < withdrawalAndUser.Withdrawal.Amount {
+		if withdrawalAndUser.User.Balance.LessThan(withdrawalAndUser.Withdrawal.Amount) {
 			return nil, utils.ErrInternal(fmt.Sprintf("insufficent balance: %v", withdrawalAndUser.User.Balance))
 		}
 	default:
@@ -908,13 +910,13 @@ func SignedWithdrawRequest(r *http.Request, supabaseClient *supabase.Client, par
 	}
 
 	// this is required for the withdrawal api to both trying to transfer
-	withdrawalRequest, err := db.SignWithdraw(supabaseClient, params.WithdrawalId, params.SignatureId)
+	withdrawalRequest, err := db.SignWithdraw(supabaseClient, params.WithdrawalId, params.SignatureId, nonce)
 	if err != nil {
-		return nil, utils.ErrInternal(err.Error())
+		return nil, verify.ActionError(err)
 	}
 	if !withdrawalRequest.IsValid {
-		utils.LogError("sign cancel order error", err.Error())
-		return nil, utils.ErrInternal(fmt.Sprintf("invalid sig-s value: %v", withdrawalRequest.ErrorMessage))
+		utils.LogError("sign withdrawal error", withdrawalRequest.ErrorMessage)
+		return nil, utils.ErrInternal(withdrawalRequest.ErrorMessage)
 	}
 
 	if withdrawalRequest.Withdrawal.TokenType == "BLP" {
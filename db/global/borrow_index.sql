@@ -0,0 +1,106 @@
+-- cumulative borrow index, replaces charging the whole position lifetime at the current utilization
+-- the index grows by the hourly borrow rate over the elapsed time, the rate follows the global utilization:
+--   borrow_rate = base_borrow_rate * current_borrowed / current_liquidity
+-- the rate is reset every time current_borrowed or current_liquidity change, so each period is charged the utilization it had
+-- a position snapshots the index when it opens and pays amount * (index - borrow_index) when it closes
+
+CREATE TABLE IF NOT EXISTS borrow_index (
+    key TEXT PRIMARY KEY DEFAULT 'global' CHECK (key = 'global'),
+    base_borrow_rate NUMERIC(12, 10) NOT NULL DEFAULT 0.0001 CHECK (base_borrow_rate >= 0),
+    borrow_rate NUMERIC(20, 12) NOT NULL DEFAULT 0,
+    cumulative_borrow_index NUMERIC(30, 18) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO borrow_index (key) VALUES ('global') ON CONFLICT (key) DO NOTHING;
+
+COMMENT ON COLUMN borrow_index.base_borrow_rate IS 'Hourly borrow rate at 100% utilization';
+COMMENT ON COLUMN borrow_index.borrow_rate IS 'Current hourly borrow rate';
+COMMENT ON COLUMN borrow_index.cumulative_borrow_index IS 'Borrow fee per unit of value since the index started';
+
+-- positions open before the index existed start accruing from the migration
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS borrow_index NUMERIC(30, 18) NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN orders2.borrow_index IS 'Cumulative borrow index when the position opened';
+
+-- accrues the index up to now with the rate set at the previous accrual, then resets the rate from the current utilization
+CREATE OR REPLACE FUNCTION accrue_borrow_index() RETURNS borrow_index AS $$
+DECLARE
+    v_index borrow_index;
+    v_borrowed NUMERIC;
+    v_liquidity NUMERIC;
+BEGIN
+    SELECT * INTO v_index FROM borrow_index WHERE borrow_index.key = 'global' FOR UPDATE;
+
+    SELECT value INTO v_borrowed FROM global_state WHERE global_state.key = 'current_borrowed';
+    SELECT value INTO v_liquidity FROM global_state WHERE global_state.key = 'current_liquidity';
+
+    UPDATE borrow_index
+    SET
+        cumulative_borrow_index = cumulative_borrow_index
+            + borrow_rate * GREATEST(EXTRACT(EPOCH FROM (NOW() - v_index.updated_at)) / 3600, 0),
+        borrow_rate = CASE WHEN COALESCE(v_liquidity, 0) > 0
+            THEN base_borrow_rate * GREATEST(COALESCE(v_borrowed, 0), 0) / v_liquidity
+            ELSE 0
+        END,
+        updated_at = NOW()
+    WHERE borrow_index.key = 'global'
+    RETURNING * INTO v_index;
+
+    RETURN v_index;
+END;
+$$ LANGUAGE plpgsql;
+
+-- the index as last accrued, for the reads that must not move it (quotes, position views)
+CREATE OR REPLACE FUNCTION get_borrow_index() RETURNS borrow_index AS $$
+BEGIN
+    RETURN (SELECT borrow_index FROM borrow_index WHERE borrow_index.key = 'global');
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- the index accrue_borrow_index would return now, without writing it, for views of open positions
+CREATE OR REPLACE FUNCTION get_accrued_borrow_index() RETURNS borrow_index AS $$
+DECLARE
+    v_index borrow_index;
+BEGIN
+    SELECT * INTO v_index FROM borrow_index WHERE borrow_index.key = 'global';
+    v_index.cumulative_borrow_index := v_index.cumulative_borrow_index
+        + v_index.borrow_rate * GREATEST(EXTRACT(EPOCH FROM (NOW() - v_index.updated_at)) / 3600, 0);
+    v_index.updated_at := NOW();
+    RETURN v_index;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- every write to current_borrowed or current_liquidity closes the period at the old rate and starts one at the new rate
+CREATE OR REPLACE FUNCTION global_state_accrue_borrow_index() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM accrue_borrow_index();
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS global_state_borrow_index ON global_state;
+CREATE TRIGGER global_state_borrow_index
+    AFTER INSERT OR UPDATE ON global_state
+    FOR EACH ROW
+    WHEN (NEW.key IN ('current_borrowed', 'current_liquidity'))
+    EXECUTE FUNCTION global_state_accrue_borrow_index();
+
+-- snapshots the index when a position opens, market orders on insert and limit orders when they fill
+CREATE OR REPLACE FUNCTION snapshot_order_borrow_index() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status = 'pending' AND (TG_OP = 'INSERT' OR OLD.status != 'pending') THEN
+        NEW.borrow_index := (accrue_borrow_index()).cumulative_borrow_index;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders2_snapshot_borrow_index ON orders2;
+CREATE TRIGGER orders2_snapshot_borrow_index
+    BEFORE INSERT OR UPDATE ON orders2
+    FOR EACH ROW EXECUTE FUNCTION snapshot_order_borrow_index();
+
+GRANT EXECUTE ON FUNCTION accrue_borrow_index() TO public;
+GRANT EXECUTE ON FUNCTION get_borrow_index() TO public;
+GRANT EXECUTE ON FUNCTION get_accrued_borrow_index() TO public;
@@ -24,6 +24,7 @@ CREATE TABLE order_modifications (
     pnl NUMERIC(30, 6) DEFAULT 0,
     -- Timestamps
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    prev_modified_at TIMESTAMP, -- orders.modified_at when requested, the signed modify is rejected if it moved
     signed_at TIMESTAMP,
     canceled_at TIMESTAMP
 );
\ No newline at end of file
@@ -0,0 +1,525 @@
+-- algo orders, a position opened over time by child orders in orders2
+--   twap: the collateral is split in equal slices, one slice opens every interval_seconds at the mark price
+--   scale: the collateral is split in limit entries spread from price_from to price_to, all placed when signed
+-- the api plans the slices and the user signs the algo order once, the rebalancer spawns the slices that are due
+-- with spawn_algo_slices on every price cycle of the pair, a child rests in status limit until the rebalancer opens it
+--   a twap child is a market entry opened at the validated mark price of the cycle that spawned it
+--   a scale child is a limit entry at its slice price
+-- twap slices only spawn when a price of the pair arrives, after a gap the late slice opens on the next price
+-- and the remaining slices of that order move back so they keep their interval
+-- the slice collateral is reserved in escrow when the algo order is signed and released for the slices canceled
+
+CREATE TABLE IF NOT EXISTS algo_orders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    userid VARCHAR(16) NOT NULL,
+    kind VARCHAR(5) NOT NULL CHECK (kind IN ('twap', 'scale')),
+    order_type VARCHAR(10) NOT NULL CHECK (order_type IN ('long', 'short')),
+    pair VARCHAR(64) NOT NULL,
+    pair_id VARCHAR(64) NOT NULL,
+    leverage NUMERIC(7, 2) NOT NULL CHECK (leverage > 0),
+    collateral NUMERIC(20, 6) NOT NULL CHECK (collateral > 0),
+    slices INTEGER NOT NULL CHECK (slices BETWEEN 2 AND 50),
+    interval_seconds INTEGER NOT NULL DEFAULT 0 CHECK (interval_seconds >= 0),
+    price_from NUMERIC(20, 6),
+    price_to NUMERIC(20, 6),
+    liq_distance NUMERIC(20, 12) NOT NULL CHECK (liq_distance > 0 AND liq_distance < 1),
+    max_distance NUMERIC(20, 12) NOT NULL CHECK (max_distance > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'unsigned'
+        CHECK (status IN ('unsigned', 'active', 'completed', 'canceled')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    signed_at TIMESTAMP,
+    ended_at TIMESTAMP,
+    CONSTRAINT valid_algo_kind CHECK (
+        (kind = 'twap' AND interval_seconds > 0 AND price_from IS NULL AND price_to IS NULL) OR
+        (kind = 'scale' AND interval_seconds = 0 AND price_from > 0 AND price_to > 0)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_algo_orders_userid ON algo_orders(userid);
+CREATE INDEX IF NOT EXISTS idx_algo_orders_active ON algo_orders(pair_id) WHERE status = 'active';
+
+COMMENT ON COLUMN algo_orders.collateral IS 'Sum of the slice collaterals, reserved in escrow when signed';
+COMMENT ON COLUMN algo_orders.liq_distance IS 'Liquidation distance from the entry price, in fraction of the price, the same for every slice';
+COMMENT ON COLUMN algo_orders.max_distance IS 'Max profit distance from the entry price, in fraction of the price, the same for every slice';
+COMMENT ON COLUMN algo_orders.status IS 'unsigned -> active -> completed once every slice is spawned, or canceled';
+
+CREATE TABLE IF NOT EXISTS algo_order_slices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    algo_order_id UUID NOT NULL REFERENCES algo_orders(id) ON DELETE CASCADE,
+    slice_index INTEGER NOT NULL CHECK (slice_index >= 0),
+    collateral NUMERIC(20, 6) NOT NULL CHECK (collateral > 0),
+    open_fee NUMERIC(20, 6) NOT NULL DEFAULT 0,
+    lim_price NUMERIC(20, 6) CHECK (lim_price > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'planned'
+        CHECK (status IN ('planned', 'scheduled', 'spawned', 'canceled')),
+    scheduled_at TIMESTAMP,
+    spawned_at TIMESTAMP,
+    order_id UUID REFERENCES orders2(id),
+    UNIQUE (algo_order_id, slice_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_algo_order_slices_due ON algo_order_slices(scheduled_at) WHERE status = 'scheduled';
+
+COMMENT ON COLUMN algo_order_slices.lim_price IS 'Entry price of a scale slice, NULL for twap slices placed at the mark price';
+COMMENT ON COLUMN algo_order_slices.order_id IS 'Child order in orders2 once spawned';
+
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS algo_order_id UUID REFERENCES algo_orders(id);
+
+COMMENT ON COLUMN orders2.algo_order_id IS 'Algo order that spawned this order, NULL for orders created by the user';
+
+CREATE INDEX IF NOT EXISTS idx_orders2_algo_order_id ON orders2(algo_order_id) WHERE algo_order_id IS NOT NULL;
+
+-- creates an algo order and its slices, slices match by index, p_lim_prices is empty for twap
+CREATE OR REPLACE FUNCTION unsigned_algo_order(
+    p_user_id VARCHAR,
+    p_kind VARCHAR,
+    p_order_type VARCHAR,
+    p_pair VARCHAR,
+    p_pair_id VARCHAR,
+    p_leverage NUMERIC,
+    p_interval_seconds INTEGER,
+    p_price_from NUMERIC,
+    p_price_to NUMERIC,
+    p_liq_distance NUMERIC,
+    p_max_distance NUMERIC,
+    p_collaterals NUMERIC[],
+    p_open_fees NUMERIC[],
+    p_lim_prices NUMERIC[]
+) RETURNS JSON AS $$
+DECLARE
+    v_user users;
+    v_algo_order algo_orders;
+    v_slices JSON;
+    v_signature_id UUID;
+    v_signature_hash VARCHAR(64);
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT * INTO v_user FROM users WHERE users.userid = p_user_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'User with ID % does not exist.', p_user_id;
+    END IF;
+    IF p_kind = 'scale' AND cardinality(p_lim_prices) != cardinality(p_collaterals) THEN
+        RAISE EXCEPTION 'Scale orders need a price for each slice';
+    END IF;
+
+    INSERT INTO algo_orders (
+        userid, kind, order_type, pair, pair_id, leverage, collateral, slices,
+        interval_seconds, price_from, price_to, liq_distance, max_distance
+    )
+    VALUES (
+        p_user_id, p_kind, p_order_type, p_pair, p_pair_id, p_leverage,
+        (SELECT SUM(collateral) FROM unnest(p_collaterals) AS collateral), cardinality(p_collaterals),
+        p_interval_seconds, p_price_from, p_price_to, p_liq_distance, p_max_distance
+    )
+    RETURNING * INTO v_algo_order;
+
+    INSERT INTO algo_order_slices (algo_order_id, slice_index, collateral, open_fee, lim_price)
+    SELECT v_algo_order.id, s.ordinality - 1, s.collateral, s.open_fee, p_lim_prices[s.ordinality]
+    FROM unnest(p_collaterals, p_open_fees) WITH ORDINALITY AS s(collateral, open_fee, ordinality);
+
+    SELECT json_agg(algo_order_slices ORDER BY algo_order_slices.slice_index) INTO v_slices
+    FROM algo_order_slices WHERE algo_order_slices.algo_order_id = v_algo_order.id;
+
+    SELECT signature_id, signature_hash, expiry_time
+    INTO v_signature_id, v_signature_hash, v_expiry_time
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'algo_orders', v_algo_order.id, 'algo');
+
+    RETURN json_build_object(
+        'algo_order', row_to_json(v_algo_order),
+        'slices', v_slices,
+        'signature_id', v_signature_id,
+        'signature_hash', v_signature_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- reserves the collateral of a signed algo order and schedules its slices, twap slices one interval apart
+CREATE OR REPLACE FUNCTION signed_algo_order(
+    p_algo_order_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_algo_order algo_orders;
+    v_balance NUMERIC;
+    proof_ signature_validations;
+    v_is_valid BOOLEAN;
+    v_error_message TEXT;
+BEGIN
+    SELECT * INTO v_algo_order FROM algo_orders WHERE algo_orders.id = p_algo_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Algo order with ID % does not exist.', p_algo_order_id;
+    END IF;
+
+    SELECT * INTO proof_ FROM signature_validations WHERE signature_validations.id = p_signature_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
+    END IF;
+    IF proof_.reference_table != 'algo_orders' OR proof_.reference_id != p_algo_order_id THEN
+        RAISE EXCEPTION 'algo order id and signature id mismatch';
+    END IF;
+
+    SELECT is_valid, error_message
+    INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
+
+    SELECT balance INTO v_balance FROM users WHERE users.userid = v_algo_order.userid FOR UPDATE;
+
+    IF v_is_valid AND v_algo_order.status != 'unsigned' THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Algo order was already signed, status %s', v_algo_order.status);
+    ELSIF v_is_valid AND v_balance < v_algo_order.collateral THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Insufficient balance, required %s, available %s', v_algo_order.collateral, v_balance);
+    END IF;
+
+    IF v_is_valid THEN
+        PERFORM use_user_nonce(v_algo_order.userid, p_nonce);
+
+        UPDATE users
+        SET
+            balance = balance - v_algo_order.collateral,
+            escrow_balance = escrow_balance + v_algo_order.collateral
+        WHERE userid = v_algo_order.userid;
+
+        UPDATE algo_order_slices
+        SET
+            status = 'scheduled',
+            scheduled_at = CURRENT_TIMESTAMP + make_interval(secs => v_algo_order.interval_seconds * algo_order_slices.slice_index)
+        WHERE algo_order_slices.algo_order_id = p_algo_order_id;
+
+        UPDATE algo_orders
+        SET status = 'active', signed_at = CURRENT_TIMESTAMP
+        WHERE algo_orders.id = p_algo_order_id
+        RETURNING * INTO v_algo_order;
+    ELSIF v_algo_order.status = 'unsigned' THEN
+        UPDATE algo_order_slices
+        SET status = 'canceled'
+        WHERE algo_order_slices.algo_order_id = p_algo_order_id;
+
+        UPDATE algo_orders
+        SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+        WHERE algo_orders.id = p_algo_order_id
+        RETURNING * INTO v_algo_order;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'algo_order', to_jsonb(v_algo_order),
+        'is_valid', v_is_valid,
+        'error_message', v_error_message
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- places the due slices of the active algo orders of a pair and returns them, with the twap children not opened yet
+-- twap slices are market entries at p_mark_price, one slice per algo order per cycle
+-- slices locked by another spawn are left to the next cycle
+CREATE OR REPLACE FUNCTION spawn_algo_slices(
+    p_pair_id VARCHAR,
+    p_mark_price NUMERIC
+) RETURNS SETOF orders2 AS $$
+DECLARE
+    v_slice algo_order_slices;
+    v_algo_order algo_orders;
+    v_price NUMERIC;
+    v_order orders2;
+    v_spawned INTEGER := 0;
+    v_spawned_ids UUID[] := '{}';
+    v_twap_ids UUID[] := '{}';
+BEGIN
+    FOR v_slice IN
+        SELECT algo_order_slices.* FROM algo_order_slices
+        JOIN algo_orders ON algo_orders.id = algo_order_slices.algo_order_id
+        WHERE algo_orders.pair_id = p_pair_id
+            AND algo_orders.status = 'active'
+            AND algo_order_slices.status = 'scheduled'
+            AND algo_order_slices.scheduled_at <= NOW()
+        ORDER BY algo_order_slices.scheduled_at, algo_order_slices.slice_index
+        FOR UPDATE OF algo_order_slices SKIP LOCKED
+    LOOP
+        SELECT * INTO v_algo_order FROM algo_orders WHERE algo_orders.id = v_slice.algo_order_id;
+
+        -- slices due together are intervals missed without a price, they are spread again below
+        IF v_algo_order.kind = 'twap' THEN
+            IF v_algo_order.id = ANY(v_twap_ids) THEN
+                CONTINUE;
+            END IF;
+            v_twap_ids := v_twap_ids || v_algo_order.id;
+        END IF;
+
+        v_price := ROUND(COALESCE(v_slice.lim_price, p_mark_price), 6);
+
+        INSERT INTO orders2 (
+            userid,
+            order_type,
+            leverage,
+            pair,
+            pair_id,
+            collateral,
+            status,
+            entry_type,
+            entry_price,
+            lim_price,
+            liq_price,
+            max_price,
+            open_fee,
+            algo_order_id,
+            signed_at
+        )
+        VALUES (
+            v_algo_order.userid,
+            v_algo_order.order_type,
+            v_algo_order.leverage,
+            v_algo_order.pair,
+            v_algo_order.pair_id,
+            v_slice.collateral,
+            'limit',
+            CASE WHEN v_algo_order.kind = 'twap' THEN 'market' ELSE 'limit' END,
+            v_price,
+            v_slice.lim_price,
+            CASE WHEN v_algo_order.order_type = 'long'
+                THEN ROUND(v_price * (1 - v_algo_order.liq_distance), 6)
+                ELSE ROUND(v_price * (1 + v_algo_order.liq_distance), 6)
+            END,
+            CASE WHEN v_algo_order.order_type = 'long'
+                THEN ROUND(v_price * (1 + v_algo_order.max_distance), 6)
+                ELSE ROUND(v_price * (1 - v_algo_order.max_distance), 6)
+            END,
+            v_slice.open_fee,
+            v_algo_order.id,
+            CURRENT_TIMESTAMP
+        )
+        RETURNING * INTO v_order;
+
+        UPDATE algo_order_slices
+        SET status = 'spawned', spawned_at = CURRENT_TIMESTAMP, order_id = v_order.id
+        WHERE algo_order_slices.id = v_slice.id;
+
+        IF v_algo_order.kind = 'twap'
+            AND v_slice.scheduled_at < NOW() - make_interval(secs => v_algo_order.interval_seconds) THEN
+            UPDATE algo_order_slices
+            SET scheduled_at = NOW() + make_interval(
+                secs => (algo_order_slices.slice_index - v_slice.slice_index) * v_algo_order.interval_seconds)
+            WHERE algo_order_slices.algo_order_id = v_algo_order.id
+                AND algo_order_slices.status = 'scheduled';
+        END IF;
+
+        v_spawned := v_spawned + 1;
+        v_spawned_ids := v_spawned_ids || v_order.id;
+        RETURN NEXT v_order;
+    END LOOP;
+
+    IF v_spawned > 0 THEN
+        -- the same counters a signed limit order moves, the collateral is already in escrow
+        UPDATE global_state
+        SET value = value + v_spawned, updated_at = CURRENT_TIMESTAMP
+        WHERE key IN ('current_orders_limit', 'total_orders_limit');
+
+        UPDATE algo_orders
+        SET status = 'completed', ended_at = CURRENT_TIMESTAMP
+        WHERE algo_orders.pair_id = p_pair_id
+            AND algo_orders.status = 'active'
+            AND NOT EXISTS (
+                SELECT 1 FROM algo_order_slices
+                WHERE algo_order_slices.algo_order_id = algo_orders.id
+                    AND algo_order_slices.status = 'scheduled'
+            );
+    END IF;
+
+    -- twap children of an earlier cycle whose batch did not go through, priced again to open at this mark price
+    v_price := ROUND(p_mark_price, 6);
+    RETURN QUERY
+    UPDATE orders2
+    SET
+        entry_price = v_price,
+        liq_price = CASE WHEN orders2.order_type = 'long'
+            THEN ROUND(v_price * (1 - algo_orders.liq_distance), 6)
+            ELSE ROUND(v_price * (1 + algo_orders.liq_distance), 6)
+        END,
+        max_price = CASE WHEN orders2.order_type = 'long'
+            THEN ROUND(v_price * (1 + algo_orders.max_distance), 6)
+            ELSE ROUND(v_price * (1 - algo_orders.max_distance), 6)
+        END
+    FROM algo_orders
+    WHERE algo_orders.id = orders2.algo_order_id
+        AND orders2.pair_id = p_pair_id
+        AND orders2.entry_type = 'market'
+        AND orders2.status = 'limit'
+        AND NOT (orders2.id = ANY(v_spawned_ids))
+    RETURNING orders2.*;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION unsigned_cancel_algo_order(
+    p_algo_order_id UUID
+) RETURNS JSON AS $$
+DECLARE
+    v_algo_order algo_orders;
+    v_user users;
+    v_signature_id UUID;
+    v_signature_hash VARCHAR(64);
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT * INTO v_algo_order FROM algo_orders WHERE algo_orders.id = p_algo_order_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Algo order with ID % does not exist.', p_algo_order_id;
+    END IF;
+    IF v_algo_order.status NOT IN ('active', 'completed') THEN
+        RAISE EXCEPTION 'Algo orders of status % cannot be canceled', v_algo_order.status;
+    END IF;
+
+    SELECT * INTO v_user FROM users WHERE users.userid = v_algo_order.userid;
+
+    SELECT signature_id, signature_hash, expiry_time
+    INTO v_signature_id, v_signature_hash, v_expiry_time
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'algo_orders', v_algo_order.id, 'cancel');
+
+    RETURN json_build_object(
+        'order_id', v_algo_order.id,
+        'signature_id', v_signature_id,
+        'signature_hash', v_signature_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- cancels the slices not spawned yet and the children still resting, filled children stay open positions
+-- a completed scale order can still be canceled while some of its entries rest
+CREATE OR REPLACE FUNCTION signed_cancel_algo_order(
+    p_algo_order_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_algo_order algo_orders;
+    proof_ signature_validations;
+    v_is_valid BOOLEAN;
+    v_error_message TEXT;
+    v_released NUMERIC := 0;
+    v_resting_collateral NUMERIC := 0;
+    v_resting INTEGER := 0;
+BEGIN
+    SELECT * INTO v_algo_order FROM algo_orders WHERE algo_orders.id = p_algo_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Algo order with ID % does not exist.', p_algo_order_id;
+    END IF;
+
+    SELECT * INTO proof_ FROM signature_validations WHERE signature_validations.id = p_signature_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
+    END IF;
+    IF proof_.reference_table != 'algo_orders' OR proof_.reference_id != p_algo_order_id THEN
+        RAISE EXCEPTION 'algo order id and signature id mismatch';
+    END IF;
+
+    SELECT is_valid, error_message
+    INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
+
+    IF v_is_valid AND v_algo_order.status NOT IN ('active', 'completed') THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Algo orders of status %s cannot be canceled', v_algo_order.status);
+    END IF;
+
+    IF v_is_valid THEN
+        PERFORM use_user_nonce(v_algo_order.userid, p_nonce);
+
+        WITH canceled AS (
+            UPDATE algo_order_slices
+            SET status = 'canceled'
+            WHERE algo_order_slices.algo_order_id = p_algo_order_id AND algo_order_slices.status = 'scheduled'
+            RETURNING algo_order_slices.collateral
+        )
+        SELECT COALESCE(SUM(collateral), 0) INTO v_released FROM canceled;
+
+        PERFORM set_order_transition('cancel', 'user');
+        WITH canceled AS (
+            UPDATE orders2
+            SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+            WHERE orders2.algo_order_id = p_algo_order_id AND orders2.status = 'limit'
+            RETURNING orders2.collateral
+        )
+        SELECT COUNT(*), COALESCE(SUM(collateral), 0) INTO v_resting, v_resting_collateral FROM canceled;
+
+        UPDATE users
+        SET
+            balance = balance + v_released + v_resting_collateral,
+            escrow_balance = escrow_balance - v_released - v_resting_collateral
+        WHERE userid = v_algo_order.userid;
+
+        IF v_resting > 0 THEN
+            UPDATE global_state
+            SET value = value - v_resting, updated_at = CURRENT_TIMESTAMP
+            WHERE key = 'current_orders_limit';
+        END IF;
+
+        UPDATE algo_orders
+        SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+        WHERE algo_orders.id = p_algo_order_id
+        RETURNING * INTO v_algo_order;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'algo_order', to_jsonb(v_algo_order),
+        'is_valid', v_is_valid,
+        'error_message', v_error_message
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- an algo order with its slices and the aggregate fill of its children
+-- a child counts as filled once it left the limit status for a position, average_entry_price is weighted by collateral
+CREATE OR REPLACE FUNCTION get_algo_order(
+    p_algo_order_id UUID
+) RETURNS JSON AS $$
+DECLARE
+    v_algo_order algo_orders;
+    v_slices JSON;
+    v_progress JSON;
+BEGIN
+    SELECT * INTO v_algo_order FROM algo_orders WHERE algo_orders.id = p_algo_order_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Algo order with ID % does not exist.', p_algo_order_id;
+    END IF;
+
+    SELECT json_agg(algo_order_slices ORDER BY algo_order_slices.slice_index) INTO v_slices
+    FROM algo_order_slices WHERE algo_order_slices.algo_order_id = p_algo_order_id;
+
+    SELECT json_build_object(
+        'slices_spawned', (SELECT COUNT(*) FROM algo_order_slices
+            WHERE algo_order_slices.algo_order_id = p_algo_order_id AND algo_order_slices.status = 'spawned'),
+        'slices_resting', COUNT(*) FILTER (WHERE orders2.status = 'limit'),
+        'slices_filled', COUNT(*) FILTER (WHERE orders2.status NOT IN ('unsigned', 'limit', 'canceled', 'expired')),
+        'filled_collateral', COALESCE(SUM(orders2.collateral) FILTER (WHERE orders2.status NOT IN ('unsigned', 'limit', 'canceled', 'expired')), 0),
+        'average_entry_price', ROUND(
+            SUM(orders2.entry_price * orders2.collateral) FILTER (WHERE orders2.status NOT IN ('unsigned', 'limit', 'canceled', 'expired'))
+            / NULLIF(SUM(orders2.collateral) FILTER (WHERE orders2.status NOT IN ('unsigned', 'limit', 'canceled', 'expired')), 0),
+            6)
+    ) INTO v_progress
+    FROM orders2 WHERE orders2.algo_order_id = p_algo_order_id;
+
+    RETURN json_build_object(
+        'algo_order', row_to_json(v_algo_order),
+        'slices', v_slices,
+        'progress', v_progress
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION get_algo_orders(
+    p_user_id VARCHAR
+) RETURNS SETOF algo_orders AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM algo_orders
+    WHERE algo_orders.userid = p_user_id
+    ORDER BY algo_orders.created_at DESC;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION unsigned_algo_order(VARCHAR, VARCHAR, VARCHAR, VARCHAR, VARCHAR, NUMERIC, INTEGER, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC[], NUMERIC[], NUMERIC[]) TO public;
+GRANT EXECUTE ON FUNCTION signed_algo_order(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION spawn_algo_slices(VARCHAR, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION unsigned_cancel_algo_order(UUID) TO public;
+GRANT EXECUTE ON FUNCTION signed_cancel_algo_order(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION get_algo_order(UUID) TO public;
+GRANT EXECUTE ON FUNCTION get_algo_orders(VARCHAR) TO public;
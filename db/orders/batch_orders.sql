@@ -0,0 +1,295 @@
+-- batches of orders created or canceled with a single signature
+-- create_orders_batch creates each order with create_order, an order that fails is reported and the others are kept
+-- the user signs the batch once, sign_orders_batch then signs every order of it with sign_order
+-- cancel batches cancel unsigned and limit orders, the collateral of a limit order goes back to the balance
+-- every item is run in its own subtransaction so one failing order never rolls back the rest of the batch
+
+CREATE TABLE IF NOT EXISTS order_batches (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    userid VARCHAR(16) NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('create', 'cancel')),
+    order_ids UUID[] NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'unsigned'
+        CHECK (status IN ('unsigned', 'signed', 'rejected')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    signed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_batches_userid ON order_batches(userid);
+
+COMMENT ON COLUMN order_batches.order_ids IS 'Orders covered by the batch signature, in submission order, failed items are not included';
+
+-- creates the orders of a batch, p_orders is an array of create_order params with the index of the item
+-- entry_type, trigger_price and expires_at are applied like set_order_entry and set_order_expiry, client_order_id is set
+-- with the order, an item failing rolls back its own order, a client order id already used fails the item
+CREATE OR REPLACE FUNCTION create_orders_batch(
+    p_user_id VARCHAR,
+    p_orders JSONB
+) RETURNS JSON AS $$
+DECLARE
+    v_user users;
+    v_item JSONB;
+    v_created JSON;
+    v_order orders2;
+    v_order_ids UUID[] := '{}';
+    v_results JSONB := '[]'::JSONB;
+    v_batch order_batches;
+    v_signature_id UUID;
+    v_signature_hash VARCHAR(64);
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT * INTO v_user FROM users WHERE users.userid = p_user_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'User with ID % does not exist.', p_user_id;
+    END IF;
+
+    FOR v_item IN SELECT value FROM jsonb_array_elements(p_orders)
+    LOOP
+        BEGIN
+            v_created := create_order(
+                user_id => p_user_id,
+                order_type => v_item->>'order_type',
+                leverage => (v_item->>'leverage')::NUMERIC,
+                pair => v_item->>'pair',
+                pair_id => v_item->>'pair_id',
+                collateral => (v_item->>'collateral')::NUMERIC,
+                entry_price => (v_item->>'entry_price')::NUMERIC,
+                liq_price => (v_item->>'liq_price')::NUMERIC,
+                max_price => (v_item->>'max_price')::NUMERIC,
+                open_fee => (v_item->>'open_fee')::NUMERIC,
+                lim_price => (v_item->>'lim_price')::NUMERIC,
+                stop_price => (v_item->>'stop_price')::NUMERIC,
+                tp_price => (v_item->>'tp_price')::NUMERIC,
+                tp_value => (v_item->>'tp_value')::NUMERIC,
+                tp_collateral => (v_item->>'tp_collateral')::NUMERIC
+            );
+            v_order := json_populate_record(NULL::orders2, v_created->'order');
+
+            IF COALESCE(v_item->>'entry_type', 'market') != 'market' THEN
+                v_order := set_order_entry(v_order.id, v_item->>'entry_type', (v_item->>'trigger_price')::NUMERIC);
+            END IF;
+            IF v_item->>'expires_at' IS NOT NULL THEN
+                v_order := set_order_expiry(v_order.id, (v_item->>'expires_at')::TIMESTAMPTZ);
+            END IF;
+            IF v_item->>'client_order_id' IS NOT NULL THEN
+                UPDATE orders2
+                SET
+                    client_order_id = v_item->>'client_order_id',
+                    client_order_hash = v_item->>'client_order_hash'
+                WHERE orders2.id = v_order.id
+                RETURNING * INTO v_order;
+            END IF;
+
+            v_order_ids := v_order_ids || v_order.id;
+            v_results := v_results || jsonb_build_object('index', (v_item->>'index')::INTEGER, 'order', to_jsonb(v_order));
+        EXCEPTION WHEN OTHERS THEN
+            v_results := v_results || jsonb_build_object('index', (v_item->>'index')::INTEGER, 'error', SQLERRM);
+        END;
+    END LOOP;
+
+    IF cardinality(v_order_ids) = 0 THEN
+        RETURN json_build_object('results', v_results);
+    END IF;
+
+    INSERT INTO order_batches (userid, action, order_ids)
+    VALUES (p_user_id, 'create', v_order_ids)
+    RETURNING * INTO v_batch;
+
+    SELECT signature_id, signature_hash, expiry_time
+    INTO v_signature_id, v_signature_hash, v_expiry_time
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'order_batches', v_batch.id, 'create');
+
+    RETURN json_build_object(
+        'batch', row_to_json(v_batch),
+        'results', v_results,
+        'signature_id', v_signature_id,
+        'signature_hash', v_signature_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- records the cancel batch of the orders that can be canceled, the others are reported
+CREATE OR REPLACE FUNCTION unsigned_cancel_orders_batch(
+    p_user_id VARCHAR,
+    p_order_ids UUID[]
+) RETURNS JSON AS $$
+DECLARE
+    v_user users;
+    v_order_id UUID;
+    v_order orders2;
+    v_order_ids UUID[] := '{}';
+    v_results JSONB := '[]'::JSONB;
+    v_batch order_batches;
+    v_signature_id UUID;
+    v_signature_hash VARCHAR(64);
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT * INTO v_user FROM users WHERE users.userid = p_user_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'User with ID % does not exist.', p_user_id;
+    END IF;
+
+    FOREACH v_order_id IN ARRAY p_order_ids
+    LOOP
+        SELECT * INTO v_order FROM orders2 WHERE orders2.id = v_order_id;
+        IF NOT FOUND OR v_order.userid != p_user_id THEN
+            v_results := v_results || jsonb_build_object('order_id', v_order_id, 'error', format('Order with ID %s does not exist.', v_order_id));
+        ELSIF v_order.status NOT IN ('unsigned', 'limit') THEN
+            v_results := v_results || jsonb_build_object('order_id', v_order_id, 'error', format('orders of status %s cannot be mutated', v_order.status));
+        ELSE
+            v_order_ids := v_order_ids || v_order_id;
+            v_results := v_results || jsonb_build_object('order_id', v_order_id, 'order', to_jsonb(v_order));
+        END IF;
+    END LOOP;
+
+    IF cardinality(v_order_ids) = 0 THEN
+        RETURN json_build_object('results', v_results);
+    END IF;
+
+    INSERT INTO order_batches (userid, action, order_ids)
+    VALUES (p_user_id, 'cancel', v_order_ids)
+    RETURNING * INTO v_batch;
+
+    SELECT signature_id, signature_hash, expiry_time
+    INTO v_signature_id, v_signature_hash, v_expiry_time
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'order_batches', v_batch.id, 'cancel');
+
+    RETURN json_build_object(
+        'batch', row_to_json(v_batch),
+        'results', v_results,
+        'signature_id', v_signature_id,
+        'signature_hash', v_signature_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- signs or cancels every order of a batch, each order is reported on its own
+-- a batch is only signed once, a failed signature rejects it
+CREATE OR REPLACE FUNCTION signed_orders_batch(
+    p_batch_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_batch order_batches;
+    proof_ signature_validations;
+    v_is_valid BOOLEAN;
+    v_error_message TEXT;
+    v_order_id UUID;
+    v_signed JSON;
+    v_order orders2;
+    v_results JSONB := '[]'::JSONB;
+    v_canceled_limits INTEGER := 0;
+BEGIN
+    SELECT * INTO v_batch FROM order_batches WHERE order_batches.id = p_batch_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order batch with ID % does not exist.', p_batch_id;
+    END IF;
+
+    SELECT * INTO proof_ FROM signature_validations WHERE signature_validations.id = p_signature_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
+    END IF;
+    IF proof_.reference_table != 'order_batches' OR proof_.reference_id != p_batch_id THEN
+        RAISE EXCEPTION 'batch id and signature id mismatch';
+    END IF;
+
+    SELECT is_valid, error_message
+    INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
+
+    IF v_is_valid AND v_batch.status != 'unsigned' THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Order batch was already signed, status %s', v_batch.status);
+    END IF;
+
+    IF NOT v_is_valid THEN
+        IF v_batch.status = 'unsigned' THEN
+            UPDATE order_batches SET status = 'rejected'
+            WHERE order_batches.id = p_batch_id
+            RETURNING * INTO v_batch;
+        END IF;
+        RETURN jsonb_build_object(
+            'batch', to_jsonb(v_batch),
+            'results', v_results,
+            'is_valid', v_is_valid,
+            'error_message', v_error_message
+        );
+    END IF;
+
+    PERFORM use_user_nonce(v_batch.userid, p_nonce);
+
+    FOREACH v_order_id IN ARRAY v_batch.order_ids
+    LOOP
+        BEGIN
+            IF v_batch.action = 'create' THEN
+                PERFORM set_order_transition('sign', 'user');
+                v_signed := sign_order(order_id => v_order_id);
+                v_order := json_populate_record(NULL::orders2, v_signed->'order');
+            ELSE
+                SELECT * INTO v_order FROM orders2 WHERE orders2.id = v_order_id FOR UPDATE;
+                IF v_order.status NOT IN ('unsigned', 'limit') THEN
+                    RAISE EXCEPTION 'orders of status % cannot be mutated', v_order.status;
+                END IF;
+
+                -- the open fee is only taken when a limit fills, the whole collateral is still in escrow
+                IF v_order.status = 'limit' THEN
+                    UPDATE users
+                    SET
+                        balance = balance + v_order.collateral,
+                        escrow_balance = escrow_balance - v_order.collateral
+                    WHERE userid = v_order.userid;
+                    v_canceled_limits := v_canceled_limits + 1;
+                END IF;
+
+                PERFORM set_order_transition('cancel', 'user');
+                UPDATE orders2
+                SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+                WHERE orders2.id = v_order_id
+                RETURNING * INTO v_order;
+            END IF;
+            v_results := v_results || jsonb_build_object('order_id', v_order_id, 'order', to_jsonb(v_order));
+        EXCEPTION WHEN OTHERS THEN
+            v_results := v_results || jsonb_build_object('order_id', v_order_id, 'error', SQLERRM);
+        END;
+    END LOOP;
+
+    IF v_canceled_limits > 0 THEN
+        UPDATE global_state
+        SET value = value - v_canceled_limits, updated_at = CURRENT_TIMESTAMP
+        WHERE key = 'current_orders_limit';
+    END IF;
+
+    UPDATE order_batches
+    SET status = 'signed', signed_at = CURRENT_TIMESTAMP
+    WHERE order_batches.id = p_batch_id
+    RETURNING * INTO v_batch;
+
+    RETURN jsonb_build_object(
+        'batch', to_jsonb(v_batch),
+        'results', v_results,
+        'is_valid', v_is_valid,
+        'error_message', v_error_message
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION get_order_batch(
+    p_batch_id UUID
+) RETURNS order_batches AS $$
+DECLARE
+    v_batch order_batches;
+BEGIN
+    SELECT * INTO v_batch FROM order_batches WHERE order_batches.id = p_batch_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order batch with ID % does not exist.', p_batch_id;
+    END IF;
+    RETURN v_batch;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION create_orders_batch(VARCHAR, JSONB) TO public;
+GRANT EXECUTE ON FUNCTION unsigned_cancel_orders_batch(VARCHAR, UUID[]) TO public;
+GRANT EXECUTE ON FUNCTION signed_orders_batch(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION get_order_batch(UUID) TO public;
@@ -0,0 +1,118 @@
+-- client order ids, a label chosen by the user that is unique among their orders
+-- the api stores a hash of the create-order params with it, a retried create with the same id and params
+-- returns the original order instead of creating a duplicate, the same id with other params is a conflict
+-- orders can be looked up and canceled by (userid, client_order_id) as well as by id
+
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS client_order_id VARCHAR(64);
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS client_order_hash VARCHAR(64);
+
+COMMENT ON COLUMN orders2.client_order_id IS 'Label chosen by the user, unique per user, NULL when not set';
+COMMENT ON COLUMN orders2.client_order_hash IS 'sha256 of the create-order params submitted with client_order_id';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders2_client_order_id ON orders2(userid, client_order_id)
+    WHERE client_order_id IS NOT NULL;
+
+-- create_order with a client order id, the order is labeled in the same transaction it is created in
+-- when the user already has an order with this client order id nothing is created and it is returned as existing,
+-- a concurrent create that commits the same id first makes the label a unique_violation, this order is rolled back
+-- and the order of the other request is returned instead
+CREATE OR REPLACE FUNCTION create_order_with_client_id(
+    p_user_id VARCHAR,
+    p_order_type VARCHAR,
+    p_leverage NUMERIC,
+    p_pair VARCHAR,
+    p_pair_id VARCHAR,
+    p_collateral NUMERIC,
+    p_entry_price NUMERIC,
+    p_liq_price NUMERIC,
+    p_max_price NUMERIC,
+    p_open_fee NUMERIC,
+    p_client_order_id VARCHAR,
+    p_client_order_hash VARCHAR,
+    p_lim_price NUMERIC DEFAULT NULL,
+    p_stop_price NUMERIC DEFAULT NULL,
+    p_tp_price NUMERIC DEFAULT NULL,
+    p_tp_value NUMERIC DEFAULT NULL,
+    p_tp_collateral NUMERIC DEFAULT NULL
+) RETURNS jsonb AS $$
+DECLARE
+    v_existing JSON;
+    v_created jsonb;
+    v_order orders2;
+BEGIN
+    v_existing := get_order_by_client_id(p_user_id, p_client_order_id);
+    IF v_existing IS NOT NULL THEN
+        RETURN jsonb_build_object('existing', v_existing);
+    END IF;
+
+    BEGIN
+        -- create_order is not part of this repo, see pkg/db CreateOrder for its params
+        v_created := to_jsonb(create_order(
+            user_id => p_user_id,
+            order_type => p_order_type,
+            leverage => p_leverage,
+            pair => p_pair,
+            pair_id => p_pair_id,
+            collateral => p_collateral,
+            entry_price => p_entry_price,
+            liq_price => p_liq_price,
+            max_price => p_max_price,
+            open_fee => p_open_fee,
+            lim_price => p_lim_price,
+            stop_price => p_stop_price,
+            tp_price => p_tp_price,
+            tp_value => p_tp_value,
+            tp_collateral => p_tp_collateral
+        ));
+
+        UPDATE orders2
+        SET
+            client_order_id = p_client_order_id,
+            client_order_hash = p_client_order_hash
+        WHERE orders2.id = (v_created->'order'->>'id')::UUID
+        RETURNING * INTO v_order;
+    EXCEPTION WHEN unique_violation THEN
+        RETURN jsonb_build_object('existing', get_order_by_client_id(p_user_id, p_client_order_id));
+    END;
+
+    RETURN jsonb_set(v_created, '{order}', to_jsonb(v_order));
+END;
+$$ LANGUAGE plpgsql;
+
+-- returns the order with its user like get_order_by_id2, NULL when the user has no order with this client id
+-- expiry_time is the latest signature request of an unsigned order that can still be signed
+CREATE OR REPLACE FUNCTION get_order_by_client_id(
+    p_user_id VARCHAR,
+    p_client_order_id VARCHAR
+) RETURNS JSON AS $$
+DECLARE
+    v_order orders2;
+    v_user users;
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT * INTO v_order FROM orders2
+    WHERE orders2.userid = p_user_id AND orders2.client_order_id = p_client_order_id;
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT * INTO v_user FROM users WHERE users.userid = v_order.userid;
+
+    IF v_order.status = 'unsigned' THEN
+        SELECT MAX(signature_validations.expiry_time) INTO v_expiry_time
+        FROM signature_validations
+        WHERE signature_validations.reference_id = v_order.id
+            AND signature_validations.expiry_time > NOW();
+    END IF;
+
+    RETURN json_build_object(
+        'order', row_to_json(v_order),
+        'user', row_to_json(v_user),
+        'client_order_hash', v_order.client_order_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION create_order_with_client_id(VARCHAR, VARCHAR, NUMERIC, VARCHAR, VARCHAR, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, VARCHAR, VARCHAR, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION get_order_by_client_id(VARCHAR, VARCHAR) TO public;
@@ -3,3 +3,15 @@ DROP FUNCTION IF EXISTS get_orders_by_userid(VARCHAR);
 DROP FUNCTION IF EXISTS get_orders_by_address(VARCHAR, VARCHAR);
 DROP FUNCTION IF EXITST sign_order(UUID);
 DROP FUNCTION IF EXISTS create_order(VARCHAR, VARCHAR, NUMERIC, VARCHAR, NUMERIC, NUMERIC, NUMERIC);
+
+DROP FUNCTION IF EXISTS signed_partial_close_order(UUID, UUID, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC);
+DROP FUNCTION IF EXISTS signed_modify_order(UUID, UUID);
+DROP FUNCTION IF EXISTS signed_margin_order(UUID, UUID);
+DROP FUNCTION IF EXISTS signed_partial_close_order(UUID, UUID, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC);
+DROP FUNCTION IF EXISTS signed_reduce_only_order(UUID, UUID);
+DROP FUNCTION IF EXISTS signed_cancel_reduce_only_order(UUID, UUID);
+DROP FUNCTION IF EXISTS signed_algo_order(UUID, UUID);
+DROP FUNCTION IF EXISTS signed_cancel_algo_order(UUID, UUID);
+DROP FUNCTION IF EXISTS signed_orders_batch(UUID, UUID);
+
+DROP FUNCTION IF EXISTS set_order_client_id(UUID, VARCHAR, VARCHAR);
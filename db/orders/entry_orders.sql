@@ -0,0 +1,107 @@
+-- explicit entry order types, replaces inferring the trigger direction from lim_price against entry_price
+-- entry orders rest in status 'limit', liq_price and max_price are quoted from lim_price and moved to the fill price
+-- when a mit, stop or stop_limit entry triggers (process_batch_orders_with_transitions)
+--   limit: fills at lim_price when the price comes back to it, at or under it for longs and at or over it for shorts
+--   mit: goes to market when the price comes back to lim_price, fills at that mark price
+--   stop: fills at the mark price when the price breaks through lim_price, at or over it for longs and at or under it for shorts
+--   stop_limit: arms when the price breaks through trigger_price, then fills at the mark price up to lim_price, its worst acceptable price
+-- the rebalancer arms stop limits with arm_stop_limit_orders before its batch fills them
+
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS entry_type VARCHAR(10) NOT NULL DEFAULT 'market'
+    CHECK (entry_type IN ('market', 'limit', 'stop', 'mit', 'stop_limit'));
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS trigger_price NUMERIC(20, 6) CHECK (trigger_price > 0);
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS triggered_at TIMESTAMP;
+
+COMMENT ON COLUMN orders2.entry_type IS 'How the order enters: market, limit, stop, mit (market-if-touched) or stop_limit';
+COMMENT ON COLUMN orders2.trigger_price IS 'Stop price arming a stop_limit, NULL for other entry types';
+COMMENT ON COLUMN orders2.triggered_at IS 'When a stop_limit was armed';
+
+ALTER TABLE orders2 DROP CONSTRAINT IF EXISTS valid_entry_type;
+ALTER TABLE orders2 ADD CONSTRAINT valid_entry_type CHECK (
+    (entry_type = 'market' AND trigger_price IS NULL) OR
+    (entry_type IN ('limit', 'stop', 'mit') AND lim_price IS NOT NULL AND trigger_price IS NULL) OR
+    (entry_type = 'stop_limit' AND lim_price IS NOT NULL AND trigger_price IS NOT NULL)
+) NOT VALID;
+
+-- open entry orders keep the direction the rebalancer inferred for them
+UPDATE orders2
+SET entry_type = CASE
+        WHEN orders2.order_type = 'long' AND orders2.lim_price > orders2.entry_price THEN 'stop'
+        WHEN orders2.order_type = 'short' AND orders2.lim_price < orders2.entry_price THEN 'stop'
+        ELSE 'limit'
+    END
+WHERE orders2.lim_price IS NOT NULL
+    AND orders2.entry_type = 'market'
+    AND orders2.status IN ('unsigned', 'limit');
+
+CREATE INDEX IF NOT EXISTS idx_orders2_stop_limit ON orders2(pair_id, trigger_price)
+    WHERE entry_type = 'stop_limit' AND triggered_at IS NULL;
+
+-- sets the entry type of an order created with create_order, before it is signed
+CREATE OR REPLACE FUNCTION set_order_entry(
+    p_order_id UUID,
+    p_entry_type VARCHAR,
+    p_trigger_price NUMERIC
+) RETURNS orders2 AS $$
+DECLARE
+    v_order orders2;
+BEGIN
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_order_id;
+    END IF;
+    IF v_order.status != 'unsigned' THEN
+        RAISE EXCEPTION 'Entry type can only be set on unsigned orders, order status is %', v_order.status;
+    END IF;
+    IF (p_entry_type = 'stop_limit') != (p_trigger_price IS NOT NULL) THEN
+        RAISE EXCEPTION 'A trigger price is required for stop limits and only for them';
+    END IF;
+    IF (p_entry_type = 'market') != (v_order.lim_price IS NULL) THEN
+        RAISE EXCEPTION 'Entry type % does not match limit price %', p_entry_type, v_order.lim_price;
+    END IF;
+
+    UPDATE orders2
+    SET
+        entry_type = p_entry_type,
+        trigger_price = p_trigger_price
+    WHERE orders2.id = p_order_id
+    RETURNING * INTO v_order;
+
+    RETURN v_order;
+END;
+$$ LANGUAGE plpgsql;
+
+-- stop limits of a pair not armed yet whose trigger is inside the streamed price range
+CREATE OR REPLACE FUNCTION get_stop_limit_orders(
+    p_pair_id VARCHAR,
+    p_min_price NUMERIC,
+    p_max_price NUMERIC
+) RETURNS SETOF orders2 AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM orders2
+    WHERE orders2.pair_id = p_pair_id
+        AND orders2.status = 'limit'
+        AND orders2.entry_type = 'stop_limit'
+        AND orders2.triggered_at IS NULL
+        AND orders2.trigger_price BETWEEN p_min_price AND p_max_price;
+END;
+$$ LANGUAGE plpgsql;
+
+-- persists armed stop limits, an order already armed or no longer resting is left as is
+CREATE OR REPLACE FUNCTION arm_stop_limit_orders(
+    p_order_ids UUID[]
+) RETURNS VOID AS $$
+BEGIN
+    UPDATE orders2
+    SET triggered_at = CURRENT_TIMESTAMP
+    WHERE orders2.id = ANY(p_order_ids)
+        AND orders2.entry_type = 'stop_limit'
+        AND orders2.status = 'limit'
+        AND orders2.triggered_at IS NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION set_order_entry(UUID, VARCHAR, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION get_stop_limit_orders(VARCHAR, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION arm_stop_limit_orders(UUID[]) TO public;
@@ -0,0 +1,249 @@
+-- take profit and stop loss ladders
+-- an order can carry up to 10 exit levels next to (not instead of) its stop price, each closing a fixed collateral at its price
+-- levels are partial exits, their percents (of the collateral at open) add up to less than 100
+-- the rest of the position closes at the stop price, max profit, liquidation or by the user
+-- the single take profit (tp_price) and a ladder cannot be combined on the same order
+-- the rebalancer fills crossed levels with fill_exit_levels before the rest of its batch, each fill is an order_fills row
+
+CREATE TABLE IF NOT EXISTS order_exit_levels (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    orderid UUID NOT NULL REFERENCES orders2(id) ON DELETE CASCADE,
+    kind VARCHAR(2) NOT NULL CHECK (kind IN ('tp', 'sl')),
+    price NUMERIC(20, 6) NOT NULL CHECK (price > 0),
+    percent NUMERIC(7, 4) NOT NULL CHECK (percent > 0 AND percent < 100),
+    collateral NUMERIC(20, 6) NOT NULL CHECK (collateral > 0),
+    fill_id UUID,
+    triggered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_exit_levels_orderid ON order_exit_levels(orderid);
+CREATE INDEX IF NOT EXISTS idx_order_exit_levels_open ON order_exit_levels(price) WHERE triggered_at IS NULL;
+
+COMMENT ON COLUMN order_exit_levels.percent IS 'Share of the collateral at open closed by this level';
+COMMENT ON COLUMN order_exit_levels.collateral IS 'Collateral closed by this level, scaled down by manual partial closes';
+COMMENT ON COLUMN order_exit_levels.fill_id IS 'order_fills row written when the level filled';
+
+ALTER TABLE order_fills ADD COLUMN IF NOT EXISTS exit_level_id UUID REFERENCES order_exit_levels(id);
+
+COMMENT ON COLUMN order_fills.exit_level_id IS 'exit level filled by the rebalancer, NULL for fills signed by the user';
+
+-- adds the ladder of an order created with create_order, before it is signed, levels match by index
+CREATE OR REPLACE FUNCTION create_order_exit_levels(
+    p_order_id UUID,
+    p_kinds VARCHAR[],
+    p_prices NUMERIC[],
+    p_percents NUMERIC[],
+    p_collaterals NUMERIC[]
+) RETURNS SETOF order_exit_levels AS $$
+DECLARE
+    v_order orders2;
+BEGIN
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_order_id;
+    END IF;
+    IF v_order.status != 'unsigned' THEN
+        RAISE EXCEPTION 'Exit levels can only be set on unsigned orders, order status is %', v_order.status;
+    END IF;
+    IF v_order.tp_price IS NOT NULL THEN
+        RAISE EXCEPTION 'Exit levels cannot be combined with a take profit price';
+    END IF;
+    IF EXISTS (SELECT 1 FROM order_exit_levels WHERE order_exit_levels.orderid = p_order_id) THEN
+        RAISE EXCEPTION 'Order % already has exit levels', p_order_id;
+    END IF;
+    IF cardinality(p_kinds) > 10 THEN
+        RAISE EXCEPTION 'At most 10 exit levels, found %', cardinality(p_kinds);
+    END IF;
+    IF (SELECT SUM(percent) FROM unnest(p_percents) AS percent) >= 100 THEN
+        RAISE EXCEPTION 'Exit level percents must add up to less than 100';
+    END IF;
+
+    RETURN QUERY
+    INSERT INTO order_exit_levels (orderid, kind, price, percent, collateral)
+    SELECT p_order_id, l.kind, l.price, l.percent, l.collateral
+    FROM unnest(p_kinds, p_prices, p_percents, p_collaterals) AS l(kind, price, percent, collateral)
+    RETURNING *;
+END;
+$$ LANGUAGE plpgsql;
+
+-- levels of an order, filled ones included, in the order they trigger
+CREATE OR REPLACE FUNCTION get_order_exit_levels(
+    p_order_id UUID
+) RETURNS SETOF order_exit_levels AS $$
+BEGIN
+    RETURN QUERY
+    SELECT order_exit_levels.* FROM order_exit_levels
+    JOIN orders2 ON orders2.id = order_exit_levels.orderid
+    WHERE order_exit_levels.orderid = p_order_id
+    ORDER BY order_exit_levels.kind DESC,
+        CASE WHEN (orders2.order_type = 'long') = (order_exit_levels.kind = 'tp')
+            THEN order_exit_levels.price
+            ELSE -order_exit_levels.price
+        END;
+END;
+$$ LANGUAGE plpgsql;
+
+-- pending orders of a pair with an open level inside the streamed price range, and their open levels
+CREATE OR REPLACE FUNCTION get_exit_level_orders(
+    p_pair_id VARCHAR,
+    p_min_price NUMERIC,
+    p_max_price NUMERIC
+) RETURNS SETOF orders2 AS $$
+BEGIN
+    RETURN QUERY
+    SELECT DISTINCT orders2.* FROM orders2
+    JOIN order_exit_levels ON order_exit_levels.orderid = orders2.id
+    WHERE orders2.pair_id = p_pair_id
+        AND orders2.status = 'pending'
+        AND order_exit_levels.triggered_at IS NULL
+        AND order_exit_levels.price BETWEEN p_min_price AND p_max_price;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION get_open_exit_levels(
+    p_order_ids UUID[]
+) RETURNS SETOF order_exit_levels AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM order_exit_levels
+    WHERE order_exit_levels.orderid = ANY(p_order_ids)
+        AND order_exit_levels.triggered_at IS NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- fills crossed levels, p_fills is a json array of
+--   { exit_level_id, close_collateral, payout, close_fee, close_price, close_value, funding }
+-- with the same accounting as signed_partial_close_order, a fill that no longer applies is skipped and reported
+CREATE OR REPLACE FUNCTION fill_exit_levels(
+    p_fills jsonb
+) RETURNS jsonb AS $$
+DECLARE
+    v_item jsonb;
+    v_level order_exit_levels;
+    v_order orders2;
+    v_fill order_fills;
+    v_live_collateral NUMERIC;
+    v_close_collateral NUMERIC;
+    v_payout NUMERIC;
+    v_close_fee NUMERIC;
+    v_close_value NUMERIC;
+    v_funding NUMERIC;
+    v_pnl NUMERIC;
+    v_results jsonb := '[]'::jsonb;
+BEGIN
+    FOR v_item IN SELECT * FROM jsonb_array_elements(p_fills) LOOP
+        SELECT * INTO v_level FROM order_exit_levels
+        WHERE order_exit_levels.id = (v_item->>'exit_level_id')::UUID FOR UPDATE;
+        IF NOT FOUND OR v_level.triggered_at IS NOT NULL THEN
+            v_results := v_results || jsonb_build_object(
+                'exit_level_id', v_item->>'exit_level_id', 'is_valid', FALSE, 'error_message', 'Exit level is missing or already filled');
+            CONTINUE;
+        END IF;
+
+        SELECT * INTO v_order FROM orders2 WHERE orders2.id = v_level.orderid FOR UPDATE;
+
+        v_close_collateral := (v_item->>'close_collateral')::NUMERIC;
+        v_payout := (v_item->>'payout')::NUMERIC;
+        v_close_fee := (v_item->>'close_fee')::NUMERIC;
+        v_close_value := (v_item->>'close_value')::NUMERIC;
+        v_funding := COALESCE((v_item->>'funding')::NUMERIC, 0);
+
+        v_live_collateral := v_order.collateral;
+        IF v_order.tp_at IS NOT NULL THEN
+            v_live_collateral := v_live_collateral - COALESCE(v_order.tp_collateral, 0);
+        END IF;
+
+        IF v_order.status != 'pending' OR v_close_collateral <= 0 OR v_close_collateral >= v_live_collateral THEN
+            v_results := v_results || jsonb_build_object(
+                'exit_level_id', v_level.id, 'is_valid', FALSE,
+                'error_message', format('Order status %s, close collateral %s, open collateral %s', v_order.status, v_close_collateral, v_live_collateral));
+            CONTINUE;
+        END IF;
+
+        v_pnl := v_payout - v_close_collateral;
+
+        INSERT INTO order_fills (
+            orderid,
+            userid,
+            exit_level_id,
+            collateral,
+            size,
+            close_price,
+            payout,
+            close_fee,
+            pnl,
+            funding
+        )
+        VALUES (
+            v_order.id,
+            v_order.userid,
+            v_level.id,
+            v_close_collateral,
+            v_close_collateral * v_order.leverage,
+            (v_item->>'close_price')::NUMERIC,
+            v_payout,
+            v_close_fee,
+            v_pnl,
+            v_funding
+        )
+        RETURNING * INTO v_fill;
+
+        UPDATE order_exit_levels
+        SET triggered_at = CURRENT_TIMESTAMP, fill_id = v_fill.id
+        WHERE order_exit_levels.id = v_level.id;
+
+        UPDATE users
+        SET
+            balance = balance + v_payout,
+            escrow_balance = escrow_balance - v_close_collateral
+        WHERE userid = v_order.userid;
+
+        PERFORM set_order_transition(
+            CASE v_level.kind WHEN 'tp' THEN 'take_profit' ELSE 'stop' END, 'rebalancer', (v_item->>'close_price')::NUMERIC);
+
+        UPDATE orders2
+        SET
+            collateral = collateral - v_close_collateral,
+            pnl = COALESCE(pnl, 0) + v_pnl,
+            close_fee = COALESCE(close_fee, 0) + v_close_fee,
+            funding_owed = funding_owed - v_funding,
+            funding_paid = funding_paid + v_funding,
+            modified_at = CURRENT_TIMESTAMP
+        WHERE orders2.id = v_order.id;
+
+        UPDATE global_state
+        SET value = value + CASE key
+                WHEN 'current_borrowed' THEN -v_close_collateral * (v_order.leverage - 1)
+                WHEN 'current_liquidity' THEN -v_close_value
+                WHEN 'total_pnl_profits' THEN GREATEST(v_pnl, 0)
+                WHEN 'total_pnl_losses' THEN LEAST(v_pnl, 0)
+                WHEN 'total_revenue' THEN v_close_fee
+                WHEN 'treasury_balance' THEN v_close_fee * 0.1
+                WHEN 'total_treasury_profits' THEN v_close_fee * 0.1
+                WHEN 'vault_balance' THEN v_close_fee * 0.1
+                WHEN 'total_vault_profits' THEN v_close_fee * 0.1
+                WHEN 'total_blp_rewards' THEN v_close_fee * 0.5
+                WHEN 'current_blp_rewards' THEN v_close_fee * 0.5
+                WHEN 'total_blu_rewards' THEN v_close_fee * 0.3
+                WHEN 'current_blu_rewards' THEN v_close_fee * 0.3
+            END,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE key IN (
+            'current_borrowed', 'current_liquidity', 'total_pnl_profits', 'total_pnl_losses', 'total_revenue',
+            'treasury_balance', 'total_treasury_profits', 'vault_balance', 'total_vault_profits',
+            'total_blp_rewards', 'current_blp_rewards', 'total_blu_rewards', 'current_blu_rewards'
+        );
+
+        v_results := v_results || jsonb_build_object('exit_level_id', v_level.id, 'fill', to_jsonb(v_fill), 'is_valid', TRUE);
+    END LOOP;
+
+    RETURN v_results;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION create_order_exit_levels(UUID, VARCHAR[], NUMERIC[], NUMERIC[], NUMERIC[]) TO public;
+GRANT EXECUTE ON FUNCTION get_order_exit_levels(UUID) TO public;
+GRANT EXECUTE ON FUNCTION get_exit_level_orders(VARCHAR, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION get_open_exit_levels(UUID[]) TO public;
+GRANT EXECUTE ON FUNCTION fill_exit_levels(jsonb) TO public;
@@ -0,0 +1,61 @@
+-- order history of a user, newest first, with the filters of get-orders-by-user-id
+-- pages are keyed on (created_at, id) so they stay stable while new orders come in
+-- total counts every order matching the filters, not only the ones after the cursor
+-- next_cursor_* is the last order of the page, NULL on the last page
+
+CREATE INDEX IF NOT EXISTS idx_orders2_userid_created_at ON orders2(userid, created_at DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION get_orders_page(
+    p_user_id VARCHAR,
+    p_status VARCHAR[] DEFAULT NULL,
+    p_order_type VARCHAR DEFAULT NULL,
+    p_pair VARCHAR DEFAULT NULL,
+    p_created_from TIMESTAMPTZ DEFAULT NULL,
+    p_created_to TIMESTAMPTZ DEFAULT NULL,
+    p_ended_from TIMESTAMPTZ DEFAULT NULL,
+    p_ended_to TIMESTAMPTZ DEFAULT NULL,
+    p_cursor_created_at TIMESTAMP DEFAULT NULL,
+    p_cursor_id UUID DEFAULT NULL,
+    p_limit INTEGER DEFAULT 50
+) RETURNS JSON AS $$
+DECLARE
+    v_total BIGINT;
+    v_orders JSON;
+    v_next_created_at TIMESTAMP;
+    v_next_id UUID;
+BEGIN
+    -- one extra row tells whether there is a next page
+    WITH filtered AS (
+        SELECT * FROM orders2
+        WHERE orders2.userid = p_user_id
+            AND (p_status IS NULL OR orders2.status = ANY(p_status))
+            AND (p_order_type IS NULL OR orders2.order_type = p_order_type)
+            AND (p_pair IS NULL OR orders2.pair = p_pair)
+            AND (p_created_from IS NULL OR orders2.created_at >= p_created_from)
+            AND (p_created_to IS NULL OR orders2.created_at < p_created_to)
+            AND (p_ended_from IS NULL OR orders2.ended_at >= p_ended_from)
+            AND (p_ended_to IS NULL OR orders2.ended_at < p_ended_to)
+    ), page AS (
+        SELECT *, ROW_NUMBER() OVER (ORDER BY filtered.created_at DESC, filtered.id DESC) AS page_row
+        FROM filtered
+        WHERE p_cursor_id IS NULL OR (filtered.created_at, filtered.id) < (p_cursor_created_at, p_cursor_id)
+        ORDER BY filtered.created_at DESC, filtered.id DESC
+        LIMIT p_limit + 1
+    )
+    SELECT
+        (SELECT COUNT(*) FROM filtered),
+        (SELECT COALESCE(json_agg(to_jsonb(page) - 'page_row' ORDER BY page.page_row), '[]'::JSON) FROM page WHERE page.page_row <= p_limit),
+        (SELECT page.created_at FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit)),
+        (SELECT page.id FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit))
+    INTO v_total, v_orders, v_next_created_at, v_next_id;
+
+    RETURN json_build_object(
+        'orders', v_orders,
+        'total', v_total,
+        'next_cursor_created_at', v_next_created_at,
+        'next_cursor_id', v_next_id
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION get_orders_page(VARCHAR, VARCHAR[], VARCHAR, VARCHAR, TIMESTAMPTZ, TIMESTAMPTZ, TIMESTAMPTZ, TIMESTAMPTZ, TIMESTAMP, UUID, INTEGER) TO public;
@@ -0,0 +1,562 @@
+-- linked orders, reduce-only close orders attached to a parent position in orders2
+-- a reduce-only order closes close_percent of the live collateral when the price crosses trigger_price
+--   kind 'tp' triggers in favour of the position, 'sl' against it, like order_exit_levels
+--   it only ever closes its parent, capped at the live collateral, so it cannot open, increase or flip a position
+-- bracket: a limit entry created with bracket prices gets a tp and an sl child signed with the entry,
+--   inactive until the entry fills, and linked one-cancels-other
+-- oco: reduce-only orders sharing an oco_group, the first one to fill cancels the others
+-- children follow their parent from triggers on orders2, so a limit fill, stop, liquidation or close
+-- written by process_batch_orders activates or cancels them in the same transaction
+
+CREATE TABLE IF NOT EXISTS reduce_only_orders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    parent_id UUID NOT NULL REFERENCES orders2(id) ON DELETE CASCADE,
+    userid VARCHAR(16) NOT NULL,
+    kind VARCHAR(2) NOT NULL CHECK (kind IN ('tp', 'sl')),
+    trigger_price NUMERIC(20, 6) NOT NULL CHECK (trigger_price > 0),
+    close_percent NUMERIC(7, 4) NOT NULL DEFAULT 100 CHECK (close_percent > 0 AND close_percent <= 100),
+    oco_group UUID,
+    is_bracket BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'unsigned'
+        CHECK (status IN ('unsigned', 'inactive', 'open', 'filled', 'canceled')),
+    fill_id UUID REFERENCES order_fills(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    signed_at TIMESTAMP,
+    triggered_at TIMESTAMP,
+    ended_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reduce_only_orders_parent_id ON reduce_only_orders(parent_id);
+CREATE INDEX IF NOT EXISTS idx_reduce_only_orders_oco_group ON reduce_only_orders(oco_group) WHERE oco_group IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_reduce_only_orders_open ON reduce_only_orders(trigger_price) WHERE status = 'open';
+
+COMMENT ON COLUMN reduce_only_orders.status IS 'unsigned -> inactive (parent is a limit entry) -> open (parent is pending) -> filled/canceled';
+COMMENT ON COLUMN reduce_only_orders.close_percent IS 'Share of the live collateral closed when triggered, 100 closes the position';
+COMMENT ON COLUMN reduce_only_orders.oco_group IS 'Orders of the group cancel each other, the first fill wins';
+COMMENT ON COLUMN reduce_only_orders.is_bracket IS 'Created with its parent entry and signed by the entry signature';
+
+ALTER TABLE order_fills ADD COLUMN IF NOT EXISTS reduce_only_order_id UUID REFERENCES reduce_only_orders(id);
+
+COMMENT ON COLUMN order_fills.reduce_only_order_id IS 'reduce-only order filled by the rebalancer, NULL otherwise';
+
+-- tp and sl children of a limit entry created with create_order, before it is signed
+CREATE OR REPLACE FUNCTION create_bracket_orders(
+    p_parent_id UUID,
+    p_tp_price NUMERIC,
+    p_sl_price NUMERIC
+) RETURNS SETOF reduce_only_orders AS $$
+DECLARE
+    v_order orders2;
+    v_oco_group UUID := gen_random_uuid();
+BEGIN
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_parent_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_parent_id;
+    END IF;
+    IF v_order.status != 'unsigned' OR v_order.lim_price IS NULL THEN
+        RAISE EXCEPTION 'Brackets can only be attached to unsigned limit orders, order status is %', v_order.status;
+    END IF;
+    IF p_tp_price IS NULL AND p_sl_price IS NULL THEN
+        RAISE EXCEPTION 'A bracket needs a take profit or a stop loss price';
+    END IF;
+    IF EXISTS (SELECT 1 FROM reduce_only_orders WHERE reduce_only_orders.parent_id = p_parent_id) THEN
+        RAISE EXCEPTION 'Order % already has a bracket', p_parent_id;
+    END IF;
+
+    RETURN QUERY
+    INSERT INTO reduce_only_orders (parent_id, userid, kind, trigger_price, oco_group, is_bracket)
+    SELECT p_parent_id, v_order.userid, b.kind, b.price, v_oco_group, TRUE
+    FROM (VALUES ('tp', p_tp_price), ('sl', p_sl_price)) AS b(kind, price)
+    WHERE b.price IS NOT NULL
+    RETURNING *;
+END;
+$$ LANGUAGE plpgsql;
+
+-- a reduce-only order on a limit entry or a pending position, p_oco_with links it to an open sibling of the same parent
+CREATE OR REPLACE FUNCTION unsigned_reduce_only_order(
+    p_parent_id UUID,
+    p_kind VARCHAR,
+    p_trigger_price NUMERIC,
+    p_close_percent NUMERIC,
+    p_oco_with UUID DEFAULT NULL
+) RETURNS JSON AS $$
+DECLARE
+    v_order orders2;
+    v_user users;
+    v_sibling reduce_only_orders;
+    v_oco_group UUID;
+    v_reduce_only_order reduce_only_orders;
+    v_signature_id UUID;
+    v_signature_hash VARCHAR(64);
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_parent_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_parent_id;
+    END IF;
+    IF v_order.status NOT IN ('limit', 'pending') THEN
+        RAISE EXCEPTION 'Reduce-only orders need a limit or pending parent, order status is %', v_order.status;
+    END IF;
+
+    SELECT * INTO v_user FROM users WHERE users.userid = v_order.userid;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'User with ID % does not exist.', v_order.userid;
+    END IF;
+
+    IF p_oco_with IS NOT NULL THEN
+        SELECT * INTO v_sibling FROM reduce_only_orders WHERE reduce_only_orders.id = p_oco_with FOR UPDATE;
+        IF NOT FOUND OR v_sibling.parent_id != p_parent_id THEN
+            RAISE EXCEPTION 'Reduce-only order % is not an order of %', p_oco_with, p_parent_id;
+        END IF;
+        IF v_sibling.status NOT IN ('inactive', 'open') THEN
+            RAISE EXCEPTION 'Reduce-only order % cannot be linked, status is %', p_oco_with, v_sibling.status;
+        END IF;
+        -- a group with a single signed order cancels nothing, so the sibling can join it before this order is signed
+        IF v_sibling.oco_group IS NULL THEN
+            UPDATE reduce_only_orders SET oco_group = gen_random_uuid()
+            WHERE reduce_only_orders.id = p_oco_with
+            RETURNING * INTO v_sibling;
+        END IF;
+        v_oco_group := v_sibling.oco_group;
+    END IF;
+
+    INSERT INTO reduce_only_orders (parent_id, userid, kind, trigger_price, close_percent, oco_group)
+    VALUES (p_parent_id, v_order.userid, p_kind, p_trigger_price, p_close_percent, v_oco_group)
+    RETURNING * INTO v_reduce_only_order;
+
+    SELECT signature_id, signature_hash, expiry_time
+    INTO v_signature_id, v_signature_hash, v_expiry_time
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'reduce_only_orders', v_reduce_only_order.id, 'reduce_only');
+
+    RETURN json_build_object(
+        'reduce_only_order', row_to_json(v_reduce_only_order),
+        'signature_id', v_signature_id,
+        'signature_hash', v_signature_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- activates a signed reduce-only order, inactive until a limit parent fills
+CREATE OR REPLACE FUNCTION signed_reduce_only_order(
+    p_reduce_only_order_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_reduce_only_order reduce_only_orders;
+    v_order orders2;
+    proof_ signature_validations;
+    v_is_valid BOOLEAN;
+    v_error_message TEXT;
+BEGIN
+    SELECT * INTO v_reduce_only_order FROM reduce_only_orders WHERE reduce_only_orders.id = p_reduce_only_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Reduce-only order with ID % does not exist.', p_reduce_only_order_id;
+    END IF;
+
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = v_reduce_only_order.parent_id FOR UPDATE;
+
+    SELECT * INTO proof_ FROM signature_validations WHERE signature_validations.id = p_signature_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
+    END IF;
+    IF proof_.reference_table != 'reduce_only_orders' OR proof_.reference_id != p_reduce_only_order_id THEN
+        RAISE EXCEPTION 'reduce-only order id and signature id mismatch';
+    END IF;
+
+    SELECT is_valid, error_message
+    INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
+
+    IF v_is_valid AND v_reduce_only_order.status != 'unsigned' THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Reduce-only order was already signed, status %s', v_reduce_only_order.status);
+    ELSIF v_is_valid AND v_order.status NOT IN ('limit', 'pending') THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Parent order status is %s', v_order.status);
+    END IF;
+
+    IF v_is_valid THEN
+        PERFORM use_user_nonce(v_reduce_only_order.userid, p_nonce);
+
+        UPDATE reduce_only_orders
+        SET
+            status = CASE WHEN v_order.status = 'pending' THEN 'open' ELSE 'inactive' END,
+            signed_at = CURRENT_TIMESTAMP
+        WHERE reduce_only_orders.id = p_reduce_only_order_id
+        RETURNING * INTO v_reduce_only_order;
+    ELSE
+        UPDATE reduce_only_orders
+        SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+        WHERE reduce_only_orders.id = p_reduce_only_order_id
+        RETURNING * INTO v_reduce_only_order;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'reduce_only_order', to_jsonb(v_reduce_only_order),
+        'is_valid', v_is_valid,
+        'error_message', v_error_message
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION unsigned_cancel_reduce_only_order(
+    p_reduce_only_order_id UUID
+) RETURNS JSON AS $$
+DECLARE
+    v_reduce_only_order reduce_only_orders;
+    v_user users;
+    v_signature_id UUID;
+    v_signature_hash VARCHAR(64);
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT * INTO v_reduce_only_order FROM reduce_only_orders WHERE reduce_only_orders.id = p_reduce_only_order_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Reduce-only order with ID % does not exist.', p_reduce_only_order_id;
+    END IF;
+    IF v_reduce_only_order.status NOT IN ('inactive', 'open') THEN
+        RAISE EXCEPTION 'Reduce-only orders of status % cannot be canceled', v_reduce_only_order.status;
+    END IF;
+
+    SELECT * INTO v_user FROM users WHERE users.userid = v_reduce_only_order.userid;
+
+    SELECT signature_id, signature_hash, expiry_time
+    INTO v_signature_id, v_signature_hash, v_expiry_time
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'reduce_only_orders', v_reduce_only_order.id, 'cancel');
+
+    RETURN json_build_object(
+        'order_id', v_reduce_only_order.id,
+        'signature_id', v_signature_id,
+        'signature_hash', v_signature_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- canceling one order of an oco group leaves the others open
+CREATE OR REPLACE FUNCTION signed_cancel_reduce_only_order(
+    p_reduce_only_order_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_reduce_only_order reduce_only_orders;
+    proof_ signature_validations;
+    v_is_valid BOOLEAN;
+    v_error_message TEXT;
+BEGIN
+    SELECT * INTO v_reduce_only_order FROM reduce_only_orders WHERE reduce_only_orders.id = p_reduce_only_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Reduce-only order with ID % does not exist.', p_reduce_only_order_id;
+    END IF;
+
+    SELECT * INTO proof_ FROM signature_validations WHERE signature_validations.id = p_signature_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
+    END IF;
+    IF proof_.reference_table != 'reduce_only_orders' OR proof_.reference_id != p_reduce_only_order_id THEN
+        RAISE EXCEPTION 'reduce-only order id and signature id mismatch';
+    END IF;
+
+    SELECT is_valid, error_message
+    INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
+
+    IF v_is_valid AND v_reduce_only_order.status NOT IN ('inactive', 'open') THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Reduce-only orders of status %s cannot be canceled', v_reduce_only_order.status);
+    END IF;
+
+    IF v_is_valid THEN
+        PERFORM use_user_nonce(v_reduce_only_order.userid, p_nonce);
+
+        UPDATE reduce_only_orders
+        SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+        WHERE reduce_only_orders.id = p_reduce_only_order_id
+        RETURNING * INTO v_reduce_only_order;
+    END IF;
+
+    RETURN jsonb_build_object(
+        'reduce_only_order', to_jsonb(v_reduce_only_order),
+        'is_valid', v_is_valid,
+        'error_message', v_error_message
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- children follow the parent status
+--   signed limit entry: bracket children become inactive
+--   entry filled (pending): bracket and inactive children open
+--   parent ended: every child still waiting is canceled
+CREATE OR REPLACE FUNCTION follow_parent_order() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status = OLD.status THEN
+        RETURN NULL;
+    END IF;
+
+    IF NEW.status = 'limit' THEN
+        UPDATE reduce_only_orders
+        SET status = 'inactive', signed_at = CURRENT_TIMESTAMP
+        WHERE reduce_only_orders.parent_id = NEW.id AND reduce_only_orders.is_bracket AND reduce_only_orders.status = 'unsigned';
+    ELSIF NEW.status = 'pending' THEN
+        UPDATE reduce_only_orders
+        SET status = 'open', signed_at = COALESCE(signed_at, CURRENT_TIMESTAMP)
+        WHERE reduce_only_orders.parent_id = NEW.id
+            AND (reduce_only_orders.status = 'inactive' OR reduce_only_orders.is_bracket AND reduce_only_orders.status = 'unsigned');
+    ELSIF NEW.status IN ('filled', 'canceled', 'closed', 'liquidated', 'stopped', 'expired') THEN
+        UPDATE reduce_only_orders
+        SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+        WHERE reduce_only_orders.parent_id = NEW.id AND reduce_only_orders.status IN ('unsigned', 'inactive', 'open');
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders2_follow_parent ON orders2;
+CREATE TRIGGER orders2_follow_parent
+    AFTER UPDATE OF status ON orders2
+    FOR EACH ROW EXECUTE FUNCTION follow_parent_order();
+
+-- the first fill of an oco group cancels its siblings
+CREATE OR REPLACE FUNCTION cancel_oco_siblings() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE reduce_only_orders
+    SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+    WHERE reduce_only_orders.oco_group = NEW.oco_group
+        AND reduce_only_orders.id != NEW.id
+        AND reduce_only_orders.status IN ('unsigned', 'inactive', 'open');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS reduce_only_orders_oco ON reduce_only_orders;
+CREATE TRIGGER reduce_only_orders_oco
+    AFTER UPDATE OF status ON reduce_only_orders
+    FOR EACH ROW
+    WHEN (NEW.status = 'filled' AND OLD.status != 'filled' AND NEW.oco_group IS NOT NULL)
+    EXECUTE FUNCTION cancel_oco_siblings();
+
+CREATE OR REPLACE FUNCTION get_reduce_only_orders(
+    p_parent_id UUID
+) RETURNS SETOF reduce_only_orders AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM reduce_only_orders
+    WHERE reduce_only_orders.parent_id = p_parent_id
+    ORDER BY reduce_only_orders.created_at;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION get_reduce_only_order_by_id(
+    p_reduce_only_order_id UUID
+) RETURNS reduce_only_orders AS $$
+DECLARE
+    v_reduce_only_order reduce_only_orders;
+BEGIN
+    SELECT * INTO v_reduce_only_order FROM reduce_only_orders WHERE reduce_only_orders.id = p_reduce_only_order_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Reduce-only order with ID % does not exist.', p_reduce_only_order_id;
+    END IF;
+    RETURN v_reduce_only_order;
+END;
+$$ LANGUAGE plpgsql;
+
+-- pending parents of a pair with an open reduce-only order inside the streamed price range
+CREATE OR REPLACE FUNCTION get_reduce_only_parent_orders(
+    p_pair_id VARCHAR,
+    p_min_price NUMERIC,
+    p_max_price NUMERIC
+) RETURNS SETOF orders2 AS $$
+BEGIN
+    RETURN QUERY
+    SELECT DISTINCT orders2.* FROM orders2
+    JOIN reduce_only_orders ON reduce_only_orders.parent_id = orders2.id
+    WHERE orders2.pair_id = p_pair_id
+        AND orders2.status = 'pending'
+        AND reduce_only_orders.status = 'open'
+        AND reduce_only_orders.trigger_price BETWEEN p_min_price AND p_max_price;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION get_open_reduce_only_orders(
+    p_parent_ids UUID[]
+) RETURNS SETOF reduce_only_orders AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM reduce_only_orders
+    WHERE reduce_only_orders.parent_id = ANY(p_parent_ids)
+        AND reduce_only_orders.status = 'open';
+END;
+$$ LANGUAGE plpgsql;
+
+-- fills triggered reduce-only orders, p_fills is a json array of
+--   { reduce_only_order_id, close_collateral, payout, close_fee, close_price, close_value, funding }
+-- a fill closing the live collateral closes the position, any other fill is a partial close like signed_partial_close_order
+-- a fill that no longer applies is skipped and reported
+CREATE OR REPLACE FUNCTION fill_reduce_only_orders(
+    p_fills jsonb
+) RETURNS jsonb AS $$
+DECLARE
+    v_item jsonb;
+    v_reduce_only_order reduce_only_orders;
+    v_order orders2;
+    v_fill order_fills;
+    v_live_collateral NUMERIC;
+    v_close_collateral NUMERIC;
+    v_payout NUMERIC;
+    v_close_fee NUMERIC;
+    v_close_price NUMERIC;
+    v_close_value NUMERIC;
+    v_funding NUMERIC;
+    v_pnl NUMERIC;
+    v_closes_position BOOLEAN;
+    v_remaining NUMERIC;
+    v_results jsonb := '[]'::jsonb;
+BEGIN
+    FOR v_item IN SELECT * FROM jsonb_array_elements(p_fills) LOOP
+        SELECT * INTO v_reduce_only_order FROM reduce_only_orders
+        WHERE reduce_only_orders.id = (v_item->>'reduce_only_order_id')::UUID FOR UPDATE;
+        IF NOT FOUND OR v_reduce_only_order.status != 'open' THEN
+            v_results := v_results || jsonb_build_object(
+                'reduce_only_order_id', v_item->>'reduce_only_order_id', 'is_valid', FALSE,
+                'error_message', 'Reduce-only order is missing or not open');
+            CONTINUE;
+        END IF;
+
+        SELECT * INTO v_order FROM orders2 WHERE orders2.id = v_reduce_only_order.parent_id FOR UPDATE;
+
+        v_close_collateral := (v_item->>'close_collateral')::NUMERIC;
+        v_payout := (v_item->>'payout')::NUMERIC;
+        v_close_fee := (v_item->>'close_fee')::NUMERIC;
+        v_close_price := (v_item->>'close_price')::NUMERIC;
+        v_close_value := (v_item->>'close_value')::NUMERIC;
+        v_funding := COALESCE((v_item->>'funding')::NUMERIC, 0);
+
+        v_live_collateral := v_order.collateral;
+        IF v_order.tp_at IS NOT NULL THEN
+            v_live_collateral := v_live_collateral - COALESCE(v_order.tp_collateral, 0);
+        END IF;
+
+        IF v_order.status != 'pending' OR v_close_collateral <= 0 OR v_close_collateral > v_live_collateral THEN
+            v_results := v_results || jsonb_build_object(
+                'reduce_only_order_id', v_reduce_only_order.id, 'is_valid', FALSE,
+                'error_message', format('Order status %s, close collateral %s, open collateral %s', v_order.status, v_close_collateral, v_live_collateral));
+            CONTINUE;
+        END IF;
+
+        v_closes_position := v_close_collateral = v_live_collateral;
+        v_pnl := v_payout - v_close_collateral;
+
+        INSERT INTO order_fills (
+            orderid,
+            userid,
+            reduce_only_order_id,
+            collateral,
+            size,
+            close_price,
+            payout,
+            close_fee,
+            pnl,
+            funding
+        )
+        VALUES (
+            v_order.id,
+            v_order.userid,
+            v_reduce_only_order.id,
+            v_close_collateral,
+            v_close_collateral * v_order.leverage,
+            v_close_price,
+            v_payout,
+            v_close_fee,
+            v_pnl,
+            v_funding
+        )
+        RETURNING * INTO v_fill;
+
+        -- filled before the parent update, so the parent trigger only cancels the other children
+        UPDATE reduce_only_orders
+        SET status = 'filled', fill_id = v_fill.id, triggered_at = CURRENT_TIMESTAMP, ended_at = CURRENT_TIMESTAMP
+        WHERE reduce_only_orders.id = v_reduce_only_order.id;
+
+        UPDATE users
+        SET
+            balance = balance + v_payout,
+            escrow_balance = escrow_balance - v_close_collateral
+        WHERE userid = v_order.userid;
+
+        PERFORM set_order_transition('close', 'rebalancer', v_close_price);
+
+        IF v_closes_position THEN
+            UPDATE orders2
+            SET
+                status = 'closed',
+                close_price = v_close_price,
+                pnl = COALESCE(pnl, 0) + v_pnl,
+                close_fee = COALESCE(close_fee, 0) + v_close_fee,
+                funding_owed = 0,
+                funding_paid = funding_paid + v_funding,
+                ended_at = CURRENT_TIMESTAMP
+            WHERE orders2.id = v_order.id;
+        ELSE
+            v_remaining := (v_live_collateral - v_close_collateral) / v_live_collateral;
+
+            UPDATE orders2
+            SET
+                collateral = collateral - v_close_collateral,
+                tp_value = CASE WHEN tp_at IS NULL THEN ROUND(tp_value * v_remaining, 6) ELSE tp_value END,
+                tp_collateral = CASE WHEN tp_at IS NULL THEN ROUND(tp_collateral * v_remaining, 6) ELSE tp_collateral END,
+                pnl = COALESCE(pnl, 0) + v_pnl,
+                close_fee = COALESCE(close_fee, 0) + v_close_fee,
+                funding_owed = funding_owed - v_funding,
+                funding_paid = funding_paid + v_funding,
+                modified_at = CURRENT_TIMESTAMP
+            WHERE orders2.id = v_order.id;
+
+            UPDATE order_exit_levels
+            SET collateral = GREATEST(ROUND(collateral * v_remaining, 6), 0.000001)
+            WHERE order_exit_levels.orderid = v_order.id AND order_exit_levels.triggered_at IS NULL;
+        END IF;
+
+        UPDATE global_state
+        SET value = value + CASE key
+                WHEN 'current_borrowed' THEN -v_close_collateral * (v_order.leverage - 1)
+                WHEN 'current_liquidity' THEN -v_close_value
+                WHEN 'current_orders_active' THEN CASE WHEN v_closes_position THEN -1 ELSE 0 END
+                WHEN 'current_orders_pending' THEN CASE WHEN v_closes_position THEN -1 ELSE 0 END
+                WHEN 'total_pnl_profits' THEN GREATEST(v_pnl, 0)
+                WHEN 'total_pnl_losses' THEN LEAST(v_pnl, 0)
+                WHEN 'total_revenue' THEN v_close_fee
+                WHEN 'treasury_balance' THEN v_close_fee * 0.1
+                WHEN 'total_treasury_profits' THEN v_close_fee * 0.1
+                WHEN 'vault_balance' THEN v_close_fee * 0.1
+                WHEN 'total_vault_profits' THEN v_close_fee * 0.1
+                WHEN 'total_blp_rewards' THEN v_close_fee * 0.5
+                WHEN 'current_blp_rewards' THEN v_close_fee * 0.5
+                WHEN 'total_blu_rewards' THEN v_close_fee * 0.3
+                WHEN 'current_blu_rewards' THEN v_close_fee * 0.3
+            END,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE key IN (
+            'current_borrowed', 'current_liquidity', 'current_orders_active', 'current_orders_pending',
+            'total_pnl_profits', 'total_pnl_losses', 'total_revenue',
+            'treasury_balance', 'total_treasury_profits', 'vault_balance', 'total_vault_profits',
+            'total_blp_rewards', 'current_blp_rewards', 'total_blu_rewards', 'current_blu_rewards'
+        );
+
+        v_results := v_results || jsonb_build_object(
+            'reduce_only_order_id', v_reduce_only_order.id, 'fill', to_jsonb(v_fill), 'is_valid', TRUE);
+    END LOOP;
+
+    RETURN v_results;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION create_bracket_orders(UUID, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION unsigned_reduce_only_order(UUID, VARCHAR, NUMERIC, NUMERIC, UUID) TO public;
+GRANT EXECUTE ON FUNCTION signed_reduce_only_order(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION unsigned_cancel_reduce_only_order(UUID) TO public;
+GRANT EXECUTE ON FUNCTION signed_cancel_reduce_only_order(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION get_reduce_only_orders(UUID) TO public;
+GRANT EXECUTE ON FUNCTION get_reduce_only_order_by_id(UUID) TO public;
+GRANT EXECUTE ON FUNCTION get_reduce_only_parent_orders(VARCHAR, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION get_open_reduce_only_orders(UUID[]) TO public;
+GRANT EXECUTE ON FUNCTION fill_reduce_only_orders(jsonb) TO public;
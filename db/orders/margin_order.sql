@@ -0,0 +1,218 @@
+-- add/remove margin on a pending position
+-- the position size (collateral * leverage) is fixed, so moving collateral moves the leverage,
+-- the liquidation price and the borrowed amount (collateral * (leverage - 1))
+-- the requested values are stored as an order_modifications row and applied once signed
+-- tp value/collateral are only passed while the take profit is open, otherwise the order values are kept
+
+CREATE OR REPLACE FUNCTION unsigned_margin_order(
+    p_order_id UUID,
+    p_collateral NUMERIC,
+    p_leverage NUMERIC,
+    p_liq_price NUMERIC,
+    p_max_price NUMERIC,
+    p_tp_value NUMERIC,
+    p_tp_collateral NUMERIC
+) RETURNS JSON AS $$
+DECLARE
+    v_order_modification order_modifications;
+    v_order orders2;
+    v_user users;
+    v_signature_id UUID;
+    v_signature_hash VARCHAR(64);
+    v_expiry_time TIMESTAMP WITH TIME ZONE;
+    v_action TEXT;
+BEGIN
+    SELECT * INTO v_order
+    FROM orders2 WHERE orders2.id = p_order_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_order_id;
+    END IF;
+
+    SELECT * INTO v_user
+    FROM users WHERE users.userid = v_order.userid;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'User with ID % does not exist.', v_order.userid;
+    END IF;
+
+    IF v_order.status != 'pending' THEN
+        RAISE EXCEPTION 'Margin can only be changed on pending orders, found %', v_order.status;
+    END IF;
+
+    IF p_collateral = v_order.collateral THEN
+        RAISE EXCEPTION 'Margin change cannot be zero';
+    ELSIF p_collateral > v_order.collateral THEN
+        v_action := 'add_margin';
+        IF v_user.balance < p_collateral - v_order.collateral THEN
+            RAISE EXCEPTION 'Insufficient balance to add margin. Required: %, Available: %', p_collateral - v_order.collateral, v_user.balance;
+        END IF;
+    ELSE
+        v_action := 'remove_margin';
+    END IF;
+
+    IF p_leverage > 1250 THEN
+        RAISE EXCEPTION 'Leverage cannot exceed 1250x.';
+    END IF;
+
+    INSERT INTO order_modifications (
+        orderid,
+        userid,
+        leverage,
+        collateral,
+        entry_price,
+        liq_price,
+        max_price,
+        max_value,
+        lim_price,
+        stop_price,
+        tp_price,
+        tp_value,
+        tp_collateral,
+        pnl,
+        open_fee,
+        close_fee,
+        prev_modified_at
+    )
+    VALUES (
+        p_order_id,
+        v_order.userid,
+        p_leverage,
+        p_collateral,
+        v_order.entry_price,
+        p_liq_price,
+        p_max_price,
+        p_collateral * 10,
+        v_order.lim_price,
+        v_order.stop_price,
+        v_order.tp_price,
+        COALESCE(p_tp_value, v_order.tp_value),
+        COALESCE(p_tp_collateral, v_order.tp_collateral, 0),
+        v_order.pnl,
+        v_order.open_fee,
+        v_order.close_fee,
+        v_order.modified_at
+    )
+    RETURNING * INTO v_order_modification;
+
+    SELECT signature_id, signature_hash, expiry_time
+    INTO v_signature_id, v_signature_hash, v_expiry_time
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'order_modifications', v_order_modification.id, v_action);
+
+    RETURN json_build_object(
+        'order_modification_id', v_order_modification.id,
+        'signature_id', v_signature_id,
+        'signature_hash', v_signature_hash,
+        'expiry_time', v_expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION signed_margin_order(
+    p_order_modification_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    signed_order orders2;
+    v_order orders2;
+    v_modification order_modifications;
+    v_user users;
+    proof_ signature_validations;
+    v_is_valid BOOLEAN;
+    v_error_message TEXT;
+    v_delta NUMERIC;
+    v_live_collateral NUMERIC;
+BEGIN
+    SELECT * INTO v_modification FROM order_modifications WHERE order_modifications.id = p_order_modification_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order modification with ID % does not exist.', p_order_modification_id;
+    END IF;
+    IF v_modification.signed_at IS NOT NULL OR v_modification.canceled_at IS NOT NULL THEN
+        RAISE EXCEPTION 'Order modification % was already processed', p_order_modification_id;
+    END IF;
+
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = v_modification.orderid FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', v_modification.orderid;
+    END IF;
+
+    SELECT * INTO v_user FROM users WHERE users.userid = v_order.userid FOR UPDATE;
+
+    SELECT * INTO proof_ FROM signature_validations WHERE signature_validations.id = p_signature_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
+    END IF;
+    IF proof_.reference_table != 'order_modifications' OR proof_.reference_id != p_order_modification_id THEN
+        RAISE EXCEPTION 'order modification id and signature id mismatch';
+    END IF;
+
+    SELECT is_valid, error_message
+    INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
+
+    v_delta := v_modification.collateral - v_order.collateral;
+    v_live_collateral := v_order.collateral;
+    IF v_order.tp_at IS NOT NULL THEN
+        v_live_collateral := v_live_collateral - COALESCE(v_order.tp_collateral, 0);
+    END IF;
+
+    IF v_is_valid AND v_order.modified_at IS DISTINCT FROM v_modification.prev_modified_at THEN
+        v_is_valid := FALSE;
+        v_error_message := 'Order was modified since the request was created';
+    ELSIF v_is_valid AND v_order.status != 'pending' THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Margin can only be changed on pending orders, found %s', v_order.status);
+    ELSIF v_is_valid AND v_delta > 0 AND v_user.balance < v_delta THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Insufficient balance to add margin. Required: %s, Available: %s', v_delta, v_user.balance);
+    END IF;
+
+    IF v_is_valid THEN
+        PERFORM use_user_nonce(v_order.userid, p_nonce);
+
+        -- a positive delta moves balance into escrow, a negative delta releases it
+        UPDATE users
+        SET
+            balance = balance - v_delta,
+            escrow_balance = escrow_balance + v_delta
+        WHERE userid = v_order.userid;
+
+        PERFORM set_order_transition('margin', 'user');
+
+        UPDATE orders2
+        SET
+            leverage = v_modification.leverage,
+            collateral = v_modification.collateral,
+            liq_price = v_modification.liq_price,
+            max_price = v_modification.max_price,
+            tp_value = v_modification.tp_value,
+            tp_collateral = v_modification.tp_collateral,
+            modified_at = CURRENT_TIMESTAMP
+        WHERE orders2.id = v_order.id;
+
+        -- borrowed = collateral * (leverage - 1), the leverage is rounded so the size can move by a few cents
+        UPDATE global_state
+        SET value = value
+                + (v_live_collateral + v_delta) * (v_modification.leverage - 1)
+                - v_live_collateral * (v_order.leverage - 1),
+            updated_at = CURRENT_TIMESTAMP
+        WHERE key = 'current_borrowed';
+
+        UPDATE order_modifications
+        SET signed_at = CURRENT_TIMESTAMP
+        WHERE order_modifications.id = p_order_modification_id;
+    ELSE
+        UPDATE order_modifications
+        SET canceled_at = CURRENT_TIMESTAMP
+        WHERE order_modifications.id = p_order_modification_id;
+    END IF;
+
+    SELECT * INTO signed_order FROM orders2 WHERE orders2.id = v_order.id;
+    RETURN jsonb_build_object(
+        'order', to_jsonb(signed_order),
+        'is_valid', v_is_valid,
+        'error_message', v_error_message
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION unsigned_margin_order(UUID, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION signed_margin_order(UUID, UUID, BIGINT) TO public;
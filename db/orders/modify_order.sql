@@ -1,43 +1,23 @@
 -- long <> short cannot be replaced
 -- pair cannot be changed
+-- leverage and collateral are changed through add/remove margin, not modify
 
-
--- collateral can change
--- entry_price is augemented?
--- close price an be changed
 -- liquidation is changed by inference
 -- max price is changed by inference
--- max value is changed by inference
 -- limit price can only be changed if the limit has not been reached or unsigned state
--- tp price/value/collateral/at is complicated
+-- stop price can be changed while the order is unsigned, limit or pending, a trailing stop can only be removed
+-- tp price/value/collateral can be changed until the take profit has been taken (tp_at is set)
 -- modified at is implict
--- pnl is not reset, so can be complicated
--- open fee is modified
-
--- upon modifying the order, the collateral must reflect the new values
--- this means if a new tp or change in collateral we need to deduct winnings
-
--- reduced leverage does NOT get fees back, increased leverage added difference in fee
--- for now, utilization fee will not effect the modified trade
 
 CREATE OR REPLACE FUNCTION unsigned_modify_order(
     p_order_id UUID,
-    p_entry_price NUMERIC,
-    p_leverage NUMERIC,
-    p_collateral NUMERIC,
+    p_lim_price NUMERIC,
     p_stop_price NUMERIC,
     p_liq_price NUMERIC,
     p_max_price NUMERIC,
-    p_max_value NUMERIC,
-    p_lim_price NUMERIC,
     p_tp_price NUMERIC,
     p_tp_value NUMERIC,
-    p_tp_collateral NUMERIC,
-    -- p_tp_at TIMESTAMP, not an input but needs to be reset upon new tp
-    p_pnl NUMERIC,
-    p_open_fee NUMERIC,
-    p_close_fee NUMERIC,
-    p_prev_modified_at TIMESTAMP
+    p_tp_collateral NUMERIC
 ) RETURNS JSON AS $$
 DECLARE
     v_order_modification order_modifications;
@@ -46,13 +26,11 @@ DECLARE
     v_signature_id UUID;
     v_signature_hash VARCHAR(64);
     v_expiry_time TIMESTAMP WITH TIME ZONE;
-    v_collateral_operation TEXT;
 BEGIN
-    -- Select target order to sign
     SELECT * INTO v_order
-    FROM orders2 WHERE orders2.id = order_id;
+    FROM orders2 WHERE orders2.id = p_order_id;
     IF NOT FOUND THEN
-        RAISE EXCEPTION 'Order with ID % does not exist.', order_id;
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_order_id;
     END IF;
 
     SELECT * INTO v_user
@@ -61,123 +39,40 @@ BEGIN
         RAISE EXCEPTION 'User with ID % does not exist.', v_order.userid;
     END IF;
 
-    -- Backend must pre-execute this
-    IF tp_value = 0 AND tp_collateral != NULL THEN
-        v_order.collateral := v_order.collateral - v_order.tp_collateral;
-        v_order.max_value := v_order.collateral * 10;
-    END IF;
-
-    -- Pairty check correct last modified timestamp
-    IF p_prev_modified_at != v_order.modified_at THEN
-        RAISE EXCEPTION 'Invalid modify timestamp: expected %, found %', p_prev_modified_at, v_order.modified_at;
+    IF v_order.status NOT IN ('unsigned', 'limit', 'pending') THEN
+        RAISE EXCEPTION 'Orders of status % cannot be modified', v_order.status;
     END IF;
 
-    -- invalid order
-    IF v_order.ended_at != NULL THEN
-        RAISE EXCEPTION 'Invalid order state: ended at %', v_order.ended_at;
-    END IF;
-
-    IF p_open_fee < v_order.open_fee THEN 
-        RAISE EXCEPTION 'Invalid open fee, open fee cannot be reduced';
-    END IF;
-    
-    IF p_close_fee < v_order.close_fee THEN 
-        RAISE EXCEPTION 'Invalid close fee, close fee cannot be reduced';
-    END IF;
-
-    IF p_lim_price IS NOT NULL AND v_order.status NOT IN ('limit', 'unsigned') THEN
+    IF p_lim_price IS DISTINCT FROM v_order.lim_price AND v_order.status NOT IN ('limit', 'unsigned') THEN
         RAISE EXCEPTION 'Cannot modify limit price for an order with status %', v_order.status;
     END IF;
 
-
-    IF p_leverage <= 1.1 OR p_leverage > 1250 THEN
-        RAISE EXCEPTION 'Invalid leverage, required: 1.1 < value <= 1250';
+    IF v_order.tp_at IS NOT NULL AND (p_tp_price IS DISTINCT FROM v_order.tp_price OR p_tp_collateral IS DISTINCT FROM v_order.tp_collateral) THEN
+        RAISE EXCEPTION 'Take profit was already taken at %', v_order.tp_at;
     END IF;
 
-    IF p_leverage > v_order.leverage THEN
-        IF p_open_fee <= v_order.open_fee THEN 
-            RAISE EXCEPTION 'Invalid open fee, increased leverage requires increased open fee';
-        END IF;
-    ELSIF p_leverage < v_order.leverage THEN
-        IF p_close_fee <= v_order.close_fee THEN 
-            RAISE EXCEPTION 'Invalid close fee, decreased leverage requires decreased close fee';
-        END IF;
-    END IF;
-
-    -- when leverage is unchanged
-    IF p_tp_collateral >= p_collateral THEN
-        RAISE EXCEPTION 'Invalid take profit collateral, collateral % must exceed take profit collateral %', p_collateral, p_tp_collateral;
-    END IF;
-
-    IF p_tp_value >= v_order.max_value THEN
-        RAISE EXCEPTION 'Invalid take profit value, max value % must exceed take profit value %', v_order.max_value, p_tp_value;
-    END IF;
-
-
-    IF v_order.collateral < p_collateral THEN
-        IF p_max_value < v_order.max_value THEN
-            RAISE EXCEPTION 'Invalid max price, when adding collateral max price must be increased';
-        END IF;
-    ELSIF v_order.collateral > p_collateral THEN
-        IF p_max_value > v_order.max_value THEN
-            RAISE EXCEPTION 'Invalid max price, when removing collateral max price must be reduced';
-        END IF;
-    ELSE -- v_order.collateral = p_collateral
-        IF p_max_price != v_order.max_price THEN
-            RAISE EXCEPTION 'Invalid max price, when static collateral max price cannot change';
-        END IF;
-
-        IF p_max_value != v_order.max_value THEN
-            RAISE EXCEPTION 'Invalid max price, when static collateral max price cannot change';
-        END IF;
+    IF p_tp_collateral IS NOT NULL AND p_tp_collateral >= v_order.collateral THEN
+        RAISE EXCEPTION 'Invalid take profit collateral, collateral % must exceed take profit collateral %', v_order.collateral, p_tp_collateral;
     END IF;
 
     IF v_order.order_type = 'long' THEN
-        IF p_stop_price <= p_liq_price THEN
-            RAISE EXCEPTION 'Stop price cannot exceed liquidation price';
+        IF p_stop_price IS NOT NULL AND p_stop_price <= p_liq_price THEN
+            RAISE EXCEPTION 'Stop price must exceed liquidation price';
         END IF;
-
-        IF p_tp_price >= v_order.max_price THEN
-            RAISE EXCEPTION 'Invalid take profit price, max price % must exceed take profit price %', v_order.max_price, p_tp_price;
-        END IF;
-
-        -- p_max_price
-        -- p_max_value
-        IF v_order.collateral < p_collateral THEN
-            IF p_max_price > v_order.max_price THEN
-                RAISE EXCEPTION 'Invalid long max price, when adding collateral max price must be increased';
-            END IF;
-        ELSIF v_order.collateral > p_collateral THEN
-            IF p_max_price < v_order.max_price THEN
-                RAISE EXCEPTION 'Invalid long max price, when removing collateral max price must be reduced';
-            END IF;
+        IF p_tp_price IS NOT NULL AND p_tp_price >= p_max_price THEN
+            RAISE EXCEPTION 'Invalid take profit price, max price % must exceed take profit price %', p_max_price, p_tp_price;
         END IF;
     ELSIF v_order.order_type = 'short' THEN
-        IF p_stop_price >= p_liq_price THEN
-            RAISE EXCEPTION 'Liquidiation price cannot exceed stop price';
+        IF p_stop_price IS NOT NULL AND p_stop_price >= p_liq_price THEN
+            RAISE EXCEPTION 'Liquidiation price must exceed stop price';
         END IF;
-
-        IF p_tp_price <= v_order.max_price THEN
-            RAISE EXCEPTION 'Invalid take profit price, take profit price % must exceed max price %', p_tp_price, v_order.max_price;
-        END IF;
-
-        -- p_max_price
-        -- p_max_value
-        IF v_order.collateral < p_collateral THEN
-            IF p_max_price < v_order.max_price THEN
-                RAISE EXCEPTION 'Invalid short max price, when adding collateral max price must be reduced';
-            END IF;
-        ELSIF v_order.collateral > p_collateral THEN
-            IF p_max_price > v_order.max_price THEN
-                RAISE EXCEPTION 'Invalid short max price, when removing collateral max price must be increased';
-            END IF;
+        IF p_tp_price IS NOT NULL AND p_tp_price <= p_max_price THEN
+            RAISE EXCEPTION 'Invalid take profit price, take profit price % must exceed max price %', p_tp_price, p_max_price;
         END IF;
     ELSE
         RAISE EXCEPTION 'Unknown order type % found', v_order.order_type;
     END IF;
 
-
-    -- Insert the order modification using the provided parameters
     INSERT INTO order_modifications (
         orderid,
         userid,
@@ -194,35 +89,35 @@ BEGIN
         tp_collateral,
         pnl,
         open_fee,
-        close_fee
+        close_fee,
+        prev_modified_at
     )
     VALUES (
         p_order_id,
         v_order.userid,
-        p_leverage,
-        p_collateral,
-        p_entry_price,
+        v_order.leverage,
+        v_order.collateral,
+        v_order.entry_price,
         p_liq_price,
         p_max_price,
-        p_max_value,
+        v_order.max_value,
         p_lim_price,
         p_stop_price,
         p_tp_price,
         p_tp_value,
-        p_tp_collateral,
-        p_pnl,
-        p_open_fee,
-        p_close_fee
+        COALESCE(p_tp_collateral, 0),
+        v_order.pnl,
+        v_order.open_fee,
+        v_order.close_fee,
+        v_order.modified_at
     )
     RETURNING * INTO v_order_modification;
 
     -- Create signature verification request
     SELECT signature_id, signature_hash, expiry_time
     INTO v_signature_id, v_signature_hash, v_expiry_time
-    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'order_modification', v_order_modification.id, 'cancel');
-    
+    FROM generate_signature_hash(v_user.wallet_address, v_user.wallet_type, 'order_modifications', v_order_modification.id, 'modify');
 
-    -- Return the result as JSON
     RETURN json_build_object(
         'order_modification_id', v_order_modification.id,
         'signature_id', v_signature_id,
@@ -232,31 +127,30 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
--- need to validate timestap (!closed_at, now > modified_at, created_at > modified_at)
--- need to update_global_state_on_modify function
--- need to apply new tp_at to null when applicable
-
 CREATE OR REPLACE FUNCTION signed_modify_order(
     p_order_modification_id UUID,
-    p_signature_id UUID
+    p_signature_id UUID,
+    p_nonce BIGINT
 ) RETURNS jsonb AS $$
 DECLARE
-    total_balance_ NUMERIC(30, 6);
     signed_order orders2;
     v_order orders2;
+    v_modification order_modifications;
     proof_ signature_validations;
     v_is_valid BOOLEAN;
     v_error_message TEXT;
 BEGIN
-    -- select target order to sign
-    SELECT o.* INTO v_order FROM orders2 o WHERE o.id = order_id;
+    SELECT * INTO v_modification FROM order_modifications WHERE order_modifications.id = p_order_modification_id;
     IF NOT FOUND THEN
-        RAISE EXCEPTION 'Order with ID % does not exist.', order_id;
+        RAISE EXCEPTION 'Order modification with ID % does not exist.', p_order_modification_id;
+    END IF;
+    IF v_modification.signed_at IS NOT NULL OR v_modification.canceled_at IS NOT NULL THEN
+        RAISE EXCEPTION 'Order modification % was already processed', p_order_modification_id;
     END IF;
 
-    -- check if order can be signed
-    IF order_.status != 'unsigned' AND order_.status != 'limit' THEN
-        RAISE EXCEPTION 'Only orders with status limit or unsigned can be canceled';
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = v_modification.orderid FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', v_modification.orderid;
     END IF;
 
     -- select signature proof
@@ -264,50 +158,82 @@ BEGIN
     IF NOT FOUND THEN
         RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
     END IF;
-    IF proof_.reference_table != 'orders2' OR proof_.reference_id != order_id THEN
-        RAISE EXCEPTION 'order id and signature id mismatch';
+    IF proof_.reference_table != 'order_modifications' OR proof_.reference_id != p_order_modification_id THEN
+        RAISE EXCEPTION 'order modification id and signature id mismatch';
     END IF;
 
-    -- validate request
-    SELECT is_valid, error_message 
+    SELECT is_valid, error_message
     INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
-    
-    -- IF NOT v_is_valid THEN
-    --     RAISE EXCEPTION 'Signature validation failed for order %: %', order_id, v_error_message;
-    -- END IF;
 
-    
+    -- the order may have moved on since the modification was requested
+    IF v_is_valid AND v_order.modified_at IS DISTINCT FROM v_modification.prev_modified_at THEN
+        v_is_valid := FALSE;
+        v_error_message := 'Order was modified since the request was created';
+    ELSIF v_is_valid AND v_order.status NOT IN ('unsigned', 'limit', 'pending') THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Orders of status %s cannot be modified', v_order.status);
+    ELSIF v_is_valid AND v_modification.lim_price IS DISTINCT FROM v_order.lim_price AND v_order.status NOT IN ('limit', 'unsigned') THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Cannot modify limit price for an order with status %s', v_order.status);
+    END IF;
 
     IF v_is_valid THEN
-        -- if a limit order is cancelled we need to return funds to user
-        IF order_.status = 'limit' THEN
-            UPDATE users
-            SET 
-                balance = balance + order_.collateral + order_.open_fee,
-                escrow_balance = escrow_balance - order_.collateral - order_.open_fee
-            WHERE userid = order_.userid;
-        END IF;
-    
-        -- Update the order status to pending
+        PERFORM use_user_nonce(v_order.userid, p_nonce);
+
+        PERFORM set_order_transition('modify', 'user');
+
         UPDATE orders2
         SET
-            status = 'canceled',
-            ended_at = CURRENT_TIMESTAMP
-        WHERE orders2.id = order_id;
+            lim_price = v_modification.lim_price,
+            -- a trailing stop keeps the level it ratcheted to since the request, removing the stop removes the trail
+            stop_price = CASE WHEN v_order.trail_extreme IS NOT NULL AND v_modification.stop_price IS NOT NULL
+                THEN v_order.stop_price
+                ELSE v_modification.stop_price
+            END,
+            trail_amount = CASE WHEN v_modification.stop_price IS NULL THEN NULL ELSE orders2.trail_amount END,
+            trail_percent = CASE WHEN v_modification.stop_price IS NULL THEN NULL ELSE orders2.trail_percent END,
+            trail_extreme = CASE WHEN v_modification.stop_price IS NULL THEN NULL ELSE orders2.trail_extreme END,
+            liq_price = v_modification.liq_price,
+            max_price = v_modification.max_price,
+            tp_price = v_modification.tp_price,
+            tp_value = v_modification.tp_value,
+            tp_collateral = v_modification.tp_collateral,
+            modified_at = CURRENT_TIMESTAMP
+        WHERE orders2.id = v_order.id;
+
+        UPDATE order_modifications
+        SET signed_at = CURRENT_TIMESTAMP
+        WHERE order_modifications.id = p_order_modification_id;
+    ELSE
+        UPDATE order_modifications
+        SET canceled_at = CURRENT_TIMESTAMP
+        WHERE order_modifications.id = p_order_modification_id;
     END IF;
 
-    UPDATE global_state
-    SET value = value + 1,
-        updated_at = CURRENT_TIMESTAMP
-    WHERE key = 'total_orders_canceled';
-
-    -- Return the updated order
-    SELECT * INTO signed_order FROM orders2 WHERE orders2.id = order_id;
+    SELECT * INTO signed_order FROM orders2 WHERE orders2.id = v_order.id;
     RETURN jsonb_build_object(
         'order', to_jsonb(signed_order),
         'is_valid', v_is_valid,
-        'error_massage', v_error_message
+        'error_message', v_error_message
     );
+END;
+$$ LANGUAGE plpgsql;
 
+CREATE OR REPLACE FUNCTION get_order_modification_by_id(
+    p_order_modification_id UUID
+) RETURNS jsonb AS $$
+DECLARE
+    v_modification order_modifications;
+BEGIN
+    SELECT * INTO v_modification FROM order_modifications WHERE order_modifications.id = p_order_modification_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order modification with ID % does not exist.', p_order_modification_id;
+    END IF;
+
+    RETURN to_jsonb(v_modification);
 END;
-$$ LANGUAGE plpgsql;
\ No newline at end of file
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION unsigned_modify_order(UUID, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION signed_modify_order(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION get_order_modification_by_id(UUID) TO public;
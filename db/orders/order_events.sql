@@ -0,0 +1,94 @@
+-- the lifecycle of each order: created, signed, limit triggered, take profit, stop, liquidation, close, cancel and modify
+-- every insert of orders2 and every update that changes its status, collateral, take profit or terms is an order_events row
+-- funding settlement, trailing stop ratchets and other bookkeeping updates are not events
+-- the action, actor and price come from set_order_transition or set_order_transitions (db/orders/order_state.sql),
+-- an update that keeps the status and names no transition is bookkeeping
+-- events of one transaction keep the order they were written in through seq
+
+ALTER TABLE order_events ALTER COLUMN from_status DROP NOT NULL;
+ALTER TABLE order_events ADD COLUMN IF NOT EXISTS price NUMERIC(20, 6);
+ALTER TABLE order_events ADD COLUMN IF NOT EXISTS fee NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE order_events ADD COLUMN IF NOT EXISTS collateral_delta NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE order_events ADD COLUMN IF NOT EXISTS seq BIGSERIAL NOT NULL;
+ALTER TABLE order_events ALTER COLUMN created_at SET DEFAULT clock_timestamp();
+
+DROP INDEX IF EXISTS idx_order_events_order_id;
+CREATE INDEX IF NOT EXISTS idx_order_events_order_seq ON order_events(order_id, seq);
+
+COMMENT ON COLUMN order_events.from_status IS 'NULL for the create event';
+COMMENT ON COLUMN order_events.price IS 'Price the event happened at, NULL for cancels, expiries and modifications';
+COMMENT ON COLUMN order_events.fee IS 'Open and close fees charged by the event';
+COMMENT ON COLUMN order_events.collateral_delta IS 'Change of the order collateral, the whole collateral for the create event';
+COMMENT ON COLUMN order_events.seq IS 'Write order, NOW() is the same for every event of a transaction';
+
+CREATE OR REPLACE FUNCTION record_order_event() RETURNS TRIGGER AS $$
+DECLARE
+    v_action VARCHAR;
+    v_actor VARCHAR;
+    v_price NUMERIC;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO order_events (order_id, from_status, to_status, action, actor, price, fee, collateral_delta)
+        VALUES (
+            NEW.id,
+            NULL,
+            NEW.status,
+            'create',
+            CASE WHEN NEW.algo_order_id IS NOT NULL THEN 'rebalancer' ELSE 'user' END,
+            COALESCE(NEW.lim_price, NEW.entry_price),
+            COALESCE(NEW.open_fee, 0) + COALESCE(NEW.close_fee, 0),
+            NEW.collateral
+        );
+        RETURN NULL;
+    END IF;
+
+    SELECT action, actor, price INTO v_action, v_actor, v_price FROM current_order_transition(NEW.id);
+    IF v_action IS NULL THEN
+        -- a status change without a transition was already rejected by check_order_transition
+        RETURN NULL;
+    END IF;
+
+    v_price := COALESCE(v_price, CASE v_action
+        WHEN 'sign' THEN COALESCE(NEW.lim_price, NEW.entry_price)
+        WHEN 'trigger' THEN NEW.entry_price
+        WHEN 'take_profit' THEN NEW.tp_price
+        WHEN 'fill' THEN NEW.close_price
+        WHEN 'stop' THEN NEW.close_price
+        WHEN 'liquidate' THEN NEW.close_price
+        WHEN 'close' THEN NEW.close_price
+    END);
+
+    INSERT INTO order_events (order_id, from_status, to_status, action, actor, price, fee, collateral_delta)
+    VALUES (
+        NEW.id,
+        OLD.status,
+        NEW.status,
+        v_action,
+        v_actor,
+        v_price,
+        COALESCE(NEW.open_fee, 0) - COALESCE(OLD.open_fee, 0) + COALESCE(NEW.close_fee, 0) - COALESCE(OLD.close_fee, 0),
+        COALESCE(NEW.collateral, 0) - COALESCE(OLD.collateral, 0)
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders2_record_event ON orders2;
+CREATE TRIGGER orders2_record_event
+    AFTER INSERT OR UPDATE ON orders2
+    FOR EACH ROW EXECUTE FUNCTION record_order_event();
+
+-- oldest first, the order of the lifecycle
+CREATE OR REPLACE FUNCTION get_order_events(
+    p_order_id UUID
+) RETURNS SETOF order_events AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM order_events
+    WHERE order_events.order_id = p_order_id
+    ORDER BY order_events.seq;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION get_order_events(UUID) TO public;
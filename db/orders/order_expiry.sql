@@ -0,0 +1,125 @@
+-- good-till-time orders and the expiry sweep
+-- a limit order created with expires_at is canceled by the sweep once it passes without filling, its collateral goes back to the balance
+-- an unsigned order expires at expires_at, or once none of its signature requests can be signed any more
+-- signature requests past their expiry_time are marked expired_at
+-- the rebalancer runs expire_orders on a timer, and skips limit orders past expires_at until they are swept
+
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN orders2.expires_at IS 'Good-till-time, a limit order still open at this time is canceled, NULL is good-till-canceled';
+
+CREATE INDEX IF NOT EXISTS idx_orders2_expires_at ON orders2(expires_at) WHERE expires_at IS NOT NULL;
+
+-- unsigned orders that expire end as 'expired', any other status keeps its meaning
+ALTER TABLE orders2 DROP CONSTRAINT IF EXISTS orders2_status_check;
+ALTER TABLE orders2 ADD CONSTRAINT orders2_status_check
+    CHECK (status IN ('unsigned', 'pending', 'limit', 'filled', 'canceled', 'closed', 'liquidated', 'stopped', 'expired'));
+
+ALTER TABLE signature_validations ADD COLUMN IF NOT EXISTS expired_at TIMESTAMP;
+
+COMMENT ON COLUMN signature_validations.expired_at IS 'Set by expire_orders once expiry_time passed';
+
+-- sets the expiry of a limit order created with create_order, before it is signed
+CREATE OR REPLACE FUNCTION set_order_expiry(
+    p_order_id UUID,
+    p_expires_at TIMESTAMPTZ
+) RETURNS orders2 AS $$
+DECLARE
+    v_order orders2;
+BEGIN
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_order_id;
+    END IF;
+    IF v_order.status != 'unsigned' THEN
+        RAISE EXCEPTION 'Expiry can only be set on unsigned orders, order status is %', v_order.status;
+    END IF;
+    IF v_order.lim_price IS NULL THEN
+        RAISE EXCEPTION 'Expiry can only be set on limit orders';
+    END IF;
+    IF p_expires_at <= NOW() THEN
+        RAISE EXCEPTION 'Expiry % is in the past', p_expires_at;
+    END IF;
+
+    UPDATE orders2
+    SET expires_at = p_expires_at
+    WHERE orders2.id = p_order_id
+    RETURNING * INTO v_order;
+
+    RETURN v_order;
+END;
+$$ LANGUAGE plpgsql;
+
+-- cancels expired limit orders and expires unsigned orders and signature requests
+-- rows locked by a running batch are left to the next sweep
+CREATE OR REPLACE FUNCTION expire_orders() RETURNS jsonb AS $$
+DECLARE
+    v_order orders2;
+    v_limit_orders INTEGER := 0;
+    v_released_collateral NUMERIC := 0;
+    v_unsigned_orders INTEGER := 0;
+    v_signatures INTEGER := 0;
+BEGIN
+    -- both sweeps are recorded as expiries by the rebalancer, not as user cancels (db/orders/order_state.sql)
+    PERFORM set_order_transition('expire', 'rebalancer');
+
+    FOR v_order IN
+        SELECT * FROM orders2
+        WHERE orders2.status = 'limit' AND orders2.expires_at <= NOW()
+        FOR UPDATE SKIP LOCKED
+    LOOP
+        UPDATE orders2
+        SET status = 'canceled', ended_at = CURRENT_TIMESTAMP
+        WHERE orders2.id = v_order.id;
+
+        -- the open fee is only taken when a limit fills, the whole collateral is still in escrow
+        UPDATE users
+        SET
+            balance = balance + v_order.collateral,
+            escrow_balance = escrow_balance - v_order.collateral
+        WHERE userid = v_order.userid;
+
+        v_limit_orders := v_limit_orders + 1;
+        v_released_collateral := v_released_collateral + v_order.collateral;
+    END LOOP;
+
+    IF v_limit_orders > 0 THEN
+        UPDATE global_state
+        SET value = value - v_limit_orders, updated_at = CURRENT_TIMESTAMP
+        WHERE key = 'current_orders_limit';
+    END IF;
+
+    UPDATE orders2
+    SET status = 'expired', ended_at = CURRENT_TIMESTAMP
+    WHERE orders2.id IN (
+        SELECT orders2.id FROM orders2
+        WHERE orders2.status = 'unsigned'
+            AND (
+                orders2.expires_at <= NOW()
+                OR NOT EXISTS (
+                    SELECT 1 FROM signature_validations
+                    WHERE signature_validations.reference_id = orders2.id
+                        AND signature_validations.expiry_time > NOW()
+                )
+            )
+        FOR UPDATE SKIP LOCKED
+    );
+    GET DIAGNOSTICS v_unsigned_orders = ROW_COUNT;
+
+    UPDATE signature_validations
+    SET expired_at = CURRENT_TIMESTAMP
+    WHERE signature_validations.expired_at IS NULL
+        AND signature_validations.expiry_time <= NOW();
+    GET DIAGNOSTICS v_signatures = ROW_COUNT;
+
+    RETURN jsonb_build_object(
+        'expired_limit_orders', v_limit_orders,
+        'released_collateral', v_released_collateral,
+        'expired_unsigned_orders', v_unsigned_orders,
+        'expired_signatures', v_signatures
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION set_order_expiry(UUID, TIMESTAMPTZ) TO public;
+GRANT EXECUTE ON FUNCTION expire_orders() TO public;
@@ -0,0 +1,187 @@
+-- the order state machine of pkg/orderstate, every change of orders2.status has to be one of its transitions
+-- order_state_transitions mirrors the transitions of pkg/orderstate/orderstate.go, both are changed together
+-- the trigger rejects any other status change, db/orders/order_events.sql records each change in order_events
+-- every writer names the transition, set_order_transition(action, actor) before the update or
+-- set_order_transitions(map) for a batch of orders, a status change that names none is rejected
+
+CREATE TABLE IF NOT EXISTS order_state_transitions (
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor VARCHAR(20) NOT NULL CHECK (actor IN ('user', 'rebalancer', 'admin')),
+    PRIMARY KEY (from_status, to_status, action, actor)
+);
+
+-- transitions are no longer inferred from the status pair
+DROP INDEX IF EXISTS idx_order_state_transitions_default;
+ALTER TABLE order_state_transitions DROP COLUMN IF EXISTS is_default;
+
+-- transitions from a status to itself keep the status, they are listed for completeness and never fire the trigger
+INSERT INTO order_state_transitions (from_status, to_status, action, actor) VALUES
+    ('unsigned', 'pending', 'sign', 'user'),
+    ('unsigned', 'limit', 'sign', 'user'),
+    ('unsigned', 'unsigned', 'modify', 'user'),
+    ('unsigned', 'canceled', 'cancel', 'user'),
+    ('unsigned', 'canceled', 'cancel', 'admin'),
+    ('unsigned', 'expired', 'expire', 'rebalancer'),
+    ('limit', 'limit', 'modify', 'user'),
+    ('limit', 'canceled', 'cancel', 'user'),
+    ('limit', 'canceled', 'cancel', 'admin'),
+    ('limit', 'canceled', 'expire', 'rebalancer'),
+    ('limit', 'pending', 'trigger', 'rebalancer'),
+    ('pending', 'pending', 'modify', 'user'),
+    ('pending', 'pending', 'margin', 'user'),
+    ('pending', 'pending', 'close', 'user'),
+    ('pending', 'closed', 'close', 'user'),
+    ('pending', 'closed', 'close', 'admin'),
+    ('pending', 'pending', 'take_profit', 'rebalancer'),
+    ('pending', 'pending', 'stop', 'rebalancer'),
+    ('pending', 'pending', 'close', 'rebalancer'),
+    ('pending', 'closed', 'close', 'rebalancer'),
+    ('pending', 'filled', 'fill', 'rebalancer'),
+    ('pending', 'stopped', 'stop', 'rebalancer'),
+    ('pending', 'liquidated', 'liquidate', 'rebalancer'),
+    ('pending', 'liquidated', 'liquidate', 'admin')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS order_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders2(id) ON DELETE CASCADE,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor VARCHAR(20) NOT NULL,
+    seq BIGSERIAL NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT clock_timestamp()
+);
+
+DROP FUNCTION IF EXISTS set_order_transition(VARCHAR, VARCHAR);
+
+-- names the action, actor and price of the order updates that follow, until the end of the transaction
+CREATE OR REPLACE FUNCTION set_order_transition(
+    p_action VARCHAR,
+    p_actor VARCHAR,
+    p_price NUMERIC DEFAULT NULL
+) RETURNS VOID AS $$
+BEGIN
+    PERFORM set_config('blp.order_action', p_action, TRUE);
+    PERFORM set_config('blp.order_actor', p_actor, TRUE);
+    PERFORM set_config('blp.order_price', COALESCE(p_price::TEXT, ''), TRUE);
+END;
+$$ LANGUAGE plpgsql;
+
+-- names the transition of each order of a batch, keyed by order id: {"<id>": {"action", "actor", "price"}}
+-- an order of the map takes its entry over set_order_transition
+CREATE OR REPLACE FUNCTION set_order_transitions(
+    p_transitions jsonb
+) RETURNS VOID AS $$
+BEGIN
+    PERFORM set_config('blp.order_transitions', COALESCE(p_transitions, '{}'::jsonb)::TEXT, TRUE);
+END;
+$$ LANGUAGE plpgsql;
+
+-- the transition named for an order by the current transaction, NULLs when none is
+CREATE OR REPLACE FUNCTION current_order_transition(
+    p_order_id UUID,
+    OUT action VARCHAR,
+    OUT actor VARCHAR,
+    OUT price NUMERIC
+) AS $$
+DECLARE
+    v_entry jsonb := NULLIF(current_setting('blp.order_transitions', TRUE), '')::jsonb -> p_order_id::TEXT;
+BEGIN
+    IF v_entry IS NOT NULL THEN
+        action := v_entry->>'action';
+        actor := v_entry->>'actor';
+        price := NULLIF(v_entry->>'price', '')::NUMERIC;
+    ELSE
+        action := NULLIF(current_setting('blp.order_action', TRUE), '');
+        actor := NULLIF(current_setting('blp.order_actor', TRUE), '');
+        price := NULLIF(current_setting('blp.order_price', TRUE), '')::NUMERIC;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- process_batch_orders of the rebalancer with the transition of each order, the action and actor of every
+-- order update name it. the arguments are passed through untyped, as the api passes them
+-- the funding share each update settled (its payout is net of it) is recorded in the same transaction, and so are
+-- the liquidation and max profit prices of entries that triggered, repriced at their fill (pkg/entry Reprice)
+CREATE OR REPLACE FUNCTION process_batch_orders_with_transitions(
+    batch_timestamp TEXT,
+    order_updates jsonb,
+    order_global_update_ TEXT
+) RETURNS VOID AS $$
+BEGIN
+    PERFORM set_order_transitions((
+        SELECT jsonb_object_agg(u->>'order_id', jsonb_build_object('action', u->>'action', 'actor', u->>'actor'))
+        FROM jsonb_array_elements(order_updates) AS u
+        WHERE COALESCE(u->>'action', '') != ''
+    ));
+
+    EXECUTE format(
+        'SELECT process_batch_orders(batch_timestamp => %L, order_updates => %L, order_global_update_ => %L)',
+        batch_timestamp, order_updates, order_global_update_
+    );
+
+    -- bookkeeping, not a second event of the orders. a take profit keeps owing the rest, an ended order nothing
+    PERFORM set_order_transitions('{}'::jsonb);
+    UPDATE orders2
+    SET
+        funding_owed = CASE WHEN orders2.status = 'pending' THEN orders2.funding_owed - u.funding_paid ELSE 0 END,
+        funding_paid = orders2.funding_paid + u.funding_paid
+    FROM (
+        SELECT (e->>'order_id')::UUID AS order_id, (e->>'funding_paid')::NUMERIC AS funding_paid
+        FROM jsonb_array_elements(order_updates) AS e
+    ) AS u
+    WHERE orders2.id = u.order_id AND u.funding_paid != 0;
+
+    UPDATE orders2
+    SET
+        liq_price = u.liq_price,
+        max_price = u.max_price
+    FROM (
+        SELECT
+            (e->>'order_id')::UUID AS order_id,
+            COALESCE((e->>'liq_price')::NUMERIC, 0) AS liq_price,
+            COALESCE((e->>'max_price')::NUMERIC, 0) AS max_price
+        FROM jsonb_array_elements(order_updates) AS e
+        WHERE e->>'action' = 'trigger'
+    ) AS u
+    WHERE orders2.id = u.order_id AND orders2.status = 'pending' AND u.liq_price > 0 AND u.max_price > 0;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION check_order_transition() RETURNS TRIGGER AS $$
+DECLARE
+    v_named RECORD;
+    v_transition order_state_transitions;
+BEGIN
+    IF NEW.status = OLD.status THEN
+        RETURN NEW;
+    END IF;
+
+    SELECT * INTO v_named FROM current_order_transition(NEW.id);
+    IF v_named.action IS NULL THEN
+        RAISE EXCEPTION 'Order % moved from % to % without set_order_transition', OLD.id, OLD.status, NEW.status;
+    END IF;
+
+    SELECT * INTO v_transition FROM order_state_transitions
+    WHERE from_status = OLD.status AND to_status = NEW.status
+        AND action = v_named.action AND actor = v_named.actor;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order % cannot move from % to %', OLD.id, OLD.status, NEW.status;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders2_check_transition ON orders2;
+CREATE TRIGGER orders2_check_transition
+    BEFORE UPDATE OF status ON orders2
+    FOR EACH ROW EXECUTE FUNCTION check_order_transition();
+
+GRANT EXECUTE ON FUNCTION set_order_transition(VARCHAR, VARCHAR, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION set_order_transitions(jsonb) TO public;
+GRANT EXECUTE ON FUNCTION current_order_transition(UUID) TO public;
+GRANT EXECUTE ON FUNCTION process_batch_orders_with_transitions(TEXT, jsonb, TEXT) TO public;
@@ -0,0 +1,188 @@
+-- partial close of a pending position
+-- closes a share of the open collateral at the mark price, the remaining position keeps its leverage and liquidation price
+-- each partial exit is recorded in order_fills, the realized pnl accumulates into orders2.pnl
+-- the full close of signed_close_order_with_nonce (db/users/consume_nonce.sql) is the last fill of the order
+-- p_funding is the share of the accrued funding settled by this fill (db/pairs/funding.sql), the payout is already net of it
+
+CREATE TABLE IF NOT EXISTS order_fills (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    orderid UUID NOT NULL REFERENCES orders2(id),
+    userid VARCHAR(16) NOT NULL,
+    signature_id UUID,
+    collateral NUMERIC(20, 6) NOT NULL,
+    size NUMERIC(20, 6) NOT NULL,
+    close_price NUMERIC(20, 6) NOT NULL,
+    payout NUMERIC(20, 6) NOT NULL,
+    close_fee NUMERIC(20, 6) NOT NULL,
+    pnl NUMERIC(20, 6) NOT NULL,
+    funding NUMERIC(20, 6) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_fills_orderid ON order_fills(orderid);
+
+COMMENT ON COLUMN order_fills.collateral IS 'collateral closed by this fill';
+COMMENT ON COLUMN order_fills.size IS 'collateral * leverage closed by this fill';
+COMMENT ON COLUMN order_fills.payout IS 'returned to the user balance, after the close fee and borrowed amount';
+COMMENT ON COLUMN order_fills.pnl IS 'payout - collateral';
+COMMENT ON COLUMN order_fills.funding IS 'funding settled by this fill, negative when received';
+
+ALTER TABLE order_fills ADD COLUMN IF NOT EXISTS funding NUMERIC(20, 6) NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION signed_partial_close_order(
+    p_order_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT,
+    p_close_collateral NUMERIC,
+    p_payout_value NUMERIC,
+    p_close_fee NUMERIC,
+    p_close_price NUMERIC,
+    p_close_value NUMERIC,
+    p_tp_value NUMERIC,
+    p_tp_collateral NUMERIC,
+    p_funding NUMERIC DEFAULT 0
+) RETURNS jsonb AS $$
+DECLARE
+    signed_order orders2;
+    v_order orders2;
+    v_fill order_fills;
+    proof_ signature_validations;
+    v_is_valid BOOLEAN;
+    v_error_message TEXT;
+    v_live_collateral NUMERIC;
+    v_pnl NUMERIC;
+BEGIN
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_order_id;
+    END IF;
+
+    SELECT * INTO proof_ FROM signature_validations WHERE signature_validations.id = p_signature_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Signature ID % does not exist.', p_signature_id;
+    END IF;
+    -- the signature comes from unsigned_close_order
+    IF proof_.reference_id != p_order_id THEN
+        RAISE EXCEPTION 'order id and signature id mismatch';
+    END IF;
+
+    SELECT is_valid, error_message
+    INTO v_is_valid, v_error_message FROM validate_signature(p_signature_id);
+
+    v_live_collateral := v_order.collateral;
+    IF v_order.tp_at IS NOT NULL THEN
+        v_live_collateral := v_live_collateral - COALESCE(v_order.tp_collateral, 0);
+    END IF;
+
+    IF v_is_valid AND v_order.status != 'pending' THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Orders of status %s cannot be partially closed', v_order.status);
+    ELSIF v_is_valid AND (p_close_collateral <= 0 OR p_close_collateral >= v_live_collateral) THEN
+        v_is_valid := FALSE;
+        v_error_message := format('Invalid close collateral %s, open collateral %s', p_close_collateral, v_live_collateral);
+    END IF;
+
+    IF v_is_valid THEN
+        PERFORM use_user_nonce(v_order.userid, p_nonce);
+
+        v_pnl := p_payout_value - p_close_collateral;
+
+        INSERT INTO order_fills (
+            orderid,
+            userid,
+            signature_id,
+            collateral,
+            size,
+            close_price,
+            payout,
+            close_fee,
+            pnl,
+            funding
+        )
+        VALUES (
+            v_order.id,
+            v_order.userid,
+            p_signature_id,
+            p_close_collateral,
+            p_close_collateral * v_order.leverage,
+            p_close_price,
+            p_payout_value,
+            p_close_fee,
+            v_pnl,
+            p_funding
+        )
+        RETURNING * INTO v_fill;
+
+        UPDATE users
+        SET
+            balance = balance + p_payout_value,
+            escrow_balance = escrow_balance - p_close_collateral
+        WHERE userid = v_order.userid;
+
+        PERFORM set_order_transition('close', 'user', p_close_price);
+
+        UPDATE orders2
+        SET
+            collateral = collateral - p_close_collateral,
+            tp_value = CASE WHEN v_order.tp_at IS NULL THEN p_tp_value ELSE v_order.tp_value END,
+            tp_collateral = CASE WHEN v_order.tp_at IS NULL THEN p_tp_collateral ELSE v_order.tp_collateral END,
+            pnl = COALESCE(pnl, 0) + v_pnl,
+            close_fee = COALESCE(close_fee, 0) + p_close_fee,
+            funding_owed = funding_owed - p_funding,
+            funding_paid = funding_paid + p_funding,
+            modified_at = CURRENT_TIMESTAMP
+        WHERE orders2.id = v_order.id;
+
+        -- open exit levels shrink with the position (db/orders/exit_levels.sql)
+        UPDATE order_exit_levels
+        SET collateral = GREATEST(ROUND(collateral * (v_live_collateral - p_close_collateral) / v_live_collateral, 6), 0.000001)
+        WHERE order_exit_levels.orderid = v_order.id AND order_exit_levels.triggered_at IS NULL;
+
+        -- same global accounting as a take profit fill
+        UPDATE global_state
+        SET value = value + CASE key
+                WHEN 'current_borrowed' THEN -p_close_collateral * (v_order.leverage - 1)
+                WHEN 'current_liquidity' THEN -p_close_value
+                WHEN 'total_pnl_profits' THEN GREATEST(v_pnl, 0)
+                WHEN 'total_pnl_losses' THEN LEAST(v_pnl, 0)
+                WHEN 'total_revenue' THEN p_close_fee
+                WHEN 'treasury_balance' THEN p_close_fee * 0.1
+                WHEN 'total_treasury_profits' THEN p_close_fee * 0.1
+                WHEN 'vault_balance' THEN p_close_fee * 0.1
+                WHEN 'total_vault_profits' THEN p_close_fee * 0.1
+                WHEN 'total_blp_rewards' THEN p_close_fee * 0.5
+                WHEN 'current_blp_rewards' THEN p_close_fee * 0.5
+                WHEN 'total_blu_rewards' THEN p_close_fee * 0.3
+                WHEN 'current_blu_rewards' THEN p_close_fee * 0.3
+            END,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE key IN (
+            'current_borrowed', 'current_liquidity', 'total_pnl_profits', 'total_pnl_losses', 'total_revenue',
+            'treasury_balance', 'total_treasury_profits', 'vault_balance', 'total_vault_profits',
+            'total_blp_rewards', 'current_blp_rewards', 'total_blu_rewards', 'current_blu_rewards'
+        );
+    END IF;
+
+    SELECT * INTO signed_order FROM orders2 WHERE orders2.id = v_order.id;
+    RETURN jsonb_build_object(
+        'order', to_jsonb(signed_order),
+        'fill', to_jsonb(v_fill),
+        'is_valid', v_is_valid,
+        'error_message', v_error_message
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION get_order_fills(
+    p_order_id UUID
+) RETURNS SETOF order_fills AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM order_fills
+    WHERE order_fills.orderid = p_order_id
+    ORDER BY order_fills.created_at;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION signed_partial_close_order(UUID, UUID, BIGINT, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION get_order_fills(UUID) TO public;
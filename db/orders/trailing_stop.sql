@@ -0,0 +1,98 @@
+-- trailing stops
+-- a trailing order keeps its current stop level in stop_price, so get-order and the stop trigger read it like any stop
+-- trail_extreme is the most favourable price seen since the position opened (highest for longs, lowest for shorts)
+-- the stop follows the extreme at trail_amount (absolute) or trail_percent (of the extreme) and never moves back
+-- the rebalancer ratchets the stop on every price it streams and persists it with update_trailing_stops
+-- a signed modify removing the stop (stop price NULL) also removes the trail, any other modify keeps the trailed stop
+
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS trail_amount NUMERIC(20, 6) CHECK (trail_amount > 0);
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS trail_percent NUMERIC(7, 4) CHECK (trail_percent > 0 AND trail_percent < 100);
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS trail_extreme NUMERIC(20, 6);
+
+COMMENT ON COLUMN orders2.trail_amount IS 'Trailing stop distance in USD, NULL when the stop does not trail';
+COMMENT ON COLUMN orders2.trail_percent IS 'Trailing stop distance in percent of trail_extreme, NULL when the stop does not trail';
+COMMENT ON COLUMN orders2.trail_extreme IS 'Most favourable price since the position opened, the trailing stop follows it';
+
+CREATE INDEX IF NOT EXISTS idx_orders2_trailing ON orders2(pair_id) WHERE trail_extreme IS NOT NULL;
+
+-- sets the trail of an order created with create_order, before it is signed
+-- the initial stop_price is set by create_order from the entry (or limit) price
+CREATE OR REPLACE FUNCTION set_order_trailing_stop(
+    p_order_id UUID,
+    p_trail_amount NUMERIC,
+    p_trail_percent NUMERIC,
+    p_trail_extreme NUMERIC
+) RETURNS orders2 AS $$
+DECLARE
+    v_order orders2;
+BEGIN
+    IF (p_trail_amount IS NULL) = (p_trail_percent IS NULL) THEN
+        RAISE EXCEPTION 'Exactly one of trail amount and trail percent must be set';
+    END IF;
+
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Order with ID % does not exist.', p_order_id;
+    END IF;
+    IF v_order.status != 'unsigned' THEN
+        RAISE EXCEPTION 'Trailing stops can only be set on unsigned orders, order status is %', v_order.status;
+    END IF;
+    IF v_order.stop_price IS NULL THEN
+        RAISE EXCEPTION 'Trailing stop requires an initial stop price';
+    END IF;
+
+    UPDATE orders2
+    SET
+        trail_amount = p_trail_amount,
+        trail_percent = p_trail_percent,
+        trail_extreme = p_trail_extreme
+    WHERE orders2.id = p_order_id
+    RETURNING * INTO v_order;
+
+    RETURN v_order;
+END;
+$$ LANGUAGE plpgsql;
+
+-- open trailing orders of a pair, the rebalancer ratchets them on every price whether or not the stop is in range
+CREATE OR REPLACE FUNCTION get_trailing_orders(
+    p_pair_id VARCHAR
+) RETURNS SETOF orders2 AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM orders2
+    WHERE orders2.pair_id = p_pair_id
+        AND orders2.trail_extreme IS NOT NULL
+        AND orders2.status IN ('limit', 'pending')
+        AND orders2.ended_at IS NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- persists ratcheted stops, amounts match order ids by index
+-- only pending trailing orders move and only in their favour, a late or repeated batch cannot loosen a stop
+CREATE OR REPLACE FUNCTION update_trailing_stops(
+    p_order_ids UUID[],
+    p_stop_prices NUMERIC[],
+    p_trail_extremes NUMERIC[]
+) RETURNS VOID AS $$
+BEGIN
+    UPDATE orders2
+    SET
+        stop_price = CASE WHEN orders2.order_type = 'long'
+            THEN GREATEST(orders2.stop_price, t.stop_price)
+            ELSE LEAST(orders2.stop_price, t.stop_price)
+        END,
+        trail_extreme = CASE WHEN orders2.order_type = 'long'
+            THEN GREATEST(orders2.trail_extreme, t.trail_extreme)
+            ELSE LEAST(orders2.trail_extreme, t.trail_extreme)
+        END
+    FROM unnest(p_order_ids, p_stop_prices, p_trail_extremes) AS t(order_id, stop_price, trail_extreme)
+    WHERE orders2.id = t.order_id
+        AND orders2.status = 'pending'
+        AND orders2.trail_extreme IS NOT NULL
+        AND orders2.stop_price IS NOT NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION set_order_trailing_stop(UUID, NUMERIC, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION get_trailing_orders(VARCHAR) TO public;
+GRANT EXECUTE ON FUNCTION update_trailing_stops(UUID[], NUMERIC[], NUMERIC[]) TO public;
@@ -0,0 +1,188 @@
+-- funding between longs and shorts
+-- every pair keeps a cumulative funding index, the funding paid by one unit of long size since the pair was listed
+-- the index grows by the hourly funding rate over the elapsed time, the rate follows the open interest skew:
+--   funding_rate = max_funding_rate * (long_open_interest - short_open_interest) / (long_open_interest + short_open_interest)
+-- a positive rate means longs pay shorts, a negative rate means shorts pay longs
+-- a position owes size * (index - funding_index) when long and the opposite when short, settled on close, tp, stop and liquidation
+
+CREATE TABLE IF NOT EXISTS pair_funding (
+    pair_id VARCHAR(64) PRIMARY KEY,
+    max_funding_rate NUMERIC(12, 10) NOT NULL DEFAULT 0.0001 CHECK (max_funding_rate >= 0),
+    funding_rate NUMERIC(12, 10) NOT NULL DEFAULT 0,
+    cumulative_funding_index NUMERIC(30, 18) NOT NULL DEFAULT 0,
+    long_open_interest NUMERIC(30, 6) NOT NULL DEFAULT 0,
+    short_open_interest NUMERIC(30, 6) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS funding_rates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pair_id VARCHAR(64) NOT NULL,
+    funding_rate NUMERIC(12, 10) NOT NULL,
+    cumulative_funding_index NUMERIC(30, 18) NOT NULL,
+    long_open_interest NUMERIC(30, 6) NOT NULL,
+    short_open_interest NUMERIC(30, 6) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_funding_rates_pair_id_created_at ON funding_rates(pair_id, created_at DESC);
+
+COMMENT ON COLUMN pair_funding.max_funding_rate IS 'Hourly funding rate when all open interest is on one side';
+COMMENT ON COLUMN pair_funding.funding_rate IS 'Current hourly funding rate, positive when longs pay shorts';
+COMMENT ON COLUMN pair_funding.cumulative_funding_index IS 'Funding paid per unit of long size since listing';
+COMMENT ON TABLE funding_rates IS 'Hourly snapshots of pair_funding';
+
+-- the pair indexes start at 0, so positions open before funding existed start accruing from their first accrual
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS funding_index NUMERIC(30, 18) NOT NULL DEFAULT 0;
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS funding_owed NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE orders2 ADD COLUMN IF NOT EXISTS funding_paid NUMERIC(20, 6) NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN orders2.funding_index IS 'Pair cumulative funding index when the live size last changed';
+COMMENT ON COLUMN orders2.funding_owed IS 'Funding accrued before the last size change and not yet settled, negative when the position is owed';
+COMMENT ON COLUMN orders2.funding_paid IS 'Funding settled so far by closes and take profits, negative when received';
+
+-- accrues the index up to now with the rate set at the previous accrual, then resets the rate from the current open interest
+-- called by the rebalancer every cycle and by the api before a close, a snapshot is kept in funding_rates once per hour
+CREATE OR REPLACE FUNCTION accrue_pair_funding(
+    p_pair_id VARCHAR
+) RETURNS pair_funding AS $$
+DECLARE
+    v_funding pair_funding;
+    v_long NUMERIC;
+    v_short NUMERIC;
+    v_elapsed_hours NUMERIC;
+BEGIN
+    INSERT INTO pair_funding (pair_id) VALUES (p_pair_id) ON CONFLICT (pair_id) DO NOTHING;
+    SELECT * INTO v_funding FROM pair_funding WHERE pair_funding.pair_id = p_pair_id FOR UPDATE;
+
+    v_elapsed_hours := EXTRACT(EPOCH FROM (NOW() - v_funding.updated_at)) / 3600;
+
+    SELECT
+        COALESCE(SUM(o.size) FILTER (WHERE o.order_type = 'long'), 0),
+        COALESCE(SUM(o.size) FILTER (WHERE o.order_type = 'short'), 0)
+    INTO v_long, v_short
+    FROM (
+        SELECT
+            orders2.order_type,
+            CASE WHEN orders2.tp_at IS NOT NULL
+                THEN orders2.collateral - COALESCE(orders2.tp_collateral, 0)
+                ELSE orders2.collateral
+            END * orders2.leverage AS size
+        FROM orders2
+        WHERE orders2.pair_id = p_pair_id AND orders2.status = 'pending'
+    ) o;
+
+    UPDATE pair_funding
+    SET
+        cumulative_funding_index = cumulative_funding_index + funding_rate * GREATEST(v_elapsed_hours, 0),
+        funding_rate = CASE WHEN v_long + v_short > 0
+            THEN max_funding_rate * (v_long - v_short) / (v_long + v_short)
+            ELSE 0
+        END,
+        long_open_interest = v_long,
+        short_open_interest = v_short,
+        updated_at = NOW()
+    WHERE pair_funding.pair_id = p_pair_id
+    RETURNING * INTO v_funding;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM funding_rates
+        WHERE funding_rates.pair_id = p_pair_id AND funding_rates.created_at >= date_trunc('hour', NOW())
+    ) THEN
+        INSERT INTO funding_rates (pair_id, funding_rate, cumulative_funding_index, long_open_interest, short_open_interest)
+        VALUES (p_pair_id, v_funding.funding_rate, v_funding.cumulative_funding_index, v_long, v_short);
+    END IF;
+
+    RETURN v_funding;
+END;
+$$ LANGUAGE plpgsql;
+
+-- snapshots the pair index when a position opens, and rolls the accrued funding into funding_owed when its live size changes
+-- so size * (index - funding_index) always covers the current size only
+CREATE OR REPLACE FUNCTION roll_order_funding() RETURNS TRIGGER AS $$
+DECLARE
+    v_index NUMERIC;
+    v_old_size NUMERIC;
+    v_new_size NUMERIC;
+BEGIN
+    IF NEW.status != 'pending' THEN
+        RETURN NEW;
+    END IF;
+
+    SELECT cumulative_funding_index INTO v_index FROM pair_funding WHERE pair_funding.pair_id = NEW.pair_id;
+    v_index := COALESCE(v_index, 0);
+
+    IF TG_OP = 'INSERT' OR OLD.status != 'pending' THEN
+        NEW.funding_index := v_index;
+        RETURN NEW;
+    END IF;
+
+    v_old_size := (OLD.collateral - CASE WHEN OLD.tp_at IS NOT NULL THEN COALESCE(OLD.tp_collateral, 0) ELSE 0 END) * OLD.leverage;
+    v_new_size := (NEW.collateral - CASE WHEN NEW.tp_at IS NOT NULL THEN COALESCE(NEW.tp_collateral, 0) ELSE 0 END) * NEW.leverage;
+    IF v_old_size != v_new_size THEN
+        NEW.funding_owed := NEW.funding_owed + ROUND(
+            v_old_size * (v_index - OLD.funding_index) * CASE WHEN OLD.order_type = 'long' THEN 1 ELSE -1 END, 6);
+        NEW.funding_index := v_index;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders2_roll_funding ON orders2;
+CREATE TRIGGER orders2_roll_funding
+    BEFORE INSERT OR UPDATE ON orders2
+    FOR EACH ROW EXECUTE FUNCTION roll_order_funding();
+
+-- funding is recorded by the rpc that settles it: signed_close_order_with_nonce, signed_partial_close_order,
+-- fill_exit_levels, fill_reduce_only_orders and process_batch_orders_with_transitions
+DROP FUNCTION IF EXISTS settle_order_funding(UUID[], NUMERIC[]);
+
+-- current funding of one pair, or of every pair when p_pair_id is NULL
+CREATE OR REPLACE FUNCTION get_pair_funding(
+    p_pair_id VARCHAR DEFAULT NULL
+) RETURNS SETOF pair_funding AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM pair_funding
+    WHERE p_pair_id IS NULL OR pair_funding.pair_id = p_pair_id
+    ORDER BY pair_funding.pair_id;
+END;
+$$ LANGUAGE plpgsql;
+
+-- the funding accrue_pair_funding would return now for the index, without writing it, for views of open positions
+-- the rate stays the one of the last accrual, NULL when the pair was never accrued
+CREATE OR REPLACE FUNCTION get_accrued_pair_funding(
+    p_pair_id VARCHAR
+) RETURNS pair_funding AS $$
+DECLARE
+    v_funding pair_funding;
+BEGIN
+    SELECT * INTO v_funding FROM pair_funding WHERE pair_funding.pair_id = p_pair_id;
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+    v_funding.cumulative_funding_index := v_funding.cumulative_funding_index
+        + v_funding.funding_rate * GREATEST(EXTRACT(EPOCH FROM (NOW() - v_funding.updated_at)) / 3600, 0);
+    v_funding.updated_at := NOW();
+    RETURN v_funding;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- hourly funding snapshots of a pair, newest first
+CREATE OR REPLACE FUNCTION get_funding_rates(
+    p_pair_id VARCHAR,
+    p_limit INTEGER DEFAULT 168
+) RETURNS SETOF funding_rates AS $$
+BEGIN
+    RETURN QUERY
+    SELECT * FROM funding_rates
+    WHERE funding_rates.pair_id = p_pair_id
+    ORDER BY funding_rates.created_at DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION accrue_pair_funding(VARCHAR) TO public;
+GRANT EXECUTE ON FUNCTION get_pair_funding(VARCHAR) TO public;
+GRANT EXECUTE ON FUNCTION get_accrued_pair_funding(VARCHAR) TO public;
+GRANT EXECUTE ON FUNCTION get_funding_rates(VARCHAR, INTEGER) TO public;
@@ -0,0 +1,78 @@
+-- per pair risk limits, enforced by the api when an order is created
+-- a pair without a row uses the api defaults (pkg/risk), a NULL cap is uncapped
+
+CREATE TABLE IF NOT EXISTS pair_risk_params (
+    pair_id VARCHAR(64) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    max_leverage NUMERIC(7, 2) NOT NULL DEFAULT 1250 CHECK (max_leverage >= 1),
+    min_collateral NUMERIC(20, 6) NOT NULL DEFAULT 0 CHECK (min_collateral >= 0),
+    max_collateral NUMERIC(20, 6) CHECK (max_collateral IS NULL OR max_collateral > 0),
+    max_long_open_interest NUMERIC(30, 6) CHECK (max_long_open_interest IS NULL OR max_long_open_interest > 0),
+    max_short_open_interest NUMERIC(30, 6) CHECK (max_short_open_interest IS NULL OR max_short_open_interest > 0),
+    leverage_fee_multiplier NUMERIC(10, 4) NOT NULL DEFAULT 1 CHECK (leverage_fee_multiplier >= 0),
+    utilization_fee_multiplier NUMERIC(10, 4) NOT NULL DEFAULT 1 CHECK (utilization_fee_multiplier >= 0),
+    max_profit_multiple NUMERIC(10, 4) NOT NULL DEFAULT 10 CHECK (max_profit_multiple > 0),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+COMMENT ON TABLE pair_risk_params IS 'Per pair order limits and fee multipliers';
+COMMENT ON COLUMN pair_risk_params.enabled IS 'Disabled pairs reject new orders, open positions can still be modified and closed';
+COMMENT ON COLUMN pair_risk_params.max_long_open_interest IS 'Cap on the summed size (collateral * leverage) of open and limit long orders';
+COMMENT ON COLUMN pair_risk_params.max_short_open_interest IS 'Cap on the summed size (collateral * leverage) of open and limit short orders';
+COMMENT ON COLUMN pair_risk_params.leverage_fee_multiplier IS 'Applied to the dynamic leverage fee, open and close';
+COMMENT ON COLUMN pair_risk_params.utilization_fee_multiplier IS 'Applied to the dynamic utilization fee';
+COMMENT ON COLUMN pair_risk_params.max_profit_multiple IS 'Max profit price distance, as a multiple of the collateral';
+
+-- returns the configured pairs with their current open interest, all pairs when p_pair_id is NULL
+-- limit orders are counted so a triggered limit cannot exceed the cap
+CREATE OR REPLACE FUNCTION get_pair_risk_params(
+    p_pair_id VARCHAR DEFAULT NULL
+) RETURNS TABLE (
+    pair_id VARCHAR,
+    enabled BOOLEAN,
+    max_leverage NUMERIC,
+    min_collateral NUMERIC,
+    max_collateral NUMERIC,
+    max_long_open_interest NUMERIC,
+    max_short_open_interest NUMERIC,
+    leverage_fee_multiplier NUMERIC,
+    utilization_fee_multiplier NUMERIC,
+    max_profit_multiple NUMERIC,
+    long_open_interest NUMERIC,
+    short_open_interest NUMERIC,
+    updated_at TIMESTAMP
+) AS $$
+BEGIN
+    RETURN QUERY
+    SELECT
+        p.pair_id,
+        p.enabled,
+        p.max_leverage,
+        p.min_collateral,
+        p.max_collateral,
+        p.max_long_open_interest,
+        p.max_short_open_interest,
+        p.leverage_fee_multiplier,
+        p.utilization_fee_multiplier,
+        p.max_profit_multiple,
+        COALESCE(SUM(o.size) FILTER (WHERE o.order_type = 'long'), 0),
+        COALESCE(SUM(o.size) FILTER (WHERE o.order_type = 'short'), 0),
+        p.updated_at
+    FROM pair_risk_params p
+    LEFT JOIN (
+        SELECT
+            orders2.pair_id,
+            orders2.order_type,
+            CASE WHEN orders2.tp_at IS NOT NULL
+                THEN orders2.collateral - COALESCE(orders2.tp_collateral, 0)
+                ELSE orders2.collateral
+            END * orders2.leverage AS size
+        FROM orders2
+        WHERE orders2.status IN ('pending', 'limit')
+    ) o ON o.pair_id = p.pair_id
+    WHERE p_pair_id IS NULL OR p.pair_id = p_pair_id
+    GROUP BY p.pair_id;
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION get_pair_risk_params(VARCHAR) TO public;
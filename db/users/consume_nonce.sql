@@ -0,0 +1,273 @@
+-- signature replay protection
+-- a user nonce is only consumed when it matches the stored value, so two requests racing
+-- with the same signed message cannot both pass
+-- the nonce is consumed by the rpc that applies the signed action, a failed action rolls back with it
+-- and the nonce stays usable
+
+CREATE OR REPLACE FUNCTION use_user_nonce(
+    p_user_id VARCHAR,
+    p_nonce BIGINT
+) RETURNS VOID AS $$
+BEGIN
+    UPDATE users
+    SET nonce = nonce + 1
+    WHERE users.userid = p_user_id AND users.nonce = p_nonce;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'nonce % already consumed or invalid for user %', p_nonce, p_user_id;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- the signature request created by an unsigned rpc, its expiry_time is the expiry of the typed data
+-- without a signature id the latest request of the reference is returned, NULL when there is none
+CREATE OR REPLACE FUNCTION get_signature_request(
+    p_signature_id UUID DEFAULT NULL,
+    p_reference_id UUID DEFAULT NULL
+) RETURNS JSON AS $$
+DECLARE
+    v_proof signature_validations;
+BEGIN
+    IF p_signature_id IS NULL AND p_reference_id IS NULL THEN
+        RAISE EXCEPTION 'signature id or reference id required';
+    END IF;
+
+    SELECT * INTO v_proof FROM signature_validations
+    WHERE (p_signature_id IS NULL OR signature_validations.id = p_signature_id)
+        AND (p_reference_id IS NULL OR signature_validations.reference_id = p_reference_id)
+    ORDER BY signature_validations.expiry_time DESC
+    LIMIT 1;
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+
+    RETURN json_build_object(
+        'signature_id', v_proof.id,
+        'reference_table', v_proof.reference_table,
+        'reference_id', v_proof.reference_id,
+        'expiry_time', v_proof.expiry_time
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+-- sign_order, signed_close_order, signed_cancel_order and signed_create_withdraw are not part of this repo,
+-- these wrappers consume the nonce in the same transaction when the action is applied
+-- and name the transition of the order for db/orders/order_state.sql
+
+CREATE OR REPLACE FUNCTION sign_order_with_nonce(
+    p_order_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_result jsonb;
+BEGIN
+    PERFORM set_order_transition('sign', 'user');
+    v_result := to_jsonb(sign_order(order_id => p_order_id));
+    PERFORM use_user_nonce((SELECT userid FROM orders2 WHERE orders2.id = p_order_id), p_nonce);
+    RETURN v_result;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION signed_close_order_with_nonce(
+    p_order_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT,
+    p_remaining_collateral NUMERIC,
+    p_payout_value NUMERIC,
+    p_close_fee NUMERIC,
+    p_close_price NUMERIC,
+    p_funding NUMERIC
+) RETURNS jsonb AS $$
+DECLARE
+    v_result jsonb;
+    v_order orders2;
+BEGIN
+    SELECT * INTO v_order FROM orders2 WHERE orders2.id = p_order_id;
+
+    PERFORM set_order_transition('close', 'user', p_close_price);
+    v_result := to_jsonb(signed_close_order(
+        order_id => p_order_id,
+        signature_id => p_signature_id,
+        remaining_collateral => p_remaining_collateral,
+        payout_value => p_payout_value,
+        close_fee_ => p_close_fee,
+        close_price_ => p_close_price
+    ));
+    IF (v_result->>'is_valid')::BOOLEAN THEN
+        PERFORM use_user_nonce(v_order.userid, p_nonce);
+
+        -- the last exit of the position, with the partial closes and take profits in order_fills
+        -- (db/orders/partial_close_order.sql), p_remaining_collateral is the collateral it closed
+        INSERT INTO order_fills (
+            orderid,
+            userid,
+            signature_id,
+            collateral,
+            size,
+            close_price,
+            payout,
+            close_fee,
+            pnl,
+            funding
+        )
+        VALUES (
+            v_order.id,
+            v_order.userid,
+            p_signature_id,
+            p_remaining_collateral,
+            p_remaining_collateral * v_order.leverage,
+            p_close_price,
+            p_payout_value,
+            p_close_fee,
+            p_payout_value - p_remaining_collateral,
+            p_funding
+        );
+
+        -- the payout is net of the funding share, recorded with it like signed_partial_close_order does
+        -- bookkeeping of the closed order, not a second close event
+        PERFORM set_order_transition('', '');
+        UPDATE orders2
+        SET
+            funding_owed = 0,
+            funding_paid = funding_paid + p_funding
+        WHERE orders2.id = p_order_id;
+    END IF;
+    RETURN v_result;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION signed_cancel_order_with_nonce(
+    p_order_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_result jsonb;
+BEGIN
+    PERFORM set_order_transition('cancel', 'user');
+    v_result := to_jsonb(signed_cancel_order(order_id => p_order_id, signature_id => p_signature_id));
+    IF (v_result->>'is_valid')::BOOLEAN THEN
+        PERFORM use_user_nonce((SELECT userid FROM orders2 WHERE orders2.id = p_order_id), p_nonce);
+    END IF;
+    RETURN v_result;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION signed_create_withdraw_with_nonce(
+    p_withdrawal_id UUID,
+    p_signature_id UUID,
+    p_nonce BIGINT
+) RETURNS jsonb AS $$
+DECLARE
+    v_result jsonb;
+BEGIN
+    v_result := to_jsonb(signed_create_withdraw(p_withdrawal_id => p_withdrawal_id, p_signature_id => p_signature_id));
+    IF (v_result->>'is_valid')::BOOLEAN THEN
+        PERFORM use_user_nonce((SELECT userid FROM pending_withdrawals WHERE pending_withdrawals.id = p_withdrawal_id), p_nonce);
+    END IF;
+    RETURN v_result;
+END;
+$$ LANGUAGE plpgsql;
+
+-- requests forwarded by the escrow listener are keyed by tx hash, the listener signature only covers the hash
+-- so one transaction is processed once whatever query forwards it. the hash is consumed by the rpc that applies
+-- the request, a deposit or stake that fails rolls back with it and the listener can retry
+CREATE TABLE IF NOT EXISTS listener_requests (
+    tx_hash VARCHAR(64) PRIMARY KEY,
+    query VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- keyed by (tx_hash, query) before, the first request of each hash is kept
+DELETE FROM listener_requests a
+USING listener_requests b
+WHERE a.tx_hash = b.tx_hash AND (a.created_at, a.query) > (b.created_at, b.query);
+ALTER TABLE listener_requests DROP CONSTRAINT IF EXISTS listener_requests_pkey;
+ALTER TABLE listener_requests ADD PRIMARY KEY (tx_hash);
+
+DROP FUNCTION IF EXISTS consume_listener_request(VARCHAR, VARCHAR);
+
+CREATE OR REPLACE FUNCTION use_listener_request(
+    p_tx_hash VARCHAR,
+    p_query VARCHAR
+) RETURNS VOID AS $$
+DECLARE
+    v_query VARCHAR;
+BEGIN
+    INSERT INTO listener_requests (tx_hash, query)
+    VALUES (p_tx_hash, p_query)
+    ON CONFLICT DO NOTHING;
+
+    IF NOT FOUND THEN
+        SELECT query INTO v_query FROM listener_requests WHERE listener_requests.tx_hash = p_tx_hash;
+        RAISE EXCEPTION '% request for tx % already processed as %', p_query, p_tx_hash, v_query;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- add_user_deposit of the listener with the tx hash consumed, the arguments are passed through untyped
+CREATE OR REPLACE FUNCTION add_user_deposit_with_listener_request(
+    p_query VARCHAR,
+    wallet_addr TEXT,
+    wallet_t TEXT,
+    chain TEXT,
+    blk TEXT,
+    blk_hash TEXT,
+    tx_hash TEXT,
+    sndr TEXT,
+    deposit_nonce TEXT,
+    asset_addr TEXT,
+    amt TEXT,
+    val TEXT
+) RETURNS jsonb AS $$
+BEGIN
+    PERFORM use_listener_request(tx_hash, p_query);
+
+    EXECUTE format(
+        'SELECT add_user_deposit(wallet_addr => %L, wallet_t => %L, chain => %L, blk => %L, blk_hash => %L, '
+        'tx_hash => %L, sndr => %L, deposit_nonce => %L, asset_addr => %L, amt => %L, val => %L)',
+        wallet_addr, wallet_t, chain, blk, blk_hash, tx_hash, sndr, deposit_nonce, asset_addr, amt, val
+    );
+
+    RETURN jsonb_build_object('tx_hash', tx_hash, 'query', p_query);
+END;
+$$ LANGUAGE plpgsql;
+
+-- process_deposit_and_stake of the listener with the tx hash consumed
+CREATE OR REPLACE FUNCTION process_deposit_and_stake_with_listener_request(
+    p_query VARCHAR,
+    wallet_addr TEXT,
+    wallet_t TEXT,
+    chain TEXT,
+    blk TEXT,
+    blk_hash TEXT,
+    tx_hash TEXT,
+    sndr TEXT,
+    deposit_nonce TEXT,
+    asset_addr TEXT,
+    amt TEXT,
+    val TEXT,
+    stake_type_param TEXT
+) RETURNS jsonb AS $$
+BEGIN
+    PERFORM use_listener_request(tx_hash, p_query);
+
+    EXECUTE format(
+        'SELECT process_deposit_and_stake(wallet_addr => %L, wallet_t => %L, chain => %L, blk => %L, blk_hash => %L, '
+        'tx_hash => %L, sndr => %L, deposit_nonce => %L, asset_addr => %L, amt => %L, val => %L, stake_type_param => %L)',
+        wallet_addr, wallet_t, chain, blk, blk_hash, tx_hash, sndr, deposit_nonce, asset_addr, amt, val, stake_type_param
+    );
+
+    RETURN jsonb_build_object('tx_hash', tx_hash, 'query', p_query);
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION use_user_nonce(VARCHAR, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION get_signature_request(UUID, UUID) TO public;
+GRANT EXECUTE ON FUNCTION sign_order_with_nonce(UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION signed_close_order_with_nonce(UUID, UUID, BIGINT, NUMERIC, NUMERIC, NUMERIC, NUMERIC, NUMERIC) TO public;
+GRANT EXECUTE ON FUNCTION signed_cancel_order_with_nonce(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION signed_create_withdraw_with_nonce(UUID, UUID, BIGINT) TO public;
+GRANT EXECUTE ON FUNCTION use_listener_request(VARCHAR, VARCHAR) TO public;
+GRANT EXECUTE ON FUNCTION add_user_deposit_with_listener_request(VARCHAR, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT) TO public;
+GRANT EXECUTE ON FUNCTION process_deposit_and_stake_with_listener_request(VARCHAR, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT, TEXT) TO public;
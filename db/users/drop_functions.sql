@@ -1,3 +1,6 @@
 DROP FUNCTION IF EXISTS get_or_create_user(VARCHAR, VARCHAR);
 DROP FUNCTION IF EXISTS get_user_by_userid(VARCHAR);
 DROP FUNCTION IF EXISTS public.add_user_deposit(VARCHAR, VARCHAR, TEXT, TEXT, VARCHAR, VARCHAR, VARCHAR, TEXT, VARCHAR, TEXT, NUMERIC);
+
+DROP FUNCTION IF EXISTS consume_user_nonce(VARCHAR, BIGINT);
+DROP FUNCTION IF EXISTS signed_close_order_with_nonce(UUID, UUID, BIGINT, NUMERIC, NUMERIC, NUMERIC, NUMERIC);
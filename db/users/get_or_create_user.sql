@@ -10,7 +10,8 @@ RETURNS TABLE(
     stake_balance NUMERIC(30, 6),
     frozen_balance NUMERIC(30, 6),
     total_balance NUMERIC(30, 6),
-    created_at TIMESTAMP
+    created_at TIMESTAMP,
+    nonce BIGINT -- db/users/user_nonce.sql, signed into the EIP-712 messages
 ) AS $$
 BEGIN
     -- First, check if the user exists
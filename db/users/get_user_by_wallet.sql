@@ -0,0 +1,15 @@
+-- the user of a wallet for the read only requests, NULL when the wallet has no user yet
+-- get_or_create_user is left to the requests that act for the wallet
+CREATE OR REPLACE FUNCTION get_user_by_wallet(
+    wallet_addr VARCHAR,
+    wallet_t VARCHAR
+) RETURNS JSON AS $$
+BEGIN
+    RETURN (
+        SELECT row_to_json(users) FROM users
+        WHERE users.wallet_address = wallet_addr AND users.wallet_type = wallet_t
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION get_user_by_wallet(VARCHAR, VARCHAR) TO public;
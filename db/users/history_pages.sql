@@ -0,0 +1,144 @@
+-- deposit, stake and withdrawal history of a user, paged like get_orders_page (db/orders/get_orders_page.sql)
+-- newest first on (created_at, id), total counts every row matching the filters
+
+CREATE INDEX IF NOT EXISTS idx_deposits_userid_created_at ON deposits(userid, created_at DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION get_deposits_page(
+    p_user_id VARCHAR,
+    p_asset VARCHAR DEFAULT NULL,
+    p_created_from TIMESTAMPTZ DEFAULT NULL,
+    p_created_to TIMESTAMPTZ DEFAULT NULL,
+    p_cursor_created_at TIMESTAMP DEFAULT NULL,
+    p_cursor_id UUID DEFAULT NULL,
+    p_limit INTEGER DEFAULT 50
+) RETURNS JSON AS $$
+DECLARE
+    v_total BIGINT;
+    v_rows JSON;
+    v_next_created_at TIMESTAMP;
+    v_next_id UUID;
+BEGIN
+    WITH filtered AS (
+        SELECT * FROM deposits
+        WHERE deposits.userid = p_user_id
+            AND (p_asset IS NULL OR deposits.asset = p_asset)
+            AND (p_created_from IS NULL OR deposits.created_at >= p_created_from)
+            AND (p_created_to IS NULL OR deposits.created_at < p_created_to)
+    ), page AS (
+        SELECT *, ROW_NUMBER() OVER (ORDER BY filtered.created_at DESC, filtered.id DESC) AS page_row
+        FROM filtered
+        WHERE p_cursor_id IS NULL OR (filtered.created_at, filtered.id) < (p_cursor_created_at, p_cursor_id)
+        ORDER BY filtered.created_at DESC, filtered.id DESC
+        LIMIT p_limit + 1
+    )
+    SELECT
+        (SELECT COUNT(*) FROM filtered),
+        (SELECT COALESCE(json_agg(to_jsonb(page) - 'page_row' ORDER BY page.page_row), '[]'::JSON) FROM page WHERE page.page_row <= p_limit),
+        (SELECT page.created_at FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit)),
+        (SELECT page.id FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit))
+    INTO v_total, v_rows, v_next_created_at, v_next_id;
+
+    RETURN json_build_object(
+        'deposits', v_rows,
+        'total', v_total,
+        'next_cursor_created_at', v_next_created_at,
+        'next_cursor_id', v_next_id
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE INDEX IF NOT EXISTS idx_stake_deposits_userid_created_at ON stake_deposits(userid, created_at DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION get_stakes_page(
+    p_user_id VARCHAR,
+    p_stake_type VARCHAR DEFAULT NULL,
+    p_created_from TIMESTAMPTZ DEFAULT NULL,
+    p_created_to TIMESTAMPTZ DEFAULT NULL,
+    p_cursor_created_at TIMESTAMP DEFAULT NULL,
+    p_cursor_id UUID DEFAULT NULL,
+    p_limit INTEGER DEFAULT 50
+) RETURNS JSON AS $$
+DECLARE
+    v_total BIGINT;
+    v_rows JSON;
+    v_next_created_at TIMESTAMP;
+    v_next_id UUID;
+BEGIN
+    WITH filtered AS (
+        SELECT * FROM stake_deposits
+        WHERE stake_deposits.userid = p_user_id
+            AND (p_stake_type IS NULL OR stake_deposits.stake_type = p_stake_type)
+            AND (p_created_from IS NULL OR stake_deposits.created_at >= p_created_from)
+            AND (p_created_to IS NULL OR stake_deposits.created_at < p_created_to)
+    ), page AS (
+        SELECT *, ROW_NUMBER() OVER (ORDER BY filtered.created_at DESC, filtered.id DESC) AS page_row
+        FROM filtered
+        WHERE p_cursor_id IS NULL OR (filtered.created_at, filtered.id) < (p_cursor_created_at, p_cursor_id)
+        ORDER BY filtered.created_at DESC, filtered.id DESC
+        LIMIT p_limit + 1
+    )
+    SELECT
+        (SELECT COUNT(*) FROM filtered),
+        (SELECT COALESCE(json_agg(to_jsonb(page) - 'page_row' ORDER BY page.page_row), '[]'::JSON) FROM page WHERE page.page_row <= p_limit),
+        (SELECT page.created_at FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit)),
+        (SELECT page.id FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit))
+    INTO v_total, v_rows, v_next_created_at, v_next_id;
+
+    RETURN json_build_object(
+        'stakes', v_rows,
+        'total', v_total,
+        'next_cursor_created_at', v_next_created_at,
+        'next_cursor_id', v_next_id
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE INDEX IF NOT EXISTS idx_pending_withdrawals_userid_created_at ON pending_withdrawals(userid, created_at DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION get_withdrawals_page(
+    p_user_id VARCHAR,
+    p_status VARCHAR[] DEFAULT NULL,
+    p_created_from TIMESTAMPTZ DEFAULT NULL,
+    p_created_to TIMESTAMPTZ DEFAULT NULL,
+    p_cursor_created_at TIMESTAMP DEFAULT NULL,
+    p_cursor_id UUID DEFAULT NULL,
+    p_limit INTEGER DEFAULT 50
+) RETURNS JSON AS $$
+DECLARE
+    v_total BIGINT;
+    v_rows JSON;
+    v_next_created_at TIMESTAMP;
+    v_next_id UUID;
+BEGIN
+    WITH filtered AS (
+        SELECT * FROM pending_withdrawals
+        WHERE pending_withdrawals.userid = p_user_id
+            AND (p_status IS NULL OR pending_withdrawals.status = ANY(p_status))
+            AND (p_created_from IS NULL OR pending_withdrawals.created_at >= p_created_from)
+            AND (p_created_to IS NULL OR pending_withdrawals.created_at < p_created_to)
+    ), page AS (
+        SELECT *, ROW_NUMBER() OVER (ORDER BY filtered.created_at DESC, filtered.id DESC) AS page_row
+        FROM filtered
+        WHERE p_cursor_id IS NULL OR (filtered.created_at, filtered.id) < (p_cursor_created_at, p_cursor_id)
+        ORDER BY filtered.created_at DESC, filtered.id DESC
+        LIMIT p_limit + 1
+    )
+    SELECT
+        (SELECT COUNT(*) FROM filtered),
+        (SELECT COALESCE(json_agg(to_jsonb(page) - 'page_row' ORDER BY page.page_row), '[]'::JSON) FROM page WHERE page.page_row <= p_limit),
+        (SELECT page.created_at FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit)),
+        (SELECT page.id FROM page WHERE page.page_row = p_limit AND EXISTS (SELECT 1 FROM page WHERE page.page_row > p_limit))
+    INTO v_total, v_rows, v_next_created_at, v_next_id;
+
+    RETURN json_build_object(
+        'withdrawals', v_rows,
+        'total', v_total,
+        'next_cursor_created_at', v_next_created_at,
+        'next_cursor_id', v_next_id
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT EXECUTE ON FUNCTION get_deposits_page(VARCHAR, VARCHAR, TIMESTAMPTZ, TIMESTAMPTZ, TIMESTAMP, UUID, INTEGER) TO public;
+GRANT EXECUTE ON FUNCTION get_stakes_page(VARCHAR, VARCHAR, TIMESTAMPTZ, TIMESTAMPTZ, TIMESTAMP, UUID, INTEGER) TO public;
+GRANT EXECUTE ON FUNCTION get_withdrawals_page(VARCHAR, VARCHAR[], TIMESTAMPTZ, TIMESTAMPTZ, TIMESTAMP, UUID, INTEGER) TO public;
@@ -0,0 +1,3 @@
+-- per user nonce, signed into every EIP-712 message (order, close, cancel, withdrawal)
+-- returned with the user row so the unsigned requests can build the typed data
+ALTER TABLE users ADD COLUMN IF NOT EXISTS nonce BIGINT NOT NULL DEFAULT 0;
@@ -51,16 +51,6 @@ func example() {
 	// 	log.Printf("Error creating order: %v", err)
 	// }
 
-	// Example: Modify an order
-	orderUpdate := map[string]interface{}{
-		"status": "filled",
-		"amount": 150000000, // Adjusted to 150 nano-USD
-	}
-	err = ModifyOrder(supabaseClient, "example_order_id", orderUpdate)
-	if err != nil {
-		log.Printf("Error modifying order: %v", err)
-	}
-
 	// Example: Close an order
 	// err = CloseOrder(supabaseClient, "example_order_id")
 	// if err != nil {
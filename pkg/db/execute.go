@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
 	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
 	"github.com/google/uuid"
 	"github.com/supabase-community/supabase-go"
@@ -53,19 +55,21 @@ func ModifyUserBalance(client *supabase.Client, userID string, newBalance int64)
 	return nil
 }
 
-func SignOrder(client *supabase.Client, orderId string) (*SignOrderResponse, error) {
+// SignOrder signs an unsigned order and consumes the users nonce in the same transaction
+func SignOrder(client *supabase.Client, orderId string, nonce uint64) (*SignOrderResponse, error) {
 	_, err := uuid.Parse(orderId)
 	if err != nil {
 		return nil, fmt.Errorf("invalid UUID format: %v", err)
 	}
 
 	params := map[string]interface{}{
-		"order_id": orderId,
+		"p_order_id": orderId,
+		"p_nonce":    nonce,
 	}
 
-	utils.LogInfo("sign_order params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("sign_order_with_nonce params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("sign_order", "estimate", params)
+	response := client.Rpc("sign_order_with_nonce", "estimate", params)
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -88,7 +92,7 @@ func SignOrder(client *supabase.Client, orderId string) (*SignOrderResponse, err
 func CreateOrder(
 	client *supabase.Client,
 	userId, orderType, pair, pairId string,
-	leverage, collateral, entryPrice, liquidationPrice, maxPrice, limitPrice, stopLossPrice, takeProfitPrice, takeProfitValue, takeProfitCollateral, openFee float64) (*UnsignedCreateOrderResponse, error) {
+	leverage, collateral, entryPrice, liquidationPrice, maxPrice, limitPrice, stopLossPrice, takeProfitPrice, takeProfitValue, takeProfitCollateral, openFee decimal.Decimal) (*UnsignedCreateOrderResponse, error) {
 	// Convert chainID, block, and depositNonce to string for TEXT type in the database
 	params := map[string]interface{}{
 		"user_id":     userId,
@@ -103,15 +107,15 @@ func CreateOrder(
 		"open_fee":    openFee,
 	}
 
-	if limitPrice != 0 {
+	if !limitPrice.IsZero() {
 		params["lim_price"] = limitPrice
 	}
 
-	if stopLossPrice != 0 {
+	if !stopLossPrice.IsZero() {
 		params["stop_price"] = stopLossPrice
 	}
 
-	if takeProfitPrice != 0 && takeProfitValue != 0 && takeProfitCollateral != 0 {
+	if !takeProfitPrice.IsZero() && !takeProfitValue.IsZero() && !takeProfitCollateral.IsZero() {
 		params["tp_price"] = takeProfitPrice
 		params["tp_value"] = takeProfitValue
 		params["tp_collateral"] = takeProfitCollateral
@@ -142,13 +146,753 @@ func CreateOrder(
 	return &order, nil
 }
 
-func ModifyOrder(client *supabase.Client, orderID string, updatedData map[string]interface{}) error {
-	_, _, err := client.From("orders").Update(updatedData, "", "").Eq("id", orderID).Execute()
-	if err != nil {
-		log.Printf("Failed to modify order: %v", err)
-		return err
+// CreateOrderExitLevels adds the take profit and stop loss ladder of an unsigned order, levels match by index
+func CreateOrderExitLevels(client *supabase.Client, orderId string, kinds []string, prices, percents, collaterals []decimal.Decimal) (*[]OrderExitLevelResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id":    orderId,
+		"p_kinds":       kinds,
+		"p_prices":      prices,
+		"p_percents":    percents,
+		"p_collaterals": collaterals,
 	}
-	return nil
+
+	utils.LogInfo("create_order_exit_levels params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("create_order_exit_levels", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var levels []OrderExitLevelResponse
+	if err := json.Unmarshal([]byte(response), &levels); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order exit levels response: %v", err)
+	}
+
+	return &levels, nil
+}
+
+// CreateBracketOrders attaches the tp and sl children of an unsigned limit order, a zero price leaves that side out
+func CreateBracketOrders(client *supabase.Client, orderId string, tpPrice, slPrice decimal.Decimal) (*[]ReduceOnlyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_parent_id": orderId,
+		"p_tp_price":  nil,
+		"p_sl_price":  nil,
+	}
+	if !tpPrice.IsZero() {
+		params["p_tp_price"] = tpPrice
+	}
+	if !slPrice.IsZero() {
+		params["p_sl_price"] = slPrice
+	}
+
+	utils.LogInfo("create_bracket_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("create_bracket_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []ReduceOnlyOrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling reduce-only orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+// UnsignedReduceOnlyOrder creates a reduce-only order on a limit or pending order, ocoWith is empty or an order to link with
+func UnsignedReduceOnlyOrder(client *supabase.Client, orderId, kind string, triggerPrice, closePercent decimal.Decimal, ocoWith string) (*UnsignedReduceOnlyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_parent_id":     orderId,
+		"p_kind":          kind,
+		"p_trigger_price": triggerPrice,
+		"p_close_percent": closePercent,
+		"p_oco_with":      nil,
+	}
+	if ocoWith != "" {
+		params["p_oco_with"] = ocoWith
+	}
+
+	utils.LogInfo("unsigned_reduce_only_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("unsigned_reduce_only_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute unsigned_reduce_only_order for order ID %v", orderId)
+	}
+
+	var order UnsignedReduceOnlyOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func SignReduceOnlyOrder(client *supabase.Client, reduceOnlyOrderId, signatureId string, nonce uint64) (*SignedReduceOnlyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_reduce_only_order_id": reduceOnlyOrderId,
+		"p_signature_id":         signatureId,
+		"p_nonce":                nonce,
+	}
+
+	utils.LogInfo("signed_reduce_only_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_reduce_only_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_reduce_only_order for ID %v", reduceOnlyOrderId)
+	}
+
+	var order SignedReduceOnlyOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func CancelReduceOnlyOrder(client *supabase.Client, reduceOnlyOrderId string) (*UnsignedCancelOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_reduce_only_order_id": reduceOnlyOrderId,
+	}
+
+	utils.LogInfo("unsigned_cancel_reduce_only_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("unsigned_cancel_reduce_only_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute unsigned_cancel_reduce_only_order for ID %v", reduceOnlyOrderId)
+	}
+
+	var order UnsignedCancelOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func SignCancelReduceOnlyOrder(client *supabase.Client, reduceOnlyOrderId, signatureId string, nonce uint64) (*SignedReduceOnlyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_reduce_only_order_id": reduceOnlyOrderId,
+		"p_signature_id":         signatureId,
+		"p_nonce":                nonce,
+	}
+
+	utils.LogInfo("signed_cancel_reduce_only_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_cancel_reduce_only_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_cancel_reduce_only_order for ID %v", reduceOnlyOrderId)
+	}
+
+	var order SignedReduceOnlyOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// UnsignedAlgoOrder creates an algo order with its planned slices, limPrices is empty for a twap
+func UnsignedAlgoOrder(client *supabase.Client, userId, kind, positionType, pair, pairId string, leverage decimal.Decimal, intervalSeconds int64, priceFrom, priceTo, liqDistance, maxDistance decimal.Decimal, collaterals, openFees, limPrices []decimal.Decimal) (*UnsignedAlgoOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_user_id":          userId,
+		"p_kind":             kind,
+		"p_order_type":       positionType,
+		"p_pair":             pair,
+		"p_pair_id":          pairId,
+		"p_leverage":         leverage,
+		"p_interval_seconds": intervalSeconds,
+		"p_price_from":       nil,
+		"p_price_to":         nil,
+		"p_liq_distance":     liqDistance,
+		"p_max_distance":     maxDistance,
+		"p_collaterals":      collaterals,
+		"p_open_fees":        openFees,
+		"p_lim_prices":       limPrices,
+	}
+	if !priceFrom.IsZero() {
+		params["p_price_from"] = priceFrom
+	}
+	if !priceTo.IsZero() {
+		params["p_price_to"] = priceTo
+	}
+
+	utils.LogInfo("unsigned_algo_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("unsigned_algo_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute unsigned_algo_order for user ID %v", userId)
+	}
+
+	var order UnsignedAlgoOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func SignAlgoOrder(client *supabase.Client, algoOrderId, signatureId string, nonce uint64) (*SignedAlgoOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_algo_order_id": algoOrderId,
+		"p_signature_id":  signatureId,
+		"p_nonce":         nonce,
+	}
+
+	utils.LogInfo("signed_algo_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_algo_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_algo_order for ID %v", algoOrderId)
+	}
+
+	var order SignedAlgoOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// CancelAlgoOrder stops the slices not spawned yet and cancels the resting ones, filled slices are left open
+func CancelAlgoOrder(client *supabase.Client, algoOrderId string) (*UnsignedCancelOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_algo_order_id": algoOrderId,
+	}
+
+	utils.LogInfo("unsigned_cancel_algo_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("unsigned_cancel_algo_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute unsigned_cancel_algo_order for ID %v", algoOrderId)
+	}
+
+	var order UnsignedCancelOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func SignCancelAlgoOrder(client *supabase.Client, algoOrderId, signatureId string, nonce uint64) (*SignedAlgoOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_algo_order_id": algoOrderId,
+		"p_signature_id":  signatureId,
+		"p_nonce":         nonce,
+	}
+
+	utils.LogInfo("signed_cancel_algo_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_cancel_algo_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_cancel_algo_order for ID %v", algoOrderId)
+	}
+
+	var order SignedAlgoOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// CreateOrdersBatch creates the orders in one transaction, an order that fails is reported in the results and not part of the batch
+func CreateOrdersBatch(client *supabase.Client, userId string, orders []BatchOrder) (*UnsignedOrderBatchResponse, error) {
+	items := make([]map[string]interface{}, 0, len(orders))
+	for _, order := range orders {
+		item := map[string]interface{}{
+			"index":         order.Index,
+			"order_type":    order.OrderType,
+			"pair":          order.Pair,
+			"pair_id":       order.PairId,
+			"leverage":      order.Leverage,
+			"collateral":    order.Collateral,
+			"entry_price":   order.EntryPrice,
+			"liq_price":     order.LiquidationPrice,
+			"max_price":     order.MaxPrice,
+			"open_fee":      order.OpenFee,
+			"lim_price":     nil,
+			"stop_price":    nil,
+			"tp_price":      nil,
+			"tp_value":      nil,
+			"tp_collateral": nil,
+			"entry_type":    order.EntryType,
+			"trigger_price": nil,
+			"expires_at":    nil,
+		}
+		if !order.LimitPrice.IsZero() {
+			item["lim_price"] = order.LimitPrice
+		}
+		if !order.StopLossPrice.IsZero() {
+			item["stop_price"] = order.StopLossPrice
+		}
+		if !order.TakeProfitPrice.IsZero() && !order.TakeProfitValue.IsZero() && !order.TakeProfitCollateral.IsZero() {
+			item["tp_price"] = order.TakeProfitPrice
+			item["tp_value"] = order.TakeProfitValue
+			item["tp_collateral"] = order.TakeProfitCollateral
+		}
+		if !order.TriggerPrice.IsZero() {
+			item["trigger_price"] = order.TriggerPrice
+		}
+		if !order.ExpiresAt.IsZero() {
+			item["expires_at"] = order.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		if order.ClientOrderId != "" {
+			item["client_order_id"] = order.ClientOrderId
+			item["client_order_hash"] = order.ClientOrderHash
+		}
+		items = append(items, item)
+	}
+
+	params := map[string]interface{}{
+		"p_user_id": userId,
+		"p_orders":  items,
+	}
+
+	utils.LogInfo("create_orders_batch params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("create_orders_batch", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute create_orders_batch for user ID %v", userId)
+	}
+
+	var batch UnsignedOrderBatchResponse
+	if err := json.Unmarshal([]byte(response), &batch); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &batch, nil
+}
+
+// CancelOrdersBatch records a cancel batch of the unsigned and limit orders of the user, the other orders are reported in the results
+func CancelOrdersBatch(client *supabase.Client, userId string, orderIds []string) (*UnsignedOrderBatchResponse, error) {
+	params := map[string]interface{}{
+		"p_user_id":   userId,
+		"p_order_ids": orderIds,
+	}
+
+	utils.LogInfo("unsigned_cancel_orders_batch params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("unsigned_cancel_orders_batch", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute unsigned_cancel_orders_batch for user ID %v", userId)
+	}
+
+	var batch UnsignedOrderBatchResponse
+	if err := json.Unmarshal([]byte(response), &batch); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &batch, nil
+}
+
+// SignOrdersBatch signs or cancels every order of a batch depending on its action
+func SignOrdersBatch(client *supabase.Client, batchId, signatureId string, nonce uint64) (*SignedOrderBatchResponse, error) {
+	params := map[string]interface{}{
+		"p_batch_id":     batchId,
+		"p_signature_id": signatureId,
+		"p_nonce":        nonce,
+	}
+
+	utils.LogInfo("signed_orders_batch params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_orders_batch", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_orders_batch for ID %v", batchId)
+	}
+
+	var batch SignedOrderBatchResponse
+	if err := json.Unmarshal([]byte(response), &batch); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &batch, nil
+}
+
+// CreateOrderWithClientId is CreateOrder labeled with a client order id in the same transaction, hash is the fingerprint
+// of the params it was created with, an order the user already has with this client order id is returned as Existing
+func CreateOrderWithClientId(
+	client *supabase.Client,
+	userId, orderType, pair, pairId, clientOrderId, hash string,
+	leverage, collateral, entryPrice, liquidationPrice, maxPrice, limitPrice, stopLossPrice, takeProfitPrice, takeProfitValue, takeProfitCollateral, openFee decimal.Decimal) (*UnsignedCreateOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_user_id":           userId,
+		"p_order_type":        orderType,
+		"p_leverage":          leverage,
+		"p_pair":              pair,
+		"p_pair_id":           pairId,
+		"p_collateral":        collateral,
+		"p_entry_price":       entryPrice,
+		"p_liq_price":         liquidationPrice,
+		"p_max_price":         maxPrice,
+		"p_open_fee":          openFee,
+		"p_client_order_id":   clientOrderId,
+		"p_client_order_hash": hash,
+	}
+
+	if !limitPrice.IsZero() {
+		params["p_lim_price"] = limitPrice
+	}
+
+	if !stopLossPrice.IsZero() {
+		params["p_stop_price"] = stopLossPrice
+	}
+
+	if !takeProfitPrice.IsZero() && !takeProfitValue.IsZero() && !takeProfitCollateral.IsZero() {
+		params["p_tp_price"] = takeProfitPrice
+		params["p_tp_value"] = takeProfitValue
+		params["p_tp_collateral"] = takeProfitCollateral
+	}
+
+	utils.LogInfo("create_order_with_client_id params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("create_order_with_client_id", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute create_order_with_client_id for user ID %v", userId)
+	}
+
+	var order UnsignedCreateOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// SetOrderTrailingStop makes the stop of an unsigned order trail the most favourable price, one of amount and percent is zero
+func SetOrderTrailingStop(client *supabase.Client, orderId string, trailAmount, trailPercent, trailExtreme decimal.Decimal) (*OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id":      orderId,
+		"p_trail_amount":  nil,
+		"p_trail_percent": nil,
+		"p_trail_extreme": trailExtreme,
+	}
+	if !trailAmount.IsZero() {
+		params["p_trail_amount"] = trailAmount
+	}
+	if !trailPercent.IsZero() {
+		params["p_trail_percent"] = trailPercent
+	}
+
+	utils.LogInfo("set_order_trailing_stop params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("set_order_trailing_stop", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute set_order_trailing_stop for order ID %v", orderId)
+	}
+
+	var order OrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// SetOrderEntry sets how an unsigned order enters, the trigger price is zero for anything but a stop limit
+func SetOrderEntry(client *supabase.Client, orderId string, entryType string, triggerPrice decimal.Decimal) (*OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id":      orderId,
+		"p_entry_type":    entryType,
+		"p_trigger_price": nil,
+	}
+	if !triggerPrice.IsZero() {
+		params["p_trigger_price"] = triggerPrice
+	}
+
+	utils.LogInfo("set_order_entry params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("set_order_entry", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute set_order_entry for order ID %v", orderId)
+	}
+
+	var order OrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// SetOrderExpiry makes an unsigned limit order good-till-time, expire_orders cancels it once expiresAt passes
+func SetOrderExpiry(client *supabase.Client, orderId string, expiresAt time.Time) (*OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id":   orderId,
+		"p_expires_at": expiresAt.UTC().Format(time.RFC3339),
+	}
+
+	utils.LogInfo("set_order_expiry params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("set_order_expiry", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute set_order_expiry for order ID %v", orderId)
+	}
+
+	var order OrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func UnsignedModifyOrder(client *supabase.Client, orderId string, limitPrice, stopLossPrice, liquidationPrice, maxPrice, takeProfitPrice, takeProfitValue, takeProfitCollateral decimal.Decimal) (*UnsignedModifyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id":      orderId,
+		"p_lim_price":     nil,
+		"p_stop_price":    nil,
+		"p_liq_price":     liquidationPrice,
+		"p_max_price":     maxPrice,
+		"p_tp_price":      nil,
+		"p_tp_value":      nil,
+		"p_tp_collateral": nil,
+	}
+
+	if !limitPrice.IsZero() {
+		params["p_lim_price"] = limitPrice
+	}
+
+	if !stopLossPrice.IsZero() {
+		params["p_stop_price"] = stopLossPrice
+	}
+
+	if !takeProfitPrice.IsZero() && !takeProfitValue.IsZero() && !takeProfitCollateral.IsZero() {
+		params["p_tp_price"] = takeProfitPrice
+		params["p_tp_value"] = takeProfitValue
+		params["p_tp_collateral"] = takeProfitCollateral
+	}
+
+	utils.LogInfo("unsigned_modify_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("unsigned_modify_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute unsigned_modify_order for order ID %v", orderId)
+	}
+
+	var modification UnsignedModifyOrderResponse
+	if err := json.Unmarshal([]byte(response), &modification); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &modification, nil
+}
+
+func SignModifyOrder(client *supabase.Client, modificationId, signatureId string, nonce uint64) (*SignedModifyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_modification_id": modificationId,
+		"p_signature_id":          signatureId,
+		"p_nonce":                 nonce,
+	}
+
+	utils.LogInfo("signed_modify_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_modify_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_modify_order for modification ID %v", modificationId)
+	}
+
+	var order SignedModifyOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// UnsignedMarginOrder stores the position values after adding or removing margin, the size is unchanged
+func UnsignedMarginOrder(client *supabase.Client, orderId string, collateral, leverage, liquidationPrice, maxPrice, takeProfitValue, takeProfitCollateral decimal.Decimal) (*UnsignedModifyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id":      orderId,
+		"p_collateral":    collateral,
+		"p_leverage":      leverage,
+		"p_liq_price":     liquidationPrice,
+		"p_max_price":     maxPrice,
+		"p_tp_value":      nil,
+		"p_tp_collateral": nil,
+	}
+
+	if !takeProfitValue.IsZero() && !takeProfitCollateral.IsZero() {
+		params["p_tp_value"] = takeProfitValue
+		params["p_tp_collateral"] = takeProfitCollateral
+	}
+
+	utils.LogInfo("unsigned_margin_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("unsigned_margin_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute unsigned_margin_order for order ID %v", orderId)
+	}
+
+	var modification UnsignedModifyOrderResponse
+	if err := json.Unmarshal([]byte(response), &modification); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &modification, nil
+}
+
+// SignMarginOrder applies the margin change, moving balance to or from escrow and updating current_borrowed
+func SignMarginOrder(client *supabase.Client, modificationId, signatureId string, nonce uint64) (*SignedModifyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_modification_id": modificationId,
+		"p_signature_id":          signatureId,
+		"p_nonce":                 nonce,
+	}
+
+	utils.LogInfo("signed_margin_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_margin_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_margin_order for modification ID %v", modificationId)
+	}
+
+	var order SignedModifyOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
 }
 
 func CloseOrder(client *supabase.Client, orderID string) (*UnsignedCloseOrderResponse, error) {
@@ -182,20 +926,22 @@ func CloseOrder(client *supabase.Client, orderID string) (*UnsignedCloseOrderRes
 	return &order, nil
 }
 
-func SignCloseOrder(client *supabase.Client, orderId, signatureId string, remainingCollateral, payoutValue, closeFee, closePrice float64) (*SignedCloseOrderResponse, error) {
+func SignCloseOrder(client *supabase.Client, orderId, signatureId string, nonce uint64, remainingCollateral, payoutValue, closeFee, closePrice, funding decimal.Decimal) (*SignedCloseOrderResponse, error) {
 	params := map[string]interface{}{
-		"order_id":             orderId,
-		"signature_id":         signatureId,
-		"remaining_collateral": remainingCollateral,
-		"payout_value":         payoutValue,
-		"close_fee_":           closeFee,
-		"close_price_":         closePrice,
+		"p_order_id":             orderId,
+		"p_signature_id":         signatureId,
+		"p_nonce":                nonce,
+		"p_remaining_collateral": remainingCollateral,
+		"p_payout_value":         payoutValue,
+		"p_close_fee":            closeFee,
+		"p_close_price":          closePrice,
+		"p_funding":              funding,
 	}
 
-	utils.LogInfo("signed_close_order params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("signed_close_order_with_nonce params", utils.StringifyStructFields(params, ""))
 
 	// Execute the RPC call
-	response := client.Rpc("signed_close_order", "exact", params)
+	response := client.Rpc("signed_close_order_with_nonce", "exact", params)
 
 	// Check for any Supabase errors
 	var supabaseError SupabaseError
@@ -218,6 +964,103 @@ func SignCloseOrder(client *supabase.Client, orderId, signatureId string, remain
 	return &order, nil
 }
 
+// SignPartialCloseOrder closes part of the open collateral and records the fill, the rest of the position stays pending
+func SignPartialCloseOrder(client *supabase.Client, orderId, signatureId string, nonce uint64, closeCollateral, payoutValue, closeFee, closePrice, closeValue, takeProfitValue, takeProfitCollateral, funding decimal.Decimal) (*SignedPartialCloseOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id":         orderId,
+		"p_signature_id":     signatureId,
+		"p_nonce":            nonce,
+		"p_close_collateral": closeCollateral,
+		"p_payout_value":     payoutValue,
+		"p_close_fee":        closeFee,
+		"p_close_price":      closePrice,
+		"p_close_value":      closeValue,
+		"p_tp_value":         nil,
+		"p_tp_collateral":    nil,
+		"p_funding":          funding,
+	}
+
+	if !takeProfitValue.IsZero() && !takeProfitCollateral.IsZero() {
+		params["p_tp_value"] = takeProfitValue
+		params["p_tp_collateral"] = takeProfitCollateral
+	}
+
+	utils.LogInfo("signed_partial_close_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("signed_partial_close_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute signed_partial_close_order for order ID %v", orderId)
+	}
+
+	var order SignedPartialCloseOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	}
+
+	return &order, nil
+}
+
+// AccrueBorrowIndex brings the global borrow index up to now and resets the rate from the current utilization
+func AccrueBorrowIndex(client *supabase.Client) (*BorrowIndexResponse, error) {
+	params := map[string]interface{}{}
+
+	utils.LogInfo("accrue_borrow_index params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("accrue_borrow_index", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute accrue_borrow_index")
+	}
+
+	var index BorrowIndexResponse
+	if err := json.Unmarshal([]byte(response), &index); err != nil {
+		return nil, fmt.Errorf("error unmarshalling borrow index response: %v", err)
+	}
+
+	return &index, nil
+}
+
+// AccruePairFunding brings the pair funding index up to now and resets the rate from the current open interest
+func AccruePairFunding(client *supabase.Client, pairId string) (*PairFundingResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id": pairId,
+	}
+
+	utils.LogInfo("accrue_pair_funding params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("accrue_pair_funding", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return nil, fmt.Errorf("db error: failed to execute accrue_pair_funding for pair ID %v", pairId)
+	}
+
+	var funding PairFundingResponse
+	if err := json.Unmarshal([]byte(response), &funding); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pair funding response: %v", err)
+	}
+
+	return &funding, nil
+}
+
 func CancelOrder(client *supabase.Client, orderID string) (*UnsignedCancelOrderResponse, error) {
 	params := map[string]interface{}{
 		"order_id": orderID,
@@ -248,15 +1091,16 @@ func CancelOrder(client *supabase.Client, orderID string) (*UnsignedCancelOrderR
 	return &order, nil
 }
 
-func SignCancelOrder(client *supabase.Client, orderId, signatureId string) (*SignedCancelOrderResponse, error) {
+func SignCancelOrder(client *supabase.Client, orderId, signatureId string, nonce uint64) (*SignedCancelOrderResponse, error) {
 	params := map[string]interface{}{
-		"order_id":     orderId,
-		"signature_id": signatureId,
+		"p_order_id":     orderId,
+		"p_signature_id": signatureId,
+		"p_nonce":        nonce,
 	}
 
-	utils.LogInfo("signed_cancel_order params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("signed_cancel_order_with_nonce params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("signed_cancel_order", "exact", params)
+	response := client.Rpc("signed_cancel_order_with_nonce", "exact", params)
 
 	// Check for any Supabase errors
 	var supabaseError SupabaseError
@@ -308,9 +1152,11 @@ func GetOrCreateUser(client *supabase.Client, walletAddress, walletType string)
 	return &users, nil
 }
 
-func AddUserDeposit(client *supabase.Client, walletAddress, walletType, chainID, block, blockHash, txHash, sender, depositNonce, asset, amount, value string) error {
+// AddUserDeposit applies a deposit forwarded by the listener as query, its tx hash is consumed in the same rpc
+func AddUserDeposit(client *supabase.Client, query, walletAddress, walletType, chainID, block, blockHash, txHash, sender, depositNonce, asset, amount, value string) error {
 	// Convert chainID, block, and depositNonce to string for TEXT type in the database
 	params := map[string]interface{}{
+		"p_query":       query,
 		"wallet_addr":   walletAddress,
 		"wallet_t":      walletType,
 		"chain":         chainID,
@@ -324,9 +1170,9 @@ func AddUserDeposit(client *supabase.Client, walletAddress, walletType, chainID,
 		"val":           value,
 	}
 
-	utils.LogInfo("add_user_deposit params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("add_user_deposit_with_listener_request params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("add_user_deposit", "exact", params)
+	response := client.Rpc("add_user_deposit_with_listener_request", "exact", params)
 
 	// Check for any Supabase errors
 	var supabaseError SupabaseError
@@ -343,9 +1189,11 @@ func AddUserDeposit(client *supabase.Client, walletAddress, walletType, chainID,
 	return nil
 }
 
-func ProcessDepositAndStake(client *supabase.Client, walletAddress, walletType, chainID, block, blockHash, txHash, sender, depositNonce, asset, amount, value, stakeType string) error {
+// ProcessDepositAndStake applies a stake forwarded by the listener as query, its tx hash is consumed in the same rpc
+func ProcessDepositAndStake(client *supabase.Client, query, walletAddress, walletType, chainID, block, blockHash, txHash, sender, depositNonce, asset, amount, value, stakeType string) error {
 	// Convert chainID, block, and depositNonce to string for TEXT type in the database
 	params := map[string]interface{}{
+		"p_query":          query,
 		"wallet_addr":      walletAddress,
 		"wallet_t":         walletType,
 		"chain":            chainID,
@@ -360,9 +1208,9 @@ func ProcessDepositAndStake(client *supabase.Client, walletAddress, walletType,
 		"stake_type_param": stakeType,
 	}
 
-	utils.LogInfo("process_deposit_and_stake params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("process_deposit_and_stake_with_listener_request params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("process_deposit_and_stake", "exact", params)
+	response := client.Rpc("process_deposit_and_stake_with_listener_request", "exact", params)
 
 	// Check for any Supabase errors
 	var supabaseError SupabaseError
@@ -379,7 +1227,7 @@ func ProcessDepositAndStake(client *supabase.Client, walletAddress, walletType,
 	return nil
 }
 
-func Withdraw(client *supabase.Client, userId string, amount float64) (*UnsignedWithdrawalResponse, error) {
+func Withdraw(client *supabase.Client, userId string, amount decimal.Decimal) (*UnsignedWithdrawalResponse, error) {
 	params := map[string]interface{}{
 		"p_user_id": userId,
 		"p_amount":  amount,
@@ -411,16 +1259,17 @@ func Withdraw(client *supabase.Client, userId string, amount float64) (*Unsigned
 	return &withdrawal, nil
 }
 
-func SignWithdraw(client *supabase.Client, withdrawalId, signatureId string) (*SignedWithdrawalResponse, error) {
+func SignWithdraw(client *supabase.Client, withdrawalId, signatureId string, nonce uint64) (*SignedWithdrawalResponse, error) {
 	params := map[string]interface{}{
 		"p_withdrawal_id": withdrawalId,
 		"p_signature_id":  signatureId,
+		"p_nonce":         nonce,
 	}
 
-	utils.LogInfo("signed_create_withdraw params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("signed_create_withdraw_with_nonce params", utils.StringifyStructFields(params, ""))
 
 	// Execute the RPC call
-	response := client.Rpc("signed_create_withdraw", "exact", params)
+	response := client.Rpc("signed_create_withdraw_with_nonce", "exact", params)
 
 	// Check for any Supabase errors
 	var supabaseError SupabaseError
@@ -443,7 +1292,7 @@ func SignWithdraw(client *supabase.Client, withdrawalId, signatureId string) (*S
 	return &withdrawal, nil
 }
 
-func Unstake(client *supabase.Client, userId, stakeType string, amount float64) (*ProcessUnstakeResponse, error) {
+func Unstake(client *supabase.Client, userId, stakeType string, amount decimal.Decimal) (*ProcessUnstakeResponse, error) {
 	params := map[string]interface{}{
 		"p_user_id":    userId,
 		"p_stake_type": stakeType,
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/pagination"
 	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
 	"github.com/supabase-community/supabase-go"
 )
@@ -39,38 +40,16 @@ func GetUserByUserId(client *supabase.Client, userId string) (*UserResponse, err
 	return &users, nil
 }
 
-func GetDepositsByUserId(client *supabase.Client, userId string) (*[]DepositResponse, error) {
-	params := map[string]interface{}{
-		"user_id": userId,
-	}
-
-	utils.LogInfo("get_deposits_by_userid params", utils.StringifyStructFields(params, ""))
-
-	response := client.Rpc("get_deposits_by_userid", "exact", params)
-
-	var supabaseError SupabaseError
-	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
-		LogSupabaseError(supabaseError)
-		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
-	}
-
-	var deposits []DepositResponse
-	if err := json.Unmarshal([]byte(response), &deposits); err != nil {
-		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
-	}
-
-	return &deposits, nil
-}
-
-func GetDepositsByUserAddress(client *supabase.Client, walletAddress, walletType string) (*[]DepositResponse, error) {
+// GetUserByWallet returns the user of a wallet without creating one, nil when the wallet has no user
+func GetUserByWallet(client *supabase.Client, walletAddress, walletType string) (*UserResponse, error) {
 	params := map[string]interface{}{
 		"wallet_addr": walletAddress,
 		"wallet_t":    walletType,
 	}
 
-	utils.LogInfo("get_deposits_by_address params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("get_user_by_wallet params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("get_deposits_by_address", "exact", params)
+	response := client.Rpc("get_user_by_wallet", "exact", params)
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -78,13 +57,16 @@ func GetDepositsByUserAddress(client *supabase.Client, walletAddress, walletType
 		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
 	}
 
-	var deposits []DepositResponse
-	err := json.Unmarshal([]byte(response), &deposits)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling db.rpc response: %v", err)
+	if response == "" || response == "null" {
+		return nil, nil
+	}
+
+	var user UserResponse
+	if err := json.Unmarshal([]byte(response), &user); err != nil {
+		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
 	}
 
-	return &deposits, nil
+	return &user, nil
 }
 
 func GetOrderById(client *supabase.Client, id string) (*OrderAndUserResponse, error) {
@@ -111,14 +93,16 @@ func GetOrderById(client *supabase.Client, id string) (*OrderAndUserResponse, er
 	return &order, nil
 }
 
-func GetOrdersByUserId(client *supabase.Client, userId string) (*[]OrderResponse, error) {
+// GetOrderByClientId returns nil when the user has no order with this client order id
+func GetOrderByClientId(client *supabase.Client, userId, clientOrderId string) (*OrderByClientIdResponse, error) {
 	params := map[string]interface{}{
-		"user_id": userId,
+		"p_user_id":         userId,
+		"p_client_order_id": clientOrderId,
 	}
 
-	utils.LogInfo("get_orders_by_userid2 params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("get_order_by_client_id params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("get_orders_by_userid2", "exact", params)
+	response := client.Rpc("get_order_by_client_id", "exact", params)
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -126,23 +110,32 @@ func GetOrdersByUserId(client *supabase.Client, userId string) (*[]OrderResponse
 		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
 	}
 
-	var orders []OrderResponse
-	if err := json.Unmarshal([]byte(response), &orders); err != nil {
-		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
+	if response == "" || response == "null" {
+		return nil, nil
 	}
 
-	return &orders, nil
+	var order OrderByClientIdResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order response: %v", err)
+	}
+
+	return &order, nil
 }
 
-func GetOrdersByUserAddress(client *supabase.Client, walletAddress, walletType string) (*[]OrderResponse, error) {
-	params := map[string]interface{}{
-		"wallet_addr": walletAddress,
-		"wallet_t":    walletType,
+// GetSignatureRequest returns the signature request by id, or the latest one of the reference when signatureId is empty
+// nil when there is none
+func GetSignatureRequest(client *supabase.Client, signatureId, referenceId string) (*SignatureRequestResponse, error) {
+	params := map[string]interface{}{}
+	if signatureId != "" {
+		params["p_signature_id"] = signatureId
+	}
+	if referenceId != "" {
+		params["p_reference_id"] = referenceId
 	}
 
-	utils.LogInfo("get_orders_by_address2 params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("get_signature_request params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("get_orders_by_address2", "exact", params)
+	response := client.Rpc("get_signature_request", "exact", params)
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -150,12 +143,16 @@ func GetOrdersByUserAddress(client *supabase.Client, walletAddress, walletType s
 		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
 	}
 
-	var orders []OrderResponse
-	if err := json.Unmarshal([]byte(response), &orders); err != nil {
-		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
+	if response == "" || response == "null" {
+		return nil, nil
 	}
 
-	return &orders, nil
+	var request SignatureRequestResponse
+	if err := json.Unmarshal([]byte(response), &request); err != nil {
+		return nil, fmt.Errorf("error unmarshalling signature request response: %v", err)
+	}
+
+	return &request, nil
 }
 
 func GetSignatureValidationHash(client *supabase.Client, SignatureId string) (*GetSignatureValidationHashResponse, error) {
@@ -231,22 +228,250 @@ func GetSignatureHash(client *supabase.Client, signatureId string) (*GetSignatur
 	return &order, nil
 }
 
-func GetStakesByUserId(client *supabase.Client, userId string, stakeType string, limit float64) (*StakesAndUserResponse, error) {
+func GetPendingWithdrawalById(client *supabase.Client, withdrawalId string) (*WithdrawalAndUserResponse, error) {
+	params := map[string]interface{}{
+		"p_id": withdrawalId,
+	}
+
+	utils.LogInfo("get_pending_withdrawal_by_id params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_pending_withdrawal_by_id", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var withdrawalAndUser WithdrawalAndUserResponse
+	if err := json.Unmarshal([]byte(response), &withdrawalAndUser); err != nil {
+		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
+	}
+
+	return &withdrawalAndUser, nil
+}
+
+func GetOrderModificationById(client *supabase.Client, modificationId string) (*OrderModificationResponse, error) {
+	params := map[string]interface{}{
+		"p_order_modification_id": modificationId,
+	}
+
+	utils.LogInfo("get_order_modification_by_id params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_order_modification_by_id", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var modification OrderModificationResponse
+	if err := json.Unmarshal([]byte(response), &modification); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order modification response: %v", err)
+	}
+
+	return &modification, nil
+}
+
+func GetOrderFillsByOrderId(client *supabase.Client, orderId string) (*[]OrderFillResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id": orderId,
+	}
+
+	utils.LogInfo("get_order_fills params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_order_fills", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var fills []OrderFillResponse
+	if err := json.Unmarshal([]byte(response), &fills); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order fills response: %v", err)
+	}
+
+	return &fills, nil
+}
+
+// GetOrderEvents lists the lifecycle of an order, oldest first
+func GetOrderEvents(client *supabase.Client, orderId string) (*[]OrderEventResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id": orderId,
+	}
+
+	utils.LogInfo("get_order_events params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_order_events", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var events []OrderEventResponse
+	if err := json.Unmarshal([]byte(response), &events); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order events response: %v", err)
+	}
+
+	return &events, nil
+}
+
+// GetOrderExitLevels lists the ladder of an order, filled levels included
+func GetOrderExitLevels(client *supabase.Client, orderId string) (*[]OrderExitLevelResponse, error) {
+	params := map[string]interface{}{
+		"p_order_id": orderId,
+	}
+
+	utils.LogInfo("get_order_exit_levels params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_order_exit_levels", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var levels []OrderExitLevelResponse
+	if err := json.Unmarshal([]byte(response), &levels); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order exit levels response: %v", err)
+	}
+
+	return &levels, nil
+}
+
+// GetReduceOnlyOrders lists the reduce-only orders of a parent order, ended ones included
+func GetReduceOnlyOrders(client *supabase.Client, orderId string) (*[]ReduceOnlyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_parent_id": orderId,
+	}
+
+	utils.LogInfo("get_reduce_only_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_reduce_only_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []ReduceOnlyOrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling reduce-only orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+func GetReduceOnlyOrderById(client *supabase.Client, reduceOnlyOrderId string) (*ReduceOnlyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_reduce_only_order_id": reduceOnlyOrderId,
+	}
+
+	utils.LogInfo("get_reduce_only_order_by_id params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_reduce_only_order_by_id", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var order ReduceOnlyOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling reduce-only order response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func GetOrderBatch(client *supabase.Client, batchId string) (*OrderBatchResponse, error) {
+	params := map[string]interface{}{
+		"p_batch_id": batchId,
+	}
+
+	utils.LogInfo("get_order_batch params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_order_batch", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var batch OrderBatchResponse
+	if err := json.Unmarshal([]byte(response), &batch); err != nil {
+		return nil, fmt.Errorf("error unmarshalling order batch response: %v", err)
+	}
+
+	return &batch, nil
+}
+
+// GetAlgoOrder returns an algo order with its slices and how much of it filled
+func GetAlgoOrder(client *supabase.Client, algoOrderId string) (*GetAlgoOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_algo_order_id": algoOrderId,
+	}
+
+	utils.LogInfo("get_algo_order params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_algo_order", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var order GetAlgoOrderResponse
+	if err := json.Unmarshal([]byte(response), &order); err != nil {
+		return nil, fmt.Errorf("error unmarshalling algo order response: %v", err)
+	}
+
+	return &order, nil
+}
+
+func GetAlgoOrders(client *supabase.Client, userId string) (*[]AlgoOrderResponse, error) {
 	params := map[string]interface{}{
 		"p_user_id": userId,
 	}
 
-	if stakeType != "" {
-		params["p_stake_type"] = stakeType
+	utils.LogInfo("get_algo_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_algo_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
 	}
 
-	if limit != 0 {
-		params["p_limit"] = limit
+	var orders []AlgoOrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling algo orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+// GetPairRiskParams returns the configured pairs, all of them when pairId is empty
+func GetPairRiskParams(client *supabase.Client, pairId string) (*[]PairRiskParamsResponse, error) {
+	params := map[string]interface{}{}
+	if pairId != "" {
+		params["p_pair_id"] = pairId
 	}
 
-	utils.LogInfo("get_stakes_by_user_id params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("get_pair_risk_params params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("get_stakes_by_user_id", "exact", params)
+	response := client.Rpc("get_pair_risk_params", "exact", params)
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -254,31 +479,193 @@ func GetStakesByUserId(client *supabase.Client, userId string, stakeType string,
 		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
 	}
 
-	var stakes StakesAndUserResponse
-	if err := json.Unmarshal([]byte(response), &stakes); err != nil {
-		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
+	var riskParams []PairRiskParamsResponse
+	if err := json.Unmarshal([]byte(response), &riskParams); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pair risk params response: %v", err)
 	}
 
-	return &stakes, nil
+	return &riskParams, nil
 }
 
-func GetStakesByUserAddress(client *supabase.Client, walletAddress, walletType, stakeType string, limit float64) (*StakesAndUserResponse, error) {
+// GetPairFunding returns the current funding of a pair, all pairs when pairId is empty
+func GetPairFunding(client *supabase.Client, pairId string) (*[]PairFundingResponse, error) {
+	params := map[string]interface{}{}
+	if pairId != "" {
+		params["p_pair_id"] = pairId
+	}
+
+	utils.LogInfo("get_pair_funding params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_pair_funding", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var funding []PairFundingResponse
+	if err := json.Unmarshal([]byte(response), &funding); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pair funding response: %v", err)
+	}
+
+	return &funding, nil
+}
+
+// GetFundingRates returns the hourly funding snapshots of a pair, newest first
+func GetFundingRates(client *supabase.Client, pairId string, limit int) (*[]FundingRateResponse, error) {
 	params := map[string]interface{}{
-		"wallet_addr": walletAddress,
-		"wallet_t":    walletType,
+		"p_pair_id": pairId,
+		"p_limit":   limit,
+	}
+
+	utils.LogInfo("get_funding_rates params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_funding_rates", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var rates []FundingRateResponse
+	if err := json.Unmarshal([]byte(response), &rates); err != nil {
+		return nil, fmt.Errorf("error unmarshalling funding rates response: %v", err)
+	}
+
+	return &rates, nil
+}
+
+// getPage runs a paged history rpc into page and returns the cursor of the next page, empty on the last one
+func getPage(client *supabase.Client, rpc string, params map[string]interface{}, window pagination.Page, page interface{}) (string, error) {
+	window.Params(params)
+
+	utils.LogInfo(rpc+" params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc(rpc, "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return "", fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" {
+		return "", fmt.Errorf("db error: failed to execute %v for user ID %v", rpc, params["p_user_id"])
+	}
+
+	var cursor pageCursorResponse
+	if err := json.Unmarshal([]byte(response), &cursor); err != nil {
+		return "", fmt.Errorf("error unmarshalling %v response: %v", rpc, err)
+	}
+	if err := json.Unmarshal([]byte(response), page); err != nil {
+		return "", fmt.Errorf("error unmarshalling %v response: %v", rpc, err)
+	}
+
+	return pagination.NextCursor(cursor.NextCursorCreatedAt, cursor.NextCursorId), nil
+}
+
+// GetOrdersByUserId returns a page of the order history of a user, newest first
+func GetOrdersByUserId(client *supabase.Client, userId string, filter OrderFilter, window pagination.Page) (*OrderPageResponse, error) {
+	params := map[string]interface{}{
+		"p_user_id":    userId,
+		"p_status":     nil,
+		"p_order_type": nil,
+		"p_pair":       nil,
+	}
+	if len(filter.Statuses) > 0 {
+		params["p_status"] = filter.Statuses
+	}
+	if filter.OrderType != "" {
+		params["p_order_type"] = filter.OrderType
+	}
+	if filter.Pair != "" {
+		params["p_pair"] = filter.Pair
+	}
+	filter.Created.Params(params, "p_created")
+	filter.Ended.Params(params, "p_ended")
+
+	var page OrderPageResponse
+	nextCursor, err := getPage(client, "get_orders_page", params, window, &page)
+	if err != nil {
+		return nil, err
 	}
+	page.NextCursor = nextCursor
 
+	return &page, nil
+}
+
+// GetDepositsByUserId returns a page of the deposits of a user, newest first, asset is the token contract address
+func GetDepositsByUserId(client *supabase.Client, userId, asset string, created pagination.TimeRange, window pagination.Page) (*DepositPageResponse, error) {
+	params := map[string]interface{}{
+		"p_user_id": userId,
+		"p_asset":   nil,
+	}
+	if asset != "" {
+		params["p_asset"] = asset
+	}
+	created.Params(params, "p_created")
+
+	var page DepositPageResponse
+	nextCursor, err := getPage(client, "get_deposits_page", params, window, &page)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = nextCursor
+
+	return &page, nil
+}
+
+// GetStakesByUserId returns a page of the stakes of a user, newest first
+func GetStakesByUserId(client *supabase.Client, userId, stakeType string, created pagination.TimeRange, window pagination.Page) (*StakePageResponse, error) {
+	params := map[string]interface{}{
+		"p_user_id":    userId,
+		"p_stake_type": nil,
+	}
 	if stakeType != "" {
 		params["p_stake_type"] = stakeType
 	}
+	created.Params(params, "p_created")
+
+	var page StakePageResponse
+	nextCursor, err := getPage(client, "get_stakes_page", params, window, &page)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = nextCursor
+
+	return &page, nil
+}
+
+// GetWithdrawalsByUserId returns a page of the withdrawals of a user, newest first
+func GetWithdrawalsByUserId(client *supabase.Client, userId string, statuses []string, created pagination.TimeRange, window pagination.Page) (*WithdrawalPageResponse, error) {
+	params := map[string]interface{}{
+		"p_user_id": userId,
+		"p_status":  nil,
+	}
+	if len(statuses) > 0 {
+		params["p_status"] = statuses
+	}
+	created.Params(params, "p_created")
 
-	if limit != 0 {
-		params["p_limit"] = limit
+	var page WithdrawalPageResponse
+	nextCursor, err := getPage(client, "get_withdrawals_page", params, window, &page)
+	if err != nil {
+		return nil, err
 	}
+	page.NextCursor = nextCursor
+
+	return &page, nil
+}
 
-	utils.LogInfo("get_stakes_by_user_address params", utils.StringifyStructFields(params, ""))
+// GetBorrowIndex returns the borrow index as last accrued, without accruing it
+func GetBorrowIndex(client *supabase.Client) (*BorrowIndexResponse, error) {
+	params := map[string]interface{}{}
 
-	response := client.Rpc("get_stakes_by_user_address", "exact", params)
+	utils.LogInfo("get_borrow_index params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_borrow_index", "exact", params)
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -286,22 +673,53 @@ func GetStakesByUserAddress(client *supabase.Client, walletAddress, walletType,
 		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
 	}
 
-	var stakes StakesAndUserResponse
-	if err := json.Unmarshal([]byte(response), &stakes); err != nil {
-		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
+	if response == "" || response == "null" {
+		return nil, fmt.Errorf("db error: no borrow index")
 	}
 
-	return &stakes, nil
+	var index BorrowIndexResponse
+	if err := json.Unmarshal([]byte(response), &index); err != nil {
+		return nil, fmt.Errorf("error unmarshalling borrow index response: %v", err)
+	}
+
+	return &index, nil
 }
 
-func GetPendingWithdrawalById(client *supabase.Client, withdrawalId string) (*WithdrawalAndUserResponse, error) {
+// GetAccruedBorrowIndex returns the borrow index accrued up to now without writing it
+func GetAccruedBorrowIndex(client *supabase.Client) (*BorrowIndexResponse, error) {
+	params := map[string]interface{}{}
+
+	utils.LogInfo("get_accrued_borrow_index params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_accrued_borrow_index", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	if response == "" || response == "null" {
+		return nil, fmt.Errorf("db error: no borrow index")
+	}
+
+	var index BorrowIndexResponse
+	if err := json.Unmarshal([]byte(response), &index); err != nil {
+		return nil, fmt.Errorf("error unmarshalling borrow index response: %v", err)
+	}
+
+	return &index, nil
+}
+
+// GetAccruedPairFunding returns the funding of a pair accrued up to now without writing it, nil when the pair was never accrued
+func GetAccruedPairFunding(client *supabase.Client, pairId string) (*PairFundingResponse, error) {
 	params := map[string]interface{}{
-		"p_id": withdrawalId,
+		"p_pair_id": pairId,
 	}
 
-	utils.LogInfo("get_pending_withdrawal_by_id params", utils.StringifyStructFields(params, ""))
+	utils.LogInfo("get_accrued_pair_funding params", utils.StringifyStructFields(params, ""))
 
-	response := client.Rpc("get_pending_withdrawal_by_id", "exact", params)
+	response := client.Rpc("get_accrued_pair_funding", "exact", params)
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -309,10 +727,19 @@ func GetPendingWithdrawalById(client *supabase.Client, withdrawalId string) (*Wi
 		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
 	}
 
-	var withdrawalAndUser WithdrawalAndUserResponse
-	if err := json.Unmarshal([]byte(response), &withdrawalAndUser); err != nil {
-		return nil, fmt.Errorf("error unmarshalling user response: %v", err)
+	if response == "" || response == "null" {
+		return nil, nil
 	}
 
-	return &withdrawalAndUser, nil
+	var funding PairFundingResponse
+	if err := json.Unmarshal([]byte(response), &funding); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pair funding response: %v", err)
+	}
+
+	// a composite NULL comes back as a row of nulls
+	if funding.PairId == "" {
+		return nil, nil
+	}
+
+	return &funding, nil
 }
@@ -4,66 +4,78 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/BlueSpadeXchain/blp-api/pkg/pagination"
 )
 
 type UserResponse struct {
-	ID              string  `json:"id"`
-	UserID          string  `json:"userid"`
-	WalletAddress   string  `json:"wallet_address"`
-	WalletType      string  `json:"wallet_type"`
-	Balance         float64 `json:"balance"`
-	PerpBalance     float64 `json:"perp_balance"`
-	EscrowBalance   float64 `json:"escrow_balance"`
-	FrozenBalance   float64 `json:"frozen_balance"`
-	BluStakeBalance float64 `json:"blu_stake_balance"`
-	BlpStakeBalance float64 `json:"blp_stake_balance"`
-	BluStakePending float64 `json:"blu_stake_pending"`
-	BlpStakePending float64 `json:"blp_stake_pending"`
-	TotalBalance    float64 `json:"total_balance"`
-	CreatedAt       string  `json:"created_at"`
+	ID              string          `json:"id"`
+	UserID          string          `json:"userid"`
+	WalletAddress   string          `json:"wallet_address"`
+	WalletType      string          `json:"wallet_type"`
+	Balance         decimal.Decimal `json:"balance"`
+	PerpBalance     decimal.Decimal `json:"perp_balance"`
+	EscrowBalance   decimal.Decimal `json:"escrow_balance"`
+	FrozenBalance   decimal.Decimal `json:"frozen_balance"`
+	BluStakeBalance decimal.Decimal `json:"blu_stake_balance"`
+	BlpStakeBalance decimal.Decimal `json:"blp_stake_balance"`
+	BluStakePending decimal.Decimal `json:"blu_stake_pending"`
+	BlpStakePending decimal.Decimal `json:"blp_stake_pending"`
+	TotalBalance    decimal.Decimal `json:"total_balance"`
+	Nonce           uint64          `json:"nonce"` // signed into every EIP-712 message
+	CreatedAt       string          `json:"created_at"`
 }
 
 type OrderResponse struct {
-	ID                   string     `json:"id"`
-	UserID               string     `json:"userid"`
-	OrderType            string     `json:"order_type"`
-	Leverage             float64    `json:"leverage"`
-	Pair                 string     `json:"pair"`
-	PairId               string     `json:"pair_id"`
-	OrderStatus          string     `json:"status"`
-	Collateral           float64    `json:"collateral"`
-	EntryPrice           float64    `json:"entry_price"`
-	ClosePrice           float64    `json:"close_price"`
-	LiquidationPrice     float64    `json:"liq_price"`
-	MaxPrice             float64    `json:"max_price"`
-	MaxValue             float64    `json:"max_value"`
-	LimitPrice           float64    `json:"limit_price"`
-	StopLossPrice        float64    `json:"stop_price"`
-	TakeProfitPrice      float64    `json:"tp_price"`
-	TakeProfitValue      float64    `json:"tp_value"`
-	TakeProfitCollateral float64    `json:"tp_collateral"`
-	CreatedAt            CustomTime `json:"created_at"`
-	SignedAt             CustomTime `json:"signed_at"`
-	StartedAt            CustomTime `json:"started_at"`
-	ModifiedAt           CustomTime `json:"modified_at"`
-	EndedAt              CustomTime `json:"ended_at"`
-	TakeProfitAt         CustomTime `json:"tp_at"`
-	ProfitAndLoss        float64    `json:"pnl"`
-	OpenFee              float64    `json:"open_fee"`
-	CloseFee             float64    `json:"close_fee"`
+	ID                   string          `json:"id"`
+	UserID               string          `json:"userid"`
+	OrderType            string          `json:"order_type"`
+	Leverage             decimal.Decimal `json:"leverage"`
+	Pair                 string          `json:"pair"`
+	PairId               string          `json:"pair_id"`
+	OrderStatus          string          `json:"status"`
+	Collateral           decimal.Decimal `json:"collateral"`
+	EntryPrice           decimal.Decimal `json:"entry_price"`
+	ClosePrice           decimal.Decimal `json:"close_price"`
+	LiquidationPrice     decimal.Decimal `json:"liq_price"`
+	MaxPrice             decimal.Decimal `json:"max_price"`
+	MaxValue             decimal.Decimal `json:"max_value"`
+	LimitPrice           decimal.Decimal `json:"limit_price"`
+	StopLossPrice        decimal.Decimal `json:"stop_price"`
+	TakeProfitPrice      decimal.Decimal `json:"tp_price"`
+	TakeProfitValue      decimal.Decimal `json:"tp_value"`
+	TakeProfitCollateral decimal.Decimal `json:"tp_collateral"`
+	CreatedAt            CustomTime      `json:"created_at"`
+	SignedAt             CustomTime      `json:"signed_at"`
+	StartedAt            CustomTime      `json:"started_at"`
+	ModifiedAt           CustomTime      `json:"modified_at"`
+	EndedAt              CustomTime      `json:"ended_at"`
+	TakeProfitAt         CustomTime      `json:"tp_at"`
+	ProfitAndLoss        decimal.Decimal `json:"pnl"`
+	OpenFee              decimal.Decimal `json:"open_fee"`
+	CloseFee             decimal.Decimal `json:"close_fee"`
+	FundingIndex         decimal.Decimal `json:"funding_index"`
+	FundingOwed          decimal.Decimal `json:"funding_owed"`
+	FundingPaid          decimal.Decimal `json:"funding_paid"`
+	BorrowIndex          decimal.Decimal `json:"borrow_index"`
+	TrailAmount          decimal.Decimal `json:"trail_amount"`  // zero when the stop does not trail
+	TrailPercent         decimal.Decimal `json:"trail_percent"` // zero when the stop does not trail
+	TrailExtreme         decimal.Decimal `json:"trail_extreme"`
+	ExpiresAt            CustomTime      `json:"expires_at"` // zero for good-till-canceled
+	EntryType            string          `json:"entry_type"`
+	TriggerPrice         decimal.Decimal `json:"trigger_price"` // stop limits only
+	TriggeredAt          CustomTime      `json:"triggered_at"`  // when a stop limit was armed
+	AlgoOrderId          string          `json:"algo_order_id"` // set on the slices of a twap or scale order
+	ClientOrderId        string          `json:"client_order_id"`
 }
 
 type StakeResponse struct {
-	ID        string  `json:"id"`
-	UserID    string  `json:"userid"`
-	StakeType string  `json:"stake_type"`
-	Amount    float64 `json:"amount"`
-	CreatedAt string  `json:"created_at"`
-}
-
-type StakesAndUserResponse struct {
-	Stakes []StakeResponse `json:"stakes"`
-	User   UserResponse    `json:"user"`
+	ID        string          `json:"id"`
+	UserID    string          `json:"userid"`
+	StakeType string          `json:"stake_type"`
+	Amount    decimal.Decimal `json:"amount"`
+	CreatedAt string          `json:"created_at"`
 }
 
 type OrderAndUserResponse struct {
@@ -71,26 +83,73 @@ type OrderAndUserResponse struct {
 	User  UserResponse  `json:"user"`
 }
 
+// OrderByClientIdResponse expiry_time is empty once an unsigned order has no signature request left to sign
+type OrderByClientIdResponse struct {
+	OrderAndUserResponse
+	ClientOrderHash string `json:"client_order_hash"`
+	ExpiryTime      string `json:"expiry_time"`
+}
+
 type WithdrawalAndUserResponse struct {
 	Withdrawal WithdrawalResponse `json:"pending_withdrawal"`
 	User       UserResponse       `json:"user"`
 }
 
 type DepositResponse struct {
-	ID            string  `json:"id"`
-	UserID        string  `json:"userid"`
-	WalletAddress string  `json:"wallet_address"`
-	WalletType    string  `json:"wallet_type"`
-	ChainID       string  `json:"chain_id"`
-	Block         string  `json:"block"`
-	BlockHash     string  `json:"block_hash"`
-	TxHash        string  `json:"tx_hash"`
-	Sender        string  `json:"sender"`
-	DepositNonce  string  `json:"deposit_nonce"`
-	Asset         string  `json:"asset"`
-	Amount        string  `json:"amount"`
-	Value         float64 `json:"value"`
-	CreatedAt     string  `json:"created_at"`
+	ID            string          `json:"id"`
+	UserID        string          `json:"userid"`
+	WalletAddress string          `json:"wallet_address"`
+	WalletType    string          `json:"wallet_type"`
+	ChainID       string          `json:"chain_id"`
+	Block         string          `json:"block"`
+	BlockHash     string          `json:"block_hash"`
+	TxHash        string          `json:"tx_hash"`
+	Sender        string          `json:"sender"`
+	DepositNonce  string          `json:"deposit_nonce"`
+	Asset         string          `json:"asset"`
+	Amount        string          `json:"amount"`
+	Value         decimal.Decimal `json:"value"`
+	CreatedAt     string          `json:"created_at"`
+}
+
+// OrderFilter narrows get_orders_page, empty fields match every order
+type OrderFilter struct {
+	Statuses  []string
+	OrderType string
+	Pair      string
+	Created   pagination.TimeRange
+	Ended     pagination.TimeRange
+}
+
+// pageCursorResponse is the last row of a page returned by the paged rpcs, empty on the last page
+type pageCursorResponse struct {
+	NextCursorCreatedAt string `json:"next_cursor_created_at"`
+	NextCursorId        string `json:"next_cursor_id"`
+}
+
+// the page responses count every row matching the filters in total, next_cursor is empty on the last page
+type OrderPageResponse struct {
+	Orders     []OrderResponse `json:"orders"`
+	Total      int64           `json:"total"`
+	NextCursor string          `json:"next_cursor"`
+}
+
+type DepositPageResponse struct {
+	Deposits   []DepositResponse `json:"deposits"`
+	Total      int64             `json:"total"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+type StakePageResponse struct {
+	Stakes     []StakeResponse `json:"stakes"`
+	Total      int64           `json:"total"`
+	NextCursor string          `json:"next_cursor"`
+}
+
+type WithdrawalPageResponse struct {
+	Withdrawals []WithdrawalResponse `json:"withdrawals"`
+	Total       int64                `json:"total"`
+	NextCursor  string               `json:"next_cursor"`
 }
 
 type SupabaseError struct {
@@ -105,6 +164,9 @@ type UnsignedCreateOrderResponse struct {
 	SignatureId   string        `json:"signature_id"`
 	SignatureHash string        `json:"signature_hash"`
 	ExpiryTime    string        `json:"expiry_time"`
+
+	// set instead of the fields above when the client order id was already used, nothing was created
+	Existing *OrderByClientIdResponse `json:"existing"`
 }
 
 type SignOrderResponse struct {
@@ -137,14 +199,258 @@ type SignedCloseOrderResponse struct {
 	ErrorMessage string        `json:"error_message"`
 }
 
+type OrderFillResponse struct {
+	ID            string          `json:"id"`
+	OrderID       string          `json:"orderid"`
+	UserID        string          `json:"userid"`
+	SignatureId   string          `json:"signature_id"`
+	Collateral    decimal.Decimal `json:"collateral"`
+	Size          decimal.Decimal `json:"size"`
+	ClosePrice    decimal.Decimal `json:"close_price"`
+	Payout        decimal.Decimal `json:"payout"`
+	CloseFee      decimal.Decimal `json:"close_fee"`
+	ProfitAndLoss decimal.Decimal `json:"pnl"`
+	Funding       decimal.Decimal `json:"funding"`
+	ExitLevelId   string          `json:"exit_level_id"`        // set when the fill is an exit level filled by the rebalancer
+	ReduceOnlyId  string          `json:"reduce_only_order_id"` // set when the fill is a reduce-only order filled by the rebalancer
+	CreatedAt     CustomTime      `json:"created_at"`
+}
+
+// OrderEventResponse is a step of the lifecycle of an order, from_status is empty for the create event
+type OrderEventResponse struct {
+	ID              string          `json:"id"`
+	OrderID         string          `json:"order_id"`
+	FromStatus      string          `json:"from_status"`
+	ToStatus        string          `json:"to_status"`
+	Action          string          `json:"action"` // one of the pkg/orderstate actions
+	Actor           string          `json:"actor"`  // "user", "rebalancer" or "admin"
+	Price           decimal.Decimal `json:"price"`  // zero for cancels, expiries and modifications
+	Fee             decimal.Decimal `json:"fee"`
+	CollateralDelta decimal.Decimal `json:"collateral_delta"`
+	Seq             int64           `json:"seq"` // write order, events of one transaction share created_at
+	CreatedAt       CustomTime      `json:"created_at"`
+}
+
+// OrderExitLevelResponse is a take profit or stop loss level of a ladder, filled once triggered_at is set
+type OrderExitLevelResponse struct {
+	ID          string          `json:"id"`
+	OrderID     string          `json:"orderid"`
+	Kind        string          `json:"kind"` // "tp" or "sl"
+	Price       decimal.Decimal `json:"price"`
+	Percent     decimal.Decimal `json:"percent"`
+	Collateral  decimal.Decimal `json:"collateral"`
+	FillId      string          `json:"fill_id"`
+	TriggeredAt CustomTime      `json:"triggered_at"`
+	CreatedAt   CustomTime      `json:"created_at"`
+}
+
+// ReduceOnlyOrderResponse closes close_percent of its parent position when the price crosses trigger_price
+type ReduceOnlyOrderResponse struct {
+	ID           string          `json:"id"`
+	ParentID     string          `json:"parent_id"`
+	UserID       string          `json:"userid"`
+	Kind         string          `json:"kind"` // "tp" or "sl"
+	TriggerPrice decimal.Decimal `json:"trigger_price"`
+	ClosePercent decimal.Decimal `json:"close_percent"`
+	OcoGroup     string          `json:"oco_group"`
+	IsBracket    bool            `json:"is_bracket"`
+	Status       string          `json:"status"` // "unsigned", "inactive", "open", "filled" or "canceled"
+	FillId       string          `json:"fill_id"`
+	CreatedAt    CustomTime      `json:"created_at"`
+	SignedAt     CustomTime      `json:"signed_at"`
+	TriggeredAt  CustomTime      `json:"triggered_at"`
+	EndedAt      CustomTime      `json:"ended_at"`
+}
+
+type UnsignedReduceOnlyOrderResponse struct {
+	ReduceOnlyOrder ReduceOnlyOrderResponse `json:"reduce_only_order"`
+	SignatureId     string                  `json:"signature_id"`
+	SignatureHash   string                  `json:"signature_hash"`
+	ExpiryTime      string                  `json:"expiry_time"`
+}
+
+type SignedReduceOnlyOrderResponse struct {
+	ReduceOnlyOrder ReduceOnlyOrderResponse `json:"reduce_only_order"`
+	IsValid         bool                    `json:"is_valid"`
+	ErrorMessage    string                  `json:"error_message"`
+}
+
+// AlgoOrderResponse is a twap or scale order, its slices are spawned by the rebalancer, twap slices as market entries
+type AlgoOrderResponse struct {
+	ID              string          `json:"id"`
+	UserID          string          `json:"userid"`
+	Kind            string          `json:"kind"` // "twap" or "scale"
+	OrderType       string          `json:"order_type"`
+	Pair            string          `json:"pair"`
+	PairId          string          `json:"pair_id"`
+	Leverage        decimal.Decimal `json:"leverage"`
+	Collateral      decimal.Decimal `json:"collateral"`
+	Slices          int64           `json:"slices"`
+	IntervalSeconds int64           `json:"interval_seconds"` // twap only
+	PriceFrom       decimal.Decimal `json:"price_from"`       // scale only
+	PriceTo         decimal.Decimal `json:"price_to"`         // scale only
+	LiqDistance     decimal.Decimal `json:"liq_distance"`
+	MaxDistance     decimal.Decimal `json:"max_distance"`
+	Status          string          `json:"status"` // "unsigned", "active", "completed" or "canceled"
+	CreatedAt       CustomTime      `json:"created_at"`
+	SignedAt        CustomTime      `json:"signed_at"`
+	EndedAt         CustomTime      `json:"ended_at"`
+}
+
+type AlgoOrderSliceResponse struct {
+	ID          string          `json:"id"`
+	AlgoOrderId string          `json:"algo_order_id"`
+	SliceIndex  int64           `json:"slice_index"`
+	Collateral  decimal.Decimal `json:"collateral"`
+	OpenFee     decimal.Decimal `json:"open_fee"`
+	LimitPrice  decimal.Decimal `json:"lim_price"` // zero for twap slices
+	Status      string          `json:"status"`    // "planned", "scheduled", "spawned" or "canceled"
+	ScheduledAt CustomTime      `json:"scheduled_at"`
+	SpawnedAt   CustomTime      `json:"spawned_at"`
+	OrderId     string          `json:"order_id"`
+}
+
+type UnsignedAlgoOrderResponse struct {
+	AlgoOrder     AlgoOrderResponse        `json:"algo_order"`
+	Slices        []AlgoOrderSliceResponse `json:"slices"`
+	SignatureId   string                   `json:"signature_id"`
+	SignatureHash string                   `json:"signature_hash"`
+	ExpiryTime    string                   `json:"expiry_time"`
+}
+
+type SignedAlgoOrderResponse struct {
+	AlgoOrder    AlgoOrderResponse `json:"algo_order"`
+	IsValid      bool              `json:"is_valid"`
+	ErrorMessage string            `json:"error_message"`
+}
+
+// AlgoOrderProgressResponse counts the spawned slices, a filled slice is one that opened whatever happened to it since
+type AlgoOrderProgressResponse struct {
+	SlicesSpawned     int64           `json:"slices_spawned"`
+	SlicesResting     int64           `json:"slices_resting"`
+	SlicesFilled      int64           `json:"slices_filled"`
+	FilledCollateral  decimal.Decimal `json:"filled_collateral"`
+	AverageEntryPrice decimal.Decimal `json:"average_entry_price"` // zero until a slice fills
+}
+
+type GetAlgoOrderResponse struct {
+	AlgoOrder AlgoOrderResponse         `json:"algo_order"`
+	Slices    []AlgoOrderSliceResponse  `json:"slices"`
+	Progress  AlgoOrderProgressResponse `json:"progress"`
+}
+
+// BatchOrder is one order of create_orders_batch with the create_order values, zero values are not set
+type BatchOrder struct {
+	Index                int
+	OrderType            string
+	Pair                 string
+	PairId               string
+	Leverage             decimal.Decimal
+	Collateral           decimal.Decimal
+	EntryPrice           decimal.Decimal
+	LiquidationPrice     decimal.Decimal
+	MaxPrice             decimal.Decimal
+	OpenFee              decimal.Decimal
+	LimitPrice           decimal.Decimal
+	StopLossPrice        decimal.Decimal
+	TakeProfitPrice      decimal.Decimal
+	TakeProfitValue      decimal.Decimal
+	TakeProfitCollateral decimal.Decimal
+	EntryType            string
+	TriggerPrice         decimal.Decimal
+	ExpiresAt            time.Time
+	ClientOrderId        string
+	ClientOrderHash      string
+}
+
+// OrderBatchResponse is a batch of orders created or canceled with one signature
+type OrderBatchResponse struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userid"`
+	Action    string     `json:"action"` // "create" or "cancel"
+	OrderIds  []string   `json:"order_ids"`
+	Status    string     `json:"status"` // "unsigned", "signed" or "rejected"
+	CreatedAt CustomTime `json:"created_at"`
+	SignedAt  CustomTime `json:"signed_at"`
+}
+
+// OrderBatchItemResponse is the outcome of one item of a batch, Error is set instead of Order when it failed
+// Index is the position of the item in a create batch, OrderId identifies it otherwise
+type OrderBatchItemResponse struct {
+	Index   *int           `json:"index,omitempty"`
+	OrderId string         `json:"order_id,omitempty"`
+	Order   *OrderResponse `json:"order,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// UnsignedOrderBatchResponse has no batch when every item failed
+type UnsignedOrderBatchResponse struct {
+	Batch         *OrderBatchResponse      `json:"batch"`
+	Results       []OrderBatchItemResponse `json:"results"`
+	SignatureId   string                   `json:"signature_id"`
+	SignatureHash string                   `json:"signature_hash"`
+	ExpiryTime    string                   `json:"expiry_time"`
+}
+
+type SignedOrderBatchResponse struct {
+	Batch        OrderBatchResponse       `json:"batch"`
+	Results      []OrderBatchItemResponse `json:"results"`
+	IsValid      bool                     `json:"is_valid"`
+	ErrorMessage string                   `json:"error_message"`
+}
+
+type SignedPartialCloseOrderResponse struct {
+	Order        OrderResponse     `json:"order"`
+	Fill         OrderFillResponse `json:"fill"`
+	IsValid      bool              `json:"is_valid"`
+	ErrorMessage string            `json:"error_message"`
+}
+
+type UnsignedModifyOrderResponse struct {
+	ModificationId string `json:"order_modification_id"`
+	SignatureId    string `json:"signature_id"`
+	SignatureHash  string `json:"signature_hash"`
+	ExpiryTime     string `json:"expiry_time"`
+}
+
+type SignedModifyOrderResponse struct {
+	Order        OrderResponse `json:"order"`
+	IsValid      bool          `json:"is_valid"`
+	ErrorMessage string        `json:"error_message"`
+}
+
+type OrderModificationResponse struct {
+	ID                   string          `json:"id"`
+	UserID               string          `json:"userid"`
+	OrderID              string          `json:"orderid"`
+	Leverage             decimal.Decimal `json:"leverage"`
+	Collateral           decimal.Decimal `json:"collateral"`
+	EntryPrice           decimal.Decimal `json:"entry_price"`
+	LiquidationPrice     decimal.Decimal `json:"liq_price"`
+	MaxPrice             decimal.Decimal `json:"max_price"`
+	MaxValue             decimal.Decimal `json:"max_value"`
+	LimitPrice           decimal.Decimal `json:"lim_price"`
+	StopLossPrice        decimal.Decimal `json:"stop_price"`
+	TakeProfitPrice      decimal.Decimal `json:"tp_price"`
+	TakeProfitValue      decimal.Decimal `json:"tp_value"`
+	TakeProfitCollateral decimal.Decimal `json:"tp_collateral"`
+	OpenFee              decimal.Decimal `json:"open_fee"`
+	CloseFee             decimal.Decimal `json:"close_fee"`
+	ProfitAndLoss        decimal.Decimal `json:"pnl"`
+	CreatedAt            CustomTime      `json:"created_at"`
+	PrevModifiedAt       CustomTime      `json:"prev_modified_at"`
+	SignedAt             CustomTime      `json:"signed_at"`
+	CanceledAt           CustomTime      `json:"canceled_at"`
+}
+
 type GetSignatureValidationHashResponse struct {
 	Hash string `json:"signature_hash"`
 }
 
 type GlobalStateResponse struct {
-	Key       string  `json:"key"`
-	Value     float64 `json:"value"`
-	UpdatedAt string  `json:"updated_at"`
+	Key       string          `json:"key"`
+	Value     decimal.Decimal `json:"value"`
+	UpdatedAt string          `json:"updated_at"`
 }
 
 type GetSignatureHashResponse struct {
@@ -165,35 +471,35 @@ type SignedWithdrawalResponse struct {
 }
 
 type WithdrawalResponse struct {
-	ID            string     `json:"id"`
-	UserID        string     `json:"userid"`
-	Amount        float64    `json:"amount"`
-	TokenType     string     `json:"token_type"`
-	Status        string     `json:"status"`
-	CreatedAt     CustomTime `json:"created_at"`
-	UpdatedAt     CustomTime `json:"updated_at"`
-	TxHash        string     `json:"tx_hash"`
-	WalletAddress string     `json:"wallet_address"`
+	ID            string          `json:"id"`
+	UserID        string          `json:"userid"`
+	Amount        decimal.Decimal `json:"amount"`
+	TokenType     string          `json:"token_type"`
+	Status        string          `json:"status"`
+	CreatedAt     CustomTime      `json:"created_at"`
+	UpdatedAt     CustomTime      `json:"updated_at"`
+	TxHash        string          `json:"tx_hash"`
+	WalletAddress string          `json:"wallet_address"`
 }
 
 type StakeDepositResponse struct {
-	ID        string     `json:"id"`
-	Userid    string     `json:"userid"`
-	StakeType string     `json:"stake_type"`
-	Amount    float64    `json:"amount"`
-	CreatedAt CustomTime `json:"created_at"`
+	ID        string          `json:"id"`
+	Userid    string          `json:"userid"`
+	StakeType string          `json:"stake_type"`
+	Amount    decimal.Decimal `json:"amount"`
+	CreatedAt CustomTime      `json:"created_at"`
 }
 
 type PendingWithdrawalResponse struct {
-	ID            string     `json:"id"`
-	Userid        string     `json:"userid"`
-	Amount        float64    `json:"amount"`
-	TokenType     string     `json:"token_type"`
-	Status        string     `json:"status"`
-	CreatedAt     CustomTime `json:"created_at"`
-	UpdatedAt     CustomTime `json:"updated_at"`
-	TxHash        string     `json:"tx_hash"`
-	WalletAddress string     `json:"wallet_address"`
+	ID            string          `json:"id"`
+	Userid        string          `json:"userid"`
+	Amount        decimal.Decimal `json:"amount"`
+	TokenType     string          `json:"token_type"`
+	Status        string          `json:"status"`
+	CreatedAt     CustomTime      `json:"created_at"`
+	UpdatedAt     CustomTime      `json:"updated_at"`
+	TxHash        string          `json:"tx_hash"`
+	WalletAddress string          `json:"wallet_address"`
 }
 
 type ProcessUnstakeResponse struct {
@@ -201,6 +507,14 @@ type ProcessUnstakeResponse struct {
 	PendingWithdrawal PendingWithdrawalResponse `json:"pending_withdrawal"`
 }
 
+// SignatureRequestResponse is the signature request of an unsigned rpc, the typed data expires at ExpiryTime
+type SignatureRequestResponse struct {
+	SignatureId    string `json:"signature_id"`
+	ReferenceTable string `json:"reference_table"`
+	ReferenceId    string `json:"reference_id"`
+	ExpiryTime     string `json:"expiry_time"`
+}
+
 type CustomTime struct {
 	time.Time
 }
@@ -229,3 +543,50 @@ func (ct *CustomTime) UnmarshalJSON(b []byte) error {
 
 	return fmt.Errorf("error parsing time: %v", err)
 }
+
+// PairRiskParamsResponse is a pair_risk_params row with the current open interest, a zero cap is uncapped
+type PairRiskParamsResponse struct {
+	PairId                   string          `json:"pair_id"`
+	Enabled                  bool            `json:"enabled"`
+	MaxLeverage              decimal.Decimal `json:"max_leverage"`
+	MinCollateral            decimal.Decimal `json:"min_collateral"`
+	MaxCollateral            decimal.Decimal `json:"max_collateral"`
+	MaxLongOpenInterest      decimal.Decimal `json:"max_long_open_interest"`
+	MaxShortOpenInterest     decimal.Decimal `json:"max_short_open_interest"`
+	LeverageFeeMultiplier    decimal.Decimal `json:"leverage_fee_multiplier"`
+	UtilizationFeeMultiplier decimal.Decimal `json:"utilization_fee_multiplier"`
+	MaxProfitMultiple        decimal.Decimal `json:"max_profit_multiple"`
+	LongOpenInterest         decimal.Decimal `json:"long_open_interest"`
+	ShortOpenInterest        decimal.Decimal `json:"short_open_interest"`
+	UpdatedAt                string          `json:"updated_at"`
+}
+
+// PairFundingResponse is a pair_funding row, rates are hourly and positive when longs pay shorts
+type PairFundingResponse struct {
+	PairId                 string          `json:"pair_id"`
+	MaxFundingRate         decimal.Decimal `json:"max_funding_rate"`
+	FundingRate            decimal.Decimal `json:"funding_rate"`
+	CumulativeFundingIndex decimal.Decimal `json:"cumulative_funding_index"`
+	LongOpenInterest       decimal.Decimal `json:"long_open_interest"`
+	ShortOpenInterest      decimal.Decimal `json:"short_open_interest"`
+	UpdatedAt              CustomTime      `json:"updated_at"`
+}
+
+// BorrowIndexResponse is the borrow_index row, the rate is hourly
+type BorrowIndexResponse struct {
+	BaseBorrowRate        decimal.Decimal `json:"base_borrow_rate"`
+	BorrowRate            decimal.Decimal `json:"borrow_rate"`
+	CumulativeBorrowIndex decimal.Decimal `json:"cumulative_borrow_index"`
+	UpdatedAt             CustomTime      `json:"updated_at"`
+}
+
+// FundingRateResponse is an hourly funding_rates snapshot
+type FundingRateResponse struct {
+	ID                     string          `json:"id"`
+	PairId                 string          `json:"pair_id"`
+	FundingRate            decimal.Decimal `json:"funding_rate"`
+	CumulativeFundingIndex decimal.Decimal `json:"cumulative_funding_index"`
+	LongOpenInterest       decimal.Decimal `json:"long_open_interest"`
+	ShortOpenInterest      decimal.Decimal `json:"short_open_interest"`
+	CreatedAt              CustomTime      `json:"created_at"`
+}
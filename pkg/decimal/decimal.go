@@ -0,0 +1,346 @@
+package decimal
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an arbitrary precision fixed point number, value * 10^exp
+// the zero value is 0, operations never mutate their receiver
+//
+// USD balances and order values are stored as NUMERIC(20, 6), round them with RoundUsd before they are persisted
+// so the api and postgres agree to the cent. pyth prices keep their exponent exactly, see NewFromPyth.
+
+const (
+	// UsdPlaces matches the NUMERIC(20, 6) columns
+	UsdPlaces int32 = 6
+
+	// MaxExponent bounds the e-notation exponent NewFromString accepts, request params are parsed with it
+	// and an exponent such as 1e-30000000 would make every rescale build a 10^30000000 integer
+	MaxExponent = 30
+)
+
+// DivisionPrecision is the number of decimal places kept by Div
+var DivisionPrecision int32 = 18
+
+type Decimal struct {
+	value *big.Int
+	exp   int32
+}
+
+var (
+	Zero = New(0, 0)
+	One  = New(1, 0)
+
+	ten = big.NewInt(10)
+)
+
+func New(value int64, exp int32) Decimal {
+	return Decimal{value: big.NewInt(value), exp: exp}
+}
+
+func NewFromInt(value int64) Decimal {
+	return New(value, 0)
+}
+
+func NewFromBigInt(value *big.Int, exp int32) Decimal {
+	return Decimal{value: new(big.Int).Set(value), exp: exp}
+}
+
+// NewFromPyth keeps the pyth price and exponent exactly, price is the integer string returned by hermes
+func NewFromPyth(price string, expo int32) (Decimal, error) {
+	value, ok := new(big.Int).SetString(price, 10)
+	if !ok {
+		return Zero, fmt.Errorf("invalid pyth price: %v", price)
+	}
+	return Decimal{value: value, exp: expo}, nil
+}
+
+// NewFromTokenAmount converts a raw token amount with its decimals, 1e18 with 18 decimals is 1
+func NewFromTokenAmount(amount *big.Int, decimals int32) Decimal {
+	return NewFromBigInt(amount, -decimals)
+}
+
+// NewFromString parses decimal strings such as "12", "-0.015" or "1.5e-3", the exponent is at most MaxExponent either way
+func NewFromString(value string) (Decimal, error) {
+	original := value
+	var exp int64
+
+	if i := strings.IndexAny(value, "eE"); i != -1 {
+		parsed, err := strconv.ParseInt(value[i+1:], 10, 32)
+		if err != nil {
+			return Zero, fmt.Errorf("invalid decimal exponent: %v", original)
+		}
+		if parsed < -MaxExponent || parsed > MaxExponent {
+			return Zero, fmt.Errorf("decimal exponent out of range: %v", original)
+		}
+		exp = parsed
+		value = value[:i]
+	}
+
+	if i := strings.IndexByte(value, '.'); i != -1 {
+		fraction := value[i+1:]
+		if strings.ContainsAny(fraction, "+-") {
+			return Zero, fmt.Errorf("invalid decimal value: %v", original)
+		}
+		exp -= int64(len(fraction))
+		value = value[:i] + fraction
+	}
+
+	if value == "" || value == "-" || value == "+" {
+		return Zero, fmt.Errorf("invalid decimal value: %v", original)
+	}
+	coefficient, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return Zero, fmt.Errorf("invalid decimal value: %v", original)
+	}
+	if exp < -1<<31 || exp > 1<<31-1 {
+		return Zero, fmt.Errorf("decimal exponent out of range: %v", original)
+	}
+	return Decimal{value: coefficient, exp: int32(exp)}, nil
+}
+
+// RequireFromString is NewFromString for constants, it panics on invalid input
+func RequireFromString(value string) Decimal {
+	d, err := NewFromString(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewFromFloat uses the shortest representation that round trips, only use it for rates derived from float math
+// it is printed without an exponent so no float is out of the NewFromString range
+func NewFromFloat(value float64) Decimal {
+	return RequireFromString(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (d Decimal) coefficient() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// rescale returns the coefficient at a lower exponent, exp must be <= d.exp
+func (d Decimal) rescale(exp int32) *big.Int {
+	value := new(big.Int).Set(d.coefficient())
+	if exp < d.exp {
+		value.Mul(value, pow10(d.exp-exp))
+	}
+	return value
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
+
+func minExp(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (d Decimal) Add(d2 Decimal) Decimal {
+	exp := minExp(d.exp, d2.exp)
+	return Decimal{value: new(big.Int).Add(d.rescale(exp), d2.rescale(exp)), exp: exp}
+}
+
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	exp := minExp(d.exp, d2.exp)
+	return Decimal{value: new(big.Int).Sub(d.rescale(exp), d2.rescale(exp)), exp: exp}
+}
+
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	return Decimal{value: new(big.Int).Mul(d.coefficient(), d2.coefficient()), exp: d.exp + d2.exp}
+}
+
+// Div rounds half away from zero at DivisionPrecision places, it panics on division by zero
+func (d Decimal) Div(d2 Decimal) Decimal {
+	return d.DivRound(d2, DivisionPrecision)
+}
+
+func (d Decimal) DivRound(d2 Decimal, places int32) Decimal {
+	if d2.IsZero() {
+		panic("decimal division by zero")
+	}
+
+	numerator := new(big.Int).Set(d.coefficient())
+	denominator := new(big.Int).Set(d2.coefficient())
+
+	// d / d2 * 10^places = (v1 / v2) * 10^(e1 - e2 + places)
+	shift := d.exp - d2.exp + places
+	if shift >= 0 {
+		numerator.Mul(numerator, pow10(shift))
+	} else {
+		denominator.Mul(denominator, pow10(-shift))
+	}
+	return Decimal{value: quoRoundHalfAway(numerator, denominator), exp: -places}
+}
+
+// quoRoundHalfAway matches the postgres NUMERIC rounding
+func quoRoundHalfAway(numerator, denominator *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	twice := new(big.Int).Abs(remainder)
+	twice.Lsh(twice, 1)
+	if twice.Cmp(new(big.Int).Abs(denominator)) >= 0 {
+		if numerator.Sign() == denominator.Sign() {
+			quotient.Add(quotient, big.NewInt(1))
+		} else {
+			quotient.Sub(quotient, big.NewInt(1))
+		}
+	}
+	return quotient
+}
+
+// Round rounds half away from zero to the given number of decimal places
+func (d Decimal) Round(places int32) Decimal {
+	if d.exp >= -places {
+		return Decimal{value: new(big.Int).Set(d.coefficient()), exp: d.exp}
+	}
+	return Decimal{value: quoRoundHalfAway(d.coefficient(), pow10(-places-d.exp)), exp: -places}
+}
+
+// RoundUsd rounds to the NUMERIC(20, 6) precision balances are stored at
+func (d Decimal) RoundUsd() Decimal {
+	return d.Round(UsdPlaces)
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.coefficient()), exp: d.exp}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(d.coefficient()), exp: d.exp}
+}
+
+func (d Decimal) Sign() int {
+	return d.coefficient().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+func (d Decimal) IsPositive() bool {
+	return d.Sign() > 0
+}
+
+func (d Decimal) IsNegative() bool {
+	return d.Sign() < 0
+}
+
+func (d Decimal) Cmp(d2 Decimal) int {
+	exp := minExp(d.exp, d2.exp)
+	return d.rescale(exp).Cmp(d2.rescale(exp))
+}
+
+func (d Decimal) Equal(d2 Decimal) bool {
+	return d.Cmp(d2) == 0
+}
+
+func (d Decimal) LessThan(d2 Decimal) bool {
+	return d.Cmp(d2) < 0
+}
+
+func (d Decimal) LessThanOrEqual(d2 Decimal) bool {
+	return d.Cmp(d2) <= 0
+}
+
+func (d Decimal) GreaterThan(d2 Decimal) bool {
+	return d.Cmp(d2) > 0
+}
+
+func (d Decimal) GreaterThanOrEqual(d2 Decimal) bool {
+	return d.Cmp(d2) >= 0
+}
+
+func Max(first Decimal, rest ...Decimal) Decimal {
+	max := first
+	for _, d := range rest {
+		if d.GreaterThan(max) {
+			max = d
+		}
+	}
+	return max
+}
+
+func Min(first Decimal, rest ...Decimal) Decimal {
+	min := first
+	for _, d := range rest {
+		if d.LessThan(min) {
+			min = d
+		}
+	}
+	return min
+}
+
+// Float64 is lossy, only use it for logging and float only math such as math.Log
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String is the canonical form without trailing zeros, "1.500000" and "1.5" both print "1.5"
+func (d Decimal) String() string {
+	s := d.string()
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// StringFixed prints exactly places decimal places, rounding half away from zero
+func (d Decimal) StringFixed(places int32) string {
+	rounded := d.Round(places)
+	if rounded.exp > -places {
+		rounded = Decimal{value: rounded.rescale(-places), exp: -places}
+	}
+	return rounded.string()
+}
+
+func (d Decimal) string() string {
+	value := d.coefficient()
+	if d.exp >= 0 {
+		return new(big.Int).Mul(value, pow10(d.exp)).String()
+	}
+
+	digits := new(big.Int).Abs(value).String()
+	places := int(-d.exp)
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	s := digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+	if value.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalJSON writes a json number so rpc params reach postgres without a float conversion
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts numbers, quoted numbers and null
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	str := strings.Trim(string(b), `"`)
+	if str == "null" || str == "" {
+		*d = Zero
+		return nil
+	}
+
+	parsed, err := NewFromString(str)
+	if err != nil {
+		return fmt.Errorf("error parsing decimal: %v", err)
+	}
+	*d = parsed
+	return nil
+}
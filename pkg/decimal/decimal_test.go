@@ -0,0 +1,170 @@
+package decimal
+
+import (
+	"testing"
+)
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		places  int32
+		rounded string
+	}{
+		{name: "below half rounds down", value: "1.2344", places: 3, rounded: "1.234"},
+		{name: "half rounds away from zero", value: "1.2345", places: 3, rounded: "1.235"},
+		{name: "negative half rounds away from zero", value: "-1.2345", places: 3, rounded: "-1.235"},
+		{name: "negative below half", value: "-1.2344", places: 3, rounded: "-1.234"},
+		{name: "fewer places kept", value: "1.5", places: 3, rounded: "1.5"},
+		{name: "integer", value: "42", places: 2, rounded: "42"},
+		{name: "to units", value: "2.5", places: 0, rounded: "3"},
+		{name: "carry", value: "9.9999995", places: 6, rounded: "10"},
+		{name: "negative places", value: "1250", places: -2, rounded: "1300"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rounded := RequireFromString(test.value).Round(test.places)
+			if !rounded.Equal(RequireFromString(test.rounded)) {
+				t.Fatalf("expected %v, found %v", test.rounded, rounded)
+			}
+		})
+	}
+}
+
+func TestRoundUsd(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		rounded string
+	}{
+		{name: "stored precision kept", value: "100.123456", rounded: "100.123456"},
+		{name: "seventh place below half", value: "100.1234564", rounded: "100.123456"},
+		{name: "seventh place half", value: "100.1234565", rounded: "100.123457"},
+		{name: "negative pnl", value: "-0.0000005", rounded: "-0.000001"},
+		{name: "dust", value: "0.0000004", rounded: "0"},
+		{name: "pyth price", value: "6543210987654e-8", rounded: "65432.109877"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rounded := RequireFromString(test.value).RoundUsd()
+			if !rounded.Equal(RequireFromString(test.rounded)) {
+				t.Fatalf("expected %v, found %v", test.rounded, rounded)
+			}
+		})
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		divisor  string
+		places   int32
+		quotient string
+	}{
+		{name: "exact", value: "10", divisor: "4", places: 2, quotient: "2.5"},
+		{name: "repeating", value: "10", divisor: "3", places: 6, quotient: "3.333333"},
+		{name: "half rounds away from zero", value: "1", divisor: "8", places: 2, quotient: "0.13"},
+		{name: "negative half rounds away from zero", value: "-1", divisor: "8", places: 2, quotient: "-0.13"},
+		{name: "negative divisor", value: "2", divisor: "-3", places: 4, quotient: "-0.6667"},
+		{name: "both negative", value: "-2", divisor: "-3", places: 4, quotient: "0.6667"},
+		{name: "fractional divisor", value: "1", divisor: "0.003", places: 2, quotient: "333.33"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quotient := RequireFromString(test.value).DivRound(RequireFromString(test.divisor), test.places)
+			if !quotient.Equal(RequireFromString(test.quotient)) {
+				t.Fatalf("expected %v, found %v", test.quotient, quotient)
+			}
+		})
+	}
+}
+
+func TestStringFixed(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		places int32
+		fixed  string
+	}{
+		{name: "padded", value: "1.5", places: 6, fixed: "1.500000"},
+		{name: "rounded", value: "1.2345675", places: 6, fixed: "1.234568"},
+		{name: "integer", value: "7", places: 2, fixed: "7.00"},
+		{name: "negative below one", value: "-0.05", places: 3, fixed: "-0.050"},
+		{name: "no places", value: "2.5", places: 0, fixed: "3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixed := RequireFromString(test.value).StringFixed(test.places)
+			if fixed != test.fixed {
+				t.Fatalf("expected %v, found %v", test.fixed, fixed)
+			}
+		})
+	}
+}
+
+func TestNewFromString(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		err   bool
+	}{
+		{name: "integer", value: "12", want: "12"},
+		{name: "fraction", value: "-0.015", want: "-0.015"},
+		{name: "negative exponent", value: "1.5e-3", want: "0.0015"},
+		{name: "positive exponent", value: "2E6", want: "2000000"},
+		{name: "largest exponent", value: "1e30", want: "1000000000000000000000000000000"},
+		{name: "smallest exponent", value: "1e-30", want: "0.000000000000000000000000000001"},
+		{name: "exponent too small", value: "1e-31", err: true},
+		{name: "exponent too large", value: "1e31", err: true},
+		{name: "huge exponent", value: "1e-30000000", err: true},
+		{name: "exponent past int32", value: "1e9999999999", err: true},
+		{name: "empty", value: "", err: true},
+		{name: "sign only", value: "-", err: true},
+		{name: "not a number", value: "ten", err: true},
+		{name: "sign in the fraction", value: "1.-5", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := NewFromString(test.value)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, found %v", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !value.Equal(RequireFromString(test.want)) {
+				t.Fatalf("expected %v, found %v", test.want, value)
+			}
+		})
+	}
+}
+
+func TestNewFromFloat(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 0.0001, want: "0.0001"},
+		{value: 1e-40, want: "0.0000000000000000000000000000000000000001"},
+		{value: 1.5e35, want: "150000000000000000000000000000000000"},
+		{value: -2.25, want: "-2.25"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if value := NewFromFloat(test.value); !value.Equal(RequireFromString(test.want)) {
+				t.Fatalf("expected %v, found %v", test.want, value)
+			}
+		})
+	}
+}
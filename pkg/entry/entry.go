@@ -0,0 +1,132 @@
+package entry
+
+import (
+	"fmt"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+)
+
+// entry orders rest in status limit until the price reaches them (db/orders/entry_orders.sql)
+// liquidation and max profit are quoted from the limit price when the entry is created
+// a limit fills at its limit price, stop, mit and stop limit entries at the mark price that fills them,
+// their liquidation and max profit prices move with the fill, see Reprice
+// the api validates the prices against the mark price, the rebalancer arms and fills them on every streamed price
+
+const (
+	Market          = "market"
+	Limit           = "limit"
+	Stop            = "stop"       // breakout, fills at the mark price once the price goes through the limit price
+	MarketIfTouched = "mit"        // turns into a market order once the price comes back to the limit price
+	StopLimit       = "stop_limit" // arms at the trigger price, then fills at the mark price up to the limit price
+)
+
+// Parse reads the entry-type param, without one an order with a limit price is a limit and any other order a market order
+func Parse(value string, hasLimitPrice bool) (string, error) {
+	switch value {
+	case "":
+		if hasLimitPrice {
+			return Limit, nil
+		}
+		return Market, nil
+	case Market, Limit, Stop, MarketIfTouched:
+		return value, nil
+	case StopLimit, "stop-limit":
+		return StopLimit, nil
+	}
+	return "", fmt.Errorf("invalid entry type: expected market, limit, stop, mit or stop-limit, found %v", value)
+}
+
+// Validate checks a resting entry against the mark price, an entry that would fill on the next price is rejected
+// triggerPrice is only set for stop limits, their limit price is the worst acceptable price once armed
+func Validate(entryType, positionType string, limitPrice, triggerPrice, markPrice decimal.Decimal) error {
+	long := positionType == "long"
+	if positionType != "long" && positionType != "short" {
+		return fmt.Errorf("invalid order type: %v", positionType)
+	}
+	if entryType != Market && !limitPrice.IsPositive() {
+		return fmt.Errorf("%v entry requires a positive price", entryType)
+	}
+
+	switch entryType {
+	case Market:
+		if !limitPrice.IsZero() {
+			return fmt.Errorf("market orders have no limit price")
+		}
+	case Limit:
+		if long && !limitPrice.LessThan(markPrice) || !long && !limitPrice.GreaterThan(markPrice) {
+			return fmt.Errorf("%v limit price %v must be on the far side of the mark price %v, use a stop entry for a breakout", positionType, limitPrice, markPrice)
+		}
+	case MarketIfTouched:
+		// the touch price, the fill itself can be worse
+		if long && !limitPrice.LessThan(markPrice) || !long && !limitPrice.GreaterThan(markPrice) {
+			return fmt.Errorf("%v mit trigger %v must be on the far side of the mark price %v, use a stop entry for a breakout", positionType, limitPrice, markPrice)
+		}
+	case Stop:
+		if long && !limitPrice.GreaterThan(markPrice) || !long && !limitPrice.LessThan(markPrice) {
+			return fmt.Errorf("%v stop price %v must be beyond the mark price %v, use a limit entry to buy the dip", positionType, limitPrice, markPrice)
+		}
+	case StopLimit:
+		if long && !triggerPrice.GreaterThan(markPrice) || !long && !triggerPrice.LessThan(markPrice) {
+			return fmt.Errorf("%v stop limit trigger %v must be beyond the mark price %v", positionType, triggerPrice, markPrice)
+		}
+		if long && limitPrice.LessThan(triggerPrice) || !long && limitPrice.GreaterThan(triggerPrice) {
+			return fmt.Errorf("%v stop limit price %v cannot be better than its trigger %v", positionType, limitPrice, triggerPrice)
+		}
+	default:
+		return fmt.Errorf("invalid entry type: %v", entryType)
+	}
+	return nil
+}
+
+// Arms reports whether price arms a stop limit, at or over the trigger for longs and at or under it for shorts
+func Arms(positionType string, triggerPrice, price decimal.Decimal) bool {
+	if positionType == "short" {
+		return price.LessThanOrEqual(triggerPrice)
+	}
+	return price.GreaterThanOrEqual(triggerPrice)
+}
+
+// Fills reports whether a resting entry fills at price, a stop limit has to be armed first
+func Fills(entryType, positionType string, limitPrice, price decimal.Decimal) bool {
+	switch entryType {
+	case Market:
+		// a market entry rests only until the next batch, the twap slices of an algo order
+		return true
+	case Limit, StopLimit:
+		// at the limit price or better
+		if positionType == "short" {
+			return price.GreaterThanOrEqual(limitPrice)
+		}
+		return price.LessThanOrEqual(limitPrice)
+	case MarketIfTouched:
+		// touched, the order goes to market
+		if positionType == "short" {
+			return price.GreaterThanOrEqual(limitPrice)
+		}
+		return price.LessThanOrEqual(limitPrice)
+	case Stop:
+		if positionType == "short" {
+			return price.LessThanOrEqual(limitPrice)
+		}
+		return price.GreaterThanOrEqual(limitPrice)
+	}
+	return false
+}
+
+// FillPrice is the entry price of an entry filled by markPrice, only a limit fills at its limit price
+// Fills already bounds a stop limit by its limit price
+func FillPrice(entryType string, limitPrice, markPrice decimal.Decimal) decimal.Decimal {
+	if entryType == Limit {
+		return limitPrice
+	}
+	return markPrice.RoundUsd()
+}
+
+// Reprice moves a price quoted against quotedPrice to the same relative distance from fillPrice,
+// the liquidation and max profit prices of an entry that fills away from its quote
+func Reprice(price, quotedPrice, fillPrice decimal.Decimal) decimal.Decimal {
+	if !quotedPrice.IsPositive() || quotedPrice.Equal(fillPrice) {
+		return price
+	}
+	return price.Mul(fillPrice).Div(quotedPrice).RoundUsd()
+}
@@ -0,0 +1,243 @@
+package entry
+
+import (
+	"testing"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		hasLimitPrice bool
+		entryType     string
+		err           bool
+	}{
+		{name: "market by default", value: "", entryType: Market},
+		{name: "limit by default with a price", value: "", hasLimitPrice: true, entryType: Limit},
+		{name: "stop", value: "stop", entryType: Stop},
+		{name: "mit", value: "mit", entryType: MarketIfTouched},
+		{name: "stop limit", value: "stop_limit", entryType: StopLimit},
+		{name: "stop limit with a dash", value: "stop-limit", entryType: StopLimit},
+		{name: "unknown", value: "iceberg", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entryType, err := Parse(test.value, test.hasLimitPrice)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, found %v", entryType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if entryType != test.entryType {
+				t.Fatalf("expected %v, found %v", test.entryType, entryType)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		entryType    string
+		positionType string
+		limitPrice   string
+		triggerPrice string
+		err          bool
+	}{
+		{name: "long market", entryType: Market, positionType: "long", limitPrice: "0"},
+		{name: "market with a price", entryType: Market, positionType: "long", limitPrice: "90", err: true},
+		{name: "long limit under the mark", entryType: Limit, positionType: "long", limitPrice: "90"},
+		{name: "long limit over the mark", entryType: Limit, positionType: "long", limitPrice: "110", err: true},
+		{name: "short limit over the mark", entryType: Limit, positionType: "short", limitPrice: "110"},
+		{name: "short limit under the mark", entryType: Limit, positionType: "short", limitPrice: "90", err: true},
+		{name: "limit at the mark", entryType: Limit, positionType: "long", limitPrice: "100", err: true},
+		{name: "limit without a price", entryType: Limit, positionType: "long", limitPrice: "0", err: true},
+		{name: "long mit under the mark", entryType: MarketIfTouched, positionType: "long", limitPrice: "90"},
+		{name: "long mit over the mark", entryType: MarketIfTouched, positionType: "long", limitPrice: "110", err: true},
+		{name: "short mit over the mark", entryType: MarketIfTouched, positionType: "short", limitPrice: "110"},
+		{name: "short mit under the mark", entryType: MarketIfTouched, positionType: "short", limitPrice: "90", err: true},
+		{name: "long stop over the mark", entryType: Stop, positionType: "long", limitPrice: "110"},
+		{name: "long stop under the mark", entryType: Stop, positionType: "long", limitPrice: "90", err: true},
+		{name: "short stop under the mark", entryType: Stop, positionType: "short", limitPrice: "90"},
+		{name: "short stop over the mark", entryType: Stop, positionType: "short", limitPrice: "110", err: true},
+		{name: "long stop limit", entryType: StopLimit, positionType: "long", limitPrice: "112", triggerPrice: "110"},
+		{name: "long stop limit at its trigger", entryType: StopLimit, positionType: "long", limitPrice: "110", triggerPrice: "110"},
+		{name: "long stop limit trigger under the mark", entryType: StopLimit, positionType: "long", limitPrice: "112", triggerPrice: "90", err: true},
+		{name: "long stop limit better than its trigger", entryType: StopLimit, positionType: "long", limitPrice: "108", triggerPrice: "110", err: true},
+		{name: "short stop limit", entryType: StopLimit, positionType: "short", limitPrice: "88", triggerPrice: "90"},
+		{name: "short stop limit trigger over the mark", entryType: StopLimit, positionType: "short", limitPrice: "88", triggerPrice: "110", err: true},
+		{name: "short stop limit better than its trigger", entryType: StopLimit, positionType: "short", limitPrice: "92", triggerPrice: "90", err: true},
+		{name: "unknown position type", entryType: Limit, positionType: "spot", limitPrice: "90", err: true},
+		{name: "unknown entry type", entryType: "iceberg", positionType: "long", limitPrice: "90", err: true},
+	}
+
+	markPrice := decimal.NewFromInt(100)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			triggerPrice := decimal.Zero
+			if test.triggerPrice != "" {
+				triggerPrice = decimal.RequireFromString(test.triggerPrice)
+			}
+			err := Validate(test.entryType, test.positionType, decimal.RequireFromString(test.limitPrice), triggerPrice, markPrice)
+			if test.err && err == nil {
+				t.Fatalf("expected an error, found none")
+			}
+			if !test.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFills(t *testing.T) {
+	tests := []struct {
+		name         string
+		entryType    string
+		positionType string
+		limitPrice   string
+		price        string
+		fills        bool
+	}{
+		{name: "market", entryType: Market, positionType: "long", limitPrice: "0", price: "100", fills: true},
+		{name: "long limit at its price", entryType: Limit, positionType: "long", limitPrice: "90", price: "90", fills: true},
+		{name: "long limit under its price", entryType: Limit, positionType: "long", limitPrice: "90", price: "85", fills: true},
+		{name: "long limit over its price", entryType: Limit, positionType: "long", limitPrice: "90", price: "95", fills: false},
+		{name: "short limit over its price", entryType: Limit, positionType: "short", limitPrice: "110", price: "115", fills: true},
+		{name: "short limit under its price", entryType: Limit, positionType: "short", limitPrice: "110", price: "105", fills: false},
+		{name: "long mit touched", entryType: MarketIfTouched, positionType: "long", limitPrice: "90", price: "89", fills: true},
+		{name: "long mit not touched", entryType: MarketIfTouched, positionType: "long", limitPrice: "90", price: "91", fills: false},
+		{name: "short mit touched", entryType: MarketIfTouched, positionType: "short", limitPrice: "110", price: "110", fills: true},
+		{name: "short mit not touched", entryType: MarketIfTouched, positionType: "short", limitPrice: "110", price: "109", fills: false},
+		{name: "long stop broken", entryType: Stop, positionType: "long", limitPrice: "110", price: "111", fills: true},
+		{name: "long stop not broken", entryType: Stop, positionType: "long", limitPrice: "110", price: "109", fills: false},
+		{name: "short stop broken", entryType: Stop, positionType: "short", limitPrice: "90", price: "90", fills: true},
+		{name: "short stop not broken", entryType: Stop, positionType: "short", limitPrice: "90", price: "91", fills: false},
+		{name: "unknown entry type", entryType: "iceberg", positionType: "long", limitPrice: "90", price: "80", fills: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fills := Fills(test.entryType, test.positionType, decimal.RequireFromString(test.limitPrice), decimal.RequireFromString(test.price))
+			if fills != test.fills {
+				t.Fatalf("expected %v, found %v", test.fills, fills)
+			}
+		})
+	}
+}
+
+// a stop limit arms at its trigger and then fills at any price up to its limit, the rebalancer checks
+// Arms first and Fills on the prices after it armed
+func TestStopLimitSequence(t *testing.T) {
+	tests := []struct {
+		name         string
+		positionType string
+		triggerPrice string
+		limitPrice   string
+		prices       []string
+		arms         []bool
+		fills        []bool
+	}{
+		{
+			name: "long arms then fills under its limit", positionType: "long", triggerPrice: "110", limitPrice: "112",
+			prices: []string{"105", "110", "111.5"},
+			arms:   []bool{false, true, true},
+			fills:  []bool{false, true, true},
+		},
+		{
+			name: "long gaps past its limit and waits", positionType: "long", triggerPrice: "110", limitPrice: "112",
+			prices: []string{"115", "113", "112"},
+			arms:   []bool{true, true, true},
+			fills:  []bool{false, false, true},
+		},
+		{
+			name: "short arms then fills over its limit", positionType: "short", triggerPrice: "90", limitPrice: "88",
+			prices: []string{"95", "90", "88.5"},
+			arms:   []bool{false, true, true},
+			fills:  []bool{false, true, true},
+		},
+		{
+			name: "short gaps past its limit and waits", positionType: "short", triggerPrice: "90", limitPrice: "88",
+			prices: []string{"85", "87", "88"},
+			arms:   []bool{true, true, true},
+			fills:  []bool{false, false, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			triggerPrice := decimal.RequireFromString(test.triggerPrice)
+			limitPrice := decimal.RequireFromString(test.limitPrice)
+			armed := false
+			for i, value := range test.prices {
+				price := decimal.RequireFromString(value)
+				if arms := Arms(test.positionType, triggerPrice, price); arms != test.arms[i] {
+					t.Fatalf("price %v: expected arms %v, found %v", value, test.arms[i], arms)
+				}
+				armed = armed || test.arms[i]
+				fills := armed && Fills(StopLimit, test.positionType, limitPrice, price)
+				if fills != test.fills[i] {
+					t.Fatalf("price %v: expected fills %v, found %v", value, test.fills[i], fills)
+				}
+			}
+		})
+	}
+}
+
+func TestFillPrice(t *testing.T) {
+	tests := []struct {
+		name       string
+		entryType  string
+		limitPrice string
+		markPrice  string
+		fillPrice  string
+	}{
+		{name: "limit fills at its price", entryType: Limit, limitPrice: "90", markPrice: "88.5", fillPrice: "90"},
+		{name: "stop gaps over its trigger", entryType: Stop, limitPrice: "110", markPrice: "114.25", fillPrice: "114.25"},
+		{name: "mit fills at the mark", entryType: MarketIfTouched, limitPrice: "90", markPrice: "89.75", fillPrice: "89.75"},
+		{name: "stop limit fills better than its limit", entryType: StopLimit, limitPrice: "112", markPrice: "110.5", fillPrice: "110.5"},
+		{name: "market at the rounded mark", entryType: Market, limitPrice: "0", markPrice: "100.1234567", fillPrice: "100.123457"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fillPrice := FillPrice(test.entryType, decimal.RequireFromString(test.limitPrice), decimal.RequireFromString(test.markPrice))
+			if !fillPrice.Equal(decimal.RequireFromString(test.fillPrice)) {
+				t.Fatalf("expected %v, found %v", test.fillPrice, fillPrice)
+			}
+		})
+	}
+}
+
+func TestReprice(t *testing.T) {
+	tests := []struct {
+		name        string
+		price       string
+		quotedPrice string
+		fillPrice   string
+		repriced    string
+	}{
+		{name: "long stop gap moves the liquidation up", price: "99", quotedPrice: "110", fillPrice: "120", repriced: "108"},
+		{name: "long stop gap moves the max profit up", price: "165", quotedPrice: "110", fillPrice: "120", repriced: "180"},
+		{name: "short stop gap moves the liquidation down", price: "99", quotedPrice: "90", fillPrice: "80", repriced: "88"},
+		{name: "fill better than the stop limit", price: "100.8", quotedPrice: "112", fillPrice: "110", repriced: "99"},
+		{name: "fill at the quote", price: "99", quotedPrice: "110", fillPrice: "110", repriced: "99"},
+		{name: "no quote", price: "99", quotedPrice: "0", fillPrice: "110", repriced: "99"},
+		{name: "rounded to usd precision", price: "100", quotedPrice: "3", fillPrice: "1", repriced: "33.333333"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repriced := Reprice(decimal.RequireFromString(test.price), decimal.RequireFromString(test.quotedPrice), decimal.RequireFromString(test.fillPrice))
+			if !repriced.Equal(decimal.RequireFromString(test.repriced)) {
+				t.Fatalf("expected %v, found %v", test.repriced, repriced)
+			}
+		})
+	}
+}
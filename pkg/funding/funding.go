@@ -0,0 +1,24 @@
+package funding
+
+import "github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+
+// funding between longs and shorts, the pair index and the per order snapshot are kept by db/pairs/funding.sql
+// the api and the rebalancer settle the accrued funding from the payout when a position, or part of it, closes
+
+// Accrued is the funding a position owes at index, negative when it is owed funding
+// size is the live size (open collateral * leverage), owed is the funding rolled over by earlier size changes
+func Accrued(positionType string, size, entryIndex, index, owed decimal.Decimal) decimal.Decimal {
+	accrued := size.Mul(index.Sub(entryIndex))
+	if positionType == "short" {
+		accrued = accrued.Neg()
+	}
+	return owed.Add(accrued)
+}
+
+// Share is the funding settled when closedCollateral out of liveCollateral closes
+func Share(accrued, closedCollateral, liveCollateral decimal.Decimal) decimal.Decimal {
+	if !liveCollateral.IsPositive() {
+		return decimal.Zero
+	}
+	return accrued.Mul(closedCollateral).Div(liveCollateral).RoundUsd()
+}
@@ -0,0 +1,68 @@
+package funding
+
+import (
+	"testing"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+)
+
+func TestAccrued(t *testing.T) {
+	tests := []struct {
+		name         string
+		positionType string
+		size         string
+		entryIndex   string
+		index        string
+		owed         string
+		accrued      string
+	}{
+		{name: "long pays a rising index", positionType: "long", size: "1000", entryIndex: "0.001", index: "0.003", owed: "0", accrued: "2"},
+		{name: "short is paid a rising index", positionType: "short", size: "1000", entryIndex: "0.001", index: "0.003", owed: "0", accrued: "-2"},
+		{name: "long is paid a falling index", positionType: "long", size: "1000", entryIndex: "0.003", index: "0.001", owed: "0", accrued: "-2"},
+		{name: "rolled over funding is kept", positionType: "long", size: "500", entryIndex: "0.002", index: "0.004", owed: "1.5", accrued: "2.5"},
+		{name: "unchanged index", positionType: "short", size: "1000", entryIndex: "0.002", index: "0.002", owed: "-0.25", accrued: "-0.25"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accrued := Accrued(test.positionType,
+				decimal.RequireFromString(test.size),
+				decimal.RequireFromString(test.entryIndex),
+				decimal.RequireFromString(test.index),
+				decimal.RequireFromString(test.owed))
+			if !accrued.Equal(decimal.RequireFromString(test.accrued)) {
+				t.Fatalf("expected %v, found %v", test.accrued, accrued)
+			}
+		})
+	}
+}
+
+func TestShare(t *testing.T) {
+	tests := []struct {
+		name             string
+		accrued          string
+		closedCollateral string
+		liveCollateral   string
+		share            string
+	}{
+		{name: "full close", accrued: "12.5", closedCollateral: "100", liveCollateral: "100", share: "12.5"},
+		{name: "half close", accrued: "12.5", closedCollateral: "50", liveCollateral: "100", share: "6.25"},
+		{name: "funding owed to the position", accrued: "-9", closedCollateral: "25", liveCollateral: "100", share: "-2.25"},
+		{name: "rounded to usd precision", accrued: "10", closedCollateral: "1", liveCollateral: "3", share: "3.333333"},
+		{name: "no live collateral", accrued: "10", closedCollateral: "1", liveCollateral: "0", share: "0"},
+		{name: "negative live collateral", accrued: "10", closedCollateral: "1", liveCollateral: "-1", share: "0"},
+		{name: "nothing accrued", accrued: "0", closedCollateral: "40", liveCollateral: "100", share: "0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			share := Share(
+				decimal.RequireFromString(test.accrued),
+				decimal.RequireFromString(test.closedCollateral),
+				decimal.RequireFromString(test.liveCollateral))
+			if !share.Equal(decimal.RequireFromString(test.share)) {
+				t.Fatalf("expected %v, found %v", test.share, share)
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package hermes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/oracle"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// the binary data of a hermes response is a PNAU accumulator update:
+//
+//	"PNAU" | major u8 | minor u8 | trailing header size u8 | trailing header | update type u8 (0 = wormhole merkle)
+//	vaa size u16 | vaa | number of updates u8 | (message size u16 | message | number of proofs u8 | proof 20 bytes ...) ...
+//
+// the vaa is signed by the wormhole guardians and carries the merkle root of every price message published in the slot,
+// Verify only returns price messages whose merkle proof leads to a root with a guardian quorum, no network access is needed
+
+const (
+	accumulatorMagic   = "PNAU"
+	wormholeMerkleType = 0
+	priceFeedMessage   = 0
+
+	// pythnet accumulator emitter
+	pythnetChainId = 26
+)
+
+var (
+	wormholeMerkleMagic = []byte("AUWV")
+	pythnetEmitter      = common.HexToHash("e101faedac5851e32b9b23b5f9411a8c2bac4aae3ed4dd7b811dd1a72ea4aa71")
+)
+
+var (
+	ErrMalformedUpdate    = errors.New("malformed accumulator update")
+	ErrInvalidGuardianSet = errors.New("vaa guardian set mismatch")
+	ErrNoQuorum           = errors.New("vaa signatures below guardian quorum")
+	ErrInvalidSignature   = errors.New("invalid guardian signature")
+	ErrInvalidEmitter     = errors.New("vaa emitter is not the pythnet accumulator")
+	ErrInvalidProof       = errors.New("invalid merkle proof")
+)
+
+// GuardianSet is the wormhole guardian set the vaa signatures are checked against, keys are in guardian index order
+type GuardianSet struct {
+	Index uint32
+	Keys  []common.Address
+}
+
+// MainnetGuardianSet is the wormhole mainnet guardian set 4, used when no guardian set is configured
+var MainnetGuardianSet = &GuardianSet{
+	Index: 4,
+	Keys: []common.Address{
+		common.HexToAddress("0x5893B5A76c3f739645648885bDCcC06cd70a3Cd3"),
+		common.HexToAddress("0xfF6CB952589BDE862c25Ef4392132fb9D4A42157"),
+		common.HexToAddress("0x114De8460193bdf3A2fCf81f86a09765F4762fD1"),
+		common.HexToAddress("0x107A0086b32d7A0977926A205131d8731D39cbEB"),
+		common.HexToAddress("0x8C82B2fd82FaeD2711d59AF0F2499D16e726f6b2"),
+		common.HexToAddress("0x11b39756C042441BE6D8650b69b54EbE715E2343"),
+		common.HexToAddress("0x54Ce5B4D348fb74B958e8966e2ec3dBd4958a7cd"),
+		common.HexToAddress("0x15e7cAF07C4e3DC8e7C469f92C8Cd88FB8005a20"),
+		common.HexToAddress("0x74a3bf913953D695260D88BC1aA25A4eeE363ef0"),
+		common.HexToAddress("0x000aC0076727b35FBea2dAc28fEE5cCB0fEA768e"),
+		common.HexToAddress("0xAF45Ced136b9D9e24903464AE889F5C8a723FC14"),
+		common.HexToAddress("0xf93124b7c738843CBB89E864c862c38cddCccF95"),
+		common.HexToAddress("0xD2CC37A4dc036a8D232b48f62cDD4731412f4890"),
+		common.HexToAddress("0xDA798F6896A3331F64b48c12D1D57Fd9cbe70811"),
+		common.HexToAddress("0x71AA1BE1D36CaFE3867910F99C09e347899C19C3"),
+		common.HexToAddress("0x8192b6E7387CCd768277c17DAb1b7a5027c0b3Cf"),
+		common.HexToAddress("0x178e21ad2E77AE06711549CFBB1f9c7a9d8096e8"),
+		common.HexToAddress("0x5E1487F35515d02A92753504a8D75471b9f49EdB"),
+		common.HexToAddress("0x6FbEBc898F403E4773E95feB15E80C9A99c8348d"),
+	},
+}
+
+// GuardianSetFromEnv reads WORMHOLE_GUARDIAN_SET_INDEX and the comma separated WORMHOLE_GUARDIAN_KEYS
+// without WORMHOLE_GUARDIAN_KEYS it is the MainnetGuardianSet, prices are never used unverified
+func GuardianSetFromEnv() (*GuardianSet, error) {
+	keys := os.Getenv("WORMHOLE_GUARDIAN_KEYS")
+	if keys == "" {
+		return MainnetGuardianSet, nil
+	}
+
+	index, err := strconv.ParseUint(os.Getenv("WORMHOLE_GUARDIAN_SET_INDEX"), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WORMHOLE_GUARDIAN_SET_INDEX: %v", err)
+	}
+	return ParseGuardianSet(uint32(index), strings.Split(keys, ","))
+}
+
+func ParseGuardianSet(index uint32, keys []string) (*GuardianSet, error) {
+	guardians := &GuardianSet{Index: index}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if !common.IsHexAddress(key) {
+			return nil, fmt.Errorf("invalid guardian key: %v", key)
+		}
+		guardians.Keys = append(guardians.Keys, common.HexToAddress(key))
+	}
+	if len(guardians.Keys) == 0 {
+		return nil, fmt.Errorf("empty guardian set")
+	}
+	return guardians, nil
+}
+
+// Quorum is the number of signatures needed, more than two thirds of the guardians
+func (g *GuardianSet) Quorum() int {
+	return len(g.Keys)*2/3 + 1
+}
+
+type VaaSignature struct {
+	GuardianIndex uint8
+	Signature     [65]byte
+}
+
+type Vaa struct {
+	Version          uint8
+	GuardianSetIndex uint32
+	Signatures       []VaaSignature
+	Timestamp        uint32
+	Nonce            uint32
+	EmitterChain     uint16
+	EmitterAddress   common.Hash
+	Sequence         uint64
+	ConsistencyLevel uint8
+	Payload          []byte
+
+	body []byte
+}
+
+// MerkleUpdate is one price message of the accumulator update with its proof
+type MerkleUpdate struct {
+	Message []byte
+	Proof   [][20]byte
+}
+
+type AccumulatorUpdate struct {
+	MajorVersion uint8
+	MinorVersion uint8
+	Vaa          *Vaa
+	Slot         uint64
+	RingSize     uint32
+	Root         [20]byte
+	Updates      []MerkleUpdate
+}
+
+// PriceMessage is a proven pyth price, the same fields the parsed hermes response carries
+type PriceMessage struct {
+	FeedId          string
+	Price           int64
+	Conf            uint64
+	Expo            int32
+	PublishTime     int64
+	PrevPublishTime int64
+	EmaPrice        int64
+	EmaConf         uint64
+}
+
+// PriceUpdate converts the message for oracle.Validate
+func (m PriceMessage) PriceUpdate() oracle.PriceUpdate {
+	return oracle.PriceUpdate{
+		Id: m.FeedId,
+		Price: oracle.Price{
+			Conf:        strconv.FormatUint(m.Conf, 10),
+			Expo:        int(m.Expo),
+			Price:       strconv.FormatInt(m.Price, 10),
+			PublishTime: m.PublishTime,
+		},
+		EmaPrice: oracle.Price{
+			Conf:        strconv.FormatUint(m.EmaConf, 10),
+			Expo:        int(m.Expo),
+			Price:       strconv.FormatInt(m.EmaPrice, 10),
+			PublishTime: m.PublishTime,
+		},
+	}
+}
+
+// reader reads big endian fields, the first error sticks and later reads return zero values
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if n > len(r.data) {
+		r.err = fmt.Errorf("%w: need %d bytes, %d left", ErrMalformedUpdate, n, len(r.data))
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) uint8() uint8   { return r.next(1)[0] }
+func (r *reader) uint16() uint16 { return binary.BigEndian.Uint16(r.next(2)) }
+func (r *reader) uint32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *reader) uint64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+
+// ParseAccumulatorUpdate decodes a PNAU update, it does not verify anything
+func ParseAccumulatorUpdate(data []byte) (*AccumulatorUpdate, error) {
+	r := &reader{data: data}
+	if magic := r.next(4); r.err == nil && string(magic) != accumulatorMagic {
+		return nil, fmt.Errorf("%w: invalid magic %x", ErrMalformedUpdate, magic)
+	}
+
+	update := &AccumulatorUpdate{
+		MajorVersion: r.uint8(),
+		MinorVersion: r.uint8(),
+	}
+	if r.err == nil && update.MajorVersion != 1 {
+		return nil, fmt.Errorf("%w: unsupported major version %d", ErrMalformedUpdate, update.MajorVersion)
+	}
+	r.next(int(r.uint8())) // trailing header, reserved for minor versions
+	if updateType := r.uint8(); r.err == nil && updateType != wormholeMerkleType {
+		return nil, fmt.Errorf("%w: unsupported update type %d", ErrMalformedUpdate, updateType)
+	}
+
+	vaaData := r.next(int(r.uint16()))
+	count := int(r.uint8())
+	for i := 0; i < count && r.err == nil; i++ {
+		message := r.next(int(r.uint16()))
+		proof := make([][20]byte, r.uint8())
+		for j := range proof {
+			copy(proof[j][:], r.next(20))
+		}
+		update.Updates = append(update.Updates, MerkleUpdate{Message: message, Proof: proof})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrMalformedUpdate, len(r.data))
+	}
+
+	vaa, err := ParseVaa(vaaData)
+	if err != nil {
+		return nil, err
+	}
+	update.Vaa = vaa
+
+	// wormhole merkle root payload: "AUWV" | update type u8 | slot u64 | ring size u32 | root 20 bytes
+	p := &reader{data: vaa.Payload}
+	if magic := p.next(4); p.err == nil && !bytes.Equal(magic, wormholeMerkleMagic) {
+		return nil, fmt.Errorf("%w: invalid vaa payload magic %x", ErrMalformedUpdate, magic)
+	}
+	if payloadType := p.uint8(); p.err == nil && payloadType != wormholeMerkleType {
+		return nil, fmt.Errorf("%w: unsupported vaa payload type %d", ErrMalformedUpdate, payloadType)
+	}
+	update.Slot = p.uint64()
+	update.RingSize = p.uint32()
+	copy(update.Root[:], p.next(20))
+	if p.err != nil {
+		return nil, p.err
+	}
+	return update, nil
+}
+
+// ParseVaa decodes a version 1 wormhole vaa
+func ParseVaa(data []byte) (*Vaa, error) {
+	r := &reader{data: data}
+	vaa := &Vaa{
+		Version:          r.uint8(),
+		GuardianSetIndex: r.uint32(),
+	}
+	if r.err == nil && vaa.Version != 1 {
+		return nil, fmt.Errorf("%w: unsupported vaa version %d", ErrMalformedUpdate, vaa.Version)
+	}
+
+	vaa.Signatures = make([]VaaSignature, r.uint8())
+	for i := range vaa.Signatures {
+		vaa.Signatures[i].GuardianIndex = r.uint8()
+		copy(vaa.Signatures[i].Signature[:], r.next(65))
+	}
+
+	vaa.body = r.data
+	vaa.Timestamp = r.uint32()
+	vaa.Nonce = r.uint32()
+	vaa.EmitterChain = r.uint16()
+	vaa.EmitterAddress = common.BytesToHash(r.next(32))
+	vaa.Sequence = r.uint64()
+	vaa.ConsistencyLevel = r.uint8()
+	vaa.Payload = r.data
+	if r.err != nil {
+		return nil, r.err
+	}
+	return vaa, nil
+}
+
+// Hash is the digest the guardians sign, keccak256 of keccak256 of the body
+func (v *Vaa) Hash() []byte {
+	return crypto.Keccak256(crypto.Keccak256(v.body))
+}
+
+// Verify checks the vaa was signed by a quorum of the guardian set, signatures must be in ascending guardian order
+func (v *Vaa) Verify(guardians *GuardianSet) error {
+	if guardians == nil {
+		return fmt.Errorf("%w: no guardian set configured", ErrInvalidGuardianSet)
+	}
+	if v.GuardianSetIndex != guardians.Index {
+		return fmt.Errorf("%w: vaa signed by set %d, expected %d", ErrInvalidGuardianSet, v.GuardianSetIndex, guardians.Index)
+	}
+	if len(v.Signatures) < guardians.Quorum() {
+		return fmt.Errorf("%w: %d of %d", ErrNoQuorum, len(v.Signatures), guardians.Quorum())
+	}
+
+	hash := v.Hash()
+	last := -1
+	for _, signature := range v.Signatures {
+		index := int(signature.GuardianIndex)
+		if index <= last {
+			return fmt.Errorf("%w: guardian %d out of order", ErrInvalidSignature, index)
+		}
+		if index >= len(guardians.Keys) {
+			return fmt.Errorf("%w: guardian %d not in set of %d", ErrInvalidSignature, index, len(guardians.Keys))
+		}
+		last = index
+
+		publicKey, err := crypto.SigToPub(hash, signature.Signature[:])
+		if err != nil {
+			return fmt.Errorf("%w: guardian %d: %v", ErrInvalidSignature, index, err)
+		}
+		if signer := crypto.PubkeyToAddress(*publicKey); signer != guardians.Keys[index] {
+			return fmt.Errorf("%w: guardian %d recovered %v, expected %v", ErrInvalidSignature, index, signer.Hex(), guardians.Keys[index].Hex())
+		}
+	}
+	return nil
+}
+
+func keccak160(data ...[]byte) [20]byte {
+	var hash [20]byte
+	copy(hash[:], crypto.Keccak256(data...))
+	return hash
+}
+
+// VerifyMerkleProof folds the proof from the message leaf up to the root, siblings are hashed in sorted order
+func VerifyMerkleProof(root [20]byte, message []byte, proof [][20]byte) bool {
+	node := keccak160([]byte{0}, message)
+	for _, sibling := range proof {
+		if bytes.Compare(node[:], sibling[:]) <= 0 {
+			node = keccak160([]byte{1}, node[:], sibling[:])
+		} else {
+			node = keccak160([]byte{1}, sibling[:], node[:])
+		}
+	}
+	return node == root
+}
+
+// ParsePriceMessage decodes a price feed message, other message types are rejected
+func ParsePriceMessage(message []byte) (*PriceMessage, error) {
+	r := &reader{data: message}
+	if messageType := r.uint8(); r.err == nil && messageType != priceFeedMessage {
+		return nil, fmt.Errorf("%w: unsupported message type %d", ErrMalformedUpdate, messageType)
+	}
+
+	price := &PriceMessage{
+		FeedId:          hex.EncodeToString(r.next(32)),
+		Price:           int64(r.uint64()),
+		Conf:            r.uint64(),
+		Expo:            int32(r.uint32()),
+		PublishTime:     int64(r.uint64()),
+		PrevPublishTime: int64(r.uint64()),
+		EmaPrice:        int64(r.uint64()),
+		EmaConf:         r.uint64(),
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return price, nil
+}
+
+// Verify decodes an accumulator update and returns its price messages once the vaa and every proof are verified
+func Verify(data []byte, guardians *GuardianSet) ([]PriceMessage, error) {
+	update, err := ParseAccumulatorUpdate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Vaa.EmitterChain != pythnetChainId || update.Vaa.EmitterAddress != pythnetEmitter {
+		return nil, fmt.Errorf("%w: chain %d address %v", ErrInvalidEmitter, update.Vaa.EmitterChain, update.Vaa.EmitterAddress.Hex())
+	}
+	if err := update.Vaa.Verify(guardians); err != nil {
+		return nil, err
+	}
+
+	prices := make([]PriceMessage, 0, len(update.Updates))
+	for i, merkleUpdate := range update.Updates {
+		if !VerifyMerkleProof(update.Root, merkleUpdate.Message, merkleUpdate.Proof) {
+			return nil, fmt.Errorf("%w: update %d", ErrInvalidProof, i)
+		}
+		price, err := ParsePriceMessage(merkleUpdate.Message)
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, *price)
+	}
+	return prices, nil
+}
+
+// VerifyHex verifies the hex encoded binary data of a hermes response
+func VerifyHex(data []string, guardians *GuardianSet) ([]PriceMessage, error) {
+	var prices []PriceMessage
+	for _, encoded := range data {
+		decoded, err := hex.DecodeString(strings.TrimPrefix(encoded, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedUpdate, err)
+		}
+		verified, err := Verify(decoded, guardians)
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, verified...)
+	}
+	return prices, nil
+}
@@ -0,0 +1,220 @@
+package hermes
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// a BTC/USD update captured from hermes, signed by 13 of the 19 guardians of set 4
+const capturedUpdate = "504e41550100000003b801000000040d00e351a260da76aec683d5b6179b6f8e817d8d7d0727e84ceaf6dac0deca05a4" +
+	"fc0ce55d0a5addaf6a871ed4aaacb785752db5d24b4a8bfa90158962a2517cc1f400024cb0a66e9f4adcbab8568d8f60" +
+	"32360dbf93def497ccbd02402a8abb7169e3ed1de3fa827f86ba7b3992679dcd7c6136719121254ce96d78309e1bcfe2" +
+	"63d00400035876e6d45911aa1c73028be8d41a5412701732c3f7005a86440500310b3eaa0f635a3dfcd9d3757a31f78a" +
+	"d5b3e7c4c7f1561b04c7e1af3d360dee650030ade100049613ef5f6ddbe9271ffb7bd41ee781cbe8c55180bca45b7943" +
+	"18a9d199e229f32bf8f44b8da144430d09826406861d13cbc8b9a53f50bd30a616c74d6849d7c101061cd7547a31bc89" +
+	"7fc7e2443e9cbee426ca992048d064712f5596a954fa5689374741e6ec2842532fdd480604d34292336c6744150a1446" +
+	"58bd9092bf9e87434b000852205ad844251a1349b6fbe1e7d9f27b8681d0628f47f7769142cc421b0b890433dc5ed492" +
+	"85b2717169edfa5b07544f8d53eec122079b5ceb22ccefbd4b63ef000a231ae39d67ed1f15b199ea34018660bfebb4e8" +
+	"f275037667f594868c74a64b362b548d8649136b230159342a6b2761bbca4c4996a6ce21d3504f1ff935bd670c010bb9" +
+	"e2a7ec75a714a5f77760968e50f32d9c8a70295f265e71aff8dc2c52a2d1d73753f36979cf2b2ec788961743b7299766" +
+	"75305e7725a1a4862741bc7f9aea33000c5554b32e7c51e4f5383319af3345ab57a434bb6df4251d126ba6b8667fec55" +
+	"366e83b8acc085bbd5c75bcc1d99338f4bf1c75aaf08fe9d007593042cc183aedd000d717e0a95bc5f4db1a8f5a07952" +
+	"58f030b5190d059d6cff387b1b0783cb1012242c27f23aee7ccd09729a5feb72fb22d4b8bccd9d25bc5d6f4e49892026" +
+	"975031000f18fa460fd4967520c9976682c721d9dd0b532bf6d6e286af38998d41975f1eb4562be5a05911d14def5523" +
+	"18667eb0d9a8e0e8b9307be23bf112aa700b446030011069b26caf4a5b2afad642c2c2e6efb9d5ee57dc37f39988f22f" +
+	"e7dc2f8001f6fb3fa03dfca0b7bf03dbbf9b02b2885a4785186d552de621b826ed4ef16a87741d00118e4b2346adcfa2" +
+	"3e76e089b74753d49fc27e5c041be6c627959d5a51a5d9b8f706a943fa815ebac68606c9807bfa3fa4daec36a4d5a7ae" +
+	"bb4fa02ce3229b8a73016773daea00000000001ae101faedac5851e32b9b23b5f9411a8c2bac4aae3ed4dd7b811dd1a7" +
+	"2ea4aa7100000000062a89a7014155575600000000000b376d6500002710d86affe1de75b312f0a6f7383f0b0732330e" +
+	"a7c601005500e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b430000088e17d036060000" +
+	"0002305d11befffffff8000000006773daea000000006773daea0000088ac179e42000000001bc5439500b31be0d91a8" +
+	"2eae8b2c080cf02a88e5f96a22a52fa70923bc214a8d0f3b0b4d5f4251d4fd655a2cc50ab6b8017b7ea1b2dea6957917" +
+	"76ca14d5331491993a0e8576e8e4e5991983c3be76742f55e851f5d47879b0c8728abb48ff3042a66f2ab688922740cb" +
+	"33732f7b765f1c96c91a99a5a7ddb339c155f10ccd5fe1471fd63c6e8c59271b06cd7027380aee4d1a5605dc19082195" +
+	"2944fc9168c58f7a5b04d2271cf84cf207de2550df8db4984bb7e473c269e452cf31930a62a0040e4edb21c6a6740d26" +
+	"19be0f0a92c4d15a3355ecc0050863529ff14422e9fbda"
+
+func capturedUpdateBytes(t *testing.T) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(capturedUpdate)
+	if err != nil {
+		t.Fatalf("decode captured update: %v", err)
+	}
+	return data
+}
+
+// offsets in the captured update: magic 4, versions 2, trailing header size 1, update type 1, vaa size 2,
+// then the vaa: version 1, guardian set index 4, signature count 1, signatures of guardian index 1 and 65 bytes
+const (
+	vaaSizeOffset        = 8
+	vaaOffset            = 10
+	signatureCountOffset = vaaOffset + 5
+	firstSignatureOffset = signatureCountOffset + 1
+	signatureSize        = 66
+)
+
+// dropLastSignature removes a signature and fixes the signature count and vaa size, the vaa body is unchanged
+func dropLastSignature(data []byte) []byte {
+	count := int(data[signatureCountOffset])
+	start := firstSignatureOffset + (count-1)*signatureSize
+	update := append(append([]byte{}, data[:start]...), data[start+signatureSize:]...)
+	update[signatureCountOffset] = byte(count - 1)
+	binary.BigEndian.PutUint16(update[vaaSizeOffset:], binary.BigEndian.Uint16(data[vaaSizeOffset:])-signatureSize)
+	return update
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    func([]byte) []byte
+		guardians *GuardianSet
+		err       error
+	}{
+		{
+			name:      "valid update",
+			update:    func(data []byte) []byte { return data },
+			guardians: MainnetGuardianSet,
+		},
+		{
+			name: "bad guardian signature",
+			update: func(data []byte) []byte {
+				// the s value of the first guardian signature
+				data[firstSignatureOffset+1+40] ^= 0x01
+				return data
+			},
+			guardians: MainnetGuardianSet,
+			err:       ErrInvalidSignature,
+		},
+		{
+			name:      "too few signatures for quorum",
+			update:    dropLastSignature,
+			guardians: MainnetGuardianSet,
+			err:       ErrNoQuorum,
+		},
+		{
+			name: "tampered merkle proof",
+			update: func(data []byte) []byte {
+				// the last sibling of the only price message
+				data[len(data)-1] ^= 0x01
+				return data
+			},
+			guardians: MainnetGuardianSet,
+			err:       ErrInvalidProof,
+		},
+		{
+			name:      "other guardian set",
+			update:    func(data []byte) []byte { return data },
+			guardians: &GuardianSet{Index: 3, Keys: MainnetGuardianSet.Keys},
+			err:       ErrInvalidGuardianSet,
+		},
+		{
+			name:   "no guardian set",
+			update: func(data []byte) []byte { return data },
+			err:    ErrInvalidGuardianSet,
+		},
+		{
+			name:      "truncated update",
+			update:    func(data []byte) []byte { return data[:len(data)-7] },
+			guardians: MainnetGuardianSet,
+			err:       ErrMalformedUpdate,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prices, err := Verify(test.update(capturedUpdateBytes(t)), test.guardians)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("expected %v, found %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expected := PriceMessage{
+				FeedId:          "e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b43",
+				Price:           9406377899526,
+				Conf:            9401340350,
+				Expo:            -8,
+				PublishTime:     1735645930,
+				PrevPublishTime: 1735645930,
+				EmaPrice:        9392044500000,
+				EmaConf:         7454603600,
+			}
+			if len(prices) != 1 || prices[0] != expected {
+				t.Fatalf("expected [%+v], found %+v", expected, prices)
+			}
+		})
+	}
+}
+
+func TestGuardianSetFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		index string
+		keys  string
+		set   *GuardianSet
+		err   bool
+	}{
+		{name: "mainnet default", set: MainnetGuardianSet},
+		{
+			name:  "configured set",
+			index: "5",
+			keys:  "0x5893B5A76c3f739645648885bDCcC06cd70a3Cd3, 0xfF6CB952589BDE862c25Ef4392132fb9D4A42157",
+			set:   &GuardianSet{Index: 5, Keys: MainnetGuardianSet.Keys[:2]},
+		},
+		{name: "invalid key", index: "5", keys: "0x1234", err: true},
+		{name: "missing index", keys: "0x5893B5A76c3f739645648885bDCcC06cd70a3Cd3", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("WORMHOLE_GUARDIAN_SET_INDEX", test.index)
+			t.Setenv("WORMHOLE_GUARDIAN_KEYS", test.keys)
+
+			set, err := GuardianSetFromEnv()
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, found set %+v", set)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if set.Index != test.set.Index || len(set.Keys) != len(test.set.Keys) {
+				t.Fatalf("expected %+v, found %+v", test.set, set)
+			}
+			for i := range set.Keys {
+				if set.Keys[i] != test.set.Keys[i] {
+					t.Fatalf("key %d: expected %v, found %v", i, test.set.Keys[i], set.Keys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	tests := []struct {
+		guardians int
+		quorum    int
+	}{
+		{guardians: 1, quorum: 1},
+		{guardians: 3, quorum: 3},
+		{guardians: 4, quorum: 3},
+		{guardians: 19, quorum: 13},
+	}
+
+	for _, test := range tests {
+		set := &GuardianSet{Keys: make([]common.Address, test.guardians)}
+		if quorum := set.Quorum(); quorum != test.quorum {
+			t.Errorf("%d guardians: expected quorum %d, found %d", test.guardians, test.quorum, quorum)
+		}
+	}
+}
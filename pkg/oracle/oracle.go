@@ -0,0 +1,131 @@
+package oracle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/BlueSpadeXchain/blp-api/pkg/pairs"
+)
+
+// hermes prices are only used after Validate, a price that is too old or too uncertain never opens, closes or triggers an order
+// the max age is set with ORACLE_MAX_PRICE_AGE (seconds), the confidence threshold per pair in pkg/pairs
+// with ORACLE_EMA_FALLBACK=true a rejected spot price falls back to the ema price when that one passes the same checks
+
+const (
+	DefaultMaxAge           = 60 * time.Second
+	DefaultMaxConfidenceBps = 100
+)
+
+var (
+	ErrMissingPrice   = errors.New("oracle price missing")
+	ErrStalePrice     = errors.New("oracle price is stale")
+	ErrUncertainPrice = errors.New("oracle price confidence too wide")
+)
+
+var tenThousand = decimal.NewFromInt(10000)
+
+// Price is a pyth price as returned by hermes, price and conf are integers scaled by 10^expo
+type Price struct {
+	Conf        string `json:"conf"`
+	Expo        int    `json:"expo"`
+	Price       string `json:"price"`
+	PublishTime int64  `json:"publish_time"`
+}
+
+type PriceUpdate struct {
+	Id       string
+	Price    Price
+	EmaPrice Price
+}
+
+type Config struct {
+	MaxAge      time.Duration
+	EmaFallback bool
+}
+
+// ValidatedPrice is a price that passed the freshness and confidence checks
+type ValidatedPrice struct {
+	Price       decimal.Decimal
+	Conf        decimal.Decimal
+	PublishTime time.Time
+	Ema         bool // the spot price was rejected and the ema price is used
+}
+
+func ConfigFromEnv() Config {
+	config := Config{MaxAge: DefaultMaxAge}
+	if maxAge := os.Getenv("ORACLE_MAX_PRICE_AGE"); maxAge != "" {
+		if seconds, err := strconv.ParseInt(maxAge, 10, 64); err == nil && seconds > 0 {
+			config.MaxAge = time.Duration(seconds) * time.Second
+		}
+	}
+	emaFallback := os.Getenv("ORACLE_EMA_FALLBACK")
+	config.EmaFallback = emaFallback == "true" || emaFallback == "1"
+	return config
+}
+
+// maxConfidenceBps is the pair threshold, pairs outside the registry use DefaultMaxConfidenceBps
+func maxConfidenceBps(feedId string) decimal.Decimal {
+	pair, err := pairs.LookupFeedId(feedId)
+	if err != nil || pair.MaxConfidenceBps <= 0 {
+		return decimal.NewFromInt(DefaultMaxConfidenceBps)
+	}
+	return decimal.NewFromInt(pair.MaxConfidenceBps)
+}
+
+// Validate returns the spot price of the update, or the ema price when the spot price is rejected and the fallback is enabled
+func Validate(update PriceUpdate, config Config, now time.Time) (*ValidatedPrice, error) {
+	maxBps := maxConfidenceBps(update.Id)
+
+	price, err := validatePrice(update.Price, maxBps, config.MaxAge, now)
+	if err == nil {
+		return price, nil
+	}
+	if !config.EmaFallback {
+		return nil, fmt.Errorf("feed %v: %w", update.Id, err)
+	}
+
+	emaPrice, emaErr := validatePrice(update.EmaPrice, maxBps, config.MaxAge, now)
+	if emaErr != nil {
+		return nil, fmt.Errorf("feed %v: %w, ema fallback: %v", update.Id, err, emaErr)
+	}
+	emaPrice.Ema = true
+	return emaPrice, nil
+}
+
+func validatePrice(price Price, maxBps decimal.Decimal, maxAge time.Duration, now time.Time) (*ValidatedPrice, error) {
+	if price.Price == "" || price.PublishTime == 0 {
+		return nil, ErrMissingPrice
+	}
+
+	value, err := decimal.NewFromPyth(price.Price, int32(price.Expo))
+	if err != nil {
+		return nil, err
+	}
+	if !value.IsPositive() {
+		return nil, fmt.Errorf("%w: non positive price %v", ErrMissingPrice, value)
+	}
+	conf, err := decimal.NewFromPyth(price.Conf, int32(price.Expo))
+	if err != nil {
+		return nil, err
+	}
+
+	publishTime := time.Unix(price.PublishTime, 0)
+	if age := now.Sub(publishTime); age > maxAge {
+		return nil, fmt.Errorf("%w: published %v ago, max %v", ErrStalePrice, age.Truncate(time.Second), maxAge)
+	}
+
+	// conf / price in basis points
+	if confBps := conf.Mul(tenThousand).Div(value); confBps.GreaterThan(maxBps) {
+		return nil, fmt.Errorf("%w: %v bps, max %v bps", ErrUncertainPrice, confBps.Round(2), maxBps)
+	}
+
+	return &ValidatedPrice{
+		Price:       value,
+		Conf:        conf,
+		PublishTime: publishTime,
+	}, nil
+}
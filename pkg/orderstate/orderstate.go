@@ -0,0 +1,117 @@
+package orderstate
+
+import "fmt"
+
+// the lifecycle of an order (orders2.status), every status change has to be one of the transitions below
+// db/orders/order_state.sql holds the same table and its trigger rejects any other change
+// every transition and every order creation is recorded in order_events (db/orders/order_events.sql)
+// actions that keep the status (modify, margin, partial close, take profit) are transitions from a state to itself
+
+const (
+	Unsigned   = "unsigned"   // created, waiting for the user signature
+	Limit      = "limit"      // signed resting entry, waiting for its price
+	Pending    = "pending"    // open position
+	Filled     = "filled"     // closed at the max profit price
+	Canceled   = "canceled"   // canceled before it opened
+	Closed     = "closed"     // closed by its user
+	Liquidated = "liquidated" // closed at the liquidation price
+	Stopped    = "stopped"    // closed at the stop loss price
+	Expired    = "expired"    // unsigned past its signature expiry
+)
+
+// actors that move an order
+const (
+	User       = "user"
+	Rebalancer = "rebalancer"
+	Admin      = "admin"
+)
+
+// actions, recorded as order_events.action
+const (
+	Create     = "create" // the order was inserted, it is an event but not a transition
+	Sign       = "sign"
+	Cancel     = "cancel"
+	Modify     = "modify"
+	Margin     = "margin"
+	Close      = "close"
+	Trigger    = "trigger"     // a resting entry fills and opens the position
+	TakeProfit = "take_profit" // the take profit closes part of the position
+	Fill       = "fill"        // the max profit price closes the position
+	Stop       = "stop"
+	Liquidate  = "liquidate"
+	Expire     = "expire"
+)
+
+type Transition struct {
+	From   string
+	To     string
+	Action string
+	Actor  string
+}
+
+var transitions = []Transition{
+	{Unsigned, Pending, Sign, User},
+	{Unsigned, Limit, Sign, User},
+	{Unsigned, Unsigned, Modify, User},
+	{Unsigned, Canceled, Cancel, User},
+	{Unsigned, Canceled, Cancel, Admin},
+	{Unsigned, Expired, Expire, Rebalancer},
+
+	{Limit, Limit, Modify, User},
+	{Limit, Canceled, Cancel, User},
+	{Limit, Canceled, Cancel, Admin},
+	{Limit, Canceled, Expire, Rebalancer},
+	{Limit, Pending, Trigger, Rebalancer},
+
+	{Pending, Pending, Modify, User},
+	{Pending, Pending, Margin, User},
+	{Pending, Pending, Close, User},
+	{Pending, Closed, Close, User},
+	{Pending, Closed, Close, Admin},
+	{Pending, Pending, TakeProfit, Rebalancer},
+	{Pending, Pending, Stop, Rebalancer},  // a stop loss exit level
+	{Pending, Pending, Close, Rebalancer}, // a reduce-only order
+	{Pending, Closed, Close, Rebalancer},
+	{Pending, Filled, Fill, Rebalancer},
+	{Pending, Stopped, Stop, Rebalancer},
+	{Pending, Liquidated, Liquidate, Rebalancer},
+	{Pending, Liquidated, Liquidate, Admin},
+}
+
+// Transitions returns the legal transitions
+func Transitions() []Transition {
+	return append([]Transition(nil), transitions...)
+}
+
+// IsFinal reports whether an order in state can no longer change
+func IsFinal(state string) bool {
+	for _, transition := range transitions {
+		if transition.From == state {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns an error unless actor may move an order from one state to another with action
+func Check(from, to, action, actor string) error {
+	for _, transition := range transitions {
+		if transition == (Transition{from, to, action, actor}) {
+			return nil
+		}
+	}
+	if from == to {
+		return fmt.Errorf("%v cannot %v orders of status %v", actor, action, from)
+	}
+	return fmt.Errorf("%v cannot %v orders of status %v into %v", actor, action, from, to)
+}
+
+// Allows returns an error unless actor can take action on an order in state, whatever state it leads to
+func Allows(state, action, actor string) error {
+	for _, transition := range transitions {
+		if transition.From == state && transition.Action == action && transition.Actor == actor {
+			return nil
+		}
+	}
+	return fmt.Errorf("orders of status %v cannot %v", state, action)
+}
@@ -0,0 +1,133 @@
+package orderstate
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   string
+		to     string
+		action string
+		actor  string
+		err    bool
+	}{
+		{name: "user signs a market order", from: Unsigned, to: Pending, action: Sign, actor: User},
+		{name: "user signs a limit order", from: Unsigned, to: Limit, action: Sign, actor: User},
+		{name: "rebalancer triggers a limit order", from: Limit, to: Pending, action: Trigger, actor: Rebalancer},
+		{name: "rebalancer expires a limit order", from: Limit, to: Canceled, action: Expire, actor: Rebalancer},
+		{name: "rebalancer takes profit", from: Pending, to: Pending, action: TakeProfit, actor: Rebalancer},
+		{name: "user closes part of a position", from: Pending, to: Pending, action: Close, actor: User},
+		{name: "admin liquidates", from: Pending, to: Liquidated, action: Liquidate, actor: Admin},
+		{name: "user cannot trigger a limit order", from: Limit, to: Pending, action: Trigger, actor: User, err: true},
+		{name: "user cannot liquidate", from: Pending, to: Liquidated, action: Liquidate, actor: User, err: true},
+		{name: "closed orders cannot reopen", from: Closed, to: Pending, action: Sign, actor: User, err: true},
+		{name: "open positions cannot be canceled", from: Pending, to: Canceled, action: Cancel, actor: User, err: true},
+		{name: "action must match the statuses", from: Pending, to: Closed, action: Stop, actor: Rebalancer, err: true},
+		{name: "modify keeps the status", from: Limit, to: Pending, action: Modify, actor: User, err: true},
+		{name: "unknown actor", from: Unsigned, to: Pending, action: Sign, actor: "keeper", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Check(test.from, test.to, test.action, test.actor)
+			if test.err && err == nil {
+				t.Fatalf("expected an error, found none")
+			}
+			if !test.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  string
+		action string
+		actor  string
+		err    bool
+	}{
+		{name: "user modifies an unsigned order", state: Unsigned, action: Modify, actor: User},
+		{name: "user cancels a limit order", state: Limit, action: Cancel, actor: User},
+		{name: "user adds margin to a position", state: Pending, action: Margin, actor: User},
+		{name: "rebalancer stops a position", state: Pending, action: Stop, actor: Rebalancer},
+		{name: "no margin before the position opens", state: Limit, action: Margin, actor: User, err: true},
+		{name: "no modify of a closed order", state: Closed, action: Modify, actor: User, err: true},
+		{name: "admin cannot sign", state: Unsigned, action: Sign, actor: Admin, err: true},
+		{name: "rebalancer cannot cancel", state: Limit, action: Cancel, actor: Rebalancer, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Allows(test.state, test.action, test.actor)
+			if test.err && err == nil {
+				t.Fatalf("expected an error, found none")
+			}
+			if !test.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	tests := []struct {
+		state string
+		final bool
+	}{
+		{state: Unsigned, final: false},
+		{state: Limit, final: false},
+		{state: Pending, final: false},
+		{state: Filled, final: true},
+		{state: Canceled, final: true},
+		{state: Closed, final: true},
+		{state: Liquidated, final: true},
+		{state: Stopped, final: true},
+		{state: Expired, final: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.state, func(t *testing.T) {
+			if final := IsFinal(test.state); final != test.final {
+				t.Fatalf("expected %v, found %v", test.final, final)
+			}
+		})
+	}
+}
+
+func TestTransitionsCopy(t *testing.T) {
+	copied := Transitions()
+	copied[0] = Transition{Closed, Pending, Sign, User}
+	if err := Check(Closed, Pending, Sign, User); err == nil {
+		t.Fatalf("expected the transitions to be unchanged by their copy")
+	}
+}
+
+// the seed of order_state_transitions has to list the same transitions
+func TestTransitionsMatchSql(t *testing.T) {
+	sql, err := os.ReadFile("../../db/orders/order_state.sql")
+	if err != nil {
+		t.Fatalf("read order_state.sql: %v", err)
+	}
+
+	row := regexp.MustCompile(`\('(\w+)', '(\w+)', '(\w+)', '(\w+)'\)`)
+	seeded := map[Transition]bool{}
+	for _, match := range row.FindAllStringSubmatch(string(sql), -1) {
+		seeded[Transition{match[1], match[2], match[3], match[4]}] = true
+	}
+
+	for _, transition := range transitions {
+		if !seeded[transition] {
+			t.Fatalf("%+v is missing from order_state_transitions", transition)
+		}
+		delete(seeded, transition)
+	}
+	for transition := range seeded {
+		t.Fatalf("%+v of order_state_transitions is missing from transitions", transition)
+	}
+}
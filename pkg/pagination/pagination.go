@@ -0,0 +1,161 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// history lists (orders, deposits, stakes, withdrawals) are sorted newest first by (created_at, id)
+// a cursor is the sort key of the last row of a page, the next page starts strictly after it
+// so rows created while paging never shift or repeat the pages already read
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Cursor keeps created_at as the db formatted it, it is only ever handed back to the db
+type Cursor struct {
+	CreatedAt string
+	Id        string
+}
+
+// Page is the window of a list, After is nil for the first page
+type Page struct {
+	After *Cursor
+	Limit int
+}
+
+// TimeRange bounds created_at or ended_at, a zero bound is open
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// RequestParams are the query params shared by the paged list requests, nested in their params
+type RequestParams struct {
+	CreatedFrom string `query:"created-from" optional:"true"` // unix seconds, inclusive
+	CreatedTo   string `query:"created-to" optional:"true"`   // unix seconds, exclusive
+	Cursor      string `query:"cursor" optional:"true"`       // next_cursor of the previous page
+	Limit       string `query:"limit" optional:"true"`        // page size, DefaultLimit by default and at most MaxLimit
+}
+
+// Parse reads the created range and the page
+func (params RequestParams) Parse() (TimeRange, Page, error) {
+	created, err := ParseTimeRange("created", params.CreatedFrom, params.CreatedTo)
+	if err != nil {
+		return created, Page{}, err
+	}
+	page, err := ParsePage(params.Cursor, params.Limit)
+	return created, page, err
+}
+
+// Encode returns the opaque cursor handed to clients as next_cursor
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt + "|" + c.Id))
+}
+
+// Decode reads a cursor returned by Encode
+func Decode(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	createdAt, id, found := strings.Cut(string(data), "|")
+	if !found || createdAt == "" {
+		return nil, fmt.Errorf("invalid cursor: %v", value)
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	return &Cursor{CreatedAt: createdAt, Id: id}, nil
+}
+
+// NextCursor encodes the cursor the db returned with a page, empty on the last page
+func NextCursor(createdAt, id string) string {
+	if id == "" {
+		return ""
+	}
+	return Cursor{CreatedAt: createdAt, Id: id}.Encode()
+}
+
+// ParsePage reads the cursor and limit params, limit defaults to DefaultLimit and is capped at MaxLimit
+func ParsePage(cursor, limit string) (Page, error) {
+	page := Page{Limit: DefaultLimit}
+	if cursor != "" {
+		after, err := Decode(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.After = after
+	}
+	if limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return page, fmt.Errorf("invalid limit: expected a positive integer, found %v", limit)
+		}
+		page.Limit = min(value, MaxLimit)
+	}
+	return page, nil
+}
+
+// ParseTimeRange reads unix seconds bounds, to must not be before from
+func ParseTimeRange(name, from, to string) (TimeRange, error) {
+	var timeRange TimeRange
+	for _, bound := range []struct {
+		value string
+		time  *time.Time
+	}{{from, &timeRange.From}, {to, &timeRange.To}} {
+		if bound.value == "" {
+			continue
+		}
+		seconds, err := strconv.ParseInt(bound.value, 10, 64)
+		if err != nil || seconds < 0 {
+			return timeRange, fmt.Errorf("invalid %v range: expected unix seconds, found %v", name, bound.value)
+		}
+		*bound.time = time.Unix(seconds, 0).UTC()
+	}
+	if !timeRange.From.IsZero() && !timeRange.To.IsZero() && timeRange.To.Before(timeRange.From) {
+		return timeRange, fmt.Errorf("invalid %v range: %v is before %v", name, to, from)
+	}
+	return timeRange, nil
+}
+
+// Params adds the page and range params shared by the paged rpcs, open bounds are sent as null
+func (page Page) Params(params map[string]interface{}) {
+	params["p_limit"] = page.Limit
+	params["p_cursor_created_at"] = nil
+	params["p_cursor_id"] = nil
+	if page.After != nil {
+		params["p_cursor_created_at"] = page.After.CreatedAt
+		params["p_cursor_id"] = page.After.Id
+	}
+}
+
+// Params adds the range as <prefix>_from and <prefix>_to
+func (timeRange TimeRange) Params(params map[string]interface{}, prefix string) {
+	params[prefix+"_from"] = nil
+	params[prefix+"_to"] = nil
+	if !timeRange.From.IsZero() {
+		params[prefix+"_from"] = timeRange.From.Format(time.RFC3339)
+	}
+	if !timeRange.To.IsZero() {
+		params[prefix+"_to"] = timeRange.To.Format(time.RFC3339)
+	}
+}
+
+// ParseList reads a filter that takes one value or a comma list, nil matches everything
+func ParseList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
@@ -0,0 +1,167 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+const cursorId = "0b1c8a4e-6f1d-4a4b-9f3e-2d7c5a9e8b10"
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor Cursor
+	}{
+		{name: "db timestamp", cursor: Cursor{CreatedAt: "2024-11-02T15:04:05.123456", Id: cursorId}},
+		{name: "timestamp with zone", cursor: Cursor{CreatedAt: "2024-11-02T15:04:05+00:00", Id: cursorId}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := Decode(test.cursor.Encode())
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if *decoded != test.cursor {
+				t.Fatalf("expected %+v, found %+v", test.cursor, *decoded)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	encode := func(value string) string { return base64.RawURLEncoding.EncodeToString([]byte(value)) }
+
+	tests := []struct {
+		name   string
+		value  string
+		cursor *Cursor
+		err    bool
+	}{
+		{
+			name:   "valid cursor",
+			value:  encode("2024-11-02T15:04:05.123456|" + cursorId),
+			cursor: &Cursor{CreatedAt: "2024-11-02T15:04:05.123456", Id: cursorId},
+		},
+		{name: "not base64", value: "not a cursor!", err: true},
+		{name: "padded base64", value: base64.URLEncoding.EncodeToString([]byte("2024-11-02|" + cursorId)), err: true},
+		{name: "no separator", value: encode("2024-11-02T15:04:05"), err: true},
+		{name: "empty timestamp", value: encode("|" + cursorId), err: true},
+		{name: "invalid id", value: encode("2024-11-02T15:04:05|42"), err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cursor, err := Decode(test.value)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, found cursor %+v", cursor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *cursor != *test.cursor {
+				t.Fatalf("expected %+v, found %+v", *test.cursor, *cursor)
+			}
+		})
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	if next := NextCursor("2024-11-02T15:04:05", ""); next != "" {
+		t.Fatalf("expected no cursor on the last page, found %v", next)
+	}
+	next := NextCursor("2024-11-02T15:04:05", cursorId)
+	cursor, err := Decode(next)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if cursor.CreatedAt != "2024-11-02T15:04:05" || cursor.Id != cursorId {
+		t.Fatalf("unexpected cursor %+v", *cursor)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	cursor := Cursor{CreatedAt: "2024-11-02T15:04:05", Id: cursorId}
+
+	tests := []struct {
+		name   string
+		cursor string
+		limit  string
+		page   Page
+		err    bool
+	}{
+		{name: "defaults", page: Page{Limit: DefaultLimit}},
+		{name: "limit", limit: "10", page: Page{Limit: 10}},
+		{name: "limit capped", limit: "1000", page: Page{Limit: MaxLimit}},
+		{name: "cursor", cursor: cursor.Encode(), page: Page{After: &cursor, Limit: DefaultLimit}},
+		{name: "zero limit", limit: "0", err: true},
+		{name: "negative limit", limit: "-5", err: true},
+		{name: "limit not a number", limit: "ten", err: true},
+		{name: "invalid cursor", cursor: "abc", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := ParsePage(test.cursor, test.limit)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, found page %+v", page)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if page.Limit != test.page.Limit {
+				t.Fatalf("expected limit %v, found %v", test.page.Limit, page.Limit)
+			}
+			if (page.After == nil) != (test.page.After == nil) || page.After != nil && *page.After != *test.page.After {
+				t.Fatalf("expected cursor %+v, found %+v", test.page.After, page.After)
+			}
+		})
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      string
+		to        string
+		timeRange TimeRange
+		err       bool
+	}{
+		{name: "open range"},
+		{name: "from only", from: "1700000000", timeRange: TimeRange{From: time.Unix(1700000000, 0).UTC()}},
+		{
+			name:      "closed range",
+			from:      "1700000000",
+			to:        "1700003600",
+			timeRange: TimeRange{From: time.Unix(1700000000, 0).UTC(), To: time.Unix(1700003600, 0).UTC()},
+		},
+		{name: "to before from", from: "1700003600", to: "1700000000", err: true},
+		{name: "negative seconds", from: "-1", err: true},
+		{name: "not unix seconds", to: "2024-11-02", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeRange, err := ParseTimeRange("created", test.from, test.to)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, found range %+v", timeRange)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !timeRange.From.Equal(test.timeRange.From) || !timeRange.To.Equal(test.timeRange.To) {
+				t.Fatalf("expected %+v, found %+v", test.timeRange, timeRange)
+			}
+		})
+	}
+}
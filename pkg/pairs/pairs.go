@@ -0,0 +1,120 @@
+package pairs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the registry is the only place markets are listed, orders, info and the rebalancer all read from it
+// to add a market append it to registry with its pyth feed id, pair_id columns store the feed id
+
+const (
+	AssetClassCrypto = "crypto"
+	AssetClassForex  = "forex"
+)
+
+const (
+	// StatusActive pairs accept new orders
+	StatusActive = "active"
+	// StatusCloseOnly pairs keep streaming prices for open positions but reject new orders
+	StatusCloseOnly = "close-only"
+	// StatusDelisted pairs are hidden and no longer streamed
+	StatusDelisted = "delisted"
+)
+
+type Pair struct {
+	Symbol          string   `json:"symbol"`
+	Aliases         []string `json:"aliases"`
+	FeedId          string   `json:"feed-id"`
+	Base            string   `json:"base"`
+	Quote           string   `json:"quote"`
+	DisplayDecimals int32    `json:"display-decimals"`
+	AssetClass      string   `json:"asset-class"`
+	Status          string   `json:"status"`
+	// MaxConfidenceBps rejects oracle prices whose confidence interval is wider than this share of the price
+	MaxConfidenceBps int64 `json:"max-confidence-bps"`
+}
+
+var registry = []Pair{
+	{Symbol: "ethusd", Aliases: []string{"usdeth"}, FeedId: "ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace", Base: "ETH", Quote: "USD", DisplayDecimals: 2, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 50},
+	{Symbol: "btcusd", Aliases: []string{"usdbtc"}, FeedId: "e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b43", Base: "BTC", Quote: "USD", DisplayDecimals: 2, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 50},
+	{Symbol: "moodengusd", Aliases: []string{"usdmoodeng"}, FeedId: "ffff73128917a90950cd0473fd2551d7cd274fd5a6cc45641881bbcc6ee73417", Base: "MOODENG", Quote: "USD", DisplayDecimals: 5, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 200},
+	{Symbol: "bnbusd", Aliases: []string{"usdbnb"}, FeedId: "2f95862b045670cd22bee3114c39763a4a08beeb663b145d283c31d7d1101c4f", Base: "BNB", Quote: "USD", DisplayDecimals: 2, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 100},
+	{Symbol: "solusd", Aliases: []string{"usdsol"}, FeedId: "ef0d8b6fda2ceba41da15d4095d1da392a0d2f8ed0c6c7bc0f4cfac8c280b56d", Base: "SOL", Quote: "USD", DisplayDecimals: 3, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 100},
+	{Symbol: "dogeusd", Aliases: []string{"usddoge"}, FeedId: "dcef50dd0a4cd2dcc17e45df1676dcb336a11a61c69df7a0299b0150c672d25c", Base: "DOGE", Quote: "USD", DisplayDecimals: 5, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 150},
+	{Symbol: "suiusd", Aliases: []string{"usdsui"}, FeedId: "23d7315113f5b1d3ba7a83604c44b94d79f4fd69af77f804fc7f920a6dc65744", Base: "SUI", Quote: "USD", DisplayDecimals: 4, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 150},
+	{Symbol: "trumpusd", Aliases: []string{"usdtrump"}, FeedId: "879551021853eec7a7dc827578e8e69da7e4fa8148339aa0d3d5296405be4b1a", Base: "TRUMP", Quote: "USD", DisplayDecimals: 3, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 200},
+	{Symbol: "bonkusd", Aliases: []string{"usdbonk"}, FeedId: "72b021217ca3fe68922a19aaf990109cb9d84e9ad004b4d2025ad6f529314419", Base: "BONK", Quote: "USD", DisplayDecimals: 8, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 200},
+	{Symbol: "pnutusd", Aliases: []string{"usdpnut"}, FeedId: "116da895807f81f6b5c5f01b109376e7f6834dc8b51365ab7cdfa66634340e54", Base: "PNUT", Quote: "USD", DisplayDecimals: 5, AssetClass: AssetClassCrypto, Status: StatusActive, MaxConfidenceBps: 200},
+	{Symbol: "usdjpy", Aliases: []string{"jpyusd"}, FeedId: "ef2c98c804ba503c6a707e38be4dfbb16683775f195b091252bf24693042fd52", Base: "USD", Quote: "JPY", DisplayDecimals: 3, AssetClass: AssetClassForex, Status: StatusActive, MaxConfidenceBps: 20},
+}
+
+// All returns every listed pair, delisted pairs excluded
+func All() []Pair {
+	listed := make([]Pair, 0, len(registry))
+	for _, pair := range registry {
+		if pair.Status != StatusDelisted {
+			listed = append(listed, pair)
+		}
+	}
+	return listed
+}
+
+// Lookup resolves a symbol or alias, case insensitive
+func Lookup(name string) (*Pair, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i := range registry {
+		pair := registry[i]
+		if pair.Symbol == name {
+			return &pair, nil
+		}
+		for _, alias := range pair.Aliases {
+			if alias == name {
+				return &pair, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported pair name: %s", name)
+}
+
+// LookupFeedId resolves the pair_id stored on orders back to its pair
+func LookupFeedId(feedId string) (*Pair, error) {
+	feedId = strings.ToLower(strings.TrimPrefix(feedId, "0x"))
+	for i := range registry {
+		if registry[i].FeedId == feedId {
+			pair := registry[i]
+			return &pair, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported pair id: %s", feedId)
+}
+
+// FeedId resolves a symbol or alias of a pair accepting new orders to its pyth feed id
+func FeedId(name string) (string, error) {
+	pair, err := Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	if pair.Status != StatusActive {
+		return "", fmt.Errorf("pair %s is %s", pair.Symbol, pair.Status)
+	}
+	return pair.FeedId, nil
+}
+
+// FeedIds are the price feeds the rebalancer streams, close-only pairs still have positions to settle
+func FeedIds() []string {
+	feedIds := make([]string, 0, len(registry))
+	for _, pair := range All() {
+		feedIds = append(feedIds, pair.FeedId)
+	}
+	return feedIds
+}
+
+// Symbols returns the symbol of every listed pair
+func Symbols() []string {
+	symbols := make([]string, 0, len(registry))
+	for _, pair := range All() {
+		symbols = append(symbols, pair.Symbol)
+	}
+	return symbols
+}
@@ -0,0 +1,103 @@
+package risk
+
+import (
+	"fmt"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/supabase-community/supabase-go"
+)
+
+// per pair limits live in the pair_risk_params table (db/pairs/pair_risk_params.sql)
+// pairs without a row use Default, which matches the limits before the registry existed
+
+var (
+	DefaultMaxLeverage       = decimal.NewFromInt(1250)
+	DefaultMaxProfitMultiple = decimal.NewFromInt(10)
+)
+
+// Default is enabled, uncapped and charges the base fees
+func Default(pairId string) db.PairRiskParamsResponse {
+	return db.PairRiskParamsResponse{
+		PairId:                   pairId,
+		Enabled:                  true,
+		MaxLeverage:              DefaultMaxLeverage,
+		LeverageFeeMultiplier:    decimal.One,
+		UtilizationFeeMultiplier: decimal.One,
+		MaxProfitMultiple:        DefaultMaxProfitMultiple,
+	}
+}
+
+// GetPairParams returns the limits and current open interest of a single pair
+func GetPairParams(client *supabase.Client, pairId string) (*db.PairRiskParamsResponse, error) {
+	response, err := db.GetPairRiskParams(client, pairId)
+	if err != nil {
+		return nil, err
+	}
+	for _, params := range *response {
+		if params.PairId == pairId {
+			return &params, nil
+		}
+	}
+	params := Default(pairId)
+	return &params, nil
+}
+
+// GetPairsParams returns the limits of every pair in pairIds, in the same order
+func GetPairsParams(client *supabase.Client, pairIds []string) ([]db.PairRiskParamsResponse, error) {
+	response, err := db.GetPairRiskParams(client, "")
+	if err != nil {
+		return nil, err
+	}
+
+	configured := make(map[string]db.PairRiskParamsResponse, len(*response))
+	for _, params := range *response {
+		configured[params.PairId] = params
+	}
+
+	pairsParams := make([]db.PairRiskParamsResponse, 0, len(pairIds))
+	for _, pairId := range pairIds {
+		params, found := configured[pairId]
+		if !found {
+			params = Default(pairId)
+		}
+		pairsParams = append(pairsParams, params)
+	}
+	return pairsParams, nil
+}
+
+// ValidateOrder checks a new order against the pair limits, collateral is before the open fee
+func ValidateOrder(params *db.PairRiskParamsResponse, positionType string, collateral, leverage decimal.Decimal) error {
+	if !params.Enabled {
+		return fmt.Errorf("pair %v is disabled for new orders", params.PairId)
+	}
+
+	if leverage.LessThan(decimal.One) {
+		return fmt.Errorf("leverage %v is under the minimum of 1", leverage)
+	}
+	if leverage.GreaterThan(params.MaxLeverage) {
+		return fmt.Errorf("leverage %v exceeds the pair max leverage %v", leverage, params.MaxLeverage)
+	}
+
+	if collateral.LessThan(params.MinCollateral) {
+		return fmt.Errorf("collateral %v is under the pair minimum %v", collateral, params.MinCollateral)
+	}
+	if !params.MaxCollateral.IsZero() && collateral.GreaterThan(params.MaxCollateral) {
+		return fmt.Errorf("collateral %v exceeds the pair maximum %v", collateral, params.MaxCollateral)
+	}
+
+	size := collateral.Mul(leverage)
+	switch positionType {
+	case "long":
+		if !params.MaxLongOpenInterest.IsZero() && params.LongOpenInterest.Add(size).GreaterThan(params.MaxLongOpenInterest) {
+			return fmt.Errorf("order size %v exceeds the remaining long open interest %v", size, params.MaxLongOpenInterest.Sub(params.LongOpenInterest))
+		}
+	case "short":
+		if !params.MaxShortOpenInterest.IsZero() && params.ShortOpenInterest.Add(size).GreaterThan(params.MaxShortOpenInterest) {
+			return fmt.Errorf("order size %v exceeds the remaining short open interest %v", size, params.MaxShortOpenInterest.Sub(params.ShortOpenInterest))
+		}
+	default:
+		return fmt.Errorf("invalid position type: %v", positionType)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package trailing
+
+import (
+	"fmt"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+)
+
+// trailing stops follow the most favourable price since the position opened (db/orders/trailing_stop.sql)
+// the api sets the initial stop from the entry price, the rebalancer ratchets it on every streamed price
+
+var hundred = decimal.NewFromInt(100)
+
+// Parse reads the trail distance, exactly one of amount (USD) and percent is set
+func Parse(amount, percent string) (decimal.Decimal, decimal.Decimal, error) {
+	if (amount == "") == (percent == "") {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("exactly one of trail-amount and trail-percent must be set")
+	}
+	if amount != "" {
+		trailAmount, err := decimal.NewFromString(amount)
+		if err != nil || !trailAmount.IsPositive() {
+			return decimal.Zero, decimal.Zero, fmt.Errorf("invalid trail amount: %v", amount)
+		}
+		return trailAmount.RoundUsd(), decimal.Zero, nil
+	}
+	trailPercent, err := decimal.NewFromString(percent)
+	if err != nil || !trailPercent.IsPositive() || trailPercent.GreaterThanOrEqual(hundred) {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("invalid trail percent: expected 0 < value < 100, found %v", percent)
+	}
+	return decimal.Zero, trailPercent.Round(4), nil
+}
+
+// StopPrice is the stop trailing extreme by the amount or percent distance, under it for longs and over it for shorts
+func StopPrice(positionType string, extreme, amount, percent decimal.Decimal) decimal.Decimal {
+	distance := amount
+	if distance.IsZero() {
+		distance = extreme.Mul(percent).Div(hundred)
+	}
+	if positionType == "short" {
+		return extreme.Add(distance).RoundUsd()
+	}
+	return extreme.Sub(distance).RoundUsd()
+}
+
+// Ratchet moves the extreme and the stop with price, neither moves against the position
+// it reports whether either changed
+func Ratchet(positionType string, price, amount, percent decimal.Decimal, extreme, stopPrice *decimal.Decimal) bool {
+	switch positionType {
+	case "long":
+		if !price.GreaterThan(*extreme) {
+			return false
+		}
+	case "short":
+		if !price.LessThan(*extreme) {
+			return false
+		}
+	default:
+		return false
+	}
+	*extreme = price.RoundUsd()
+
+	stop := StopPrice(positionType, price, amount, percent)
+	if positionType == "long" && stop.GreaterThan(*stopPrice) || positionType == "short" && stop.LessThan(*stopPrice) {
+		*stopPrice = stop
+	}
+	return true
+}
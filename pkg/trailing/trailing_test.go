@@ -0,0 +1,123 @@
+package trailing
+
+import (
+	"testing"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		amount       string
+		percent      string
+		trailAmount  string
+		trailPercent string
+		err          bool
+	}{
+		{name: "amount", amount: "25.1234567", trailAmount: "25.123457", trailPercent: "0"},
+		{name: "percent", percent: "2.55555", trailAmount: "0", trailPercent: "2.5556"},
+		{name: "neither", err: true},
+		{name: "both", amount: "25", percent: "2", err: true},
+		{name: "zero amount", amount: "0", err: true},
+		{name: "negative amount", amount: "-5", err: true},
+		{name: "amount not a number", amount: "ten", err: true},
+		{name: "zero percent", percent: "0", err: true},
+		{name: "whole price", percent: "100", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			amount, percent, err := Parse(test.amount, test.percent)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, found amount %v percent %v", amount, percent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !amount.Equal(decimal.RequireFromString(test.trailAmount)) || !percent.Equal(decimal.RequireFromString(test.trailPercent)) {
+				t.Fatalf("expected amount %v percent %v, found %v %v", test.trailAmount, test.trailPercent, amount, percent)
+			}
+		})
+	}
+}
+
+func TestRatchet(t *testing.T) {
+	tests := []struct {
+		name         string
+		positionType string
+		price        string
+		amount       string
+		percent      string
+		extreme      string
+		stopPrice    string
+		moved        bool
+		newExtreme   string
+		newStopPrice string
+	}{
+		{
+			name: "long new high", positionType: "long", price: "110", amount: "5", percent: "0",
+			extreme: "100", stopPrice: "95", moved: true, newExtreme: "110", newStopPrice: "105",
+		},
+		{
+			name: "long below the high", positionType: "long", price: "99", amount: "5", percent: "0",
+			extreme: "100", stopPrice: "95", moved: false, newExtreme: "100", newStopPrice: "95",
+		},
+		{
+			name: "long at the high", positionType: "long", price: "100", amount: "5", percent: "0",
+			extreme: "100", stopPrice: "95", moved: false, newExtreme: "100", newStopPrice: "95",
+		},
+		{
+			name: "long percent trail", positionType: "long", price: "200", amount: "0", percent: "2.5",
+			extreme: "100", stopPrice: "97.5", moved: true, newExtreme: "200", newStopPrice: "195",
+		},
+		{
+			name: "long stop already tighter", positionType: "long", price: "101", amount: "5", percent: "0",
+			extreme: "100", stopPrice: "98", moved: true, newExtreme: "101", newStopPrice: "98",
+		},
+		{
+			name: "short new low", positionType: "short", price: "90", amount: "5", percent: "0",
+			extreme: "100", stopPrice: "105", moved: true, newExtreme: "90", newStopPrice: "95",
+		},
+		{
+			name: "short above the low", positionType: "short", price: "101", amount: "5", percent: "0",
+			extreme: "100", stopPrice: "105", moved: false, newExtreme: "100", newStopPrice: "105",
+		},
+		{
+			name: "short percent trail", positionType: "short", price: "80", amount: "0", percent: "10",
+			extreme: "100", stopPrice: "110", moved: true, newExtreme: "80", newStopPrice: "88",
+		},
+		{
+			name: "extreme rounded to usd precision", positionType: "long", price: "100.0000004", amount: "1", percent: "0",
+			extreme: "100", stopPrice: "99", moved: true, newExtreme: "100", newStopPrice: "99",
+		},
+		{
+			name: "unknown position type", positionType: "spot", price: "110", amount: "5", percent: "0",
+			extreme: "100", stopPrice: "95", moved: false, newExtreme: "100", newStopPrice: "95",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			extreme := decimal.RequireFromString(test.extreme)
+			stopPrice := decimal.RequireFromString(test.stopPrice)
+			moved := Ratchet(test.positionType,
+				decimal.RequireFromString(test.price),
+				decimal.RequireFromString(test.amount),
+				decimal.RequireFromString(test.percent),
+				&extreme, &stopPrice)
+			if moved != test.moved {
+				t.Fatalf("expected moved %v, found %v", test.moved, moved)
+			}
+			if !extreme.Equal(decimal.RequireFromString(test.newExtreme)) {
+				t.Fatalf("expected extreme %v, found %v", test.newExtreme, extreme)
+			}
+			if !stopPrice.Equal(decimal.RequireFromString(test.newStopPrice)) {
+				t.Fatalf("expected stop price %v, found %v", test.newStopPrice, stopPrice)
+			}
+		})
+	}
+}
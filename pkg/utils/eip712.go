@@ -0,0 +1,486 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// EIP-712 typed data for every user signed action, see https://eips.ethereum.org/EIPS/eip-712
+// the typed data is returned by the unsigned requests so wallets can render it with eth_signTypedData_v4
+// decimals are signed in their canonical string form, "1.500000" from the db and "1.5" both sign as "1.5"
+
+const (
+	Eip712DomainName    = "BlueSpade"
+	Eip712DomainVersion = "1"
+)
+
+var Eip712Types = apitypes.Types{
+	"Order": {
+		{Name: "orderId", Type: "string"},
+		{Name: "pair", Type: "string"},
+		{Name: "side", Type: "string"},
+		{Name: "leverage", Type: "string"},
+		{Name: "collateral", Type: "string"},
+		{Name: "limitPrice", Type: "string"},
+		{Name: "stopPrice", Type: "string"},
+		{Name: "tpPrice", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"ModifyOrder": {
+		{Name: "orderId", Type: "string"},
+		{Name: "modificationId", Type: "string"},
+		{Name: "limitPrice", Type: "string"},
+		{Name: "stopPrice", Type: "string"},
+		{Name: "tpPrice", Type: "string"},
+		{Name: "tpCollateral", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"ModifyMargin": {
+		{Name: "orderId", Type: "string"},
+		{Name: "modificationId", Type: "string"},
+		{Name: "action", Type: "string"},
+		{Name: "amount", Type: "string"},
+		{Name: "collateral", Type: "string"},
+		{Name: "leverage", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"CloseOrder": {
+		{Name: "orderId", Type: "string"},
+		{Name: "pair", Type: "string"},
+		{Name: "side", Type: "string"},
+		{Name: "closePercent", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"ReduceOnlyOrder": {
+		{Name: "reduceOnlyOrderId", Type: "string"},
+		{Name: "orderId", Type: "string"},
+		{Name: "kind", Type: "string"},
+		{Name: "triggerPrice", Type: "string"},
+		{Name: "closePercent", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"AlgoOrder": {
+		{Name: "algoOrderId", Type: "string"},
+		{Name: "kind", Type: "string"},
+		{Name: "pair", Type: "string"},
+		{Name: "side", Type: "string"},
+		{Name: "leverage", Type: "string"},
+		{Name: "collateral", Type: "string"},
+		{Name: "slices", Type: "uint256"},
+		{Name: "intervalSeconds", Type: "uint256"},
+		{Name: "priceFrom", Type: "string"},
+		{Name: "priceTo", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"OrderBatch": {
+		{Name: "batchId", Type: "string"},
+		{Name: "action", Type: "string"},
+		{Name: "orderIds", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"CancelOrder": {
+		{Name: "orderId", Type: "string"},
+		{Name: "pair", Type: "string"},
+		{Name: "side", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+	"Withdrawal": {
+		{Name: "withdrawalId", Type: "string"},
+		{Name: "amount", Type: "string"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+	},
+}
+
+// TypedMessage is implemented by each signable action
+type TypedMessage interface {
+	PrimaryType() string
+	Message() apitypes.TypedDataMessage
+	GetNonce() uint64
+	GetExpiry() int64
+}
+
+type OrderTypedData struct {
+	OrderId    string
+	Pair       string
+	Side       string
+	Leverage   decimal.Decimal
+	Collateral decimal.Decimal
+	LimitPrice decimal.Decimal
+	StopPrice  decimal.Decimal
+	TpPrice    decimal.Decimal
+	Nonce      uint64
+	Expiry     int64
+}
+
+type ModifyOrderTypedData struct {
+	OrderId        string
+	ModificationId string
+	LimitPrice     decimal.Decimal
+	StopPrice      decimal.Decimal
+	TpPrice        decimal.Decimal
+	TpCollateral   decimal.Decimal
+	Nonce          uint64
+	Expiry         int64
+}
+
+// ModifyMarginTypedData collateral and leverage are the position values after the change
+type ModifyMarginTypedData struct {
+	OrderId        string
+	ModificationId string
+	Action         string
+	Amount         decimal.Decimal
+	Collateral     decimal.Decimal
+	Leverage       decimal.Decimal
+	Nonce          uint64
+	Expiry         int64
+}
+
+// CloseOrderTypedData closePercent is the share of the open collateral to close, 100 closes the position
+type CloseOrderTypedData struct {
+	OrderId      string
+	Pair         string
+	Side         string
+	ClosePercent decimal.Decimal
+	Nonce        uint64
+	Expiry       int64
+}
+
+// ReduceOnlyOrderTypedData orderId is the parent position, closePercent the share of its live collateral closed at triggerPrice
+type ReduceOnlyOrderTypedData struct {
+	ReduceOnlyOrderId string
+	OrderId           string
+	Kind              string
+	TriggerPrice      decimal.Decimal
+	ClosePercent      decimal.Decimal
+	Nonce             uint64
+	Expiry            int64
+}
+
+// AlgoOrderTypedData collateral is the total of the slices, priceFrom and priceTo are zero for a twap
+type AlgoOrderTypedData struct {
+	AlgoOrderId     string
+	Kind            string
+	Pair            string
+	Side            string
+	Leverage        decimal.Decimal
+	Collateral      decimal.Decimal
+	Slices          int64
+	IntervalSeconds int64
+	PriceFrom       decimal.Decimal
+	PriceTo         decimal.Decimal
+	Nonce           uint64
+	Expiry          int64
+}
+
+// OrderBatchTypedData signs every order of a batch at once, orderIds is the comma separated list in batch order
+type OrderBatchTypedData struct {
+	BatchId  string
+	Action   string // "create" or "cancel"
+	OrderIds []string
+	Nonce    uint64
+	Expiry   int64
+}
+
+type CancelOrderTypedData struct {
+	OrderId string
+	Pair    string
+	Side    string
+	Nonce   uint64
+	Expiry  int64
+}
+
+type WithdrawalTypedData struct {
+	WithdrawalId string
+	Amount       decimal.Decimal
+	Nonce        uint64
+	Expiry       int64
+}
+
+func (o OrderTypedData) PrimaryType() string { return "Order" }
+
+func (o OrderTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o OrderTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o OrderTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"orderId":    o.OrderId,
+		"pair":       o.Pair,
+		"side":       o.Side,
+		"leverage":   o.Leverage.String(),
+		"collateral": o.Collateral.String(),
+		"limitPrice": o.LimitPrice.String(),
+		"stopPrice":  o.StopPrice.String(),
+		"tpPrice":    o.TpPrice.String(),
+		"nonce":      strconv.FormatUint(o.Nonce, 10),
+		"expiry":     strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (o ModifyOrderTypedData) PrimaryType() string { return "ModifyOrder" }
+
+func (o ModifyOrderTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o ModifyOrderTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o ModifyOrderTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"orderId":        o.OrderId,
+		"modificationId": o.ModificationId,
+		"limitPrice":     o.LimitPrice.String(),
+		"stopPrice":      o.StopPrice.String(),
+		"tpPrice":        o.TpPrice.String(),
+		"tpCollateral":   o.TpCollateral.String(),
+		"nonce":          strconv.FormatUint(o.Nonce, 10),
+		"expiry":         strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (o ModifyMarginTypedData) PrimaryType() string { return "ModifyMargin" }
+
+func (o ModifyMarginTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o ModifyMarginTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o ModifyMarginTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"orderId":        o.OrderId,
+		"modificationId": o.ModificationId,
+		"action":         o.Action,
+		"amount":         o.Amount.String(),
+		"collateral":     o.Collateral.String(),
+		"leverage":       o.Leverage.String(),
+		"nonce":          strconv.FormatUint(o.Nonce, 10),
+		"expiry":         strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (o CloseOrderTypedData) PrimaryType() string { return "CloseOrder" }
+
+func (o CloseOrderTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o CloseOrderTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o CloseOrderTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"orderId":      o.OrderId,
+		"pair":         o.Pair,
+		"side":         o.Side,
+		"closePercent": o.ClosePercent.String(),
+		"nonce":        strconv.FormatUint(o.Nonce, 10),
+		"expiry":       strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (o ReduceOnlyOrderTypedData) PrimaryType() string { return "ReduceOnlyOrder" }
+
+func (o ReduceOnlyOrderTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o ReduceOnlyOrderTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o ReduceOnlyOrderTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"reduceOnlyOrderId": o.ReduceOnlyOrderId,
+		"orderId":           o.OrderId,
+		"kind":              o.Kind,
+		"triggerPrice":      o.TriggerPrice.String(),
+		"closePercent":      o.ClosePercent.String(),
+		"nonce":             strconv.FormatUint(o.Nonce, 10),
+		"expiry":            strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (o AlgoOrderTypedData) PrimaryType() string { return "AlgoOrder" }
+
+func (o AlgoOrderTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o AlgoOrderTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o AlgoOrderTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"algoOrderId":     o.AlgoOrderId,
+		"kind":            o.Kind,
+		"pair":            o.Pair,
+		"side":            o.Side,
+		"leverage":        o.Leverage.String(),
+		"collateral":      o.Collateral.String(),
+		"slices":          strconv.FormatInt(o.Slices, 10),
+		"intervalSeconds": strconv.FormatInt(o.IntervalSeconds, 10),
+		"priceFrom":       o.PriceFrom.String(),
+		"priceTo":         o.PriceTo.String(),
+		"nonce":           strconv.FormatUint(o.Nonce, 10),
+		"expiry":          strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (o OrderBatchTypedData) PrimaryType() string { return "OrderBatch" }
+
+func (o OrderBatchTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o OrderBatchTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o OrderBatchTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"batchId":  o.BatchId,
+		"action":   o.Action,
+		"orderIds": strings.Join(o.OrderIds, ","),
+		"nonce":    strconv.FormatUint(o.Nonce, 10),
+		"expiry":   strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (o CancelOrderTypedData) PrimaryType() string { return "CancelOrder" }
+
+func (o CancelOrderTypedData) GetNonce() uint64 { return o.Nonce }
+
+func (o CancelOrderTypedData) GetExpiry() int64 { return o.Expiry }
+
+func (o CancelOrderTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"orderId": o.OrderId,
+		"pair":    o.Pair,
+		"side":    o.Side,
+		"nonce":   strconv.FormatUint(o.Nonce, 10),
+		"expiry":  strconv.FormatInt(o.Expiry, 10),
+	}
+}
+
+func (w WithdrawalTypedData) PrimaryType() string { return "Withdrawal" }
+
+func (w WithdrawalTypedData) GetNonce() uint64 { return w.Nonce }
+
+func (w WithdrawalTypedData) GetExpiry() int64 { return w.Expiry }
+
+func (w WithdrawalTypedData) Message() apitypes.TypedDataMessage {
+	return apitypes.TypedDataMessage{
+		"withdrawalId": w.WithdrawalId,
+		"amount":       w.Amount.String(),
+		"nonce":        strconv.FormatUint(w.Nonce, 10),
+		"expiry":       strconv.FormatInt(w.Expiry, 10),
+	}
+}
+
+// GetEip712Domain builds the domain from the active network, the escrow is the verifying contract
+func GetEip712Domain() apitypes.TypedDataDomain {
+	var chainIdEnv, escrowEnv string
+	if os.Getenv("MAINNET_ENABLED") == "true" {
+		chainIdEnv, escrowEnv = "MAINNET_CHAIN_ID", "MAINNET_ESCROW"
+	} else {
+		chainIdEnv, escrowEnv = "TESTNET_CHAIN_ID", "TESTNET_ESCROW"
+	}
+
+	domain := apitypes.TypedDataDomain{
+		Name:    Eip712DomainName,
+		Version: Eip712DomainVersion,
+	}
+	if chainId, ok := new(big.Int).SetString(os.Getenv(chainIdEnv), 10); ok {
+		domain.ChainId = (*math.HexOrDecimal256)(chainId)
+	}
+	if escrow := os.Getenv(escrowEnv); common.IsHexAddress(escrow) {
+		domain.VerifyingContract = common.HexToAddress(escrow).Hex()
+	}
+	return domain
+}
+
+// domainType only lists the domain fields that are configured, unset fields are not encoded
+func domainType(domain apitypes.TypedDataDomain) []apitypes.Type {
+	fields := []apitypes.Type{
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+	}
+	if domain.ChainId != nil {
+		fields = append(fields, apitypes.Type{Name: "chainId", Type: "uint256"})
+	}
+	if domain.VerifyingContract != "" {
+		fields = append(fields, apitypes.Type{Name: "verifyingContract", Type: "address"})
+	}
+	return fields
+}
+
+func NewTypedData(message TypedMessage) apitypes.TypedData {
+	domain := GetEip712Domain()
+	primaryType := message.PrimaryType()
+
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": domainType(domain),
+			primaryType:    Eip712Types[primaryType],
+		},
+		PrimaryType: primaryType,
+		Domain:      domain,
+		Message:     message.Message(),
+	}
+}
+
+// HashTypedData returns keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+func HashTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash typed data: %w", err)
+	}
+	return hash, nil
+}
+
+// ValidateTypedDataSignature unlike ValidateEvmEcdsaSignature does not prefix the EthDomainHeader
+// remember to -= 27 for ethereum signatures
+func ValidateTypedDataSignature(typedData apitypes.TypedData, signature []byte, address common.Address) (bool, error) {
+	if len(signature) != 65 {
+		return false, fmt.Errorf("invalid signature length: %d", len(signature))
+	}
+
+	hash, err := HashTypedData(typedData)
+	if err != nil {
+		return false, err
+	}
+
+	recoveredPubKey, err := crypto.SigToPub(hash, signature)
+	if err != nil {
+		return false, fmt.Errorf("failed to recover public key: %w", err)
+	}
+	recoveredAddress := crypto.PubkeyToAddress(*recoveredPubKey)
+
+	LogInfo("Recover details", FormatKeyValueLogs([][2]string{
+		{"primary type", typedData.PrimaryType},
+		{"recovered address", recoveredAddress.String()},
+		{"expected address ", address.Hex()},
+	}))
+
+	return recoveredAddress == address, nil
+}
+
+// ParseExpiryTime converts the expiry_time returned by supabase into unix seconds
+func ParseExpiryTime(expiryTime string) (int64, error) {
+	formats := []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999",
+	}
+
+	var err error
+	for _, layout := range formats {
+		var t time.Time
+		t, err = time.Parse(layout, expiryTime)
+		if err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("error parsing expiry time: %v", err)
+}
@@ -15,7 +15,10 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/hermes"
+	"github.com/BlueSpadeXchain/blp-api/pkg/oracle"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -102,9 +105,12 @@ func StringifyStructFields(params interface{}, indent string) string {
 			fieldType := typ.Field(i)
 			fieldName := fieldType.Name
 
-			// Handle nested types
-			switch field.Kind() {
-			case reflect.Struct, reflect.Map:
+			// Handle nested types, values such as decimals print themselves
+			_, isStringer := field.Interface().(fmt.Stringer)
+			switch {
+			case isStringer:
+				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m: %v", indent, fieldName, field.Interface()))
+			case field.Kind() == reflect.Struct, field.Kind() == reflect.Map:
 				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m:\n", indent, fieldName))
 				nestedResult := StringifyStructFields(field.Interface(), indent+"  ")
 				result.WriteString(nestedResult)
@@ -123,8 +129,11 @@ func StringifyStructFields(params interface{}, indent string) string {
 			keyStr := fmt.Sprintf("%v", k.Interface())
 
 			// Handle nested types in map values
-			switch v.Kind() {
-			case reflect.Struct, reflect.Map:
+			_, isStringer := v.Interface().(fmt.Stringer)
+			switch {
+			case isStringer:
+				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m: %v", indent, keyStr, v.Interface()))
+			case v.Kind() == reflect.Struct, v.Kind() == reflect.Map:
 				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m:\n", indent, keyStr))
 				nestedResult := StringifyStructFields(v.Interface(), indent+"  ")
 				result.WriteString(nestedResult)
@@ -220,6 +229,17 @@ func ErrInternal(message string) Error {
 	}
 }
 
+func ErrConflict(message string) Error {
+	origin := GetOrigin()
+
+	return Error{
+		Code:    409,
+		Message: "Conflict",
+		Details: message,
+		Origin:  origin,
+	}
+}
+
 func EnvKey2Ecdsa() (*ecdsa.PrivateKey, common.Address, error) {
 	return PrivateKey2Sepc256k1(os.Getenv("RELAY_PRIVATE_KEY"))
 }
@@ -372,39 +392,140 @@ func RemoveHex0xPrefix(hex string) string {
 
 // GetCurrentPriceData queries the API for the current price data for the given pair ID.
 func GetCurrentPriceData(pair string) (PriceUpdate, error) {
+	response, err := getLatestPrice(pair)
+	if err != nil {
+		return PriceUpdate{}, err
+	}
+	return response.Parsed[0], nil
+}
+
+func getLatestPrice(pair string) (Response, error) {
+	return getLatestPrices(pair)
+}
+
+// getLatestPrices reads the latest update of every pair in one hermes request
+func getLatestPrices(pairs ...string) (Response, error) {
 	baseURL := "https://hermes.pyth.network/v2/updates/price/latest"
 
 	// Create the request with query parameters
 	reqURL, err := url.Parse(baseURL)
 	if err != nil {
-		return PriceUpdate{}, fmt.Errorf("error parsing URL: %v", err)
+		return Response{}, fmt.Errorf("error parsing URL: %v", err)
 	}
 
 	q := reqURL.Query()
-	q.Add("ids[]", pair)
+	for _, pair := range pairs {
+		q.Add("ids[]", pair)
+	}
 	reqURL.RawQuery = q.Encode()
 
 	resp, err := http.Get(reqURL.String())
 	if err != nil {
-		return PriceUpdate{}, fmt.Errorf("error making HTTP request: %v", err)
+		return Response{}, fmt.Errorf("error making HTTP request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return PriceUpdate{}, fmt.Errorf("API returned non-200 status code: %d", resp.StatusCode)
+		return Response{}, fmt.Errorf("API returned non-200 status code: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return PriceUpdate{}, fmt.Errorf("error reading response body: %v", err)
+		return Response{}, fmt.Errorf("error reading response body: %v", err)
 	}
 
 	var response Response
 	if err := json.Unmarshal(body, &response); err != nil {
-		return PriceUpdate{}, fmt.Errorf("error unmarshaling response JSON: %v", err)
+		return Response{}, fmt.Errorf("error unmarshaling response JSON: %v", err)
 	}
 
-	LogResponse(reqURL.String(), response.Parsed[0])
+	if len(response.Parsed) == 0 {
+		return Response{}, fmt.Errorf("no price returned for pairs: %v", strings.Join(pairs, ", "))
+	}
 
-	return response.Parsed[0], nil
+	for _, parsed := range response.Parsed {
+		LogResponse(reqURL.String(), parsed)
+	}
+
+	return response, nil
+}
+
+// GetValidatedPrice is GetCurrentPriceData rejecting stale and uncertain prices, see pkg/oracle
+// with a wormhole guardian set configured the price is taken from the verified binary update instead of the parsed json
+func GetValidatedPrice(pair string) (*oracle.ValidatedPrice, error) {
+	response, err := getLatestPrice(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := priceUpdate(response, pair)
+	if err != nil {
+		return nil, err
+	}
+	return oracle.Validate(update, oracle.ConfigFromEnv(), time.Now())
+}
+
+// GetValidatedPrices is GetValidatedPrice for several pairs read in one hermes request, keyed by pair
+// any missing, stale or uncertain price fails the whole read
+func GetValidatedPrices(pairs []string) (map[string]*oracle.ValidatedPrice, error) {
+	prices, priceErrors, err := GetValidatedPricesByPair(pairs)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		if err := priceErrors[pair]; err != nil {
+			return nil, err
+		}
+	}
+	return prices, nil
+}
+
+// GetValidatedPricesByPair reads several pairs in one hermes request and validates each on its own,
+// a pair whose price is missing, stale or uncertain is in the errors instead of the prices
+// err is only set when the hermes request itself fails
+func GetValidatedPricesByPair(pairs []string) (map[string]*oracle.ValidatedPrice, map[string]error, error) {
+	prices := make(map[string]*oracle.ValidatedPrice, len(pairs))
+	priceErrors := make(map[string]error)
+	if len(pairs) == 0 {
+		return prices, priceErrors, nil
+	}
+
+	response, err := getLatestPrices(pairs...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := oracle.ConfigFromEnv()
+	now := time.Now()
+	for _, pair := range pairs {
+		update, err := priceUpdate(response, pair)
+		if err != nil {
+			priceErrors[pair] = err
+			continue
+		}
+		price, err := oracle.Validate(update, config, now)
+		if err != nil {
+			priceErrors[pair] = fmt.Errorf("pair %v: %v", pair, err)
+			continue
+		}
+		prices[pair] = price
+	}
+	return prices, priceErrors, nil
+}
+
+func priceUpdate(response Response, pair string) (oracle.PriceUpdate, error) {
+	guardians, err := hermes.GuardianSetFromEnv()
+	if err != nil {
+		return oracle.PriceUpdate{}, err
+	}
+	prices, err := hermes.VerifyHex(response.Binary.Data, guardians)
+	if err != nil {
+		return oracle.PriceUpdate{}, err
+	}
+	for _, price := range prices {
+		if price.FeedId == strings.ToLower(RemoveHex0xPrefix(pair)) {
+			return price.PriceUpdate(), nil
+		}
+	}
+	return oracle.PriceUpdate{}, fmt.Errorf("no verified price for pair: %v", pair)
 }
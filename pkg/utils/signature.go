@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signature rejections each carry their own code so clients can tell them apart
+const (
+	ErrCodeSignatureMalformed uint64 = 4010
+	ErrCodeSignatureInvalid   uint64 = 4011
+	ErrCodeSignatureExpired   uint64 = 4012
+	ErrCodeNonceMismatch      uint64 = 4013
+	ErrCodeSignatureReplayed  uint64 = 4014
+)
+
+func newSignatureError(code uint64, message, details, origin string) Error {
+	return Error{
+		Code:    code,
+		Message: message,
+		Details: details,
+		Origin:  origin,
+	}
+}
+
+func ErrSignatureMalformed(details string) Error {
+	return newSignatureError(ErrCodeSignatureMalformed, "Malformed signature", details, GetOrigin())
+}
+
+func ErrSignatureInvalid(details string) Error {
+	return newSignatureError(ErrCodeSignatureInvalid, "Invalid signature", details, GetOrigin())
+}
+
+func ErrSignatureExpired(details string) Error {
+	return newSignatureError(ErrCodeSignatureExpired, "Signature expired", details, GetOrigin())
+}
+
+func ErrNonceMismatch(details string) Error {
+	return newSignatureError(ErrCodeNonceMismatch, "Nonce mismatch", details, GetOrigin())
+}
+
+func ErrSignatureReplayed(details string) Error {
+	return newSignatureError(ErrCodeSignatureReplayed, "Signature already used", details, GetOrigin())
+}
+
+// signature schemes accepted for a typed message, eip191 is a personal_sign of the typed data hash
+const (
+	SignatureSchemeEip712 = "eip712"
+	SignatureSchemeEip191 = "eip191"
+)
+
+// ParseSignature joins the r, s, v hex values into a 65 byte signature, v is normalized to 0 or 1
+func ParseSignature(r, s, v string) ([]byte, error) {
+	signatureV, err := strconv.ParseUint(RemoveHex0xPrefix(v), 16, 64) // the value from raw metamask is messed up
+	if err != nil {
+		return nil, fmt.Errorf("invalid v value: %v", err)
+	}
+
+	signatureR, err := hex.DecodeString(RemoveHex0xPrefix(r))
+	if err != nil || len(signatureR) != 32 {
+		return nil, fmt.Errorf("invalid sig-r value: %v", r)
+	}
+
+	signatureS, err := hex.DecodeString(RemoveHex0xPrefix(s))
+	if err != nil || len(signatureS) != 32 {
+		return nil, fmt.Errorf("invalid sig-s value: %v", s)
+	}
+
+	if signatureV >= 27 {
+		signatureV -= 27
+	}
+	if signatureV > 1 {
+		return nil, fmt.Errorf("invalid v value: %v", v)
+	}
+
+	signature := append(signatureR, signatureS...)
+	return append(signature, byte(signatureV)), nil
+}
+
+// VerifyTypedMessage checks the expiry, the expected nonce and the signer of a typed message
+// the nonce is only compared here, it must still be consumed in the db
+func VerifyTypedMessage(message TypedMessage, signature []byte, address common.Address, expectedNonce uint64) error {
+	if err := checkExpiryAndNonce(message, expectedNonce); err != nil {
+		return err
+	}
+
+	ok, err := ValidateTypedDataSignature(NewTypedData(message), signature, address)
+	if err != nil {
+		return ErrSignatureMalformed(err.Error())
+	}
+	if !ok {
+		return ErrSignatureInvalid(fmt.Sprintf("%v not signed by %v", message.PrimaryType(), address.Hex()))
+	}
+	return nil
+}
+
+// VerifyPersonalTypedMessage is VerifyTypedMessage for wallets without eth_signTypedData_v4
+// the typed data hash is signed with personal_sign, so it is prefixed with the EthDomainHeader (EIP-191)
+func VerifyPersonalTypedMessage(message TypedMessage, signature []byte, address common.Address, expectedNonce uint64) error {
+	if err := checkExpiryAndNonce(message, expectedNonce); err != nil {
+		return err
+	}
+
+	hash, err := HashTypedData(NewTypedData(message))
+	if err != nil {
+		return ErrSignatureMalformed(err.Error())
+	}
+	ok, err := ValidateEvmEcdsaSignature(hash, signature, address)
+	if err != nil {
+		return ErrSignatureMalformed(err.Error())
+	}
+	if !ok {
+		return ErrSignatureInvalid(fmt.Sprintf("%v not signed by %v", message.PrimaryType(), address.Hex()))
+	}
+	return nil
+}
+
+func checkExpiryAndNonce(message TypedMessage, expectedNonce uint64) error {
+	if now := time.Now().Unix(); now > message.GetExpiry() {
+		return ErrSignatureExpired(fmt.Sprintf("%v expired at %v, now %v", message.PrimaryType(), message.GetExpiry(), now))
+	}
+
+	if message.GetNonce() != expectedNonce {
+		return ErrNonceMismatch(fmt.Sprintf("expected nonce %v, found %v", expectedNonce, message.GetNonce()))
+	}
+	return nil
+}
+
+// VerifyListenerSignature checks requests forwarded by the escrow listener, signed over keccak256(txHash)
+func VerifyListenerSignature(txHash, signature string) error {
+	listener := os.Getenv("EVM_ADDRESS")
+	if listener == "" {
+		return ErrInternal("EVM_ADDRESS is not set")
+	}
+
+	txHashBytes, err := hex.DecodeString(RemoveHex0xPrefix(txHash))
+	if err != nil {
+		return ErrSignatureMalformed(fmt.Sprintf("invalid tx hash: %v", err.Error()))
+	}
+	signatureBytes, err := hex.DecodeString(RemoveHex0xPrefix(signature))
+	if err != nil {
+		return ErrSignatureMalformed(fmt.Sprintf("invalid signature: %v", err.Error()))
+	}
+
+	ok, err := ValidateEvmEcdsaSignature(crypto.Keccak256(txHashBytes), signatureBytes, common.HexToAddress(listener))
+	if err != nil {
+		return ErrSignatureMalformed(err.Error())
+	}
+	if !ok {
+		return ErrSignatureInvalid("listener signature validation failed")
+	}
+	return nil
+}
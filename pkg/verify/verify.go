@@ -0,0 +1,99 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/db"
+	"github.com/BlueSpadeXchain/blp-api/pkg/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/supabase-community/supabase-go"
+)
+
+// every sign-* query and every listener forwarded request goes through this package
+// rejections are returned as utils.Error with the codes from pkg/utils/signature.go
+
+// UserAction verifies the users typed data signature, its expiry and nonce
+// the nonce is consumed by the rpc that applies the action, see ActionError
+func UserAction(user db.UserResponse, message utils.TypedMessage, r, s, v string) error {
+	return UserActionWithScheme(user, message, utils.SignatureSchemeEip712, r, s, v)
+}
+
+// UserActionWithScheme is UserAction for a typed message signed with eip712 or eip191, empty is eip712
+func UserActionWithScheme(user db.UserResponse, message utils.TypedMessage, scheme, r, s, v string) error {
+	signature, err := utils.ParseSignature(r, s, v)
+	if err != nil {
+		utils.LogError("invalid signature", err.Error())
+		return utils.ErrSignatureMalformed(err.Error())
+	}
+
+	address := common.HexToAddress("0x" + utils.RemoveHex0xPrefix(user.WalletAddress))
+	switch scheme {
+	case "", utils.SignatureSchemeEip712:
+		err = utils.VerifyTypedMessage(message, signature, address, user.Nonce)
+	case utils.SignatureSchemeEip191:
+		err = utils.VerifyPersonalTypedMessage(message, signature, address, user.Nonce)
+	default:
+		err = utils.ErrSignatureMalformed(fmt.Sprintf("invalid signature scheme: expected eip712 or eip191, found %v", scheme))
+	}
+	if err != nil {
+		utils.LogError("signature validation failed", err.Error())
+		return err
+	}
+	return nil
+}
+
+// SignatureExpiry returns the expiry stored with the signature request, the typed data is rebuilt with it
+// so an expiry echoed by the client is never trusted, an empty signatureId takes the latest request of referenceId
+func SignatureExpiry(client *supabase.Client, signatureId, referenceId string) (int64, error) {
+	request, err := db.GetSignatureRequest(client, signatureId, referenceId)
+	if err != nil {
+		return 0, utils.ErrInternal(err.Error())
+	}
+	if request == nil {
+		return 0, utils.ErrSignatureMalformed(fmt.Sprintf("no signature request found for signature %v, reference %v", signatureId, referenceId))
+	}
+	if referenceId != "" && request.ReferenceId != referenceId {
+		return 0, utils.ErrSignatureMalformed(fmt.Sprintf("signature %v does not belong to %v", signatureId, referenceId))
+	}
+
+	expiry, err := utils.ParseExpiryTime(request.ExpiryTime)
+	if err != nil {
+		return 0, utils.ErrInternal(err.Error())
+	}
+	if now := time.Now().Unix(); now > expiry {
+		return 0, utils.ErrSignatureExpired(fmt.Sprintf("signature request %v expired at %v, now %v", request.SignatureId, expiry, now))
+	}
+	return expiry, nil
+}
+
+// ActionError wraps the error of an rpc that applies a signed action
+// a nonce consumed by another request first is a replay, anything else is internal
+func ActionError(err error) utils.Error {
+	if strings.Contains(err.Error(), "already consumed or invalid") {
+		utils.LogError("nonce consumption failed", err.Error())
+		return utils.ErrSignatureReplayed(err.Error())
+	}
+	return utils.ErrInternal(err.Error())
+}
+
+// ListenerRequest verifies the signature of a request forwarded by the escrow listener
+// its tx hash is consumed by the rpc that applies the request, see ListenerError
+func ListenerRequest(txHash, signature string) error {
+	if err := utils.VerifyListenerSignature(txHash, signature); err != nil {
+		utils.LogError("listener signature validation failed", err.Error())
+		return err
+	}
+	return nil
+}
+
+// ListenerError wraps the error of an rpc that applies a listener request
+// a tx hash processed by another request first is a replay, anything else is internal
+func ListenerError(err error) utils.Error {
+	if strings.Contains(err.Error(), "already processed") {
+		utils.LogError("listener request replayed", err.Error())
+		return utils.ErrSignatureReplayed(err.Error())
+	}
+	return utils.ErrInternal(err.Error())
+}
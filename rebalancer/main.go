@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/pairs"
 	"github.com/BlueSpadeXchain/blp-api/rebalancer/rebalancer"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -117,6 +118,8 @@ func main() {
 		logrus.Error("supabase client connection failed: ", err.Error())
 	}
 
-	rebalancer.SubscribeToPriceStream(supabaseClient, url, rebalancer.PriceFeedIds)
+	go rebalancer.SweepExpiredOrders(supabaseClient, rebalancer.ExpirySweepIntervalFromEnv())
+
+	rebalancer.SubscribeToPriceStream(supabaseClient, url, pairs.FeedIds())
 
 }
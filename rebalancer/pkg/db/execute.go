@@ -5,13 +5,14 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
 	"github.com/BlueSpadeXchain/blp-api/rebalancer/pkg/utils"
 	"github.com/supabase-community/supabase-go"
 )
 
 func ProcessBatchOrders(client *supabase.Client, batchTimestamp time.Time, orderUpdates []OrderUpdate, globalUpdates OrderGlobalUpdate) error {
 	orderGlobalUpdateTuple := fmt.Sprintf(
-		"(%f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f, %f)",
+		"(%s, %s, %f, %f, %f, %s, %f, %f, %f, %f, %f, %f, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)",
 		globalUpdates.CurrentBorrowed,
 		globalUpdates.CurrentLiquidity,
 		globalUpdates.CurrentOrdersActive,
@@ -42,7 +43,8 @@ func ProcessBatchOrders(client *supabase.Client, batchTimestamp time.Time, order
 		"order_updates":        orderUpdates,
 		"order_global_update_": orderGlobalUpdateTuple, // Pass as a string
 	}
-	response := client.Rpc("process_batch_orders", "estimate", params) // parse, so we already know the count
+	// names the transition of every order, a status change the batch does not name is rejected
+	response := client.Rpc("process_batch_orders_with_transitions", "estimate", params) // parse, so we already know the count
 
 	var supabaseError SupabaseError
 	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
@@ -53,6 +55,141 @@ func ProcessBatchOrders(client *supabase.Client, batchTimestamp time.Time, order
 	return nil
 }
 
+// FillExitLevels writes the crossed ladder levels as partial fills, each fill is applied or rejected on its own
+func FillExitLevels(client *supabase.Client, fills []ExitLevelFill) (*[]ExitLevelFillResult, error) {
+	params := map[string]interface{}{
+		"p_fills": fills,
+	}
+
+	utils.LogInfo("fill_exit_levels params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("fill_exit_levels", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var results []ExitLevelFillResult
+	if err := json.Unmarshal([]byte(response), &results); err != nil {
+		return nil, fmt.Errorf("error unmarshalling exit level fills response: %v", err)
+	}
+
+	return &results, nil
+}
+
+// UpdateTrailingStops persists ratcheted trailing stops, stop prices and extremes match order ids by index
+func UpdateTrailingStops(client *supabase.Client, orderIds []string, stopPrices, trailExtremes []decimal.Decimal) error {
+	params := map[string]interface{}{
+		"p_order_ids":      orderIds,
+		"p_stop_prices":    stopPrices,
+		"p_trail_extremes": trailExtremes,
+	}
+
+	utils.LogInfo("update_trailing_stops params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("update_trailing_stops", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	return nil
+}
+
+// ArmStopLimitOrders persists the stop limits whose trigger was crossed, they fill like limits from then on
+func ArmStopLimitOrders(client *supabase.Client, orderIds []string) error {
+	params := map[string]interface{}{
+		"p_order_ids": orderIds,
+	}
+
+	utils.LogInfo("arm_stop_limit_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("arm_stop_limit_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	return nil
+}
+
+// SpawnAlgoSlices places the due slices of the active twap and scale orders of a pair, twap slices as market entries at markPrice
+func SpawnAlgoSlices(client *supabase.Client, pairId string, markPrice decimal.Decimal) (*[]OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id":    pairId,
+		"p_mark_price": markPrice,
+	}
+
+	utils.LogInfo("spawn_algo_slices params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("spawn_algo_slices", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []OrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling algo slice orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+// AccrueBorrowIndex brings the global borrow index up to now and resets the rate from the current utilization
+func AccrueBorrowIndex(client *supabase.Client) (*BorrowIndexResponse, error) {
+	params := map[string]interface{}{}
+
+	utils.LogInfo("accrue_borrow_index params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("accrue_borrow_index", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var index BorrowIndexResponse
+	if err := json.Unmarshal([]byte(response), &index); err != nil {
+		return nil, fmt.Errorf("error unmarshalling borrow index response: %v", err)
+	}
+
+	return &index, nil
+}
+
+// AccruePairFunding brings the pair funding index up to now and resets the rate from the current open interest
+func AccruePairFunding(client *supabase.Client, pairId string) (*PairFundingResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id": pairId,
+	}
+
+	utils.LogInfo("accrue_pair_funding params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("accrue_pair_funding", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var funding PairFundingResponse
+	if err := json.Unmarshal([]byte(response), &funding); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pair funding response: %v", err)
+	}
+
+	return &funding, nil
+}
+
 // func ProcessBatchOrders(client *supabase.Client, batchTimestamp time.Time, orderUpdates []OrderUpdate, globalUpdates OrderGlobalUpdate) error {
 // 	// Build array of order updates as ROW expressions
 // 	orderUpdatesArray := make([]string, len(orderUpdates))
@@ -179,3 +316,49 @@ func UpdateWithdrawalStatus(client *supabase.Client, withdrawalId, status, txHas
 
 	return &unstake, nil
 }
+
+// FillReduceOnlyOrders writes the triggered reduce-only orders as fills of their parents, each fill is applied or rejected on its own
+func FillReduceOnlyOrders(client *supabase.Client, fills []ReduceOnlyFill) (*[]ReduceOnlyFillResult, error) {
+	params := map[string]interface{}{
+		"p_fills": fills,
+	}
+
+	utils.LogInfo("fill_reduce_only_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("fill_reduce_only_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var results []ReduceOnlyFillResult
+	if err := json.Unmarshal([]byte(response), &results); err != nil {
+		return nil, fmt.Errorf("error unmarshalling reduce-only fills response: %v", err)
+	}
+
+	return &results, nil
+}
+
+// ExpireOrders cancels the limit orders past their expiry and expires stale unsigned orders and signature requests
+func ExpireOrders(client *supabase.Client) (*ExpiredOrdersResponse, error) {
+	params := map[string]interface{}{}
+
+	utils.LogInfo("expire_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("expire_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var expired ExpiredOrdersResponse
+	if err := json.Unmarshal([]byte(response), &expired); err != nil {
+		return nil, fmt.Errorf("error unmarshalling expire orders response: %v", err)
+	}
+
+	return &expired, nil
+}
@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
 	"github.com/BlueSpadeXchain/blp-api/rebalancer/pkg/utils"
 	"github.com/google/uuid"
 	"github.com/supabase-community/supabase-go"
 )
 
-func GetOrdersParsingRange(client *supabase.Client, pairId string, minPrice, maxPrice float64) (*[]OrderResponse, error) {
+func GetOrdersParsingRange(client *supabase.Client, pairId string, minPrice, maxPrice decimal.Decimal) (*[]OrderResponse, error) {
 	params := map[string]interface{}{
 		"pair_id_":   pairId,
 		"min_price_": minPrice,
@@ -36,6 +37,106 @@ func GetOrdersParsingRange(client *supabase.Client, pairId string, minPrice, max
 	return orders, nil
 }
 
+// GetTrailingOrders returns the open trailing stop orders of a pair, their stops move whether or not they are in range
+func GetTrailingOrders(client *supabase.Client, pairId string) (*[]OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id": pairId,
+	}
+
+	utils.LogInfo("get_trailing_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_trailing_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []OrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling trailing orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+// GetStopLimitOrders returns the stop limits of a pair not armed yet with a trigger between minPrice and maxPrice
+func GetStopLimitOrders(client *supabase.Client, pairId string, minPrice, maxPrice decimal.Decimal) (*[]OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id":   pairId,
+		"p_min_price": minPrice,
+		"p_max_price": maxPrice,
+	}
+
+	utils.LogInfo("get_stop_limit_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_stop_limit_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []OrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling stop limit orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+// GetExitLevelOrders returns the pending orders of a pair with an open exit level between minPrice and maxPrice
+func GetExitLevelOrders(client *supabase.Client, pairId string, minPrice, maxPrice decimal.Decimal) (*[]OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id":   pairId,
+		"p_min_price": minPrice,
+		"p_max_price": maxPrice,
+	}
+
+	utils.LogInfo("get_exit_level_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_exit_level_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []OrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling exit level orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+// GetOpenExitLevels returns the levels of the orders that have not filled yet
+func GetOpenExitLevels(client *supabase.Client, orderIds []string) (*[]ExitLevelResponse, error) {
+	params := map[string]interface{}{
+		"p_order_ids": orderIds,
+	}
+
+	utils.LogInfo("get_open_exit_levels params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_open_exit_levels", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var levels []ExitLevelResponse
+	if err := json.Unmarshal([]byte(response), &levels); err != nil {
+		return nil, fmt.Errorf("error unmarshalling open exit levels response: %v", err)
+	}
+
+	return &levels, nil
+}
+
 func GetGlobalStateMetrics(client *supabase.Client, metrics []string) (*[]GlobalStateResponse, error) {
 	params := map[string]interface{}{
 		"metrics": metrics,
@@ -62,6 +163,29 @@ func GetGlobalStateMetrics(client *supabase.Client, metrics []string) (*[]Global
 	return &metricsResponse, nil
 }
 
+func GetPairRiskParams(client *supabase.Client, pairId string) (*[]PairRiskParamsResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id": pairId,
+	}
+
+	utils.LogInfo("get_pair_risk_params params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_pair_risk_params", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var riskParams []PairRiskParamsResponse
+	if err := json.Unmarshal([]byte(response), &riskParams); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pair risk params response: %v", err)
+	}
+
+	return &riskParams, nil
+}
+
 func (o *OrderResponse) UnmarshalJSON(data []byte) error {
 	type Alias OrderResponse // Create alias to avoid recursion
 
@@ -107,3 +231,53 @@ func (o *OrderResponse) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// GetReduceOnlyParentOrders returns the pending orders of a pair with an open reduce-only order between minPrice and maxPrice
+func GetReduceOnlyParentOrders(client *supabase.Client, pairId string, minPrice, maxPrice decimal.Decimal) (*[]OrderResponse, error) {
+	params := map[string]interface{}{
+		"p_pair_id":   pairId,
+		"p_min_price": minPrice,
+		"p_max_price": maxPrice,
+	}
+
+	utils.LogInfo("get_reduce_only_parent_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_reduce_only_parent_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []OrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling reduce-only parent orders response: %v", err)
+	}
+
+	return &orders, nil
+}
+
+// GetOpenReduceOnlyOrders returns the open reduce-only orders of the parent orders
+func GetOpenReduceOnlyOrders(client *supabase.Client, parentIds []string) (*[]ReduceOnlyOrderResponse, error) {
+	params := map[string]interface{}{
+		"p_parent_ids": parentIds,
+	}
+
+	utils.LogInfo("get_open_reduce_only_orders params", utils.StringifyStructFields(params, ""))
+
+	response := client.Rpc("get_open_reduce_only_orders", "exact", params)
+
+	var supabaseError SupabaseError
+	if err := json.Unmarshal([]byte(response), &supabaseError); err == nil && supabaseError.Message != "" {
+		LogSupabaseError(supabaseError)
+		return nil, fmt.Errorf("supabase error: %v", supabaseError.Message)
+	}
+
+	var orders []ReduceOnlyOrderResponse
+	if err := json.Unmarshal([]byte(response), &orders); err != nil {
+		return nil, fmt.Errorf("error unmarshalling open reduce-only orders response: %v", err)
+	}
+
+	return &orders, nil
+}
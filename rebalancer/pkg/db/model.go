@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
 	"github.com/google/uuid"
 )
 
@@ -18,59 +19,69 @@ type SupabaseError struct {
 }
 
 type OrderResponse struct {
-	ID                   uuid.UUID `json:"id"`
-	UserID               string    `json:"userid"`
-	OrderType            string    `json:"order_type"`
-	Leverage             float64   `json:"leverage"`
-	Pair                 string    `json:"pair"`
-	PairID               string    `json:"pair_id"`
-	OrderStatus          string    `json:"status"`
-	Collateral           float64   `json:"collateral"`
-	EntryPrice           float64   `json:"entry_price"`
-	ClosePrice           float64   `json:"close_price"`
-	LiquidationPrice     float64   `json:"liq_price"`
-	MaxPrice             float64   `json:"max_price"`
-	MaxValue             float64   `json:"max_value"`
-	LimitPrice           float64   `json:"limit_price"`
-	StopLossPrice        float64   `json:"stop_price"`
-	TakeProfitPrice      float64   `json:"tp_price"`
-	TakeProfitValue      float64   `json:"tp_value"`
-	TakeProfitCollateral float64   `json:"tp_collateral"`
-	CreatedAt            time.Time `json:"created_at"`
-	SignedAt             time.Time `json:"signed_at"`
-	StartedAt            time.Time `json:"started_at"`
-	ModifiedAt           time.Time `json:"modified_at"`
-	TakeProfitAt         time.Time `json:"tp_at"`
-	EndedAt              time.Time `json:"ended_at"`
-	ProfitAndLoss        float64   `json:"pnl"`
-	OpenFee              float64   `json:"open_fee"`
-	CloseFee             float64   `json:"close_fee"`
+	ID                   uuid.UUID       `json:"id"`
+	UserID               string          `json:"userid"`
+	OrderType            string          `json:"order_type"`
+	Leverage             decimal.Decimal `json:"leverage"`
+	Pair                 string          `json:"pair"`
+	PairID               string          `json:"pair_id"`
+	OrderStatus          string          `json:"status"`
+	Collateral           decimal.Decimal `json:"collateral"`
+	EntryPrice           decimal.Decimal `json:"entry_price"`
+	ClosePrice           decimal.Decimal `json:"close_price"`
+	LiquidationPrice     decimal.Decimal `json:"liq_price"`
+	MaxPrice             decimal.Decimal `json:"max_price"`
+	MaxValue             decimal.Decimal `json:"max_value"`
+	LimitPrice           decimal.Decimal `json:"limit_price"`
+	StopLossPrice        decimal.Decimal `json:"stop_price"`
+	TakeProfitPrice      decimal.Decimal `json:"tp_price"`
+	TakeProfitValue      decimal.Decimal `json:"tp_value"`
+	TakeProfitCollateral decimal.Decimal `json:"tp_collateral"`
+	CreatedAt            time.Time       `json:"created_at"`
+	SignedAt             time.Time       `json:"signed_at"`
+	StartedAt            time.Time       `json:"started_at"`
+	ModifiedAt           time.Time       `json:"modified_at"`
+	TakeProfitAt         time.Time       `json:"tp_at"`
+	EndedAt              time.Time       `json:"ended_at"`
+	ProfitAndLoss        decimal.Decimal `json:"pnl"`
+	OpenFee              decimal.Decimal `json:"open_fee"`
+	CloseFee             decimal.Decimal `json:"close_fee"`
+	FundingIndex         decimal.Decimal `json:"funding_index"`
+	FundingOwed          decimal.Decimal `json:"funding_owed"`
+	BorrowIndex          decimal.Decimal `json:"borrow_index"`
+	TrailAmount          decimal.Decimal `json:"trail_amount"`
+	TrailPercent         decimal.Decimal `json:"trail_percent"`
+	TrailExtreme         decimal.Decimal `json:"trail_extreme"` // zero when the stop does not trail
+	ExpiresAt            time.Time       `json:"expires_at"`    // zero for good-till-canceled
+	EntryType            string          `json:"entry_type"`
+	TriggerPrice         decimal.Decimal `json:"trigger_price"` // stop limits only
+	TriggeredAt          time.Time       `json:"triggered_at"`  // zero until a stop limit is armed
 }
 
 type OrderGlobalUpdate struct {
-	CurrentBorrowed       float64 `json:"current_borrowed"`
-	CurrentLiquidity      float64 `json:"current_liquidity"`
-	CurrentOrdersActive   float64 `json:"current_orders_active"`
-	CurrentOrdersLimit    float64 `json:"current_orders_limit"`
-	CurrentOrdersPending  float64 `json:"current_orders_pending"`
-	TotalBorrowed         float64 `json:"total_borrowed"`
-	TotalLiquidations     float64 `json:"total_liquidations"`
-	TotalOrdersActive     float64 `json:"total_orders_active"`
-	TotalOrdersFilled     float64 `json:"total_orders_filled"`
-	TotalOrdersLimit      float64 `json:"total_orders_limit"`
-	TotalOrdersLiquidated float64 `json:"total_orders_liquidated"`
-	TotalOrdersStopped    float64 `json:"total_orders_stopped"`
-	TotalPnlLosses        float64 `json:"total_pnl_losses"`
-	TotalPnlProfits       float64 `json:"total_pnl_profits"`
-	TotalRevenue          float64 `json:"total_revenue"`
-	TreasuryBalance       float64 `json:"treasury_balance"`
-	TotalTreasuryProfits  float64 `json:"total_treasury_profits"`
-	VaultBalance          float64 `json:"vault_balance"`
-	TotalVaultProfits     float64 `json:"total_vault_profits"`
-	TotalBlpRewards       float64 `json:"total_blp_rewards"`
-	TotalBluRewards       float64 `json:"total_blu_rewards"`
-	CurrentBlpRewards     float64 `json:"current_blp_rewards"`
-	CurrentBluRewards     float64 `json:"current_blu_rewards"`
+	CurrentBorrowed       decimal.Decimal `json:"current_borrowed"`
+	CurrentLiquidity      decimal.Decimal `json:"current_liquidity"`
+	CurrentOrdersActive   float64         `json:"current_orders_active"`
+	CurrentOrdersLimit    float64         `json:"current_orders_limit"`
+	CurrentOrdersPending  float64         `json:"current_orders_pending"`
+	TotalBorrowed         decimal.Decimal `json:"total_borrowed"`
+	TotalLiquidations     float64         `json:"total_liquidations"`
+	TotalOrdersActive     float64         `json:"total_orders_active"`
+	TotalOrdersFilled     float64         `json:"total_orders_filled"`
+	TotalOrdersLimit      float64         `json:"total_orders_limit"`
+	TotalOrdersLiquidated float64         `json:"total_orders_liquidated"`
+	TotalOrdersStopped    float64         `json:"total_orders_stopped"`
+	TotalPnlLosses        decimal.Decimal `json:"total_pnl_losses"`
+	TotalPnlProfits       decimal.Decimal `json:"total_pnl_profits"`
+	TotalRevenue          decimal.Decimal `json:"total_revenue"`
+	TreasuryBalance       decimal.Decimal `json:"treasury_balance"`
+	TotalTreasuryProfits  decimal.Decimal `json:"total_treasury_profits"`
+	VaultBalance          decimal.Decimal `json:"vault_balance"`
+	TotalVaultProfits     decimal.Decimal `json:"total_vault_profits"`
+	TotalBlpRewards       decimal.Decimal `json:"total_blp_rewards"`
+	TotalBluRewards       decimal.Decimal `json:"total_blu_rewards"`
+	CurrentBlpRewards     decimal.Decimal `json:"current_blp_rewards"`
+	CurrentBluRewards     decimal.Decimal `json:"current_blu_rewards"`
 }
 
 // OrderUpdate represents the PostgreSQL order_update type
@@ -78,15 +89,21 @@ type OrderUpdate struct {
 	OrderID             uuid.UUID         `json:"order_id"`
 	UserID              string            `json:"userid"`
 	Status              string            `json:"status"`
-	EntryPrice          float64           `json:"entry_price"`
-	ClosePrice          float64           `json:"close_price"`
-	TpValue             float64           `json:"tp_value"`
-	Pnl                 float64           `json:"pnl"`
-	Collateral          float64           `json:"collateral"`
+	Action              string            `json:"action"` // the pkg/orderstate transition, see process_batch_orders_with_transitions
+	Actor               string            `json:"actor"`
+	EntryPrice          decimal.Decimal   `json:"entry_price"`
+	ClosePrice          decimal.Decimal   `json:"close_price"`
+	TpValue             decimal.Decimal   `json:"tp_value"`
+	Pnl                 decimal.Decimal   `json:"pnl"`
+	Collateral          decimal.Decimal   `json:"collateral"`
 	TakeProfitAt        time.Time         `json:"tp_at"`
-	BalanceChange       float64           `json:"balance_change"`
-	EscrowBalanceChange float64           `json:"escrow_balance_change"`
+	BalanceChange       decimal.Decimal   `json:"balance_change"`
+	EscrowBalanceChange decimal.Decimal   `json:"escrow_balance_change"`
 	OrderGlobalUpdate   OrderGlobalUpdate `json:"order_global_update"`
+	FundingPaid         decimal.Decimal   `json:"funding_paid"` // recorded by process_batch_orders_with_transitions
+	LiqPrice            decimal.Decimal   `json:"liq_price"`    // set when an entry triggers, recorded by process_batch_orders_with_transitions
+	MaxPrice            decimal.Decimal   `json:"max_price"`
+	TransitionError     error             `json:"-"` // illegal status change, the batch is not sent
 }
 
 func (ou OrderUpdate) Value() (driver.Value, error) {
@@ -103,29 +120,75 @@ func (ou *OrderUpdate) Scan(value interface{}) error {
 }
 
 type GlobalStateResponse struct {
-	Key       string  `json:"key"`
-	Value     float64 `json:"value"`
-	UpdatedAt string  `json:"updated_at"`
+	Key       string          `json:"key"`
+	Value     decimal.Decimal `json:"value"`
+	UpdatedAt string          `json:"updated_at"`
+}
+
+// PairRiskParamsResponse holds the pair_risk_params fields the rebalancer charges fees with
+type PairRiskParamsResponse struct {
+	PairId                   string          `json:"pair_id"`
+	LeverageFeeMultiplier    decimal.Decimal `json:"leverage_fee_multiplier"`
+	UtilizationFeeMultiplier decimal.Decimal `json:"utilization_fee_multiplier"`
+}
+
+// ExitLevelResponse is an open take profit or stop loss level of a ladder
+type ExitLevelResponse struct {
+	ID         uuid.UUID       `json:"id"`
+	OrderID    uuid.UUID       `json:"orderid"`
+	Kind       string          `json:"kind"` // "tp" or "sl"
+	Price      decimal.Decimal `json:"price"`
+	Collateral decimal.Decimal `json:"collateral"`
+}
+
+// ExitLevelFill is a crossed level closed at its price, written by fill_exit_levels
+type ExitLevelFill struct {
+	ExitLevelId     uuid.UUID       `json:"exit_level_id"`
+	CloseCollateral decimal.Decimal `json:"close_collateral"`
+	Payout          decimal.Decimal `json:"payout"`
+	CloseFee        decimal.Decimal `json:"close_fee"`
+	ClosePrice      decimal.Decimal `json:"close_price"`
+	CloseValue      decimal.Decimal `json:"close_value"`
+	Funding         decimal.Decimal `json:"funding"`
+}
+
+type ExitLevelFillResult struct {
+	ExitLevelId  string `json:"exit_level_id"`
+	IsValid      bool   `json:"is_valid"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// BorrowIndexResponse holds the borrow_index fields the rebalancer charges borrow fees with
+type BorrowIndexResponse struct {
+	BorrowRate            decimal.Decimal `json:"borrow_rate"`
+	CumulativeBorrowIndex decimal.Decimal `json:"cumulative_borrow_index"`
+}
+
+// PairFundingResponse holds the pair_funding fields the rebalancer settles funding with
+type PairFundingResponse struct {
+	PairId                 string          `json:"pair_id"`
+	FundingRate            decimal.Decimal `json:"funding_rate"`
+	CumulativeFundingIndex decimal.Decimal `json:"cumulative_funding_index"`
 }
 
 type StakeDepositResponse struct {
-	ID        string     `json:"id"`
-	Userid    string     `json:"userid"`
-	StakeType string     `json:"stake_type"`
-	Amount    float64    `json:"amount"`
-	CreatedAt CustomTime `json:"created_at"`
+	ID        string          `json:"id"`
+	Userid    string          `json:"userid"`
+	StakeType string          `json:"stake_type"`
+	Amount    decimal.Decimal `json:"amount"`
+	CreatedAt CustomTime      `json:"created_at"`
 }
 
 type PendingWithdrawalResponse struct {
-	ID            string     `json:"id"`
-	Userid        string     `json:"userid"`
-	Amount        float64    `json:"amount"`
-	TokenType     string     `json:"token_type"`
-	Status        string     `json:"status"`
-	CreatedAt     CustomTime `json:"created_at"`
-	UpdatedAt     CustomTime `json:"updated_at"`
-	TxHash        string     `json:"tx_hash"`
-	WalletAddress string     `json:"wallet_address"`
+	ID            string          `json:"id"`
+	Userid        string          `json:"userid"`
+	Amount        decimal.Decimal `json:"amount"`
+	TokenType     string          `json:"token_type"`
+	Status        string          `json:"status"`
+	CreatedAt     CustomTime      `json:"created_at"`
+	UpdatedAt     CustomTime      `json:"updated_at"`
+	TxHash        string          `json:"tx_hash"`
+	WalletAddress string          `json:"wallet_address"`
 }
 
 type ProcessUnstakeResponse struct {
@@ -161,3 +224,38 @@ func (ct *CustomTime) UnmarshalJSON(b []byte) error {
 
 	return fmt.Errorf("error parsing time: %v", err)
 }
+
+// ReduceOnlyOrderResponse is an open reduce-only order closing part or all of its parent position
+type ReduceOnlyOrderResponse struct {
+	ID           uuid.UUID       `json:"id"`
+	ParentID     uuid.UUID       `json:"parent_id"`
+	Kind         string          `json:"kind"` // "tp" or "sl"
+	TriggerPrice decimal.Decimal `json:"trigger_price"`
+	ClosePercent decimal.Decimal `json:"close_percent"`
+	OcoGroup     uuid.UUID       `json:"oco_group"` // uuid.Nil when not linked
+}
+
+// ReduceOnlyFill is a triggered reduce-only order closed at its trigger price, written by fill_reduce_only_orders
+type ReduceOnlyFill struct {
+	ReduceOnlyOrderId uuid.UUID       `json:"reduce_only_order_id"`
+	CloseCollateral   decimal.Decimal `json:"close_collateral"`
+	Payout            decimal.Decimal `json:"payout"`
+	CloseFee          decimal.Decimal `json:"close_fee"`
+	ClosePrice        decimal.Decimal `json:"close_price"`
+	CloseValue        decimal.Decimal `json:"close_value"`
+	Funding           decimal.Decimal `json:"funding"`
+}
+
+type ReduceOnlyFillResult struct {
+	ReduceOnlyOrderId string `json:"reduce_only_order_id"`
+	IsValid           bool   `json:"is_valid"`
+	ErrorMessage      string `json:"error_message"`
+}
+
+// ExpiredOrdersResponse counts what a sweep of expire_orders expired
+type ExpiredOrdersResponse struct {
+	ExpiredLimitOrders    int             `json:"expired_limit_orders"`
+	ReleasedCollateral    decimal.Decimal `json:"released_collateral"`
+	ExpiredUnsignedOrders int             `json:"expired_unsigned_orders"`
+	ExpiredSignatures     int             `json:"expired_signatures"`
+}
@@ -28,9 +28,12 @@ func StringifyStructFields(params interface{}, indent string) string {
 			fieldType := typ.Field(i)
 			fieldName := fieldType.Name
 
-			// Handle nested types
-			switch field.Kind() {
-			case reflect.Struct, reflect.Map:
+			// Handle nested types, values such as decimals print themselves
+			_, isStringer := field.Interface().(fmt.Stringer)
+			switch {
+			case isStringer:
+				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m: %v", indent, fieldName, field.Interface()))
+			case field.Kind() == reflect.Struct, field.Kind() == reflect.Map:
 				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m:\n", indent, fieldName))
 				nestedResult := StringifyStructFields(field.Interface(), indent+"  ")
 				result.WriteString(nestedResult)
@@ -49,8 +52,11 @@ func StringifyStructFields(params interface{}, indent string) string {
 			keyStr := fmt.Sprintf("%v", k.Interface())
 
 			// Handle nested types in map values
-			switch v.Kind() {
-			case reflect.Struct, reflect.Map:
+			_, isStringer := v.Interface().(fmt.Stringer)
+			switch {
+			case isStringer:
+				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m: %v", indent, keyStr, v.Interface()))
+			case v.Kind() == reflect.Struct, v.Kind() == reflect.Map:
 				result.WriteString(fmt.Sprintf("\n%s\033[1m%s\033[0m:\n", indent, keyStr))
 				nestedResult := StringifyStructFields(v.Interface(), indent+"  ")
 				result.WriteString(nestedResult)
@@ -1,14 +0,0 @@
-package rebalancer
-
-var PriceFeedIds = []string{
-	"e62df6c8b4a85fe1a67db44dc12de5db330f7ac66b72dc658afedf0f4a415b43", // BTC/USD
-	"ff61491a931112ddf1bd8147cd1b641375f79f5825126d665480874634fd0ace", // ETH/USD
-	"ffff73128917a90950cd0473fd2551d7cd274fd5a6cc45641881bbcc6ee73417", // MOODENG/USD
-	"2f95862b045670cd22bee3114c39763a4a08beeb663b145d283c31d7d1101c4f", // BNB/USD
-	"ef0d8b6fda2ceba41da15d4095d1da392a0d2f8ed0c6c7bc0f4cfac8c280b56d", // SOL/USD
-	"dcef50dd0a4cd2dcc17e45df1676dcb336a11a61c69df7a0299b0150c672d25c", // DOGE/USD
-	"23d7315113f5b1d3ba7a83604c44b94d79f4fd69af77f804fc7f920a6dc65744", // SUI/USD
-	"879551021853eec7a7dc827578e8e69da7e4fa8148339aa0d3d5296405be4b1a", // TRUMP/USD
-	"72b021217ca3fe68922a19aaf990109cb9d84e9ad004b4d2025ad6f529314419", // BONK/USD
-	"116da895807f81f6b5c5f01b109376e7f6834dc8b51365ab7cdfa66634340e54", // PNUT/USD
-}
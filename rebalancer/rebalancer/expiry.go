@@ -0,0 +1,51 @@
+package rebalancer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BlueSpadeXchain/blp-api/pkg/orderstate"
+	"github.com/BlueSpadeXchain/blp-api/rebalancer/pkg/db"
+	"github.com/sirupsen/logrus"
+	"github.com/supabase-community/supabase-go"
+)
+
+// expired limit orders, unsigned orders and signature requests are swept by expire_orders (db/orders/order_expiry.sql)
+// between sweeps processOrders skips limit orders past their expiry so they cannot fill late
+
+const DefaultExpirySweepInterval = time.Minute
+
+// ExpirySweepIntervalFromEnv reads EXPIRY_SWEEP_INTERVAL in seconds
+func ExpirySweepIntervalFromEnv() time.Duration {
+	if interval := os.Getenv("EXPIRY_SWEEP_INTERVAL"); interval != "" {
+		if seconds, err := strconv.ParseInt(interval, 10, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return DefaultExpirySweepInterval
+}
+
+// SweepExpiredOrders runs expire_orders every interval, a failed sweep is retried on the next tick
+func SweepExpiredOrders(supabaseClient *supabase.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := db.ExpireOrders(supabaseClient)
+		if err != nil {
+			logrus.Error(fmt.Sprintf("Error expiring orders: %v", err.Error()))
+			continue
+		}
+		if expired.ExpiredLimitOrders > 0 || expired.ExpiredUnsignedOrders > 0 || expired.ExpiredSignatures > 0 {
+			logrus.Info(fmt.Sprintf("expired %d limit orders (%v collateral released), %d unsigned orders, %d signature requests",
+				expired.ExpiredLimitOrders, expired.ReleasedCollateral, expired.ExpiredUnsignedOrders, expired.ExpiredSignatures))
+		}
+	}
+}
+
+// limitExpired reports whether a limit order is past its good-till-time and waiting to be swept
+func limitExpired(order *db.OrderResponse, now time.Time) bool {
+	return order.OrderStatus == orderstate.Limit && !order.ExpiresAt.IsZero() && !now.Before(order.ExpiresAt)
+}
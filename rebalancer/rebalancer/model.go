@@ -1,5 +1,10 @@
 package rebalancer
 
+import (
+	"github.com/BlueSpadeXchain/blp-api/pkg/hermes"
+	"github.com/BlueSpadeXchain/blp-api/pkg/oracle"
+)
+
 // Price contains price information along with confidence and exponent
 type Price struct {
 	Price       string `json:"price"`
@@ -34,3 +39,16 @@ type Response struct {
 	Binary BinaryData    `json:"binary"`
 	Parsed []PriceUpdate `json:"parsed"`
 }
+
+// oracleUpdates returns the prices to validate, only the prices proven by the binary update are used
+func (r Response) oracleUpdates(guardians *hermes.GuardianSet) ([]oracle.PriceUpdate, error) {
+	prices, err := hermes.VerifyHex(r.Binary.Data, guardians)
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]oracle.PriceUpdate, 0, len(prices))
+	for _, price := range prices {
+		updates = append(updates, price.PriceUpdate())
+	}
+	return updates, nil
+}
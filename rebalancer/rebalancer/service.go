@@ -5,12 +5,20 @@ import (
 	"fmt"
 	"math"
 	"net/http"
-	"strconv"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/BlueSpadeXchain/blp-api/pkg/decimal"
+	"github.com/BlueSpadeXchain/blp-api/pkg/entry"
+	"github.com/BlueSpadeXchain/blp-api/pkg/funding"
+	"github.com/BlueSpadeXchain/blp-api/pkg/hermes"
+	"github.com/BlueSpadeXchain/blp-api/pkg/oracle"
+	"github.com/BlueSpadeXchain/blp-api/pkg/orderstate"
+	"github.com/BlueSpadeXchain/blp-api/pkg/trailing"
 	"github.com/BlueSpadeXchain/blp-api/rebalancer/pkg/db"
 	"github.com/BlueSpadeXchain/blp-api/rebalancer/pkg/utils"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/supabase-community/supabase-go"
 )
@@ -23,32 +31,158 @@ func getBaseFee() float64 {
 	return 0.001
 }
 
-func getPerHourFee() float64 {
-	return 0.0001
-}
+// closing and opening fees are split between the treasury, the vault and the BLP/BLU rewards
+var (
+	treasuryFeeShare = decimal.RequireFromString("0.1")
+	vaultFeeShare    = decimal.RequireFromString("0.1")
+	blpFeeShare      = decimal.RequireFromString("0.5")
+	bluFeeShare      = decimal.RequireFromString("0.3")
+)
 
-func dynamicLeverageFee(leverage float64) float64 {
+func dynamicLeverageFee(leverage decimal.Decimal) decimal.Decimal {
 	//fee percent = 1/ (1+ scaling factor * log(leverage)) * base fee / 100
-	return 1 / (1 + getFeeScalingFactor()*math.Log(leverage)) * getBaseFee()
+	return decimal.NewFromFloat(1 / (1 + getFeeScalingFactor()*math.Log(leverage.Float64())) * getBaseFee())
 }
 
-func dynamicUtilizationFee(startTimestamp time.Time, globalBorrowed, globalLiquidity float64) float64 {
-	elapsedTime := time.Since(startTimestamp.UTC()).Seconds()
+// borrowFee is the utilization fee rate accrued since the position opened, from the cumulative borrow index (db/global/borrow_index.sql)
+func borrowFee(entryIndex, index decimal.Decimal) decimal.Decimal {
+	if index.LessThan(entryIndex) {
+		return decimal.Zero
+	}
+	return index.Sub(entryIndex)
+}
 
-	return getPerHourFee() * (elapsedTime / 3600) * globalBorrowed / globalLiquidity
+// pairFees are the per pair fee multipliers from pair_risk_params, the api charges the same fees on open and close
+// with the borrow and pair funding indexes accrued for this cycle, fundingAccrued is false when the accrual failed and no funding is settled
+// a cycle whose borrow index cannot accrue is skipped, see processOrders
+type pairFees struct {
+	leverageMultiplier    decimal.Decimal
+	utilizationMultiplier decimal.Decimal
+	borrowIndex           decimal.Decimal
+	fundingIndex          decimal.Decimal
+	fundingAccrued        bool
 }
 
-func getCurrentBorrowAndLiquidity(supabaseClient *supabase.Client) (float64, float64, error) {
+// getPairFees falls back to the base fees when the pair has no row or the fetch fails
+func getPairFees(supabaseClient *supabase.Client, pairId string) pairFees {
+	fees := pairFees{leverageMultiplier: decimal.One, utilizationMultiplier: decimal.One}
+
+	riskParams, err := db.GetPairRiskParams(supabaseClient, pairId)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not fetch risk params for pair id %v, using base fees: %v", pairId, err))
+		return fees
+	}
+	for _, params := range *riskParams {
+		if params.PairId == pairId {
+			fees.leverageMultiplier = params.LeverageFeeMultiplier
+			fees.utilizationMultiplier = params.UtilizationFeeMultiplier
+		}
+	}
+	return fees
+}
+
+// accrueBorrowIndex brings the global borrow index up to now, orders closed this cycle pay the utilization fee against it
+func (f *pairFees) accrueBorrowIndex(supabaseClient *supabase.Client) bool {
+	borrowIndex, err := db.AccrueBorrowIndex(supabaseClient)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not accrue the borrow index: %v", err))
+		return false
+	}
+	f.borrowIndex = borrowIndex.CumulativeBorrowIndex
+	return true
+}
+
+// accrueFunding brings the pair funding index up to now, orders closed this cycle settle funding against it
+func (f *pairFees) accrueFunding(supabaseClient *supabase.Client, pairId string) {
+	pairFunding, err := db.AccruePairFunding(supabaseClient, pairId)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not accrue funding for pair id %v, no funding settled this cycle: %v", pairId, err))
+		return
+	}
+	f.fundingIndex = pairFunding.CumulativeFundingIndex
+	f.fundingAccrued = true
+}
+
+// liveCollateral is the collateral still open, without the share closed by a take profit fill
+func liveCollateral(order *db.OrderResponse) decimal.Decimal {
+	if !order.TakeProfitAt.IsZero() {
+		return order.Collateral.Sub(order.TakeProfitCollateral)
+	}
+	return order.Collateral
+}
+
+// fundingShare returns the share of the accrued funding closed with closedCollateral, negative when the position receives funding
+// the order keeps owing the rest from the current index, the same roll the orders2 trigger applies
+func (f pairFees) fundingShare(order *db.OrderResponse, closedCollateral decimal.Decimal) decimal.Decimal {
+	if !f.fundingAccrued {
+		return decimal.Zero
+	}
+	live := liveCollateral(order)
+	accrued := funding.Accrued(order.OrderType, live.Mul(order.Leverage), order.FundingIndex, f.fundingIndex, order.FundingOwed)
+	share := funding.Share(accrued, closedCollateral, live)
+
+	order.FundingOwed = accrued.Sub(share)
+	order.FundingIndex = f.fundingIndex
+	return share
+}
+
+// settleFunding is fundingShare for fills of the batch, recorded by the batch with the payout
+func (f pairFees) settleFunding(order *db.OrderResponse, orderUpdate *db.OrderUpdate, closedCollateral decimal.Decimal) decimal.Decimal {
+	share := f.fundingShare(order, closedCollateral)
+	orderUpdate.FundingPaid = orderUpdate.FundingPaid.Add(share)
+	return share
+}
+
+func (f pairFees) leverageFee(leverage decimal.Decimal) decimal.Decimal {
+	return dynamicLeverageFee(leverage).Mul(f.leverageMultiplier)
+}
+
+func (f pairFees) utilizationFee(order *db.OrderResponse) decimal.Decimal {
+	return borrowFee(order.BorrowIndex, f.borrowIndex).Mul(f.utilizationMultiplier)
+}
+
+// typeMultiplier is 1 for longs and -1 for shorts
+func typeMultiplier(orderType string) decimal.Decimal {
+	if orderType == "long" {
+		return decimal.One
+	}
+	return decimal.One.Neg()
+}
+
+// priceReturn is the signed relative move from the entry price to price
+func priceReturn(order *db.OrderResponse, price decimal.Decimal) decimal.Decimal {
+	return price.Sub(order.EntryPrice).Mul(typeMultiplier(order.OrderType)).Div(order.EntryPrice)
+}
+
+// addFee books the fee as revenue and splits it, each share is rounded to the stored precision
+func addFee(globalUpdate *db.OrderGlobalUpdate, fee decimal.Decimal) {
+	treasuryShare := fee.Mul(treasuryFeeShare).RoundUsd()
+	vaultShare := fee.Mul(vaultFeeShare).RoundUsd()
+	blpShare := fee.Mul(blpFeeShare).RoundUsd()
+	bluShare := fee.Mul(bluFeeShare).RoundUsd()
+
+	globalUpdate.TotalRevenue = globalUpdate.TotalRevenue.Add(fee)
+	globalUpdate.TreasuryBalance = globalUpdate.TreasuryBalance.Add(treasuryShare)
+	globalUpdate.TotalTreasuryProfits = globalUpdate.TotalTreasuryProfits.Add(treasuryShare)
+	globalUpdate.VaultBalance = globalUpdate.VaultBalance.Add(vaultShare)
+	globalUpdate.TotalVaultProfits = globalUpdate.TotalVaultProfits.Add(vaultShare)
+	globalUpdate.TotalBlpRewards = globalUpdate.TotalBlpRewards.Add(blpShare)
+	globalUpdate.TotalBluRewards = globalUpdate.TotalBluRewards.Add(bluShare)
+	globalUpdate.CurrentBlpRewards = globalUpdate.CurrentBlpRewards.Add(blpShare)
+	globalUpdate.CurrentBluRewards = globalUpdate.CurrentBluRewards.Add(bluShare)
+}
+
+func getCurrentBorrowAndLiquidity(supabaseClient *supabase.Client) (decimal.Decimal, decimal.Decimal, error) {
 	result, err := db.GetGlobalStateMetrics(supabaseClient, []string{"current_borrowed", "current_liquidity"})
 	if err != nil {
 		logrus.Error(err.Error())
-		return 0, 0, err
+		return decimal.Zero, decimal.Zero, err
 	}
 	if result == nil || len(*result) != 2 {
-		return 0, 0, fmt.Errorf("unexpected response from GetGlobalStateMetrics: %v", err)
+		return decimal.Zero, decimal.Zero, fmt.Errorf("unexpected response from GetGlobalStateMetrics: %v", err)
 	}
 
-	var currentBorrowed, currentLiquidity float64
+	var currentBorrowed, currentLiquidity decimal.Decimal
 	for _, metric := range *result {
 		switch metric.Key {
 		case "current_borrowed":
@@ -77,387 +211,840 @@ func printProcessedOrder(order db.OrderResponse, orderUpdate db.OrderUpdate) {
 }
 
 // order type assumed (not checked) short/long
-func processOrderTakeProfit(globalBorrowed, globalLiquidity, payout, closeFee *float64, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
+func processOrderTakeProfit(fees pairFees, globalBorrowed, globalLiquidity, payout, closeFee *decimal.Decimal, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
 	logrus.Info(fmt.Sprintf("processing %s take profit order", order.OrderType))
 
-	typeMultiplier := map[bool]float64{true: 1, false: -1}[order.OrderType == "long"]
-
-	value := order.TakeProfitCollateral * order.Leverage * (1 + (order.TakeProfitPrice-order.EntryPrice)*typeMultiplier/order.EntryPrice)
-	*closeFee = order.TakeProfitCollateral * (dynamicLeverageFee(order.Leverage) + dynamicUtilizationFee(order.StartedAt, *globalBorrowed, *globalLiquidity))
-	*payout += value - *closeFee - order.TakeProfitCollateral*(order.Leverage-1)
-	order.TakeProfitValue = 0 // reset tpValue, indication of tp fill
-	orderUpdate.Status = "pending"
+	value := order.TakeProfitCollateral.Mul(order.Leverage).Mul(decimal.One.Add(priceReturn(order, order.TakeProfitPrice))).RoundUsd()
+	borrowed := order.TakeProfitCollateral.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+	*closeFee = order.TakeProfitCollateral.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+	fundingPaid := fees.settleFunding(order, orderUpdate, order.TakeProfitCollateral)
+	*payout = payout.Add(value.Sub(*closeFee).Sub(borrowed).Sub(fundingPaid))
+	order.TakeProfitValue = decimal.Zero
+	order.TakeProfitAt = time.Now() // indication of tp fill, as tp_at in orders2
+	setStatus(order, orderUpdate, orderstate.Pending, orderstate.TakeProfit)
 	orderUpdate.EntryPrice = order.EntryPrice
-	orderUpdate.ClosePrice = 0
-	orderUpdate.TpValue = 0
-	orderUpdate.Pnl += *payout
+	orderUpdate.ClosePrice = decimal.Zero
+	orderUpdate.TpValue = decimal.Zero
+	orderUpdate.Pnl = orderUpdate.Pnl.Add(*payout)
 	orderUpdate.Collateral = order.Collateral
-	orderUpdate.TakeProfitAt = time.Now()
-
-	*globalBorrowed -= order.TakeProfitCollateral * (order.Leverage - 1)
-	*globalLiquidity -= value
-
-	orderUpdate.OrderGlobalUpdate.CurrentBorrowed -= order.TakeProfitCollateral * (order.Leverage - 1)
-	orderUpdate.OrderGlobalUpdate.CurrentLiquidity -= value
-	orderUpdate.OrderGlobalUpdate.TotalPnlProfits += *payout
-	orderUpdate.OrderGlobalUpdate.TotalRevenue += *closeFee
-	orderUpdate.OrderGlobalUpdate.TreasuryBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalTreasuryProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.VaultBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalVaultProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.TotalBluRewards += *closeFee * 0.3
-	orderUpdate.OrderGlobalUpdate.CurrentBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.CurrentBluRewards += *closeFee * 0.3
+	orderUpdate.TakeProfitAt = order.TakeProfitAt
+
+	*globalBorrowed = globalBorrowed.Sub(borrowed)
+	*globalLiquidity = globalLiquidity.Sub(value)
+
+	orderUpdate.OrderGlobalUpdate.CurrentBorrowed = orderUpdate.OrderGlobalUpdate.CurrentBorrowed.Sub(borrowed)
+	orderUpdate.OrderGlobalUpdate.CurrentLiquidity = orderUpdate.OrderGlobalUpdate.CurrentLiquidity.Sub(value)
+	orderUpdate.OrderGlobalUpdate.TotalPnlProfits = orderUpdate.OrderGlobalUpdate.TotalPnlProfits.Add(*payout)
+	addFee(&orderUpdate.OrderGlobalUpdate, *closeFee)
 
 	printProcessedOrder(*order, *orderUpdate)
 }
 
-func processOrderFill(globalBorrowed, globalLiquidity, borrowed, payout, closeFee *float64, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
+// processExitLevels fills the ladder levels crossed by markPrice at their price and returns the levels still open
+// fees and funding are charged like a take profit, the fills are written by fill_exit_levels before the batch
+func processExitLevels(fees pairFees, globalBorrowed, globalLiquidity *decimal.Decimal, markPrice decimal.Decimal, order *db.OrderResponse, levels []db.ExitLevelResponse, levelFills *[]db.ExitLevelFill) []db.ExitLevelResponse {
+	open := []db.ExitLevelResponse{}
+	for _, level := range levels {
+		// longs take profit at or over the level and stop at or under it, shorts the other way
+		crossed := markPrice.GreaterThanOrEqual(level.Price)
+		if (order.OrderType == "long") != (level.Kind == "tp") {
+			crossed = markPrice.LessThanOrEqual(level.Price)
+		}
+		// the last of the position is left to the stop, max profit or liquidation
+		if !crossed || !level.Collateral.LessThan(liveCollateral(order)) {
+			open = append(open, level)
+			continue
+		}
+
+		logrus.Info(fmt.Sprintf("processing %s %s exit level at %v", order.OrderType, level.Kind, level.Price))
+		value := level.Collateral.Mul(order.Leverage).Mul(decimal.One.Add(priceReturn(order, level.Price))).RoundUsd()
+		borrowed := level.Collateral.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+		closeFee := level.Collateral.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		fundingPaid := fees.fundingShare(order, level.Collateral)
+		payout := value.Sub(closeFee).Sub(borrowed).Sub(fundingPaid)
+		if payout.IsNegative() {
+			payout = decimal.Zero
+		}
+
+		order.Collateral = order.Collateral.Sub(level.Collateral)
+		*globalBorrowed = globalBorrowed.Sub(borrowed)
+		*globalLiquidity = globalLiquidity.Sub(value)
+
+		*levelFills = append(*levelFills, db.ExitLevelFill{
+			ExitLevelId:     level.ID,
+			CloseCollateral: level.Collateral,
+			Payout:          payout,
+			CloseFee:        closeFee,
+			ClosePrice:      level.Price,
+			CloseValue:      value,
+			Funding:         fundingPaid,
+		})
+	}
+	return open
+}
+
+// processReduceOnlyOrders closes the parent for the reduce-only orders crossed by markPrice and returns the ones still open
+// a fill of a linked order drops its oco siblings, a close of the whole live collateral ends the parent
+func processReduceOnlyOrders(fees pairFees, globalBorrowed, globalLiquidity *decimal.Decimal, markPrice decimal.Decimal, order *db.OrderResponse, reduceOnly []db.ReduceOnlyOrderResponse, reduceOnlyFills *[]db.ReduceOnlyFill) []db.ReduceOnlyOrderResponse {
+	filledGroups := make(map[uuid.UUID]bool)
+	open := []db.ReduceOnlyOrderResponse{}
+	for _, child := range reduceOnly {
+		if child.OcoGroup != uuid.Nil && filledGroups[child.OcoGroup] {
+			continue
+		}
+		crossed := markPrice.GreaterThanOrEqual(child.TriggerPrice)
+		if (order.OrderType == "long") != (child.Kind == "tp") {
+			crossed = markPrice.LessThanOrEqual(child.TriggerPrice)
+		}
+		if !crossed || !order.EndedAt.IsZero() {
+			open = append(open, child)
+			continue
+		}
+
+		logrus.Info(fmt.Sprintf("processing %s %s reduce-only order at %v", order.OrderType, child.Kind, child.TriggerPrice))
+		live := liveCollateral(order)
+		collateral := live.Mul(child.ClosePercent).Div(decimal.NewFromInt(100)).RoundUsd()
+		full := collateral.GreaterThanOrEqual(live) || child.ClosePercent.Equal(decimal.NewFromInt(100))
+		if full {
+			collateral = live
+		}
+		value := collateral.Mul(order.Leverage).Mul(decimal.One.Add(priceReturn(order, child.TriggerPrice))).RoundUsd()
+		borrowed := collateral.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+		closeFee := collateral.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		fundingPaid := fees.fundingShare(order, collateral)
+		payout := value.Sub(closeFee).Sub(borrowed).Sub(fundingPaid)
+		if payout.IsNegative() {
+			payout = decimal.Zero
+		}
 
-	typeMultiplier := map[bool]float64{true: 1, false: -1}[order.OrderType == "long"]
+		// a full close is written by fill_reduce_only_orders, the rest of the cycle skips the ended order
+		if full {
+			order.EndedAt = time.Now()
+		} else {
+			order.Collateral = order.Collateral.Sub(collateral)
+		}
+		*globalBorrowed = globalBorrowed.Sub(borrowed)
+		*globalLiquidity = globalLiquidity.Sub(value)
+		if child.OcoGroup != uuid.Nil {
+			filledGroups[child.OcoGroup] = true
+		}
 
-	var value float64
-	var liquidityChange float64
-	if order.TakeProfitValue == 0 && order.TakeProfitCollateral != 0 {
+		*reduceOnlyFills = append(*reduceOnlyFills, db.ReduceOnlyFill{
+			ReduceOnlyOrderId: child.ID,
+			CloseCollateral:   collateral,
+			Payout:            payout,
+			CloseFee:          closeFee,
+			ClosePrice:        child.TriggerPrice,
+			CloseValue:        value,
+			Funding:           fundingPaid,
+		})
+	}
+
+	// siblings kept before their group filled are canceled by the oco trigger
+	remaining := []db.ReduceOnlyOrderResponse{}
+	for _, child := range open {
+		if child.OcoGroup == uuid.Nil || !filledGroups[child.OcoGroup] {
+			remaining = append(remaining, child)
+		}
+	}
+	return remaining
+}
+
+func processOrderFill(fees pairFees, globalBorrowed, globalLiquidity, borrowed, payout, closeFee *decimal.Decimal, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
+
+	var value decimal.Decimal
+	fundingPaid := fees.settleFunding(order, orderUpdate, liveCollateral(order))
+	if !order.TakeProfitAt.IsZero() {
 		logrus.Info(fmt.Sprintf("processing %s fill order, after %s take profit", order.OrderType, order.OrderType))
-		value = (order.Collateral - order.TakeProfitCollateral) * order.Leverage * (1 + (order.MaxPrice-order.EntryPrice)*typeMultiplier/order.EntryPrice)
-		*closeFee = (order.Collateral - order.TakeProfitCollateral) * (dynamicLeverageFee(order.Leverage) + dynamicUtilizationFee(order.StartedAt, *globalBorrowed, *globalLiquidity))
-		liquidityChange = order.Collateral - order.TakeProfitCollateral
-		*globalBorrowed -= liquidityChange * (order.Leverage - 1)
-		orderUpdate.OrderGlobalUpdate.CurrentBorrowed -= liquidityChange * (order.Leverage - 1)
-		orderUpdate.TpValue = 0
-		*borrowed = (order.Collateral - order.TakeProfitCollateral) * (order.Leverage - 1)
+		liquidityChange := order.Collateral.Sub(order.TakeProfitCollateral)
+		value = liquidityChange.Mul(order.Leverage).Mul(decimal.One.Add(priceReturn(order, order.MaxPrice))).RoundUsd()
+		*closeFee = liquidityChange.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		*borrowed = liquidityChange.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+		orderUpdate.TpValue = decimal.Zero
 
 	} else { // if there is no tp collateral (implying not set)
 		logrus.Info(fmt.Sprintf("processing %s fill order", order.OrderType))
-		value = order.Collateral * order.Leverage * (1 + (order.MaxPrice-order.EntryPrice)*typeMultiplier/order.EntryPrice)
-		*closeFee = order.Collateral * dynamicLeverageFee(order.Leverage)
-		*globalBorrowed -= order.Collateral * (order.Leverage - 1)
-		orderUpdate.OrderGlobalUpdate.CurrentBorrowed -= order.Collateral * (order.Leverage - 1)
+		value = order.Collateral.Mul(order.Leverage).Mul(decimal.One.Add(priceReturn(order, order.MaxPrice))).RoundUsd()
+		*closeFee = order.Collateral.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		*borrowed = order.Collateral.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
 		orderUpdate.TpValue = order.TakeProfitValue
-		*borrowed = order.Collateral * (order.Leverage - 1)
 	}
+	*globalBorrowed = globalBorrowed.Sub(*borrowed)
+	orderUpdate.OrderGlobalUpdate.CurrentBorrowed = orderUpdate.OrderGlobalUpdate.CurrentBorrowed.Sub(*borrowed)
 
-	*payout += value - *closeFee - *borrowed
+	*payout = payout.Add(value.Sub(*closeFee).Sub(*borrowed).Sub(fundingPaid))
 
-	orderUpdate.Status = "filled"
+	setStatus(order, orderUpdate, orderstate.Filled, orderstate.Fill)
 	orderUpdate.EntryPrice = order.EntryPrice
 	orderUpdate.ClosePrice = order.MaxPrice
-	orderUpdate.Pnl += *payout
+	orderUpdate.Pnl = orderUpdate.Pnl.Add(*payout)
 	orderUpdate.Collateral = order.Collateral
-	*globalLiquidity -= value
-	orderUpdate.OrderGlobalUpdate.CurrentLiquidity -= value
+	*globalLiquidity = globalLiquidity.Sub(value)
+	orderUpdate.OrderGlobalUpdate.CurrentLiquidity = orderUpdate.OrderGlobalUpdate.CurrentLiquidity.Sub(value)
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersActive = -1
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersPending = -1
 	orderUpdate.OrderGlobalUpdate.TotalOrdersFilled = 1
-	orderUpdate.OrderGlobalUpdate.TotalPnlProfits += *payout
-	orderUpdate.OrderGlobalUpdate.TotalRevenue += *closeFee
-	orderUpdate.OrderGlobalUpdate.TreasuryBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalTreasuryProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.VaultBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalVaultProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.TotalBluRewards += *closeFee * 0.3
-	orderUpdate.OrderGlobalUpdate.CurrentBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.CurrentBluRewards += *closeFee * 0.3
+	orderUpdate.OrderGlobalUpdate.TotalPnlProfits = orderUpdate.OrderGlobalUpdate.TotalPnlProfits.Add(*payout)
+	addFee(&orderUpdate.OrderGlobalUpdate, *closeFee)
 
 	printProcessedOrder(*order, *orderUpdate)
 }
 
-func processStopLoss(globalBorrowed, globalLiquidity, borrowed, payout, closeFee *float64, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
-
-	typeMultiplier := map[bool]float64{true: 1, false: -1}[order.OrderType == "long"]
+func processStopLoss(fees pairFees, globalBorrowed, globalLiquidity, borrowed, payout, closeFee *decimal.Decimal, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
 
-	var value float64
-	var liquidityChange float64
-	if order.TakeProfitValue == 0 && order.TakeProfitCollateral != 0 {
+	var value, liquidityChange decimal.Decimal
+	fundingPaid := fees.settleFunding(order, orderUpdate, liveCollateral(order))
+	if !order.TakeProfitAt.IsZero() {
 		logrus.Info(fmt.Sprintf("processing %s stop loss order, after %s take profit", order.OrderType, order.OrderType))
-		value = (order.Collateral - order.TakeProfitCollateral) * (1 + order.Leverage*(order.StopLossPrice-order.EntryPrice)*typeMultiplier/order.EntryPrice)
-		*closeFee = (order.Collateral - order.TakeProfitCollateral) * (dynamicLeverageFee(order.Leverage) + dynamicUtilizationFee(order.StartedAt, *globalBorrowed, *globalLiquidity))
-		*borrowed = (order.Collateral - order.TakeProfitCollateral) * (order.Leverage - 1)
-		*payout = value - *closeFee - *borrowed
-		liquidityChange = order.Collateral - order.TakeProfitCollateral
-		*closeFee += liquidityChange - value
-		*globalBorrowed -= liquidityChange * (order.Leverage - 1)
-		orderUpdate.OrderGlobalUpdate.CurrentBorrowed -= liquidityChange * (order.Leverage - 1)
-		orderUpdate.TpValue = 0
+		liquidityChange = order.Collateral.Sub(order.TakeProfitCollateral)
+		value = liquidityChange.Mul(decimal.One.Add(order.Leverage.Mul(priceReturn(order, order.StopLossPrice)))).RoundUsd()
+		*closeFee = liquidityChange.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		*borrowed = liquidityChange.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+		*payout = value.Sub(*closeFee).Sub(*borrowed).Sub(fundingPaid)
+		*closeFee = closeFee.Add(liquidityChange.Sub(value))
+		orderUpdate.TpValue = decimal.Zero
 	} else { // if there is no tp collateral (implying not set)
 		logrus.Info(fmt.Sprintf("processing %s stop loss order", order.OrderType))
-		value = order.Collateral * (1 + order.Leverage*(order.StopLossPrice-order.EntryPrice)*typeMultiplier/order.EntryPrice)
-		*closeFee = order.Collateral * (dynamicLeverageFee(order.Leverage) + dynamicUtilizationFee(order.StartedAt, *globalBorrowed, *globalLiquidity))
-		*borrowed = order.Collateral * (order.Leverage - 1)
-		*payout = value - *closeFee - *borrowed
-		*closeFee += order.Collateral - value
-		*globalBorrowed -= order.Collateral * (order.Leverage - 1)
-		orderUpdate.OrderGlobalUpdate.CurrentBorrowed -= order.Collateral * (order.Leverage - 1)
+		value = order.Collateral.Mul(decimal.One.Add(order.Leverage.Mul(priceReturn(order, order.StopLossPrice)))).RoundUsd()
+		*closeFee = order.Collateral.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		*borrowed = order.Collateral.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+		*payout = value.Sub(*closeFee).Sub(*borrowed).Sub(fundingPaid)
+		*closeFee = closeFee.Add(order.Collateral.Sub(value))
 		orderUpdate.TpValue = order.TakeProfitValue
 	}
+	*globalBorrowed = globalBorrowed.Sub(*borrowed)
+	orderUpdate.OrderGlobalUpdate.CurrentBorrowed = orderUpdate.OrderGlobalUpdate.CurrentBorrowed.Sub(*borrowed)
 
-	orderUpdate.Status = "stopped"
+	setStatus(order, orderUpdate, orderstate.Stopped, orderstate.Stop)
 	orderUpdate.EntryPrice = order.EntryPrice
 	orderUpdate.ClosePrice = order.StopLossPrice
-	orderUpdate.Pnl -= (liquidityChange - *payout)
+	orderUpdate.Pnl = orderUpdate.Pnl.Sub(liquidityChange.Sub(*payout))
 	orderUpdate.Collateral = order.Collateral
-	*globalLiquidity -= value
-	orderUpdate.OrderGlobalUpdate.CurrentLiquidity -= value
+	*globalLiquidity = globalLiquidity.Sub(value)
+	orderUpdate.OrderGlobalUpdate.CurrentLiquidity = orderUpdate.OrderGlobalUpdate.CurrentLiquidity.Sub(value)
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersActive = -1
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersPending = -1
 	orderUpdate.OrderGlobalUpdate.TotalOrdersStopped = 1
-	orderUpdate.OrderGlobalUpdate.TotalPnlLosses -= (liquidityChange - *payout)
-	orderUpdate.OrderGlobalUpdate.TotalRevenue += *closeFee
-	orderUpdate.OrderGlobalUpdate.TreasuryBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalTreasuryProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.VaultBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalVaultProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.TotalBluRewards += *closeFee * 0.3
-	orderUpdate.OrderGlobalUpdate.CurrentBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.CurrentBluRewards += *closeFee * 0.3
+	orderUpdate.OrderGlobalUpdate.TotalPnlLosses = orderUpdate.OrderGlobalUpdate.TotalPnlLosses.Sub(liquidityChange.Sub(*payout))
+	addFee(&orderUpdate.OrderGlobalUpdate, *closeFee)
 
 	printProcessedOrder(*order, *orderUpdate)
 }
 
-func processLiquidation(globalBorrowed, globalLiquidity, borrowed, payout, closeFee *float64, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
-
-	typeMultiplier := map[bool]float64{true: 1, false: -1}[order.OrderType == "long"]
+func processLiquidation(fees pairFees, globalBorrowed, globalLiquidity, borrowed, payout, closeFee *decimal.Decimal, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
 
-	var value float64
-	var liquidityChange float64
-	if order.TakeProfitValue == 0 && order.TakeProfitCollateral != 0 {
+	var value, liquidityChange decimal.Decimal
+	fundingPaid := fees.settleFunding(order, orderUpdate, liveCollateral(order))
+	if !order.TakeProfitAt.IsZero() {
 		logrus.Info(fmt.Sprintf("processing %s liquidate order, after %s take profit", order.OrderType, order.OrderType))
-		value = (order.Collateral - order.TakeProfitCollateral) * (1 + order.Leverage*(order.LiquidationPrice-order.EntryPrice)*typeMultiplier/order.EntryPrice)
-		*closeFee = (order.Collateral - order.TakeProfitCollateral) * (dynamicLeverageFee(order.Leverage) + dynamicUtilizationFee(order.StartedAt, *globalBorrowed, *globalLiquidity))
-		*borrowed = (order.Collateral - order.TakeProfitCollateral) * (order.Leverage - 1)
-		*payout = value - *closeFee - *borrowed
-		liquidityChange = order.Collateral - order.TakeProfitCollateral
-		*closeFee += liquidityChange - value
-		if *closeFee > liquidityChange {
-			*payout = 0
+		liquidityChange = order.Collateral.Sub(order.TakeProfitCollateral)
+		value = liquidityChange.Mul(decimal.One.Add(order.Leverage.Mul(priceReturn(order, order.LiquidationPrice)))).RoundUsd()
+		*closeFee = liquidityChange.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		*borrowed = liquidityChange.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+		*payout = value.Sub(*closeFee).Sub(*borrowed).Sub(fundingPaid)
+		*closeFee = closeFee.Add(liquidityChange.Sub(value))
+		if closeFee.GreaterThan(liquidityChange) {
+			*payout = decimal.Zero
 			*closeFee = liquidityChange
 		}
-		*globalBorrowed -= liquidityChange * (order.Leverage - 1)
-		orderUpdate.OrderGlobalUpdate.CurrentBorrowed -= liquidityChange * (order.Leverage - 1)
-		orderUpdate.TpValue = 0
+		orderUpdate.TpValue = decimal.Zero
 	} else { // if there is no tp collateral (implying not set)
 		logrus.Info(fmt.Sprintf("processing %s liquidate order", order.OrderType))
-		value = order.Collateral * (1 + order.Leverage*(order.LiquidationPrice-order.EntryPrice)*typeMultiplier/order.EntryPrice)
-		*closeFee = order.Collateral * (dynamicLeverageFee(order.Leverage) + dynamicUtilizationFee(order.StartedAt, *globalBorrowed, *globalLiquidity))
-		*borrowed = order.Collateral * (order.Leverage - 1)
-		*payout = value - *closeFee - *borrowed
-		*closeFee += order.Collateral - value
-		if *closeFee > order.Collateral {
-			*payout = 0
+		value = order.Collateral.Mul(decimal.One.Add(order.Leverage.Mul(priceReturn(order, order.LiquidationPrice)))).RoundUsd()
+		*closeFee = order.Collateral.Mul(fees.leverageFee(order.Leverage).Add(fees.utilizationFee(order))).RoundUsd()
+		*borrowed = order.Collateral.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+		*payout = value.Sub(*closeFee).Sub(*borrowed).Sub(fundingPaid)
+		*closeFee = closeFee.Add(order.Collateral.Sub(value))
+		if closeFee.GreaterThan(order.Collateral) {
+			*payout = decimal.Zero
 			*closeFee = order.Collateral
 		}
-		*globalBorrowed -= order.Collateral * (order.Leverage - 1)
-		orderUpdate.OrderGlobalUpdate.CurrentBorrowed -= order.Collateral * (order.Leverage - 1)
 
 		orderUpdate.TpValue = order.TakeProfitValue
 	}
+	// funding owed past the collateral is not recovered from the user
+	if payout.IsNegative() {
+		*payout = decimal.Zero
+	}
+	*globalBorrowed = globalBorrowed.Sub(*borrowed)
+	orderUpdate.OrderGlobalUpdate.CurrentBorrowed = orderUpdate.OrderGlobalUpdate.CurrentBorrowed.Sub(*borrowed)
 
-	orderUpdate.Status = "liquidated"
+	setStatus(order, orderUpdate, orderstate.Liquidated, orderstate.Liquidate)
 	orderUpdate.EntryPrice = order.EntryPrice
 	orderUpdate.ClosePrice = order.LiquidationPrice
-	orderUpdate.Pnl -= (liquidityChange - *payout)
+	orderUpdate.Pnl = orderUpdate.Pnl.Sub(liquidityChange.Sub(*payout))
 	orderUpdate.Collateral = order.Collateral
-	*globalLiquidity -= order.TakeProfitCollateral
-	orderUpdate.OrderGlobalUpdate.CurrentLiquidity -= order.TakeProfitCollateral
+	*globalLiquidity = globalLiquidity.Sub(order.TakeProfitCollateral)
+	orderUpdate.OrderGlobalUpdate.CurrentLiquidity = orderUpdate.OrderGlobalUpdate.CurrentLiquidity.Sub(order.TakeProfitCollateral)
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersActive = -1
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersPending = -1
 	orderUpdate.OrderGlobalUpdate.TotalOrdersLiquidated = 1
-	orderUpdate.OrderGlobalUpdate.TotalPnlLosses -= (liquidityChange - *payout)
+	orderUpdate.OrderGlobalUpdate.TotalPnlLosses = orderUpdate.OrderGlobalUpdate.TotalPnlLosses.Sub(liquidityChange.Sub(*payout))
 	orderUpdate.OrderGlobalUpdate.TotalOrdersFilled = 1
-	orderUpdate.OrderGlobalUpdate.TotalRevenue += *closeFee
-	orderUpdate.OrderGlobalUpdate.TreasuryBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalTreasuryProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.VaultBalance += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalVaultProfits += *closeFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.TotalBluRewards += *closeFee * 0.3
-	orderUpdate.OrderGlobalUpdate.CurrentBlpRewards += *closeFee * 0.5
-	orderUpdate.OrderGlobalUpdate.CurrentBluRewards += *closeFee * 0.3
+	addFee(&orderUpdate.OrderGlobalUpdate, *closeFee)
 
 	printProcessedOrder(*order, *orderUpdate)
 }
 
-func processLimit(globalBorrowed, globalLiquidity *float64, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
+// setStatus moves the order through a transition of pkg/orderstate, the first illegal one is kept on the update
+func setStatus(order *db.OrderResponse, orderUpdate *db.OrderUpdate, status, action string) {
+	from := order.OrderStatus
+	if orderUpdate.Status != "" {
+		from = orderUpdate.Status
+	}
+	if err := orderstate.Check(from, status, action, orderstate.Rebalancer); err != nil && orderUpdate.TransitionError == nil {
+		orderUpdate.TransitionError = err
+	}
+	orderUpdate.Status = status
+	orderUpdate.Action = action
+	orderUpdate.Actor = orderstate.Rebalancer
+}
+
+// entryFills arms a stop limit crossed by markPrice and reports whether the resting entry fills at markPrice
+func entryFills(order *db.OrderResponse, markPrice decimal.Decimal) (bool, bool) {
+	armed := false
+	if order.EntryType == entry.StopLimit && order.TriggeredAt.IsZero() {
+		if !entry.Arms(order.OrderType, order.TriggerPrice, markPrice) {
+			return false, false
+		}
+		logrus.Info(fmt.Sprintf("arming %s stop limit at %v", order.OrderType, order.TriggerPrice))
+		order.TriggeredAt = time.Now()
+		armed = true
+	}
+	return entry.Fills(order.EntryType, order.OrderType, order.LimitPrice, markPrice), armed
+}
+
+// processLimit opens a resting entry filled by markPrice, at the price of entry.FillPrice
+func processLimit(fees pairFees, globalBorrowed, globalLiquidity *decimal.Decimal, markPrice decimal.Decimal, order *db.OrderResponse, orderUpdate *db.OrderUpdate) {
 
-	logrus.Info(fmt.Sprintf("processing %s limit order", order.OrderType))
-	openFee := order.Collateral * (dynamicLeverageFee(order.Leverage) + dynamicUtilizationFee(order.StartedAt, *globalBorrowed, *globalLiquidity))
+	logrus.Info(fmt.Sprintf("processing %s %s entry order", order.OrderType, order.EntryType))
+	// nothing is borrowed before the fill, the borrow index is snapshotted when the order turns pending
+	openFee := order.Collateral.Mul(fees.leverageFee(order.Leverage)).RoundUsd()
 
-	order.OrderStatus = "pending"
-	orderUpdate.Status = "pending"
-	orderUpdate.EntryPrice = order.LimitPrice
-	orderUpdate.ClosePrice = 0
-	orderUpdate.Pnl = 0
-	order.Collateral = order.Collateral - openFee
-	orderUpdate.Collateral = order.Collateral - openFee
-	*globalBorrowed += order.Collateral * (order.Leverage - 1)
-	*globalLiquidity += order.Collateral
+	setStatus(order, orderUpdate, orderstate.Pending, orderstate.Trigger)
+	order.OrderStatus = orderstate.Pending
+	// liquidation and max profit were quoted at the limit price, twap slices at the mark price they were spawned at
+	quotedPrice := order.LimitPrice
+	if quotedPrice.IsZero() {
+		quotedPrice = order.EntryPrice
+	}
+	order.EntryPrice = entry.FillPrice(order.EntryType, order.LimitPrice, markPrice)
+	order.LiquidationPrice = entry.Reprice(order.LiquidationPrice, quotedPrice, order.EntryPrice)
+	order.MaxPrice = entry.Reprice(order.MaxPrice, quotedPrice, order.EntryPrice)
+	orderUpdate.EntryPrice = order.EntryPrice
+	orderUpdate.LiqPrice = order.LiquidationPrice
+	orderUpdate.MaxPrice = order.MaxPrice
+	orderUpdate.ClosePrice = decimal.Zero
+	orderUpdate.Pnl = decimal.Zero
+	order.Collateral = order.Collateral.Sub(openFee)
+	orderUpdate.Collateral = order.Collateral
+	borrowed := order.Collateral.Mul(order.Leverage.Sub(decimal.One)).RoundUsd()
+	*globalBorrowed = globalBorrowed.Add(borrowed)
+	*globalLiquidity = globalLiquidity.Add(order.Collateral)
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersActive += 1
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersPending += 1
 	orderUpdate.OrderGlobalUpdate.CurrentOrdersLimit -= 1
-	orderUpdate.OrderGlobalUpdate.TotalBorrowed += order.Collateral * (order.Leverage - 1)
+	orderUpdate.OrderGlobalUpdate.TotalBorrowed = orderUpdate.OrderGlobalUpdate.TotalBorrowed.Add(borrowed)
 	orderUpdate.OrderGlobalUpdate.TotalOrdersActive += 1
-	orderUpdate.OrderGlobalUpdate.TotalRevenue += openFee
-	orderUpdate.OrderGlobalUpdate.TreasuryBalance += openFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalTreasuryProfits += openFee * 0.1
-	orderUpdate.OrderGlobalUpdate.VaultBalance += openFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalVaultProfits += openFee * 0.1
-	orderUpdate.OrderGlobalUpdate.TotalBlpRewards += openFee * 0.5
-	orderUpdate.OrderGlobalUpdate.TotalBluRewards += openFee * 0.3
-	orderUpdate.OrderGlobalUpdate.CurrentBlpRewards += openFee * 0.5
-	orderUpdate.OrderGlobalUpdate.CurrentBluRewards += openFee * 0.3
+	addFee(&orderUpdate.OrderGlobalUpdate, openFee)
 
 	printProcessedOrder(*order, *orderUpdate)
 }
 
+// addGlobalUpdate adds the global changes of an order to the batch total
+func addGlobalUpdate(total *db.OrderGlobalUpdate, update db.OrderGlobalUpdate) {
+	total.CurrentBorrowed = total.CurrentBorrowed.Add(update.CurrentBorrowed)
+	total.CurrentLiquidity = total.CurrentLiquidity.Add(update.CurrentLiquidity)
+	total.CurrentOrdersActive += update.CurrentOrdersActive
+	total.CurrentOrdersLimit += update.CurrentOrdersLimit
+	total.CurrentOrdersPending += update.CurrentOrdersPending
+	total.TotalBorrowed = total.TotalBorrowed.Add(update.TotalBorrowed)
+	total.TotalLiquidations += update.TotalLiquidations
+	total.TotalOrdersActive += update.TotalOrdersActive
+	total.TotalOrdersFilled += update.TotalOrdersFilled
+	total.TotalOrdersLimit += update.TotalOrdersLimit
+	total.TotalOrdersLiquidated += update.TotalOrdersLiquidated
+	total.TotalOrdersStopped += update.TotalOrdersStopped
+	total.TotalPnlLosses = total.TotalPnlLosses.Add(update.TotalPnlLosses)
+	total.TotalPnlProfits = total.TotalPnlProfits.Add(update.TotalPnlProfits)
+	total.TotalRevenue = total.TotalRevenue.Add(update.TotalRevenue)
+	total.TreasuryBalance = total.TreasuryBalance.Add(update.TreasuryBalance)
+	total.TotalTreasuryProfits = total.TotalTreasuryProfits.Add(update.TotalTreasuryProfits)
+	total.VaultBalance = total.VaultBalance.Add(update.VaultBalance)
+	total.TotalVaultProfits = total.TotalVaultProfits.Add(update.TotalVaultProfits)
+	total.TotalBlpRewards = total.TotalBlpRewards.Add(update.TotalBlpRewards)
+	total.TotalBluRewards = total.TotalBluRewards.Add(update.TotalBluRewards)
+	total.CurrentBlpRewards = total.CurrentBlpRewards.Add(update.CurrentBlpRewards)
+	total.CurrentBluRewards = total.CurrentBluRewards.Add(update.CurrentBluRewards)
+}
+
+// subGlobalUpdate takes the global changes of an order out of the batch total
+func subGlobalUpdate(total *db.OrderGlobalUpdate, update db.OrderGlobalUpdate) {
+	total.CurrentBorrowed = total.CurrentBorrowed.Sub(update.CurrentBorrowed)
+	total.CurrentLiquidity = total.CurrentLiquidity.Sub(update.CurrentLiquidity)
+	total.CurrentOrdersActive -= update.CurrentOrdersActive
+	total.CurrentOrdersLimit -= update.CurrentOrdersLimit
+	total.CurrentOrdersPending -= update.CurrentOrdersPending
+	total.TotalBorrowed = total.TotalBorrowed.Sub(update.TotalBorrowed)
+	total.TotalLiquidations -= update.TotalLiquidations
+	total.TotalOrdersActive -= update.TotalOrdersActive
+	total.TotalOrdersFilled -= update.TotalOrdersFilled
+	total.TotalOrdersLimit -= update.TotalOrdersLimit
+	total.TotalOrdersLiquidated -= update.TotalOrdersLiquidated
+	total.TotalOrdersStopped -= update.TotalOrdersStopped
+	total.TotalPnlLosses = total.TotalPnlLosses.Sub(update.TotalPnlLosses)
+	total.TotalPnlProfits = total.TotalPnlProfits.Sub(update.TotalPnlProfits)
+	total.TotalRevenue = total.TotalRevenue.Sub(update.TotalRevenue)
+	total.TreasuryBalance = total.TreasuryBalance.Sub(update.TreasuryBalance)
+	total.TotalTreasuryProfits = total.TotalTreasuryProfits.Sub(update.TotalTreasuryProfits)
+	total.VaultBalance = total.VaultBalance.Sub(update.VaultBalance)
+	total.TotalVaultProfits = total.TotalVaultProfits.Sub(update.TotalVaultProfits)
+	total.TotalBlpRewards = total.TotalBlpRewards.Sub(update.TotalBlpRewards)
+	total.TotalBluRewards = total.TotalBluRewards.Sub(update.TotalBluRewards)
+	total.CurrentBlpRewards = total.CurrentBlpRewards.Sub(update.CurrentBlpRewards)
+	total.CurrentBluRewards = total.CurrentBluRewards.Sub(update.CurrentBluRewards)
+}
+
 // todo
 // supabase client need to be called for the metrics and we need to select where to call to reduce the number of calls
 // but we also need to consider the change in liquidity and borrow state from the incoming order changes
-func processOrders(supabaseClient *supabase.Client, pairId string, priceMap []float64, minPrice, maxPrice float64) {
+func processOrders(supabaseClient *supabase.Client, pairId string, priceMap []decimal.Decimal, minPrice, maxPrice decimal.Decimal) {
+	// without the borrow index no close can be charged its utilization fee, nothing is written and the orders
+	// are evaluated again on the next prices
+	fees := getPairFees(supabaseClient, pairId)
+	if !fees.accrueBorrowIndex(supabaseClient) {
+		logrus.Error(fmt.Sprintf("cycle skipped for pair id %v until the next prices", pairId))
+		return
+	}
+	fees.accrueFunding(supabaseClient, pairId)
+
 	orders, err := db.GetOrdersParsingRange(supabaseClient, pairId, minPrice, maxPrice)
 	if err != nil {
 		logrus.Error(fmt.Sprintf("could not fetch orders using pair id %v, minPrice %v, maxPrice %v: %v", pairId, minPrice, maxPrice, err))
 	}
+	orders = withTrailingOrders(supabaseClient, pairId, orders)
+	orders = withExitLevelOrders(supabaseClient, pairId, orders, minPrice, maxPrice)
+	orders = withReduceOnlyParentOrders(supabaseClient, pairId, orders, minPrice, maxPrice)
+	orders = withStopLimitOrders(supabaseClient, pairId, orders, minPrice, maxPrice)
+	orders = withAlgoSlices(supabaseClient, pairId, orders, priceMap[0])
 
 	globalBorrowed, globalLiquidity, err := getCurrentBorrowAndLiquidity(supabaseClient)
 
 	orderUpdates_ := []db.OrderUpdate{}
 	OrderGlobalUpdate_ := db.OrderGlobalUpdate{}
+	trailedStops := []db.OrderResponse{}
+	armedStopLimits := []string{}
 	if orders == nil || len(*orders) == 0 {
 		logrus.Error(fmt.Sprintf("No orders returned for pair id %v, minPrice %v, maxPrice %v", pairId, minPrice, maxPrice))
 		return
 	}
+	exitLevels := getOpenExitLevels(supabaseClient, *orders)
+	levelFills := []db.ExitLevelFill{}
+	reduceOnlyOrders := getOpenReduceOnlyOrders(supabaseClient, *orders)
+	reduceOnlyFills := []db.ReduceOnlyFill{}
+	// the order of each level and reduce-only fill and what each order adds to the batch globals,
+	// an order with a fill the db rejects leaves the batch and is evaluated again on the next prices
+	fillOrders := map[string]uuid.UUID{}
+	orderGlobals := map[uuid.UUID]db.OrderGlobalUpdate{}
+	now := time.Now()
 	for _, order := range *orders {
-		if order.OrderStatus == "unsigned" {
+		if order.OrderStatus == orderstate.Unsigned || limitExpired(&order, now) {
 			continue
 		}
 		LogCreateOrderResponse(order)
 		orderUpdate_ := db.OrderUpdate{}
 		orderUpdate_.OrderID = order.ID
 		orderUpdate_.UserID = order.UserID
-		var payout float64
-		var borrowed float64
+		var payout decimal.Decimal
+		var borrowed decimal.Decimal
+		var trailed, triggered bool
+		levels := exitLevels[order.ID]
+		reduceOnly := reduceOnlyOrders[order.ID]
+		// kept to drop this order from the batch if it makes an illegal transition
+		batchGlobal, batchBorrowed, batchLiquidity := OrderGlobalUpdate_, globalBorrowed, globalLiquidity
+		batchLevelFills, batchReduceOnlyFills, batchArmed := len(levelFills), len(reduceOnlyFills), len(armedStopLimits)
 		// add utilitization fee to order liquidation
 		for _, markPrice := range priceMap {
-			var closeFee float64
+			// process_batch_orders writes only the last status, an entry that fills waits for the next cycle to close
+			// so the db sees limit -> pending and never limit -> stopped, liquidated or filled
+			if triggered {
+				break
+			}
+			var closeFee decimal.Decimal
+			// the trailing stop moves with each price before it is checked, so it triggers through processStopLoss
+			if order.OrderStatus == orderstate.Pending && order.EndedAt.IsZero() && !order.TrailExtreme.IsZero() {
+				if trailing.Ratchet(order.OrderType, markPrice, order.TrailAmount, order.TrailPercent, &order.TrailExtreme, &order.StopLossPrice) {
+					trailed = true
+				}
+			}
+			// crossed ladder levels close first, the checks below see the remaining collateral
+			if order.OrderStatus == orderstate.Pending && order.EndedAt.IsZero() && len(levels) > 0 {
+				levels = processExitLevels(fees, &globalBorrowed, &globalLiquidity, markPrice, &order, levels, &levelFills)
+			}
+			if order.OrderStatus == orderstate.Pending && order.EndedAt.IsZero() && len(reduceOnly) > 0 {
+				reduceOnly = processReduceOnlyOrders(fees, &globalBorrowed, &globalLiquidity, markPrice, &order, reduceOnly, &reduceOnlyFills)
+			}
 			// assume the order collateral is the exact, fees are already taken
 			// collateral_ := order.Collateral * 0.99975
 			if order.OrderType == "long" && order.EndedAt.IsZero() {
-				if order.OrderStatus == "pending" {
+				if order.OrderStatus == orderstate.Pending {
 					// profits
-					if order.TakeProfitPrice <= markPrice && order.TakeProfitValue > 0 {
-						processOrderTakeProfit(&globalBorrowed, &globalLiquidity, &payout, &closeFee, &order, &orderUpdate_)
+					if order.TakeProfitPrice.LessThanOrEqual(markPrice) && order.TakeProfitValue.IsPositive() {
+						processOrderTakeProfit(fees, &globalBorrowed, &globalLiquidity, &payout, &closeFee, &order, &orderUpdate_)
 					}
-					if order.MaxPrice <= markPrice {
-						processOrderFill(&globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
+					if order.MaxPrice.LessThanOrEqual(markPrice) {
+						processOrderFill(fees, &globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
 						break
 					}
 					// losses
-					if order.StopLossPrice >= markPrice && order.StopLossPrice > 0 {
-						processStopLoss(&globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
+					if order.StopLossPrice.GreaterThanOrEqual(markPrice) && order.StopLossPrice.IsPositive() {
+						processStopLoss(fees, &globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
 						break
 					}
 					// assume liquidations occur where value is non zero
-					if order.LiquidationPrice >= markPrice || markPrice <= 0 {
-						processLiquidation(&globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
+					if order.LiquidationPrice.GreaterThanOrEqual(markPrice) || !markPrice.IsPositive() {
+						processLiquidation(fees, &globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
 						break
 					}
-				} else if order.OrderStatus == "limit" {
-					// assuming order.LimitPrice != 0
-					if order.LimitPrice > order.EntryPrice && markPrice >= order.LimitPrice {
-						processLimit(&globalBorrowed, &globalLiquidity, &order, &orderUpdate_)
+				} else if order.OrderStatus == orderstate.Limit {
+					fills, armed := entryFills(&order, markPrice)
+					if armed {
+						armedStopLimits = append(armedStopLimits, order.ID.String())
+					}
+					if fills {
+						processLimit(fees, &globalBorrowed, &globalLiquidity, markPrice, &order, &orderUpdate_)
+						triggered = true
 					}
 				} else {
 					continue
 				}
 			} else if order.OrderType == "short" && order.EndedAt.IsZero() {
-				if order.OrderStatus == "pending" {
+				if order.OrderStatus == orderstate.Pending {
 					// profits
-					if order.TakeProfitPrice >= markPrice && order.TakeProfitValue > 0 {
-						processOrderTakeProfit(&globalBorrowed, &globalLiquidity, &payout, &closeFee, &order, &orderUpdate_)
+					if order.TakeProfitPrice.GreaterThanOrEqual(markPrice) && order.TakeProfitValue.IsPositive() {
+						processOrderTakeProfit(fees, &globalBorrowed, &globalLiquidity, &payout, &closeFee, &order, &orderUpdate_)
 					}
-					if order.MaxPrice >= markPrice {
-						processOrderFill(&globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
+					if order.MaxPrice.GreaterThanOrEqual(markPrice) {
+						processOrderFill(fees, &globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
 						break
 					}
 					// losses
-					if order.StopLossPrice <= markPrice && order.StopLossPrice > 0 {
-						processStopLoss(&globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
+					if order.StopLossPrice.LessThanOrEqual(markPrice) && order.StopLossPrice.IsPositive() {
+						processStopLoss(fees, &globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
 						break
 					}
 					// assume liquidations occur where value is non zero
-					if order.LiquidationPrice <= markPrice {
-						processLiquidation(&globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
+					if order.LiquidationPrice.LessThanOrEqual(markPrice) {
+						processLiquidation(fees, &globalBorrowed, &globalLiquidity, &borrowed, &payout, &closeFee, &order, &orderUpdate_)
 						break
 					}
-				} else if order.OrderStatus == "limit" {
-					// assuming order.LimitPrice != 0
-					if order.LimitPrice < order.EntryPrice && markPrice <= order.LimitPrice {
-						processLimit(&globalBorrowed, &globalLiquidity, &order, &orderUpdate_)
+				} else if order.OrderStatus == orderstate.Limit {
+					fills, armed := entryFills(&order, markPrice)
+					if armed {
+						armedStopLimits = append(armedStopLimits, order.ID.String())
+					}
+					if fills {
+						processLimit(fees, &globalBorrowed, &globalLiquidity, markPrice, &order, &orderUpdate_)
+						triggered = true
 					}
 				} else {
 					continue
 				}
 			}
 
-			OrderGlobalUpdate_.CurrentBorrowed += orderUpdate_.OrderGlobalUpdate.CurrentBorrowed
-			OrderGlobalUpdate_.CurrentLiquidity += orderUpdate_.OrderGlobalUpdate.CurrentLiquidity
-			OrderGlobalUpdate_.CurrentOrdersActive += orderUpdate_.OrderGlobalUpdate.CurrentOrdersActive
-			OrderGlobalUpdate_.CurrentOrdersLimit += orderUpdate_.OrderGlobalUpdate.CurrentOrdersLimit
-			OrderGlobalUpdate_.CurrentOrdersPending += orderUpdate_.OrderGlobalUpdate.CurrentOrdersPending
-			OrderGlobalUpdate_.TotalBorrowed += orderUpdate_.OrderGlobalUpdate.TotalBorrowed
-			OrderGlobalUpdate_.TotalLiquidations += orderUpdate_.OrderGlobalUpdate.TotalLiquidations
-			OrderGlobalUpdate_.TotalOrdersActive += orderUpdate_.OrderGlobalUpdate.TotalOrdersActive
-			OrderGlobalUpdate_.TotalOrdersFilled += orderUpdate_.OrderGlobalUpdate.TotalOrdersFilled
-			OrderGlobalUpdate_.TotalOrdersLimit += orderUpdate_.OrderGlobalUpdate.TotalOrdersLimit
-			OrderGlobalUpdate_.TotalOrdersLiquidated += orderUpdate_.OrderGlobalUpdate.TotalOrdersLiquidated
-			OrderGlobalUpdate_.TotalOrdersStopped += orderUpdate_.OrderGlobalUpdate.TotalOrdersStopped
-			OrderGlobalUpdate_.TotalPnlLosses += orderUpdate_.OrderGlobalUpdate.TotalPnlLosses
-			OrderGlobalUpdate_.TotalPnlProfits += orderUpdate_.OrderGlobalUpdate.TotalPnlProfits
-			OrderGlobalUpdate_.TotalRevenue += orderUpdate_.OrderGlobalUpdate.TotalRevenue
-			OrderGlobalUpdate_.TreasuryBalance += orderUpdate_.OrderGlobalUpdate.TreasuryBalance
-			OrderGlobalUpdate_.TotalTreasuryProfits += orderUpdate_.OrderGlobalUpdate.TotalTreasuryProfits
-			OrderGlobalUpdate_.VaultBalance += orderUpdate_.OrderGlobalUpdate.VaultBalance
-			OrderGlobalUpdate_.TotalVaultProfits += orderUpdate_.OrderGlobalUpdate.TotalVaultProfits
-			OrderGlobalUpdate_.TotalBlpRewards += orderUpdate_.OrderGlobalUpdate.TotalBlpRewards
-			OrderGlobalUpdate_.TotalBluRewards += orderUpdate_.OrderGlobalUpdate.TotalBluRewards
-			OrderGlobalUpdate_.CurrentBlpRewards += orderUpdate_.OrderGlobalUpdate.CurrentBlpRewards
-			OrderGlobalUpdate_.CurrentBluRewards += orderUpdate_.OrderGlobalUpdate.CurrentBlpRewards
+			addGlobalUpdate(&OrderGlobalUpdate_, orderUpdate_.OrderGlobalUpdate)
 		}
 
+		// process_batch_orders would fail on it, the db only accepts the transitions of pkg/orderstate
+		// only this order is dropped, the rest of the pair (liquidations included) still goes out
+		if orderUpdate_.TransitionError != nil {
+			logrus.Error(fmt.Sprintf("order %v: %v, skipped until the next prices", order.ID, orderUpdate_.TransitionError))
+			OrderGlobalUpdate_, globalBorrowed, globalLiquidity = batchGlobal, batchBorrowed, batchLiquidity
+			levelFills, reduceOnlyFills, armedStopLimits = levelFills[:batchLevelFills], reduceOnlyFills[:batchReduceOnlyFills], armedStopLimits[:batchArmed]
+			continue
+		}
 		orderUpdates_ = append(orderUpdates_, orderUpdate_)
+		for _, fill := range levelFills[batchLevelFills:] {
+			fillOrders[fill.ExitLevelId.String()] = order.ID
+		}
+		for _, fill := range reduceOnlyFills[batchReduceOnlyFills:] {
+			fillOrders[fill.ReduceOnlyOrderId.String()] = order.ID
+		}
+		orderGlobal := OrderGlobalUpdate_
+		subGlobalUpdate(&orderGlobal, batchGlobal)
+		orderGlobals[order.ID] = orderGlobal
+		if trailed {
+			trailedStops = append(trailedStops, order)
+		}
+	}
+	persistTrailingStops(supabaseClient, trailedStops)
+	persistArmedStopLimits(supabaseClient, armedStopLimits)
+
+	// the batch closes what is left of the positions, so the level fills go first
+	rejected := fillExitLevels(supabaseClient, levelFills, fillOrders)
+	acceptedReduceOnlyFills := []db.ReduceOnlyFill{}
+	for _, fill := range reduceOnlyFills {
+		if !rejected[fillOrders[fill.ReduceOnlyOrderId.String()]] {
+			acceptedReduceOnlyFills = append(acceptedReduceOnlyFills, fill)
+		}
+	}
+	for orderId := range fillReduceOnlyOrders(supabaseClient, acceptedReduceOnlyFills, fillOrders) {
+		rejected[orderId] = true
+	}
+	if len(rejected) > 0 {
+		acceptedUpdates := []db.OrderUpdate{}
+		for _, orderUpdate := range orderUpdates_ {
+			if rejected[orderUpdate.OrderID] {
+				logrus.Error(fmt.Sprintf("order %v: fill rejected, skipped until the next prices", orderUpdate.OrderID))
+				subGlobalUpdate(&OrderGlobalUpdate_, orderGlobals[orderUpdate.OrderID])
+				continue
+			}
+			acceptedUpdates = append(acceptedUpdates, orderUpdate)
+		}
+		orderUpdates_ = acceptedUpdates
 	}
 
 	if len(orderUpdates_) > 0 {
 		if err := db.ProcessBatchOrders(supabaseClient, time.Now(), orderUpdates_, OrderGlobalUpdate_); err != nil {
 			logrus.Error(fmt.Sprintf("Error processing batch orders: %v", err.Error()))
+			return
 		}
 	} else {
 		logrus.Info("No order processed")
 	}
 }
 
-func processPrices(supabaseClient *supabase.Client, priceMap map[string][]float64) {
+// mergeOrders appends the extra orders missing from orders
+func mergeOrders(orders, extra *[]db.OrderResponse) *[]db.OrderResponse {
+	merged := []db.OrderResponse{}
+	if orders != nil {
+		merged = append(merged, *orders...)
+	}
+	fetched := make(map[uuid.UUID]bool, len(merged))
+	for _, order := range merged {
+		fetched[order.ID] = true
+	}
+	for _, order := range *extra {
+		if !fetched[order.ID] {
+			merged = append(merged, order)
+		}
+	}
+	return &merged
+}
 
-	// Process the collected prices every 3 seconds
-	for id, prices := range priceMap {
-		var minPrice, maxPrice float64
-		minPrice = 2000000 // set to a large enough value to cover all subvalues
-		if len(prices) == 0 {
-			continue
+// withTrailingOrders adds the open trailing stop orders of the pair missing from the parsing range, their stops move on any price
+func withTrailingOrders(supabaseClient *supabase.Client, pairId string, orders *[]db.OrderResponse) *[]db.OrderResponse {
+	trailingOrders, err := db.GetTrailingOrders(supabaseClient, pairId)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not fetch trailing orders using pair id %v: %v", pairId, err))
+		return orders
+	}
+	return mergeOrders(orders, trailingOrders)
+}
+
+// withStopLimitOrders adds the stop limits of the pair with a trigger in the price range, their limit price may be out of it
+func withStopLimitOrders(supabaseClient *supabase.Client, pairId string, orders *[]db.OrderResponse, minPrice, maxPrice decimal.Decimal) *[]db.OrderResponse {
+	stopLimitOrders, err := db.GetStopLimitOrders(supabaseClient, pairId, minPrice, maxPrice)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not fetch stop limit orders using pair id %v: %v", pairId, err))
+		return orders
+	}
+	return mergeOrders(orders, stopLimitOrders)
+}
+
+// withAlgoSlices spawns the twap and scale slices that are due and adds them, a twap slice is a market entry
+// at markPrice, the first price of the cycle, so it opens in this batch at that price
+// slices only spawn on a price of the pair, a twap that missed intervals opens one slice and spreads the rest again
+func withAlgoSlices(supabaseClient *supabase.Client, pairId string, orders *[]db.OrderResponse, markPrice decimal.Decimal) *[]db.OrderResponse {
+	slices, err := db.SpawnAlgoSlices(supabaseClient, pairId, markPrice)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not spawn algo slices using pair id %v: %v", pairId, err))
+		return orders
+	}
+	return mergeOrders(orders, slices)
+}
+
+// withExitLevelOrders adds the pending orders with a ladder level in the price range
+func withExitLevelOrders(supabaseClient *supabase.Client, pairId string, orders *[]db.OrderResponse, minPrice, maxPrice decimal.Decimal) *[]db.OrderResponse {
+	levelOrders, err := db.GetExitLevelOrders(supabaseClient, pairId, minPrice, maxPrice)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not fetch exit level orders using pair id %v: %v", pairId, err))
+		return orders
+	}
+	return mergeOrders(orders, levelOrders)
+}
+
+// getOpenExitLevels returns the open ladder levels by order, each in the order the levels trigger
+func getOpenExitLevels(supabaseClient *supabase.Client, orders []db.OrderResponse) map[uuid.UUID][]db.ExitLevelResponse {
+	exitLevels := make(map[uuid.UUID][]db.ExitLevelResponse)
+	orderTypes := make(map[uuid.UUID]string, len(orders))
+	orderIds := make([]string, 0, len(orders))
+	for _, order := range orders {
+		if order.OrderStatus == orderstate.Pending {
+			orderIds = append(orderIds, order.ID.String())
+			orderTypes[order.ID] = order.OrderType
 		}
+	}
+	if len(orderIds) == 0 {
+		return exitLevels
+	}
 
-		for _, price := range prices {
-			if price < minPrice {
-				minPrice = price
+	levels, err := db.GetOpenExitLevels(supabaseClient, orderIds)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not fetch exit levels, no level fills this cycle: %v", err))
+		return exitLevels
+	}
+	for _, level := range *levels {
+		exitLevels[level.OrderID] = append(exitLevels[level.OrderID], level)
+	}
+	for orderId, orderLevels := range exitLevels {
+		orderType := orderTypes[orderId]
+		// take profits before stops, longs take profit upwards and stop downwards, shorts the other way
+		sort.SliceStable(orderLevels, func(i, j int) bool {
+			if orderLevels[i].Kind != orderLevels[j].Kind {
+				return orderLevels[i].Kind == "tp"
 			}
-			if price > maxPrice {
-				maxPrice = price
+			if (orderType == "long") == (orderLevels[i].Kind == "tp") {
+				return orderLevels[i].Price.LessThan(orderLevels[j].Price)
 			}
+			return orderLevels[i].Price.GreaterThan(orderLevels[j].Price)
+		})
+	}
+	return exitLevels
+}
+
+// withReduceOnlyParentOrders adds the pending orders with a reduce-only order triggering in the price range
+func withReduceOnlyParentOrders(supabaseClient *supabase.Client, pairId string, orders *[]db.OrderResponse, minPrice, maxPrice decimal.Decimal) *[]db.OrderResponse {
+	parentOrders, err := db.GetReduceOnlyParentOrders(supabaseClient, pairId, minPrice, maxPrice)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not fetch reduce-only parent orders using pair id %v: %v", pairId, err))
+		return orders
+	}
+	return mergeOrders(orders, parentOrders)
+}
+
+// getOpenReduceOnlyOrders returns the open reduce-only orders by parent, each in the order they trigger
+func getOpenReduceOnlyOrders(supabaseClient *supabase.Client, orders []db.OrderResponse) map[uuid.UUID][]db.ReduceOnlyOrderResponse {
+	reduceOnlyOrders := make(map[uuid.UUID][]db.ReduceOnlyOrderResponse)
+	orderTypes := make(map[uuid.UUID]string, len(orders))
+	parentIds := make([]string, 0, len(orders))
+	for _, order := range orders {
+		if order.OrderStatus == orderstate.Pending {
+			parentIds = append(parentIds, order.ID.String())
+			orderTypes[order.ID] = order.OrderType
 		}
+	}
+	if len(parentIds) == 0 {
+		return reduceOnlyOrders
+	}
+
+	children, err := db.GetOpenReduceOnlyOrders(supabaseClient, parentIds)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("could not fetch reduce-only orders, no reduce-only fills this cycle: %v", err))
+		return reduceOnlyOrders
+	}
+	for _, child := range *children {
+		reduceOnlyOrders[child.ParentID] = append(reduceOnlyOrders[child.ParentID], child)
+	}
+	for parentId, parentChildren := range reduceOnlyOrders {
+		orderType := orderTypes[parentId]
+		// take profits before stops, each in the order they trigger
+		sort.SliceStable(parentChildren, func(i, j int) bool {
+			if parentChildren[i].Kind != parentChildren[j].Kind {
+				return parentChildren[i].Kind == "tp"
+			}
+			if (orderType == "long") == (parentChildren[i].Kind == "tp") {
+				return parentChildren[i].TriggerPrice.LessThan(parentChildren[j].TriggerPrice)
+			}
+			return parentChildren[i].TriggerPrice.GreaterThan(parentChildren[j].TriggerPrice)
+		})
+	}
+	return reduceOnlyOrders
+}
+
+// fillExitLevels writes the level fills of the cycle and returns the orders of the fills that did not apply
+func fillExitLevels(supabaseClient *supabase.Client, fills []db.ExitLevelFill, fillOrders map[string]uuid.UUID) map[uuid.UUID]bool {
+	rejected := map[uuid.UUID]bool{}
+	if len(fills) == 0 {
+		return rejected
+	}
+	results, err := db.FillExitLevels(supabaseClient, fills)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("Error filling exit levels: %v", err.Error()))
+		for _, fill := range fills {
+			rejected[fillOrders[fill.ExitLevelId.String()]] = true
+		}
+		return rejected
+	}
+	for _, result := range *results {
+		if !result.IsValid {
+			logrus.Error(fmt.Sprintf("exit level %v not filled: %v", result.ExitLevelId, result.ErrorMessage))
+			rejected[fillOrders[result.ExitLevelId]] = true
+		}
+	}
+	return rejected
+}
+
+// fillReduceOnlyOrders writes the reduce-only fills of the cycle and returns the orders of the fills that did not apply
+func fillReduceOnlyOrders(supabaseClient *supabase.Client, fills []db.ReduceOnlyFill, fillOrders map[string]uuid.UUID) map[uuid.UUID]bool {
+	rejected := map[uuid.UUID]bool{}
+	if len(fills) == 0 {
+		return rejected
+	}
+	results, err := db.FillReduceOnlyOrders(supabaseClient, fills)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("Error filling reduce-only orders: %v", err.Error()))
+		for _, fill := range fills {
+			rejected[fillOrders[fill.ReduceOnlyOrderId.String()]] = true
+		}
+		return rejected
+	}
+	for _, result := range *results {
+		if !result.IsValid {
+			logrus.Error(fmt.Sprintf("reduce-only order %v not filled: %v", result.ReduceOnlyOrderId, result.ErrorMessage))
+			rejected[fillOrders[result.ReduceOnlyOrderId]] = true
+		}
+	}
+	return rejected
+}
+
+// persistTrailingStops saves the ratcheted stops, the db only applies them to orders still pending
+func persistTrailingStops(supabaseClient *supabase.Client, orders []db.OrderResponse) {
+	if len(orders) == 0 {
+		return
+	}
+	orderIds := make([]string, 0, len(orders))
+	stopPrices := make([]decimal.Decimal, 0, len(orders))
+	trailExtremes := make([]decimal.Decimal, 0, len(orders))
+	for _, order := range orders {
+		orderIds = append(orderIds, order.ID.String())
+		stopPrices = append(stopPrices, order.StopLossPrice)
+		trailExtremes = append(trailExtremes, order.TrailExtreme)
+	}
+	if err := db.UpdateTrailingStops(supabaseClient, orderIds, stopPrices, trailExtremes); err != nil {
+		logrus.Error(fmt.Sprintf("Error persisting trailing stops: %v", err.Error()))
+	}
+}
+
+// persistArmedStopLimits saves the stop limits armed this cycle, the db skips the ones the batch already filled
+func persistArmedStopLimits(supabaseClient *supabase.Client, orderIds []string) {
+	if len(orderIds) == 0 {
+		return
+	}
+	if err := db.ArmStopLimitOrders(supabaseClient, orderIds); err != nil {
+		logrus.Error(fmt.Sprintf("Error arming stop limit orders: %v", err.Error()))
+	}
+}
+
+func processPrices(supabaseClient *supabase.Client, priceMap map[string][]decimal.Decimal) {
+
+	// Process the collected prices every 3 seconds
+	for id, prices := range priceMap {
+		if len(prices) == 0 {
+			continue
+		}
+		minPrice := decimal.Min(prices[0], prices[1:]...)
+		maxPrice := decimal.Max(prices[0], prices[1:]...)
 
 		logrus.Warning(fmt.Sprintf("max price: %v, min price: %v", maxPrice, minPrice))
 		logrus.Warning(fmt.Sprintf("price map: %v", priceMap))
@@ -466,8 +1053,15 @@ func processPrices(supabaseClient *supabase.Client, priceMap map[string][]float6
 }
 
 func SubscribeToPriceStream(supabaseClient *supabase.Client, url string, ids []string) {
-	var markPriceMap = make(map[string][]float64)
+	var markPriceMap = make(map[string][]decimal.Decimal)
 	var mu sync.Mutex
+	oracleConfig := oracle.ConfigFromEnv()
+	guardians, err := hermes.GuardianSetFromEnv()
+	if err != nil {
+		logrus.Fatal("Error loading guardian set:", err)
+		return
+	}
+	logrus.Infof("verifying prices against wormhole guardian set %v", guardians.Index)
 
 	go func() {
 		for {
@@ -515,16 +1109,22 @@ func SubscribeToPriceStream(supabaseClient *supabase.Client, url string, ids []s
 
 		parsedResponse, ok := response.(Response)
 		if ok && err == nil {
-			for _, priceUpdate := range parsedResponse.Parsed {
-				// assume exponent always negative
-				markPrice, _ := strconv.ParseFloat(priceUpdate.Price.Price, 64)
-				exponent := priceUpdate.Price.Expo
-				for i := int64(0); i < -int64(exponent); i++ {
-					markPrice /= 10
+			priceUpdates, err := parsedResponse.oracleUpdates(guardians)
+			if err != nil {
+				logrus.Error(err.Error())
+				continue
+			}
+
+			for _, priceUpdate := range priceUpdates {
+				// stale or uncertain prices never trigger take profits, stop losses, liquidations or limits
+				validatedPrice, err := oracle.Validate(priceUpdate, oracleConfig, time.Now())
+				if err != nil {
+					logrus.Warning(err.Error())
+					continue
 				}
 
 				mu.Lock()
-				markPriceMap[priceUpdate.ID] = append(markPriceMap[priceUpdate.ID], markPrice)
+				markPriceMap[priceUpdate.Id] = append(markPriceMap[priceUpdate.Id], validatedPrice.Price)
 				mu.Unlock()
 
 				//logrus.Infof("Received Price Update - ID: %s, MarkPrice: %.6f", priceUpdate.ID, markPrice)